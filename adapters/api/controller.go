@@ -2,10 +2,14 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"html/template"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"strconv"
+	"time"
 
 	"ehgm.com.br/url-shortener/domain/model"
 	"ehgm.com.br/url-shortener/domain/ports"
@@ -13,19 +17,30 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// Keeps the A/B variant of a visitor, one cookie for each link
+const (
+	variantCookie    = "variant_"
+	variantCookieAge = 30 * 24 * 60 * 60
+)
+
 // This struct does not need an interface, its the first level of dependency injection
 type urlController struct {
-	log        ports.Logger
-	urlService ports.UrlService
+	log            ports.Logger
+	urlService     ports.UrlService
+	redirectMaxAge int
+	trustedProxies []*net.IPNet
 }
 
-// Get an instance of 'urlController' using this method
-func NewUrlController(log ports.Logger, urlService ports.UrlService) *urlController {
-	return &urlController{log: log, urlService: urlService}
+// Get an instance of 'urlController' using this method.
+// Permanent redirects can be cached by the clients for 'redirectMaxAge' seconds.
+// The client IP is read from the 'X-Forwarded-For' header only behind the 'trustedProxies'
+func NewUrlController(log ports.Logger, urlService ports.UrlService, redirectMaxAge int, trustedProxies []string) *urlController {
+	return &urlController{log: log, urlService: urlService, redirectMaxAge: redirectMaxAge,
+		trustedProxies: parseTrustedProxies(log, trustedProxies)}
 }
 
 func (c *urlController) PostUrl(gc *gin.Context) {
-	var json Url
+	var json UrlRequest
 	ctx := gc.Request.Context()
 
 	if err := gc.BindJSON(&json); err != nil {
@@ -33,12 +48,22 @@ func (c *urlController) PostUrl(gc *gin.Context) {
 		return
 	}
 
-	if err := validateUrl(json.Url); err != nil {
-		gc.Error(fmt.Errorf("validateUrl error in urlService.PostUrl. %w", err))
+	if err := validateUrlRequest(json); err != nil {
+		gc.Error(fmt.Errorf("validateUrlRequest error in urlService.PostUrl. %w", err))
 		return
 	}
 
-	id, err := c.urlService.GenerateId(ctx, json.Url)
+	id, err := c.urlService.GenerateId(ctx, buildRequestedUrl(json))
+
+	// A lookalike destination is created disabled, the client is told it waits for moderation
+	var lookalike *model.LookalikeUrlError
+	if err != nil && errors.As(err, &lookalike) && len(id) > 0 {
+		var url = buildShortUrl(gc.Request.Host, id, gc.Request.TLS != nil)
+		c.log.Info("Long Url: %v and short Url: %v pending moderation", json.Url, url)
+
+		gc.JSON(http.StatusAccepted, Url{Url: url, Code: lookalike.Code, Message: err.Error()})
+		return
+	}
 	if err != nil {
 		gc.Error(fmt.Errorf("GenerateId error in urlService.PostUrl. %w", err))
 		return
@@ -54,21 +79,106 @@ func (c *urlController) RedirectToUrl(gc *gin.Context) {
 	var err error
 	ctx := gc.Request.Context()
 
-	id := gc.Param("id")
-	url, enable, err := c.urlService.GetUrlToRedirect(ctx, id)
+	id, preview := parsePreview(gc.Param("id"), gc.Query("preview"))
+	if preview {
+		c.previewUrl(gc, id)
+		return
+	}
+
+	visit := &model.Visit{Path: gc.Param("rest"), Query: gc.Request.URL.RawQuery}
+	visit.Variant, _ = gc.Cookie(variantCookie + id)
+	visit.Ip = clientIp(gc.Request.RemoteAddr, gc.GetHeader("X-Forwarded-For"), c.trustedProxies)
+	visit.Platform = parsePlatform(gc.GetHeader("User-Agent"))
+	visit.Language = gc.GetHeader("Accept-Language")
+	visit.Referrer = gc.Request.Referer()
+	visit.UserAgent = gc.GetHeader("User-Agent")
+	visit.RequestId = requestId(gc.GetHeader("X-Request-Id"), gc.GetHeader("X-Cloud-Trace-Context"))
+	visit.Cookies = map[string]string{}
+	for _, cookie := range gc.Request.Cookies() {
+		visit.Cookies[cookie.Name] = cookie.Value
+	}
+	redirect, err := c.urlService.GetUrlToRedirect(ctx, id, visit)
 	if err != nil {
+		var blocked *model.BlockedUrlError
+		if errors.As(err, &blocked) {
+			c.log.Info("Blocked redirect to Id: %v. Cause: %s", id, err)
+			gc.Redirect(http.StatusFound, "/static/blocked.html")
+			return
+		}
 		gc.Error(fmt.Errorf("GetUrlToRedirect error in urlService.RedirectToUrl. %w", err))
 		return
 	}
 
 	switch {
-	case len(url) <= 0:
+	case redirect.Window == model.WindowPending:
+		gc.Header("Cache-Control", "no-store")
+		gc.HTML(http.StatusForbidden, "inactive.html", redirect)
+	case redirect.Window == model.WindowExpired:
+		gc.Header("Cache-Control", "no-store")
+		gc.HTML(http.StatusGone, "inactive.html", redirect)
+	case len(redirect.Url) <= 0:
 		gc.Status(http.StatusNotFound)
-	case !enable:
+	case !redirect.Enable:
 		gc.Redirect(http.StatusFound, "/static/423.html")
 	default:
-		gc.Redirect(http.StatusFound, url)
+		c.redirectTo(gc, id, redirect)
+	}
+}
+
+// Permanent redirects are cached by the clients, so the next clicks are not counted
+// and disabling the link does not affect who already followed it. Destinations that depend on the visitor are never cached
+// and scheduled destinations are cached only until they change
+func (c *urlController) redirectTo(gc *gin.Context, id string, redirect *model.Redirect) {
+	code, permanent := redirectStatus(redirect.Type)
+	if permanent && !redirect.Targeted {
+		maxAge := c.redirectMaxAge
+		if redirect.ValidFor > 0 && redirect.ValidFor < time.Duration(maxAge)*time.Second {
+			maxAge = int(redirect.ValidFor / time.Second)
+		}
+		gc.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", maxAge))
+	} else {
+		gc.Header("Cache-Control", "private, max-age=0")
+	}
+
+	if redirect.Sticky && len(redirect.Variant) > 0 {
+		gc.SetCookie(variantCookie+id, redirect.Variant, variantCookieAge, "/r/"+id, "", gc.Request.TLS != nil, true)
+	}
+
+	// The page tries to open the app and goes to the url when it is not installed
+	if len(redirect.DeepLink) > 0 {
+		gc.HTML(http.StatusOK, "app.html", AppRedirect{Url: redirect.Url, DeepLink: template.URL(redirect.DeepLink)})
+		return
+	}
+	if redirect.Type == model.RedirectHtml {
+		gc.HTML(http.StatusOK, "redirect.html", redirect)
+		return
 	}
+	gc.Redirect(code, redirect.Url)
+}
+
+// Render the destination details instead of redirecting, the click is not counted
+func (c *urlController) previewUrl(gc *gin.Context, id string) {
+	ctx := gc.Request.Context()
+
+	shortUrl, err := c.urlService.GetUrlToPreview(ctx, id)
+	if err != nil {
+		var blocked *model.BlockedUrlError
+		if errors.As(err, &blocked) {
+			c.log.Info("Blocked preview of Id: %v. Cause: %s", id, err)
+			gc.Redirect(http.StatusFound, "/static/blocked.html")
+			return
+		}
+		gc.Error(fmt.Errorf("GetUrlToPreview error in urlService.PreviewUrl. %w", err))
+		return
+	}
+
+	if shortUrl.IsEmpty() {
+		gc.Status(http.StatusNotFound)
+		return
+	}
+
+	var url = buildShortUrl(gc.Request.Host, id, gc.Request.TLS != nil)
+	gc.HTML(http.StatusOK, "preview.html", Preview{ShortUrl: url, Url: shortUrl})
 }
 
 func (c *urlController) PatchUrl(gc *gin.Context) {
@@ -88,8 +198,24 @@ func (c *urlController) PatchUrl(gc *gin.Context) {
 		return
 	}
 
+	if err = validatePatch(jsonBody); err != nil {
+		gc.Error(fmt.Errorf("validatePatch error in urlService.PatchUrl. %w", err))
+		return
+	}
+
 	id := gc.Param("id")
-	if err = c.urlService.UpdateUrl(ctx, id, jsonBody); err != nil {
+	err = c.urlService.UpdateUrl(ctx, id, jsonBody)
+
+	// A lookalike destination disables the url, the client is told it waits for moderation
+	var lookalike *model.LookalikeUrlError
+	if err != nil && errors.As(err, &lookalike) && lookalike.Held {
+		var url = buildShortUrl(gc.Request.Host, id, gc.Request.TLS != nil)
+		c.log.Info("Short Url: %v pending moderation", url)
+
+		gc.JSON(http.StatusAccepted, Url{Url: url, Code: lookalike.Code, Message: err.Error()})
+		return
+	}
+	if err != nil {
 		gc.Error(fmt.Errorf("UpdateUrl error in urlService.PatchUrl. %w", err))
 		return
 	}
@@ -97,6 +223,31 @@ func (c *urlController) PatchUrl(gc *gin.Context) {
 	gc.Status(http.StatusOK)
 }
 
+// Dry run of the rules of a link for a simulated visit, nothing is counted
+func (c *urlController) EvaluateRules(gc *gin.Context) {
+	var json RuleEvaluationRequest
+	ctx := gc.Request.Context()
+
+	if err := gc.BindJSON(&json); err != nil {
+		gc.Error(fmt.Errorf("BindJSON error in urlService.EvaluateRules. %w", err))
+		return
+	}
+	for _, rule := range json.Rules {
+		if err := validateUrl(rule.Url); err != nil {
+			gc.Error(fmt.Errorf("validateUrl error in urlService.EvaluateRules. %w", err))
+			return
+		}
+	}
+
+	visit := buildVisit(json)
+	evaluation, err := c.urlService.EvaluateRules(ctx, gc.Param("id"), visit, json.Rules)
+	if err != nil {
+		gc.Error(fmt.Errorf("EvaluateRules error in urlService.EvaluateRules. %w", err))
+		return
+	}
+	gc.JSON(http.StatusOK, evaluation)
+}
+
 func (c *urlController) GetUrl(gc *gin.Context) {
 	ctx := gc.Request.Context()
 
@@ -107,7 +258,7 @@ func (c *urlController) GetUrl(gc *gin.Context) {
 		return
 	}
 
-	if *shortUrl == (model.ShortUrl{}) {
+	if shortUrl.IsEmpty() {
 		gc.Status(http.StatusNotFound)
 	} else {
 		gc.JSON(http.StatusOK, shortUrl)
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"ehgm.com.br/url-shortener/domain/ports"
+
+	"github.com/gin-gonic/gin"
+)
+
+// This struct does not need an interface, its the first level of dependency injection
+type healthController struct {
+	log           ports.Logger
+	healthService ports.HealthService
+}
+
+// Get an instance of 'healthController' using this method
+func NewHealthController(log ports.Logger, healthService ports.HealthService) *healthController {
+	return &healthController{log: log, healthService: healthService}
+}
+
+func (c *healthController) GetBroken(gc *gin.Context) {
+	ctx := gc.Request.Context()
+
+	lim := 0
+	if limit, ok := gc.GetQuery("limit"); ok {
+		v, _ := strconv.Atoi(limit)
+		lim = v
+	}
+
+	urls, err := c.healthService.GetBroken(ctx, lim)
+	if err != nil {
+		gc.Error(fmt.Errorf("GetBroken error in healthService.GetBroken. %w", err))
+		return
+	}
+
+	gc.JSON(http.StatusOK, urls)
+}
+
+// Always 200 while the service answers, a degraded status is for monitoring and not for restarting the instance
+func (c *healthController) GetStatus(gc *gin.Context) {
+	gc.JSON(http.StatusOK, c.healthService.Status(gc.Request.Context()))
+}
@@ -1,10 +1,15 @@
 package api
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
 
 	"ehgm.com.br/url-shortener/domain/model"
@@ -26,12 +31,29 @@ func ErrorHandlerMiddleware(log ports.Logger) gin.HandlerFunc {
 
 			var notFound *model.DocumentNotFoundError
 			var invalidUrl *model.InvalidUrlError
+			var invalidRequest *model.InvalidRequestError
+			var blocked *model.BlockedUrlError
+			var lookalike *model.LookalikeUrlError
+			var invalidRule *model.InvalidRuleError
+			var tooManyRequests *model.TooManyRequestsError
 
 			switch {
 			case errors.As(err, &notFound):
 				gc.JSON(http.StatusNotFound, obJson)
 			case errors.As(err, &invalidUrl):
 				gc.JSON(http.StatusBadRequest, obJson)
+			case errors.As(err, &invalidRequest):
+				gc.JSON(http.StatusBadRequest, obJson)
+			case errors.As(err, &invalidRule):
+				gc.JSON(http.StatusBadRequest, obJson)
+			case errors.As(err, &tooManyRequests):
+				gc.JSON(http.StatusTooManyRequests, obJson)
+			case errors.As(err, &blocked):
+				obJson.Code = model.ReasonBlocklisted
+				gc.JSON(http.StatusForbidden, obJson)
+			case errors.As(err, &lookalike):
+				obJson.Code = lookalike.Code
+				gc.JSON(http.StatusForbidden, obJson)
 			default:
 				gc.JSON(http.StatusInternalServerError, obJson)
 			}
@@ -39,6 +61,21 @@ func ErrorHandlerMiddleware(log ports.Logger) gin.HandlerFunc {
 	}
 }
 
+// Admin endpoints need the 'Authorization: Bearer <token>' header, they are closed when there is no token
+func AdminAuthMiddleware(log ports.Logger, token string) gin.HandlerFunc {
+	return func(gc *gin.Context) {
+		auth := gc.GetHeader("Authorization")
+		expected := "Bearer " + token
+
+		if len(token) <= 0 || subtle.ConstantTimeCompare([]byte(auth), []byte(expected)) != 1 {
+			log.Error("Unauthorized admin request: %s", gc.Request.URL)
+			gc.AbortWithStatusJSON(http.StatusUnauthorized, ErrorResponse{Message: "Unauthorized", Timestamp: time.Now()})
+			return
+		}
+		gc.Next()
+	}
+}
+
 func validateUrl(rawUrl string) error {
 	if len(rawUrl) > 2048 {
 		return &model.InvalidUrlError{Messsage: "URL cannot be longer than 2048 characters"}
@@ -50,6 +87,274 @@ func validateUrl(rawUrl string) error {
 	return nil
 }
 
+// Validate the destination and the urls of the targeting options of a new url
+func validateUrlRequest(request UrlRequest) error {
+	urls := []string{request.Url}
+	for _, variant := range request.Variants {
+		urls = append(urls, variant.Url)
+	}
+	for _, url := range request.Geo {
+		urls = append(urls, url)
+	}
+	for _, url := range request.Languages {
+		urls = append(urls, url)
+	}
+	for _, rule := range request.Devices {
+		if len(rule.Url) > 0 {
+			urls = append(urls, rule.Url)
+		}
+	}
+	for _, scheduled := range request.Schedule {
+		urls = append(urls, scheduled.Url)
+	}
+	for _, rule := range request.Rules {
+		urls = append(urls, rule.Url)
+	}
+
+	for _, url := range urls {
+		if err := validateUrl(url); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate the urls of the targeting options of a PATCH body, an empty 'fallbackUrl' removes it
+func validatePatch(json map[string]interface{}) error {
+	for k, v := range json {
+		switch {
+		case strings.EqualFold(k, "fallbackUrl"):
+			if v == nil {
+				continue
+			}
+			url, ok := v.(string)
+			if !ok {
+				return &model.InvalidUrlError{Messsage: "Fallback URL must be a string."}
+			}
+			if err := validateUrl(url); len(url) > 0 && err != nil {
+				return err
+			}
+		case strings.EqualFold(k, "variants"), strings.EqualFold(k, "schedule"), strings.EqualFold(k, "rules"):
+			list, _ := v.([]interface{})
+			for _, item := range list {
+				variant, _ := item.(map[string]interface{})
+				url, _ := variant["url"].(string)
+				if err := validateUrl(url); err != nil {
+					return err
+				}
+			}
+		case strings.EqualFold(k, "geo"), strings.EqualFold(k, "languages"):
+			rules, _ := v.(map[string]interface{})
+			for _, rule := range rules {
+				url, _ := rule.(string)
+				if err := validateUrl(url); err != nil {
+					return err
+				}
+			}
+		case strings.EqualFold(k, "devices"):
+			rules, _ := v.(map[string]interface{})
+			for _, item := range rules {
+				rule, _ := item.(map[string]interface{})
+				url, _ := rule["url"].(string)
+				if err := validateUrl(url); len(url) > 0 && err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Visit of a dry run, the country is looked up from the ip when it is not sent
+func buildVisit(request RuleEvaluationRequest) *model.Visit {
+	visit := &model.Visit{
+		Ip:       request.Ip,
+		Country:  strings.ToUpper(request.Country),
+		Platform: strings.ToLower(request.Device),
+		Language: request.Language,
+		Referrer: request.Referrer,
+		Path:     request.Path,
+		Query:    strings.TrimPrefix(request.Query, "?"),
+		Cookies:  request.Cookies,
+	}
+	if request.Time != nil {
+		visit.Time = *request.Time
+	}
+	return visit
+}
+
+// Platform of the visitor from the User-Agent, bots and unknown clients have no platform and get the default destination
+func parsePlatform(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+	switch {
+	case len(ua) <= 0, strings.Contains(ua, "bot"), strings.Contains(ua, "crawler"), strings.Contains(ua, "spider"):
+		return ""
+	case strings.Contains(ua, "iphone"), strings.Contains(ua, "ipad"), strings.Contains(ua, "ipod"):
+		return model.PlatformIos
+	case strings.Contains(ua, "android"):
+		return model.PlatformAndroid
+	case strings.Contains(ua, "windows phone"), strings.Contains(ua, "mobile"):
+		return ""
+	case strings.Contains(ua, "windows"), strings.Contains(ua, "macintosh"), strings.Contains(ua, "x11"), strings.Contains(ua, "cros"):
+		return model.PlatformDesktop
+	default:
+		return ""
+	}
+}
+
+// Parse the IPs and CIDRs of the trusted proxies, the invalid ones are ignored
+func parseTrustedProxies(log ports.Logger, proxies []string) []*net.IPNet {
+	networks := []*net.IPNet{}
+	for _, proxy := range proxies {
+		cidr := proxy
+		if !strings.Contains(cidr, "/") {
+			if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			log.Error("Ignoring invalid trusted proxy: %v. Cause: %s", proxy, err)
+			continue
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// Id of the request sent with the click, from the client or the Cloud Run trace, a new one when there is none
+func requestId(requestHeader, traceHeader string) string {
+	if id := strings.TrimSpace(requestHeader); len(id) > 0 && len(id) <= 128 {
+		return id
+	}
+	if trace := strings.SplitN(traceHeader, "/", 2)[0]; len(trace) > 0 && len(trace) <= 128 {
+		return trace
+	}
+
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(raw)
+}
+
+// The 'X-Forwarded-For' header is read from right to left while the hops are trusted proxies,
+// the first untrusted address is the client. A client cannot fake its address adding entries to the header
+func clientIp(remoteAddr, forwardedFor string, trusted []*net.IPNet) string {
+	host, _, err := net.SplitHostPort(strings.TrimSpace(remoteAddr))
+	if err != nil {
+		host = strings.TrimSpace(remoteAddr)
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return ""
+	}
+
+	hops := strings.Split(forwardedFor, ",")
+	for i := len(hops) - 1; i >= 0 && isTrusted(ip, trusted); i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+		ip = hop
+	}
+	return ip.String()
+}
+
+func isTrusted(ip net.IP, trusted []*net.IPNet) bool {
+	for _, network := range trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Fill the missing QR code options with the defaults and check the limits of the image
+func parseQrOptions(request QrRequest) (*model.QrOptions, error) {
+	options := &model.QrOptions{Format: "png", Size: 256, Margin: 4, Level: "M", Foreground: "000000", Background: "ffffff"}
+
+	if len(request.Format) > 0 {
+		options.Format = strings.ToLower(request.Format)
+	}
+	if options.Format != "png" && options.Format != "svg" {
+		return nil, &model.InvalidRequestError{Message: fmt.Sprintf("QR code format %v is not valid, use png or svg", request.Format)}
+	}
+
+	if request.Size != 0 {
+		options.Size = request.Size
+	}
+	if options.Size < 64 || options.Size > 2048 {
+		return nil, &model.InvalidRequestError{Message: "QR code size must be between 64 and 2048 pixels"}
+	}
+
+	if request.Margin != nil {
+		options.Margin = *request.Margin
+	}
+	if options.Margin < 0 || options.Margin > 16 {
+		return nil, &model.InvalidRequestError{Message: "QR code margin must be between 0 and 16 modules"}
+	}
+
+	if len(request.Level) > 0 {
+		options.Level = strings.ToUpper(request.Level)
+	}
+	if !strings.Contains("LMQH", options.Level) || len(options.Level) != 1 {
+		return nil, &model.InvalidRequestError{Message: fmt.Sprintf("QR code error correction level %v is not valid, use L, M, Q or H", request.Level)}
+	}
+
+	if len(request.Foreground) > 0 {
+		options.Foreground = strings.ToLower(strings.TrimPrefix(request.Foreground, "#"))
+	}
+	if len(request.Background) > 0 {
+		options.Background = strings.ToLower(strings.TrimPrefix(request.Background, "#"))
+	}
+	for _, c := range []string{options.Foreground, options.Background} {
+		if _, err := hex.DecodeString(c); err != nil || len(c) != 6 {
+			return nil, &model.InvalidRequestError{Message: fmt.Sprintf("QR code colour %v is not a valid RRGGBB value", c)}
+		}
+	}
+	return options, nil
+}
+
+// Status code of a redirect type and if it is permanent, unknown types use 302
+func redirectStatus(redirectType string) (int, bool) {
+	switch redirectType {
+	case model.RedirectMoved:
+		return http.StatusMovedPermanently, true
+	case model.RedirectPermanent:
+		return http.StatusPermanentRedirect, true
+	case model.RedirectTemporary:
+		return http.StatusTemporaryRedirect, false
+	default:
+		return http.StatusFound, false
+	}
+}
+
+// Copy the attributes of the request to a new url
+func buildRequestedUrl(request UrlRequest) *model.ShortUrl {
+	return &model.ShortUrl{
+		Url:           request.Url,
+		RedirectType:  request.RedirectType,
+		ForwardQuery:  request.ForwardQuery,
+		QueryConflict: request.QueryConflict,
+		ForwardPath:   request.ForwardPath,
+		Utm:           request.Utm,
+		UtmTemplate:   request.UtmTemplate,
+		Variants:      request.Variants,
+		StickyVariant: request.StickyVariant,
+		Geo:           request.Geo,
+		Devices:       request.Devices,
+		Languages:     request.Languages,
+		ActiveFrom:    request.ActiveFrom,
+		ActiveUntil:   request.ActiveUntil,
+		Schedule:      request.Schedule,
+		Rules:         request.Rules,
+	}
+}
+
 func buildShortUrl(host, id string, isTLS bool) string {
 	var url = fmt.Sprintf("https://%v/r/%v", host, id)
 	if !isTLS {
@@ -57,3 +362,11 @@ func buildShortUrl(host, id string, isTLS bool) string {
 	}
 	return url
 }
+
+// A preview is requested with a '+' after the id or the 'preview=1' query param
+func parsePreview(id, preview string) (string, bool) {
+	if strings.HasSuffix(id, "+") {
+		return strings.TrimSuffix(id, "+"), true
+	}
+	return id, preview == "1" || strings.EqualFold(preview, "true")
+}
@@ -1,10 +1,23 @@
 package api
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
+
+	"ehgm.com.br/url-shortener/domain/model"
+
+	"github.com/gin-gonic/gin"
 )
 
+// Empty Logger
+type loggerMock struct{}
+
+func (l *loggerMock) Info(format string, v ...interface{})  {}
+func (l *loggerMock) Error(format string, v ...interface{}) {}
+func (l *loggerMock) Fatal(format string, v ...interface{}) {}
+
 func TestBuildShortUrl(t *testing.T) {
 	type Input struct {
 		host  string
@@ -74,3 +87,375 @@ func TestValidateUrl(t *testing.T) {
 		}
 	}
 }
+
+func TestAdminAuthMiddleware(t *testing.T) {
+	type Input struct {
+		token  string
+		header string
+	}
+
+	type Output struct {
+		status int
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Valid token": {
+			Input{token: "s3cr3t", header: "Bearer s3cr3t"},
+			Output{status: http.StatusOK}},
+
+		"Test 02 - Invalid token": {
+			Input{token: "s3cr3t", header: "Bearer other"},
+			Output{status: http.StatusUnauthorized}},
+
+		"Test 03 - Admin disabled": {
+			Input{token: "", header: "Bearer "},
+			Output{status: http.StatusUnauthorized}},
+	}
+
+	gin.SetMode(gin.TestMode)
+
+	for i, test := range tests {
+		router := gin.New()
+		router.Use(AdminAuthMiddleware(&loggerMock{}, test.input.token))
+		router.GET("/admin", func(gc *gin.Context) { gc.Status(http.StatusOK) })
+
+		req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+		req.Header.Set("Authorization", test.input.header)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		if rec.Code != test.output.status {
+			t.Errorf("#%s: Output is: %v. But should be: %v", i, rec.Code, test.output.status)
+		}
+	}
+}
+
+func TestParsePreview(t *testing.T) {
+	type Input struct {
+		id      string
+		preview string
+	}
+
+	type Output struct {
+		id      string
+		preview bool
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Redirect": {
+			Input{id: "1q2w3e4", preview: ""},
+			Output{id: "1q2w3e4", preview: false}},
+
+		"Test 02 - Plus suffix": {
+			Input{id: "1q2w3e4+", preview: ""},
+			Output{id: "1q2w3e4", preview: true}},
+
+		"Test 03 - Query param": {
+			Input{id: "1q2w3e4", preview: "1"},
+			Output{id: "1q2w3e4", preview: true}},
+
+		"Test 04 - Query param disabled": {
+			Input{id: "1q2w3e4", preview: "0"},
+			Output{id: "1q2w3e4", preview: false}},
+	}
+
+	for i, test := range tests {
+		id, preview := parsePreview(test.input.id, test.input.preview)
+		if id != test.output.id || preview != test.output.preview {
+			t.Errorf("#%s: Output is: %v / %v. But should be: %v / %v", i, id, preview, test.output.id, test.output.preview)
+		}
+	}
+}
+
+func TestValidatePatch(t *testing.T) {
+	type Input struct {
+		json map[string]interface{}
+	}
+
+	type Output struct {
+		hasError bool
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Valid URL and fallback URL": {
+			Input{json: map[string]interface{}{"url": "https://ehgm.com.br", "fallbackUrl": "https://ehgm.com.br/home"}},
+			Output{hasError: false}},
+
+		"Test 02 - Empty fallback URL": {
+			Input{json: map[string]interface{}{"fallbackUrl": ""}},
+			Output{hasError: false}},
+
+		"Test 03 - Invalid fallback URL": {
+			Input{json: map[string]interface{}{"fallbackUrl": "ehgm.com.br"}},
+			Output{hasError: true}},
+
+		"Test 04 - Invalid fallback URL type": {
+			Input{json: map[string]interface{}{"fallbackUrl": 10}},
+			Output{hasError: true}},
+	}
+
+	for i, test := range tests {
+		err := validatePatch(test.input.json)
+		if test.output.hasError && err == nil {
+			t.Errorf("#%s: Output is: %s. But should has error: %v", i, err, test.output.hasError)
+			continue
+		}
+		if !test.output.hasError && err != nil {
+			t.Errorf("#%s: Output is: %s. But should not has error: %v", i, err, test.output.hasError)
+		}
+	}
+}
+
+func TestParseQrOptions(t *testing.T) {
+	zero := 0
+	big := 20
+
+	type Input struct {
+		request QrRequest
+	}
+
+	type Output struct {
+		options  model.QrOptions
+		hasError bool
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Should use the defaults": {
+			Input{request: QrRequest{}},
+			Output{options: model.QrOptions{Format: "png", Size: 256, Margin: 4, Level: "M", Foreground: "000000", Background: "ffffff"}}},
+
+		"Test 02 - Should use the options": {
+			Input{request: QrRequest{Format: "SVG", Size: 512, Margin: &zero, Level: "h", Foreground: "#1A2B3C", Background: "eeeeee"}},
+			Output{options: model.QrOptions{Format: "svg", Size: 512, Margin: 0, Level: "H", Foreground: "1a2b3c", Background: "eeeeee"}}},
+
+		"Test 03 - Invalid format": {
+			Input{request: QrRequest{Format: "gif"}},
+			Output{hasError: true}},
+
+		"Test 04 - Invalid size": {
+			Input{request: QrRequest{Size: 4096}},
+			Output{hasError: true}},
+
+		"Test 05 - Invalid margin": {
+			Input{request: QrRequest{Margin: &big}},
+			Output{hasError: true}},
+
+		"Test 06 - Invalid level": {
+			Input{request: QrRequest{Level: "LM"}},
+			Output{hasError: true}},
+
+		"Test 07 - Invalid colour": {
+			Input{request: QrRequest{Background: "white"}},
+			Output{hasError: true}},
+	}
+
+	for i, test := range tests {
+		options, err := parseQrOptions(test.input.request)
+
+		if test.output.hasError && err == nil {
+			t.Errorf("#%s: Output is: %s. But should has error: %v", i, err, test.output.hasError)
+			continue
+		}
+		if !test.output.hasError && err != nil {
+			t.Errorf("#%s: Output is: %s. But should not has error: %v", i, err, test.output.hasError)
+			continue
+		}
+		if !test.output.hasError && *options != test.output.options {
+			t.Errorf("#%s: Output is: %+v. But should be: %+v", i, *options, test.output.options)
+		}
+	}
+}
+
+func TestRedirectStatus(t *testing.T) {
+	type Input struct {
+		redirectType string
+	}
+
+	type Output struct {
+		code      int
+		permanent bool
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Moved permanently": {
+			Input{redirectType: model.RedirectMoved},
+			Output{code: http.StatusMovedPermanently, permanent: true}},
+
+		"Test 02 - Found": {
+			Input{redirectType: model.RedirectFound},
+			Output{code: http.StatusFound, permanent: false}},
+
+		"Test 03 - Temporary redirect": {
+			Input{redirectType: model.RedirectTemporary},
+			Output{code: http.StatusTemporaryRedirect, permanent: false}},
+
+		"Test 04 - Permanent redirect": {
+			Input{redirectType: model.RedirectPermanent},
+			Output{code: http.StatusPermanentRedirect, permanent: true}},
+
+		"Test 05 - Unknown type": {
+			Input{redirectType: ""},
+			Output{code: http.StatusFound, permanent: false}},
+	}
+
+	for i, test := range tests {
+		code, permanent := redirectStatus(test.input.redirectType)
+		if code != test.output.code || permanent != test.output.permanent {
+			t.Errorf("#%s: Output is: %v / %v. But should be: %v / %v", i, code, permanent, test.output.code, test.output.permanent)
+		}
+	}
+}
+
+func TestClientIp(t *testing.T) {
+	trusted := parseTrustedProxies(&loggerMock{}, []string{"10.0.0.0/8", "2001:db8::1", "invalid"})
+
+	type Input struct {
+		remoteAddr   string
+		forwardedFor string
+	}
+
+	type Output struct {
+		ip string
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Direct connection ignores the header": {
+			Input{remoteAddr: "177.0.0.1:5000", forwardedFor: "8.8.8.8"},
+			Output{ip: "177.0.0.1"}},
+
+		"Test 02 - Trusted proxy uses the header": {
+			Input{remoteAddr: "10.1.2.3:5000", forwardedFor: "177.0.0.1"},
+			Output{ip: "177.0.0.1"}},
+
+		"Test 03 - Faked entries before the client are ignored": {
+			Input{remoteAddr: "10.1.2.3:5000", forwardedFor: "8.8.8.8, 177.0.0.1, 10.0.0.2"},
+			Output{ip: "177.0.0.1"}},
+
+		"Test 04 - Trusted IPv6 proxy": {
+			Input{remoteAddr: "[2001:db8::1]:5000", forwardedFor: "2001:db8::2"},
+			Output{ip: "2001:db8::2"}},
+
+		"Test 05 - Invalid header keeps the proxy": {
+			Input{remoteAddr: "10.1.2.3:5000", forwardedFor: "unknown"},
+			Output{ip: "10.1.2.3"}},
+
+		"Test 06 - Invalid remote address": {
+			Input{remoteAddr: "pipe", forwardedFor: "177.0.0.1"},
+			Output{ip: ""}},
+	}
+
+	if len(trusted) != 2 {
+		t.Errorf("Output is: %v. But should be: %v", len(trusted), 2)
+	}
+
+	for i, test := range tests {
+		ip := clientIp(test.input.remoteAddr, test.input.forwardedFor, trusted)
+		if ip != test.output.ip {
+			t.Errorf("#%s: Output is: %v. But should be: %v", i, ip, test.output.ip)
+		}
+	}
+}
+
+func TestParsePlatform(t *testing.T) {
+	type Input struct {
+		userAgent string
+	}
+
+	type Output struct {
+		platform string
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - iPhone": {
+			Input{userAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 15_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/15.0 Mobile/15E148 Safari/604.1"},
+			Output{platform: model.PlatformIos}},
+
+		"Test 02 - Android": {
+			Input{userAgent: "Mozilla/5.0 (Linux; Android 11; Pixel 5) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/95.0.4638.74 Mobile Safari/537.36"},
+			Output{platform: model.PlatformAndroid}},
+
+		"Test 03 - Windows desktop": {
+			Input{userAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/95.0.4638.69 Safari/537.36"},
+			Output{platform: model.PlatformDesktop}},
+
+		"Test 04 - Mac desktop": {
+			Input{userAgent: "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/15.1 Safari/605.1.15"},
+			Output{platform: model.PlatformDesktop}},
+
+		"Test 05 - Crawler": {
+			Input{userAgent: "Mozilla/5.0 (Linux; Android 6.0.1; Nexus 5X Build/MMB29P) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/95.0.4638.69 Mobile Safari/537.36 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)"},
+			Output{platform: ""}},
+
+		"Test 06 - Empty User-Agent": {
+			Input{userAgent: ""},
+			Output{platform: ""}},
+	}
+
+	for i, test := range tests {
+		if platform := parsePlatform(test.input.userAgent); platform != test.output.platform {
+			t.Errorf("#%s: Output is: %v. But should be: %v", i, platform, test.output.platform)
+		}
+	}
+}
+
+func TestRequestId(t *testing.T) {
+	type Input struct {
+		requestHeader string
+		traceHeader   string
+	}
+
+	type Output struct {
+		id string
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Should use the request header": {
+			Input{requestHeader: "abc123", traceHeader: "105445aa7843bc8bf206b12000100000/1;o=1"},
+			Output{id: "abc123"}},
+
+		"Test 02 - Should use the trace id": {
+			Input{requestHeader: "", traceHeader: "105445aa7843bc8bf206b12000100000/1;o=1"},
+			Output{id: "105445aa7843bc8bf206b12000100000"}},
+
+		"Test 03 - Should generate an id": {
+			Input{requestHeader: "", traceHeader: ""},
+			Output{id: ""}},
+	}
+
+	for i, test := range tests {
+		id := requestId(test.input.requestHeader, test.input.traceHeader)
+		if len(test.output.id) <= 0 {
+			if len(id) != 32 {
+				t.Errorf("#%s: Output is: %v. But should be a new id", i, id)
+			}
+			continue
+		}
+		if id != test.output.id {
+			t.Errorf("#%s: Output is: %v. But should be: %v", i, id, test.output.id)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package api
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+
+	"ehgm.com.br/url-shortener/domain/ports"
+
+	"github.com/gin-gonic/gin"
+)
+
+// This struct does not need an interface, its the first level of dependency injection
+type moderationController struct {
+	log               ports.Logger
+	urlService        ports.UrlService
+	moderationService ports.ModerationService
+	trustedProxies    []*net.IPNet
+}
+
+// Get an instance of 'moderationController' using this method.
+// The reporter is the client IP, read from the 'X-Forwarded-For' header only behind the 'trustedProxies'
+func NewModerationController(log ports.Logger,
+	urlService ports.UrlService,
+	moderationService ports.ModerationService,
+	trustedProxies []string) *moderationController {
+
+	return &moderationController{log: log, urlService: urlService, moderationService: moderationService,
+		trustedProxies: parseTrustedProxies(log, trustedProxies)}
+}
+
+func (c *moderationController) PostReport(gc *gin.Context) {
+	var json Report
+	ctx := gc.Request.Context()
+
+	if err := gc.BindJSON(&json); err != nil {
+		gc.Error(fmt.Errorf("BindJSON error in moderationService.PostReport. %w", err))
+		return
+	}
+
+	id := gc.Param("id")
+	reporter := clientIp(gc.Request.RemoteAddr, gc.GetHeader("X-Forwarded-For"), c.trustedProxies)
+	if err := c.moderationService.ReportUrl(ctx, id, json.Reason, json.Comment, reporter); err != nil {
+		gc.Error(fmt.Errorf("ReportUrl error in moderationService.PostReport. %w", err))
+		return
+	}
+
+	gc.Status(http.StatusAccepted)
+}
+
+func (c *moderationController) GetQueue(gc *gin.Context) {
+	ctx := gc.Request.Context()
+
+	lim := 0
+	if limit, ok := gc.GetQuery("limit"); ok {
+		v, _ := strconv.Atoi(limit)
+		lim = v
+	}
+
+	urls, err := c.moderationService.GetQueue(ctx, lim)
+	if err != nil {
+		gc.Error(fmt.Errorf("GetQueue error in moderationService.GetQueue. %w", err))
+		return
+	}
+
+	gc.JSON(http.StatusOK, urls)
+}
+
+func (c *moderationController) GetReports(gc *gin.Context) {
+	ctx := gc.Request.Context()
+
+	lim := 0
+	if limit, ok := gc.GetQuery("limit"); ok {
+		v, _ := strconv.Atoi(limit)
+		lim = v
+	}
+
+	id := gc.Param("id")
+	shortUrl, err := c.urlService.GetUrl(ctx, id)
+	if err != nil {
+		gc.Error(fmt.Errorf("GetUrl error in moderationService.GetReports. %w", err))
+		return
+	}
+
+	reports, err := c.moderationService.GetReports(ctx, id, lim)
+	if err != nil {
+		gc.Error(fmt.Errorf("GetReports error in moderationService.GetReports. %w", err))
+		return
+	}
+
+	gc.JSON(http.StatusOK, ModerationDetails{Url: shortUrl, Reports: reports})
+}
+
+func (c *moderationController) DismissReports(gc *gin.Context) {
+	ctx := gc.Request.Context()
+
+	id := gc.Param("id")
+	if err := c.moderationService.Dismiss(ctx, id); err != nil {
+		gc.Error(fmt.Errorf("Dismiss error in moderationService.DismissReports. %w", err))
+		return
+	}
+
+	gc.Status(http.StatusOK)
+}
+
+func (c *moderationController) DisableUrl(gc *gin.Context) {
+	ctx := gc.Request.Context()
+
+	id := gc.Param("id")
+	if err := c.moderationService.Disable(ctx, id); err != nil {
+		gc.Error(fmt.Errorf("Disable error in moderationService.DisableUrl. %w", err))
+		return
+	}
+
+	gc.Status(http.StatusOK)
+}
+
+func (c *moderationController) DisableDomain(gc *gin.Context) {
+	c.setEnableByDomain(gc, false)
+}
+
+func (c *moderationController) EnableDomain(gc *gin.Context) {
+	c.setEnableByDomain(gc, true)
+}
+
+func (c *moderationController) setEnableByDomain(gc *gin.Context, enable bool) {
+	var json BulkRequest
+	ctx := gc.Request.Context()
+
+	if err := gc.BindJSON(&json); err != nil {
+		gc.Error(fmt.Errorf("BindJSON error in moderationService.SetEnableByDomain. %w", err))
+		return
+	}
+
+	result, err := c.moderationService.SetEnableByDomain(ctx, json.Domain, json.Suffix, enable, json.DryRun)
+	if err != nil {
+		gc.Error(fmt.Errorf("SetEnableByDomain error in moderationService.SetEnableByDomain. %w", err))
+		return
+	}
+
+	gc.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+
+	"ehgm.com.br/url-shortener/domain/model"
+	"ehgm.com.br/url-shortener/domain/ports"
+
+	"github.com/gin-gonic/gin"
+)
+
+var qrContentTypes = map[string]string{
+	"png": "image/png",
+	"svg": "image/svg+xml",
+}
+
+// This struct does not need an interface, its the first level of dependency injection
+type qrController struct {
+	log           ports.Logger
+	qrCodeService ports.QrCodeService
+}
+
+// Get an instance of 'qrController' using this method
+func NewQrController(log ports.Logger, qrCodeService ports.QrCodeService) *qrController {
+	return &qrController{log: log, qrCodeService: qrCodeService}
+}
+
+func (c *qrController) GetQrCode(gc *gin.Context) {
+	var request QrRequest
+	ctx := gc.Request.Context()
+
+	if err := gc.ShouldBindQuery(&request); err != nil {
+		invalid := &model.InvalidRequestError{Message: err.Error()}
+		gc.Error(fmt.Errorf("ShouldBindQuery error in qrCodeService.GetQrCode. %w", invalid))
+		return
+	}
+
+	options, err := parseQrOptions(request)
+	if err != nil {
+		gc.Error(fmt.Errorf("parseQrOptions error in qrCodeService.GetQrCode. %w", err))
+		return
+	}
+
+	id := gc.Param("id")
+	shortUrl := buildShortUrl(gc.Request.Host, id, gc.Request.TLS != nil)
+
+	// The image only depends on the short url and the options, so it can be cached for long
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%v|%+v", shortUrl, *options)))
+	etag := `"` + hex.EncodeToString(hash[:16]) + `"`
+	gc.Header("Cache-Control", "public, max-age=86400")
+	gc.Header("ETag", etag)
+
+	image, err := c.qrCodeService.GetQrCode(ctx, id, shortUrl, options)
+	if err != nil {
+		gc.Header("Cache-Control", "no-store")
+		gc.Header("ETag", "")
+		gc.Error(fmt.Errorf("GetQrCode error in qrCodeService.GetQrCode. %w", err))
+		return
+	}
+
+	if gc.GetHeader("If-None-Match") == etag {
+		gc.Status(http.StatusNotModified)
+		return
+	}
+	gc.Data(http.StatusOK, qrContentTypes[options.Format], image)
+}
@@ -1,12 +1,114 @@
 package api
 
-import "time"
+import (
+	"html/template"
+	"time"
+
+	"ehgm.com.br/url-shortener/domain/model"
+)
 
 type Url struct {
-	Url string `json:"url"`
+	Url     string `json:"url"`
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type UrlRequest struct {
+	Url          string `json:"url"`
+	RedirectType string `json:"redirectType,omitempty"`
+
+	ForwardQuery  bool   `json:"forwardQuery,omitempty"`
+	QueryConflict string `json:"queryConflict,omitempty"`
+	ForwardPath   bool   `json:"forwardPath,omitempty"`
+
+	Utm         *model.Utm `json:"utm,omitempty"`
+	UtmTemplate string     `json:"utmTemplate,omitempty"`
+
+	Variants      []model.Variant `json:"variants,omitempty"`
+	StickyVariant bool            `json:"stickyVariant,omitempty"`
+
+	Geo     map[string]string           `json:"geo,omitempty"`
+	Devices map[string]model.DeviceRule `json:"devices,omitempty"`
+
+	Languages map[string]string `json:"languages,omitempty"`
+
+	ActiveFrom  *time.Time           `json:"activeFrom,omitempty"`
+	ActiveUntil *time.Time           `json:"activeUntil,omitempty"`
+	Schedule    []model.ScheduledUrl `json:"schedule,omitempty"`
+
+	Rules []model.Rule `json:"rules,omitempty"`
+}
+
+// Attributes of a simulated visit, the rules of the link are used when 'rules' is not sent
+type RuleEvaluationRequest struct {
+	Rules    []model.Rule      `json:"rules,omitempty"`
+	Ip       string            `json:"ip,omitempty"`
+	Country  string            `json:"country,omitempty"`
+	Device   string            `json:"device,omitempty"`
+	Language string            `json:"language,omitempty"`
+	Referrer string            `json:"referrer,omitempty"`
+	Path     string            `json:"path,omitempty"`
+	Query    string            `json:"query,omitempty"`
+	Cookies  map[string]string `json:"cookies,omitempty"`
+	Time     *time.Time        `json:"time,omitempty"`
 }
 
 type ErrorResponse struct {
 	Message   string    `json:"message"`
+	Code      string    `json:"code,omitempty"`
 	Timestamp time.Time `json:"timestamp"`
 }
+
+type Report struct {
+	Reason  string `json:"reason"`
+	Comment string `json:"comment,omitempty"`
+}
+
+type ModerationDetails struct {
+	Url     *model.ShortUrl `json:"url"`
+	Reports []model.Report  `json:"reports"`
+}
+
+type Preview struct {
+	ShortUrl string
+	Url      *model.ShortUrl
+}
+
+// The deep link was checked when saved, app schemes are not escaped by the template
+type AppRedirect struct {
+	Url      string
+	DeepLink template.URL
+}
+
+type BulkRequest struct {
+	Domain string `json:"domain"`
+	Suffix bool   `json:"suffix"`
+	DryRun bool   `json:"dryRun"`
+}
+
+type QrRequest struct {
+	Format     string `form:"format"`
+	Size       int    `form:"size"`
+	Margin     *int   `form:"margin"`
+	Level      string `form:"level"`
+	Foreground string `form:"fg"`
+	Background string `form:"bg"`
+}
+
+type UtmTemplate struct {
+	Name string    `json:"name"`
+	Utm  model.Utm `json:"utm"`
+}
+
+// Webhook to be created, without events it receives all of them
+type WebhookRequest struct {
+	Url    string   `json:"url"`
+	Events []string `json:"events,omitempty"`
+}
+
+// Attributes of the webhook to change, the ones not sent are kept
+type WebhookPatch struct {
+	Url    *string   `json:"url,omitempty"`
+	Events *[]string `json:"events,omitempty"`
+	Enable *bool     `json:"enable,omitempty"`
+}
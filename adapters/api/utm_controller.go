@@ -0,0 +1,83 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"ehgm.com.br/url-shortener/domain/model"
+	"ehgm.com.br/url-shortener/domain/ports"
+
+	"github.com/gin-gonic/gin"
+)
+
+// This struct does not need an interface, its the first level of dependency injection
+type utmController struct {
+	log        ports.Logger
+	utmService ports.UtmService
+}
+
+// Get an instance of 'utmController' using this method
+func NewUtmController(log ports.Logger, utmService ports.UtmService) *utmController {
+	return &utmController{log: log, utmService: utmService}
+}
+
+// Create the template or replace the one with the same name
+func (c *utmController) PostTemplate(gc *gin.Context) {
+	var json UtmTemplate
+	ctx := gc.Request.Context()
+
+	if err := gc.BindJSON(&json); err != nil {
+		gc.Error(fmt.Errorf("BindJSON error in utmService.PostTemplate. %w", err))
+		return
+	}
+
+	template := &model.UtmTemplate{Name: json.Name, Utm: json.Utm}
+	if err := c.utmService.SaveTemplate(ctx, template); err != nil {
+		gc.Error(fmt.Errorf("SaveTemplate error in utmService.PostTemplate. %w", err))
+		return
+	}
+
+	gc.JSON(http.StatusCreated, template)
+}
+
+func (c *utmController) GetTemplate(gc *gin.Context) {
+	ctx := gc.Request.Context()
+
+	template, err := c.utmService.GetTemplate(ctx, gc.Param("name"))
+	if err != nil {
+		gc.Error(fmt.Errorf("GetTemplate error in utmService.GetTemplate. %w", err))
+		return
+	}
+
+	gc.JSON(http.StatusOK, template)
+}
+
+func (c *utmController) GetTemplates(gc *gin.Context) {
+	ctx := gc.Request.Context()
+
+	lim := 0
+	if limit, ok := gc.GetQuery("limit"); ok {
+		v, _ := strconv.Atoi(limit)
+		lim = v
+	}
+
+	templates, err := c.utmService.GetTemplates(ctx, lim)
+	if err != nil {
+		gc.Error(fmt.Errorf("GetTemplates error in utmService.GetTemplates. %w", err))
+		return
+	}
+
+	gc.JSON(http.StatusOK, templates)
+}
+
+func (c *utmController) DeleteTemplate(gc *gin.Context) {
+	ctx := gc.Request.Context()
+
+	if err := c.utmService.DeleteTemplate(ctx, gc.Param("name")); err != nil {
+		gc.Error(fmt.Errorf("DeleteTemplate error in utmService.DeleteTemplate. %w", err))
+		return
+	}
+
+	gc.Status(http.StatusNoContent)
+}
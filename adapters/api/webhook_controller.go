@@ -0,0 +1,158 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"ehgm.com.br/url-shortener/domain/model"
+	"ehgm.com.br/url-shortener/domain/ports"
+
+	"github.com/gin-gonic/gin"
+)
+
+// This struct does not need an interface, its the first level of dependency injection
+type webhookController struct {
+	log            ports.Logger
+	webhookService ports.WebhookService
+}
+
+// Get an instance of 'webhookController' using this method
+func NewWebhookController(log ports.Logger, webhookService ports.WebhookService) *webhookController {
+	return &webhookController{log: log, webhookService: webhookService}
+}
+
+// The secret is only in this response and in the one of the rotation
+func (c *webhookController) PostWebhook(gc *gin.Context) {
+	var json WebhookRequest
+	ctx := gc.Request.Context()
+
+	if err := gc.BindJSON(&json); err != nil {
+		gc.Error(fmt.Errorf("BindJSON error in webhookService.PostWebhook. %w", err))
+		return
+	}
+
+	webhook := &model.Webhook{Url: json.Url, Events: json.Events}
+	if err := c.webhookService.SaveWebhook(ctx, webhook); err != nil {
+		gc.Error(fmt.Errorf("SaveWebhook error in webhookService.PostWebhook. %w", err))
+		return
+	}
+
+	gc.JSON(http.StatusCreated, webhook)
+}
+
+func (c *webhookController) GetWebhook(gc *gin.Context) {
+	ctx := gc.Request.Context()
+
+	webhook, err := c.webhookService.GetWebhook(ctx, gc.Param("id"))
+	if err != nil {
+		gc.Error(fmt.Errorf("GetWebhook error in webhookService.GetWebhook. %w", err))
+		return
+	}
+
+	gc.JSON(http.StatusOK, webhook)
+}
+
+func (c *webhookController) GetWebhooks(gc *gin.Context) {
+	ctx := gc.Request.Context()
+
+	lim := 0
+	if limit, ok := gc.GetQuery("limit"); ok {
+		v, _ := strconv.Atoi(limit)
+		lim = v
+	}
+
+	webhooks, err := c.webhookService.GetWebhooks(ctx, lim)
+	if err != nil {
+		gc.Error(fmt.Errorf("GetWebhooks error in webhookService.GetWebhooks. %w", err))
+		return
+	}
+
+	gc.JSON(http.StatusOK, webhooks)
+}
+
+func (c *webhookController) PatchWebhook(gc *gin.Context) {
+	var json WebhookPatch
+	ctx := gc.Request.Context()
+
+	if err := gc.BindJSON(&json); err != nil {
+		gc.Error(fmt.Errorf("BindJSON error in webhookService.PatchWebhook. %w", err))
+		return
+	}
+
+	update := &model.WebhookUpdate{Url: json.Url, Events: json.Events, Enable: json.Enable}
+	webhook, err := c.webhookService.UpdateWebhook(ctx, gc.Param("id"), update)
+	if err != nil {
+		gc.Error(fmt.Errorf("UpdateWebhook error in webhookService.PatchWebhook. %w", err))
+		return
+	}
+
+	gc.JSON(http.StatusOK, webhook)
+}
+
+func (c *webhookController) RotateSecret(gc *gin.Context) {
+	ctx := gc.Request.Context()
+
+	webhook, err := c.webhookService.RotateSecret(ctx, gc.Param("id"))
+	if err != nil {
+		gc.Error(fmt.Errorf("RotateSecret error in webhookService.RotateSecret. %w", err))
+		return
+	}
+
+	gc.JSON(http.StatusOK, webhook)
+}
+
+func (c *webhookController) DeleteWebhook(gc *gin.Context) {
+	ctx := gc.Request.Context()
+
+	if err := c.webhookService.DeleteWebhook(ctx, gc.Param("id")); err != nil {
+		gc.Error(fmt.Errorf("DeleteWebhook error in webhookService.DeleteWebhook. %w", err))
+		return
+	}
+
+	gc.Status(http.StatusNoContent)
+}
+
+// Delivery log of the webhook, the 'status' query param filters it
+func (c *webhookController) GetDeliveries(gc *gin.Context) {
+	ctx := gc.Request.Context()
+
+	lim := 0
+	if limit, ok := gc.GetQuery("limit"); ok {
+		v, _ := strconv.Atoi(limit)
+		lim = v
+	}
+
+	deliveries, err := c.webhookService.GetDeliveries(ctx, gc.Param("id"), gc.Query("status"), lim)
+	if err != nil {
+		gc.Error(fmt.Errorf("GetDeliveries error in webhookService.GetDeliveries. %w", err))
+		return
+	}
+
+	gc.JSON(http.StatusOK, deliveries)
+}
+
+func (c *webhookController) RetryDelivery(gc *gin.Context) {
+	ctx := gc.Request.Context()
+
+	delivery, err := c.webhookService.RetryDelivery(ctx, gc.Param("id"), gc.Param("deliveryId"))
+	if err != nil {
+		gc.Error(fmt.Errorf("RetryDelivery error in webhookService.RetryDelivery. %w", err))
+		return
+	}
+
+	gc.JSON(http.StatusOK, delivery)
+}
+
+// The test event is sent before answering, the response has the result of the delivery
+func (c *webhookController) TestWebhook(gc *gin.Context) {
+	ctx := gc.Request.Context()
+
+	delivery, err := c.webhookService.TestWebhook(ctx, gc.Param("id"))
+	if err != nil {
+		gc.Error(fmt.Errorf("TestWebhook error in webhookService.TestWebhook. %w", err))
+		return
+	}
+
+	gc.JSON(http.StatusOK, delivery)
+}
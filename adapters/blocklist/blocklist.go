@@ -0,0 +1,135 @@
+package blocklist
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"ehgm.com.br/url-shortener/domain/model"
+	"ehgm.com.br/url-shortener/domain/ports"
+)
+
+// Struct that implements 'UrlFilter' interface
+type urlFilter struct {
+	log        ports.Logger
+	blockFiles []string
+	allowFiles []string
+
+	mu       sync.RWMutex
+	block    *domainList
+	allow    *domainList
+	modTimes map[string]time.Time
+}
+
+// Get an instance of 'UrlFilter' using this method.
+// Files are checked every 'reloadInterval' seconds and reloaded when changed until the context is done, 0 disables it
+func NewUrlFilter(ctx context.Context, log ports.Logger, blockFiles, allowFiles []string, reloadInterval int) ports.UrlFilter {
+	f := &urlFilter{
+		log:        log,
+		blockFiles: blockFiles,
+		allowFiles: allowFiles,
+		block:      newDomainList(),
+		allow:      newDomainList(),
+		modTimes:   map[string]time.Time{},
+	}
+	f.reload()
+
+	if reloadInterval > 0 {
+		go f.watch(ctx, time.Duration(reloadInterval)*time.Second)
+	}
+	return f
+}
+
+func (f *urlFilter) Check(rawUrl string) error {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return &model.InvalidUrlError{Messsage: "URL does not have a valid format."}
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if _, ok := f.allow.match(u); ok {
+		return nil
+	}
+	if entry, ok := f.block.match(u); ok {
+		return &model.BlockedUrlError{Url: rawUrl, Reason: fmt.Sprintf("destination matches blocklist entry %v", entry)}
+	}
+	return nil
+}
+
+func (f *urlFilter) watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if f.changed() {
+				f.reload()
+			}
+		}
+	}
+}
+
+// A loaded file that was removed is a change too, its entries are dropped
+func (f *urlFilter) changed() bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	for _, files := range [][]string{f.blockFiles, f.allowFiles} {
+		for _, file := range files {
+			modTime, loaded := f.modTimes[file]
+			info, err := os.Stat(file)
+			if err != nil {
+				if loaded {
+					return true
+				}
+				continue
+			}
+			if !loaded || !info.ModTime().Equal(modTime) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Lists are rebuilt from scratch and swapped, a broken file keeps the entries loaded from the others
+func (f *urlFilter) reload() {
+	block := newDomainList()
+	allow := newDomainList()
+	modTimes := map[string]time.Time{}
+
+	f.loadFiles(f.blockFiles, block, modTimes)
+	f.loadFiles(f.allowFiles, allow, modTimes)
+
+	f.mu.Lock()
+	f.block, f.allow, f.modTimes = block, allow, modTimes
+	f.mu.Unlock()
+
+	f.log.Info("Loaded %v blocklist and %v allowlist entries", block.size(), allow.size())
+}
+
+func (f *urlFilter) loadFiles(files []string, list *domainList, modTimes map[string]time.Time) {
+	for _, file := range files {
+		fd, err := os.Open(file)
+		if err != nil {
+			f.log.Error("Failed to open list file: %v. Cause: %s", file, err)
+			continue
+		}
+
+		if info, err := fd.Stat(); err == nil {
+			modTimes[file] = info.ModTime()
+		}
+		if err = parseList(fd, list); err != nil {
+			f.log.Error("Failed to parse list file: %v. Cause: %s", file, err)
+		}
+		fd.Close()
+	}
+}
@@ -0,0 +1,55 @@
+package blocklist
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Empty Logger
+type loggerMock struct{}
+
+func (l *loggerMock) Info(format string, v ...interface{})  {}
+func (l *loggerMock) Error(format string, v ...interface{}) {}
+func (l *loggerMock) Fatal(format string, v ...interface{}) {}
+
+func TestReloadRemovedFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blocklist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "block.txt")
+	if err := ioutil.WriteFile(file, []byte("evil.com\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The watcher is stopped at once, the changes are checked by hand
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	filter := NewUrlFilter(ctx, &loggerMock{}, []string{file}, nil, 1).(*urlFilter)
+	if err := filter.Check("https://evil.com/login"); err == nil {
+		t.Fatalf("Output is: nil. But should be blocked")
+	}
+	if filter.changed() {
+		t.Errorf("Output is: changed. But the file did not change")
+	}
+
+	// The entries of a removed file are dropped
+	if err := os.Remove(file); err != nil {
+		t.Fatal(err)
+	}
+	if !filter.changed() {
+		t.Fatalf("Output is: not changed. But the file was removed")
+	}
+	filter.reload()
+	if err := filter.Check("https://evil.com/login"); err != nil {
+		t.Errorf("Output is: %s. But should not be blocked", err)
+	}
+	if filter.changed() {
+		t.Errorf("Output is: changed. But the removed file was reloaded")
+	}
+}
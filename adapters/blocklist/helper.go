@@ -0,0 +1,124 @@
+package blocklist
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// Hosts files usually map these names to loopback, they are not real destinations
+var ignoredHosts = map[string]bool{
+	"localhost":             true,
+	"localhost.localdomain": true,
+	"local":                 true,
+	"broadcasthost":         true,
+	"ip6-localhost":         true,
+	"ip6-loopback":          true,
+	"0.0.0.0":               true,
+}
+
+type domainList struct {
+	domains  map[string]bool
+	patterns []string
+}
+
+func newDomainList() *domainList {
+	return &domainList{domains: map[string]bool{}}
+}
+
+// Accepts hosts-file lines ("0.0.0.0 evil.com") and plain lines ("evil.com" or "evil.com/path*")
+func parseList(r io.Reader, list *domainList) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) <= 0 {
+			continue
+		}
+		if len(fields) > 1 && net.ParseIP(fields[0]) != nil {
+			fields = fields[1:]
+		}
+
+		for _, entry := range fields {
+			list.add(entry)
+		}
+	}
+	return scanner.Err()
+}
+
+func (l *domainList) add(entry string) {
+	entry = strings.ToLower(entry)
+	entry = strings.TrimPrefix(entry, "https://")
+	entry = strings.TrimPrefix(entry, "http://")
+
+	if strings.ContainsAny(entry, "/*") {
+		l.patterns = append(l.patterns, entry)
+		return
+	}
+
+	entry = normalizeHost(entry)
+	if len(entry) > 0 && !ignoredHosts[entry] {
+		l.domains[entry] = true
+	}
+}
+
+func (l *domainList) size() int {
+	return len(l.domains) + len(l.patterns)
+}
+
+// Returns the list entry that matches the url, a domain entry also matches its subdomains
+func (l *domainList) match(u *url.URL) (string, bool) {
+	host := normalizeHost(u.Hostname())
+
+	for domain := host; len(domain) > 0; {
+		if l.domains[domain] {
+			return domain, true
+		}
+		i := strings.Index(domain, ".")
+		if i < 0 {
+			break
+		}
+		domain = domain[i+1:]
+	}
+
+	target := host + strings.ToLower(u.EscapedPath())
+	for _, pattern := range l.patterns {
+		if wildcardMatch(pattern, target) {
+			return pattern, true
+		}
+	}
+	return "", false
+}
+
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+}
+
+// Simple glob where '*' matches any sequence of characters, including '/'
+func wildcardMatch(pattern, text string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == text
+	}
+
+	if !strings.HasPrefix(text, parts[0]) {
+		return false
+	}
+	text = text[len(parts[0]):]
+
+	last := parts[len(parts)-1]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(text, part)
+		if i < 0 {
+			return false
+		}
+		text = text[i+len(part):]
+	}
+	return strings.HasSuffix(text, last)
+}
@@ -0,0 +1,92 @@
+package blocklist
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestParseList(t *testing.T) {
+	type Input struct {
+		text string
+	}
+
+	type Output struct {
+		domains  int
+		patterns int
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Hosts file format": {
+			Input{text: "# comment\n127.0.0.1 localhost\n0.0.0.0 evil.com\n0.0.0.0 a.bad.net b.bad.net # inline"},
+			Output{domains: 3, patterns: 0}},
+
+		"Test 02 - Plain format": {
+			Input{text: "evil.com\n\nphishing.org/login*\nhttps://*.bad.net/*"},
+			Output{domains: 1, patterns: 2}},
+	}
+
+	for i, test := range tests {
+		list := newDomainList()
+		if err := parseList(strings.NewReader(test.input.text), list); err != nil {
+			t.Errorf("#%s: Output is: %s. But should not has error", i, err)
+			continue
+		}
+		if len(list.domains) != test.output.domains || len(list.patterns) != test.output.patterns {
+			t.Errorf("#%s: Output is: %v / %v. But should be: %v / %v", i,
+				len(list.domains), len(list.patterns), test.output.domains, test.output.patterns)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	list := newDomainList()
+	parseList(strings.NewReader("evil.com\nphishing.org/login*\n*.bad.net/*/pay"), list)
+
+	type Input struct {
+		rawUrl string
+	}
+
+	type Output struct {
+		match bool
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Exact domain": {
+			Input{rawUrl: "https://evil.com"},
+			Output{match: true}},
+
+		"Test 02 - Subdomain": {
+			Input{rawUrl: "https://WWW.Evil.com./page"},
+			Output{match: true}},
+
+		"Test 03 - Similar domain": {
+			Input{rawUrl: "https://notevil.com"},
+			Output{match: false}},
+
+		"Test 04 - Url pattern": {
+			Input{rawUrl: "http://phishing.org/login/account"},
+			Output{match: true}},
+
+		"Test 05 - Url pattern with other path": {
+			Input{rawUrl: "http://phishing.org/about"},
+			Output{match: false}},
+
+		"Test 06 - Url pattern with many wildcards": {
+			Input{rawUrl: "http://shop.bad.net/a/b/pay"},
+			Output{match: true}},
+	}
+
+	for i, test := range tests {
+		u, _ := url.Parse(test.input.rawUrl)
+		if _, ok := list.match(u); ok != test.output.match {
+			t.Errorf("#%s: Output is: %v. But should be: %v", i, ok, test.output.match)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package clock
+
+import (
+	"time"
+
+	"ehgm.com.br/url-shortener/domain/ports"
+)
+
+// Struct that implements 'Clock' interface
+type clock struct{}
+
+// Get an instance of 'Clock' using this method
+func NewClock() ports.Clock {
+	return &clock{}
+}
+
+func (c *clock) Now() time.Time {
+	return time.Now()
+}
@@ -0,0 +1,134 @@
+package counter
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"ehgm.com.br/url-shortener/domain/model"
+	"ehgm.com.br/url-shortener/domain/ports"
+)
+
+// Time limit of each flush, the clicks are kept for the next one when it fails
+const flushTimeout = 30 * time.Second
+
+type countKey struct {
+	id      string
+	variant string
+}
+
+// Struct that implements 'UrlCounter' interface
+type batchCounter struct {
+	log       ports.Logger
+	sink      ports.ClickSink
+	batchSize int
+	interval  time.Duration
+
+	mu     sync.RWMutex
+	closed bool
+	queue  chan *model.ClickEvent
+	done   chan struct{}
+	err    error
+}
+
+// Get an instance of 'UrlCounter' using this method.
+// The clicks are counted in memory by url and variant and saved in the sink every 'interval',
+// or earlier when 'batchSize' urls and variants are waiting. At most 'queueSize' clicks wait to be counted,
+// the redirects wait when the queue is full
+func NewBatchCounter(log ports.Logger, sink ports.ClickSink, queueSize, batchSize int, interval time.Duration) ports.UrlCounter {
+	if queueSize <= 0 {
+		queueSize = 1
+	}
+	if batchSize <= 0 {
+		batchSize = 1
+	}
+
+	c := &batchCounter{log: log, sink: sink, batchSize: batchSize, interval: interval,
+		queue: make(chan *model.ClickEvent, queueSize), done: make(chan struct{})}
+	go c.run()
+	return c
+}
+
+func (c *batchCounter) IncrementCounter(event *model.ClickEvent) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.closed {
+		c.log.Error("Click of Id: %v after the counter was closed", event.Id)
+		return
+	}
+	c.queue <- event
+}
+
+// Stop receiving clicks and save the counted ones, waits until they are saved or the context is done
+func (c *batchCounter) Close(ctx context.Context) error {
+	c.mu.Lock()
+	if !c.closed {
+		c.closed = true
+		close(c.queue)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return c.err
+	case <-ctx.Done():
+		return fmt.Errorf("Close counter error. %w", ctx.Err())
+	}
+}
+
+func (c *batchCounter) run() {
+	defer close(c.done)
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	counts := map[countKey]int64{}
+	failed := false
+
+	for {
+		select {
+		case event, ok := <-c.queue:
+			if !ok {
+				if err := c.flush(counts); err != nil {
+					c.err = fmt.Errorf("Final flush error, %v counts are lost. %w", len(counts), err)
+				}
+				return
+			}
+			counts[countKey{id: event.Id, variant: event.Variant}]++
+
+			// After a failure the sink is tried again only on the next interval
+			if len(counts) >= c.batchSize && !failed {
+				failed = c.flush(counts) != nil
+			}
+		case <-ticker.C:
+			failed = c.flush(counts) != nil
+		}
+	}
+}
+
+// The counts are removed only when saved
+func (c *batchCounter) flush(counts map[countKey]int64) error {
+	if len(counts) <= 0 {
+		return nil
+	}
+
+	batch := make([]model.ClickCount, 0, len(counts))
+	for key, clicks := range counts {
+		batch = append(batch, model.ClickCount{Id: key.id, Variant: key.variant, Clicks: clicks})
+	}
+	sortCounts(batch)
+
+	ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+	defer cancel()
+
+	if err := c.sink.SaveCounts(ctx, batch); err != nil {
+		c.log.Error("Failed to save %v click counts, trying again later. Cause: %s", len(batch), err)
+		return err
+	}
+	for key := range counts {
+		delete(counts, key)
+	}
+	return nil
+}
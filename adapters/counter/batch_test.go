@@ -0,0 +1,126 @@
+package counter
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"ehgm.com.br/url-shortener/domain/model"
+)
+
+// Empty Logger
+type loggerMock struct{}
+
+func (l *loggerMock) Info(format string, v ...interface{})  {}
+func (l *loggerMock) Error(format string, v ...interface{}) {}
+func (l *loggerMock) Fatal(format string, v ...interface{}) {}
+
+// Keeps the saved batches, fails while 'failures' is positive
+type clickSinkMock struct {
+	mu       sync.Mutex
+	failures int
+	batches  [][]model.ClickCount
+}
+
+func (s *clickSinkMock) SaveCounts(ctx context.Context, counts []model.ClickCount) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.failures > 0 {
+		s.failures--
+		return errors.New("unavailable")
+	}
+	s.batches = append(s.batches, counts)
+	return nil
+}
+
+func (s *clickSinkMock) saved() [][]model.ClickCount {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([][]model.ClickCount{}, s.batches...)
+}
+
+func TestBatchCounter(t *testing.T) {
+	type Input struct {
+		events    []*model.ClickEvent
+		batchSize int
+		failures  int
+	}
+
+	type Output struct {
+		batches [][]model.ClickCount
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Should count by url and variant": {
+			Input{events: []*model.ClickEvent{{Id: "b"}, {Id: "a", Variant: "x"}, {Id: "b"}, {Id: "a", Variant: "x"}, {Id: "a"}},
+				batchSize: 100},
+			Output{batches: [][]model.ClickCount{{{Id: "a", Clicks: 1}, {Id: "a", Variant: "x", Clicks: 2}, {Id: "b", Clicks: 2}}}}},
+
+		"Test 02 - Should flush when the batch is full": {
+			Input{events: []*model.ClickEvent{{Id: "a"}, {Id: "a"}, {Id: "b"}, {Id: "c"}}, batchSize: 2},
+			Output{batches: [][]model.ClickCount{{{Id: "a", Clicks: 2}, {Id: "b", Clicks: 1}}, {{Id: "c", Clicks: 1}}}}},
+
+		"Test 03 - Should keep the counts when the sink fails": {
+			Input{events: []*model.ClickEvent{{Id: "a"}, {Id: "b"}, {Id: "a"}}, batchSize: 2, failures: 1},
+			Output{batches: [][]model.ClickCount{{{Id: "a", Clicks: 2}, {Id: "b", Clicks: 1}}}}},
+	}
+
+	for i, test := range tests {
+		sink := &clickSinkMock{failures: test.input.failures}
+		// The interval never ends during the test, the last counts are saved when closing
+		counter := NewBatchCounter(&loggerMock{}, sink, 10, test.input.batchSize, time.Hour)
+		for _, event := range test.input.events {
+			counter.IncrementCounter(event)
+		}
+
+		if err := counter.Close(context.Background()); err != nil {
+			t.Errorf("#%s: Output is: %s. But should not has error", i, err)
+			continue
+		}
+		if batches := sink.saved(); !reflect.DeepEqual(batches, test.output.batches) {
+			t.Errorf("#%s: Output is: %v. But should be: %v", i, batches, test.output.batches)
+		}
+	}
+}
+
+func TestBatchCounterInterval(t *testing.T) {
+	sink := &clickSinkMock{}
+	counter := NewBatchCounter(&loggerMock{}, sink, 10, 100, 20*time.Millisecond)
+	counter.IncrementCounter(&model.ClickEvent{Id: "a"})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(sink.saved()) <= 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	expected := [][]model.ClickCount{{{Id: "a", Clicks: 1}}}
+	if batches := sink.saved(); !reflect.DeepEqual(batches, expected) {
+		t.Errorf("Output is: %v. But should be: %v", batches, expected)
+	}
+
+	if err := counter.Close(context.Background()); err != nil {
+		t.Errorf("Output is: %s. But should not has error", err)
+	}
+	// Clicks after closing are dropped, not blocked
+	counter.IncrementCounter(&model.ClickEvent{Id: "b"})
+	if batches := sink.saved(); len(batches) != 1 {
+		t.Errorf("Output is: %v. But should be: %v", batches, expected)
+	}
+}
+
+func TestBatchCounterClose(t *testing.T) {
+	sink := &clickSinkMock{failures: 1}
+	counter := NewBatchCounter(&loggerMock{}, sink, 10, 100, time.Hour)
+	counter.IncrementCounter(&model.ClickEvent{Id: "a"})
+
+	// The final flush fails, the counts cannot be saved anymore
+	if err := counter.Close(context.Background()); err == nil {
+		t.Errorf("Output is: %v. But should has error", err)
+	}
+}
@@ -0,0 +1,66 @@
+package counter
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"ehgm.com.br/url-shortener/domain/model"
+)
+
+// Counts of a Redis hash of an id, the fields are the variants
+func parseCounts(id string, fields map[string]string) ([]model.ClickCount, error) {
+	counts := []model.ClickCount{}
+	for variant, value := range fields {
+		clicks, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("clicks of Id: %v and variant: %v are not a number. %w", id, variant, err)
+		}
+		if clicks > 0 {
+			counts = append(counts, model.ClickCount{Id: id, Variant: variant, Clicks: clicks})
+		}
+	}
+	return counts, nil
+}
+
+// Sum the counts of the same url and variant
+func mergeCounts(counts []model.ClickCount) []model.ClickCount {
+	index := map[countKey]int{}
+	merged := []model.ClickCount{}
+	for _, count := range counts {
+		key := countKey{id: count.Id, variant: count.Variant}
+		if i, ok := index[key]; ok {
+			merged[i].Clicks += count.Clicks
+			continue
+		}
+		index[key] = len(merged)
+		merged = append(merged, count)
+	}
+	sortCounts(merged)
+	return merged
+}
+
+// Counts ordered by url and variant, the same clicks are always in the same order
+func sortCounts(counts []model.ClickCount) {
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Id != counts[j].Id {
+			return counts[i].Id < counts[j].Id
+		}
+		return counts[i].Variant < counts[j].Variant
+	})
+}
+
+// Ids of the lists without repetition, in the order they appear
+func uniqueIds(lists ...[]string) []string {
+	ids := []string{}
+	seen := map[string]bool{}
+	for _, list := range lists {
+		for _, id := range list {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
@@ -0,0 +1,62 @@
+package counter
+
+import (
+	"reflect"
+	"testing"
+
+	"ehgm.com.br/url-shortener/domain/model"
+)
+
+func TestParseCounts(t *testing.T) {
+	type Input struct {
+		fields map[string]string
+	}
+
+	type Output struct {
+		counts   []model.ClickCount
+		hasError bool
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Should parse the variants": {
+			Input{fields: map[string]string{"": "3", "a": "2", "b": "0"}},
+			Output{counts: []model.ClickCount{{Id: "0aYS7JJ", Clicks: 3}, {Id: "0aYS7JJ", Variant: "a", Clicks: 2}}, hasError: false}},
+
+		"Test 02 - Should fail with an invalid number": {
+			Input{fields: map[string]string{"a": "x"}},
+			Output{counts: nil, hasError: true}},
+	}
+
+	for i, test := range tests {
+		counts, err := parseCounts("0aYS7JJ", test.input.fields)
+		if test.output.hasError != (err != nil) {
+			t.Errorf("#%s: Output is: %v. But should has error: %v", i, err, test.output.hasError)
+			continue
+		}
+		if !test.output.hasError {
+			sortCounts(counts)
+		}
+		if !reflect.DeepEqual(counts, test.output.counts) {
+			t.Errorf("#%s: Output is: %v. But should be: %v", i, counts, test.output.counts)
+		}
+	}
+}
+
+func TestMergeCounts(t *testing.T) {
+	counts := []model.ClickCount{{Id: "b", Clicks: 1}, {Id: "a", Variant: "x", Clicks: 2}, {Id: "b", Clicks: 4}, {Id: "a", Clicks: 1}}
+	expected := []model.ClickCount{{Id: "a", Clicks: 1}, {Id: "a", Variant: "x", Clicks: 2}, {Id: "b", Clicks: 5}}
+
+	if merged := mergeCounts(counts); !reflect.DeepEqual(merged, expected) {
+		t.Errorf("Output is: %v. But should be: %v", merged, expected)
+	}
+}
+
+func TestUniqueIds(t *testing.T) {
+	expected := []string{"a", "b", "c"}
+	if ids := uniqueIds([]string{"a", "b"}, []string{"b", "c", "a"}); !reflect.DeepEqual(ids, expected) {
+		t.Errorf("Output is: %v. But should be: %v", ids, expected)
+	}
+}
@@ -0,0 +1,237 @@
+package counter
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"ehgm.com.br/url-shortener/domain/model"
+	"ehgm.com.br/url-shortener/domain/ports"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Ids by pending clicks, each id has a hash with its clicks by variant, the clicks without variant use an empty field.
+// A flush renames the keys to the flushing ones, the new clicks are counted apart while the flushing ones are saved.
+// Once saved the flush is committed, its clicks are no longer pending although the keys are not released yet.
+// The keys share a hash tag, so the scripts that move them run in a single slot of Redis Cluster,
+// even the keys of each id that the take script derives from the prefixes
+const (
+	pendingKey     = "{clicks}:pending"
+	pendingPrefix  = "{clicks}:pending:"
+	flushingKey    = "{clicks}:flushing"
+	flushingPrefix = "{clicks}:flushing:"
+	flushIdKey     = "{clicks}:flush-id"
+	committedKey   = "{clicks}:committed"
+)
+
+// Time limit of the increment done in each redirect
+const incrementTimeout = time.Second
+
+// Keeps the flush in progress, a failed one is taken again until it is released.
+// The pending ids are read by the script, so the ids that arrive meanwhile never make it fail
+var takeScript = redis.NewScript(`
+local current = redis.call('GET', KEYS[3])
+if current then return current end
+if redis.call('EXISTS', KEYS[1]) == 0 then return false end
+local ids = redis.call('ZRANGE', KEYS[1], 0, -1)
+for _, id in ipairs(ids) do
+	if redis.call('EXISTS', ARGV[2] .. id) == 1 then
+		redis.call('RENAME', ARGV[2] .. id, ARGV[3] .. id)
+	end
+end
+redis.call('RENAME', KEYS[1], KEYS[2])
+redis.call('SET', KEYS[3], ARGV[1])
+return ARGV[1]
+`)
+
+// Only the flush in progress is committed, a late instance cannot commit a newer one
+var commitScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) ~= ARGV[1] then return 0 end
+redis.call('SET', KEYS[2], ARGV[1])
+return 1
+`)
+
+// Only the flush in progress is released, a late instance cannot remove a newer one.
+// The flushing keys of its ids follow the first ones in KEYS
+var releaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[2]) ~= ARGV[1] then return 0 end
+for _, key in ipairs(KEYS) do
+	redis.call('DEL', key)
+end
+return 1
+`)
+
+// Struct that implements 'UrlCounter' and 'PendingClicks' interfaces
+type redisCounter struct {
+	log ports.Logger
+	rdb *redis.Client
+}
+
+// Get an instance of 'UrlCounter' using this method.
+// The clicks are counted in Redis as soon as they happen, they are saved by a 'ClickFlusher'
+func NewRedisCounter(log ports.Logger, rdb *redis.Client) ports.UrlCounter {
+	return &redisCounter{log: log, rdb: rdb}
+}
+
+// Get an instance of 'PendingClicks' using this method
+func NewPendingClicks(log ports.Logger, rdb *redis.Client) ports.PendingClicks {
+	return &redisCounter{log: log, rdb: rdb}
+}
+
+func (c *redisCounter) IncrementCounter(event *model.ClickEvent) {
+	ctx, cancel := context.WithTimeout(context.Background(), incrementTimeout)
+	defer cancel()
+
+	_, err := c.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZIncrBy(ctx, pendingKey, 1, event.Id)
+		pipe.HIncrBy(ctx, pendingPrefix+event.Id, event.Variant, 1)
+		return nil
+	})
+	if err != nil {
+		c.log.Error("IncrementCounter error for Id: %v. Cause: %s", event.Id, err)
+	}
+}
+
+// The clicks are already in Redis, the client is closed with the others
+func (c *redisCounter) Close(ctx context.Context) error {
+	return nil
+}
+
+// The clicks being saved are pending until they are committed, all the keys are read at once
+func (c *redisCounter) Pending(ctx context.Context, ids []string) ([]model.ClickCount, error) {
+	var flushId, committed *redis.StringCmd
+	cmds := make([]*redis.StringStringMapCmd, 0, 2*len(ids))
+	_, err := c.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		flushId, committed = pipe.Get(ctx, flushIdKey), pipe.Get(ctx, committedKey)
+		for _, id := range ids {
+			cmds = append(cmds, pipe.HGetAll(ctx, pendingPrefix+id), pipe.HGetAll(ctx, flushingPrefix+id))
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("Get pending clicks error. %w", err)
+	}
+
+	// The flushing clicks of a committed flush are already in the repository
+	saved := flushId.Val() != "" && flushId.Val() == committed.Val()
+	counts := []model.ClickCount{}
+	for i, cmd := range cmds {
+		if saved && i%2 == 1 {
+			continue
+		}
+		hashCounts, err := parseCounts(ids[i/2], cmd.Val())
+		if err != nil {
+			return nil, fmt.Errorf("Parse pending clicks error. %w", err)
+		}
+		counts = append(counts, hashCounts...)
+	}
+	return mergeCounts(counts), nil
+}
+
+func (c *redisCounter) TopPending(ctx context.Context, limit int) ([]string, error) {
+	if limit <= 0 {
+		return []string{}, nil
+	}
+
+	var pending, flushing *redis.StringSliceCmd
+	_, err := c.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pending = pipe.ZRevRange(ctx, pendingKey, 0, int64(limit-1))
+		flushing = pipe.ZRevRange(ctx, flushingKey, 0, int64(limit-1))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Get top pending clicks error. %w", err)
+	}
+	return uniqueIds(pending.Val(), flushing.Val()), nil
+}
+
+// Returns the id of the flush and its clicks, there are no clicks when nothing is pending
+func (c *redisCounter) Take(ctx context.Context) (string, []model.ClickCount, error) {
+	newId, err := newFlushId()
+	if err != nil {
+		return "", nil, err
+	}
+
+	keys := []string{pendingKey, flushingKey, flushIdKey}
+	flushId, err := takeScript.Run(ctx, c.rdb, keys, newId, pendingPrefix, flushingPrefix).Text()
+	if err == redis.Nil {
+		return "", []model.ClickCount{}, nil
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("Take pending clicks error. %w", err)
+	}
+
+	ids, err := c.rdb.ZRange(ctx, flushingKey, 0, -1).Result()
+	if err != nil {
+		return "", nil, fmt.Errorf("Get flushing ids error. %w", err)
+	}
+	cmds := make([]*redis.StringStringMapCmd, len(ids))
+	_, err = c.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, id := range ids {
+			cmds[i] = pipe.HGetAll(ctx, flushingPrefix+id)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", nil, fmt.Errorf("Get flushing clicks error. %w", err)
+	}
+
+	counts := []model.ClickCount{}
+	for i, cmd := range cmds {
+		hashCounts, err := parseCounts(ids[i], cmd.Val())
+		if err != nil {
+			return "", nil, fmt.Errorf("Parse flushing clicks error. %w", err)
+		}
+		counts = append(counts, hashCounts...)
+	}
+	return flushId, mergeCounts(counts), nil
+}
+
+func (c *redisCounter) Commit(ctx context.Context, flushId string) error {
+	keys := []string{flushIdKey, committedKey}
+	committed, err := commitScript.Run(ctx, c.rdb, keys, flushId).Int()
+	if err != nil {
+		return fmt.Errorf("Commit flush error. %w", err)
+	}
+	if committed == 0 {
+		c.log.Info("Flush %v was already released", flushId)
+	}
+	return nil
+}
+
+func (c *redisCounter) Release(ctx context.Context, flushId string) error {
+	// The flushing ids do not change until the flush is released
+	ids, err := c.rdb.ZRange(ctx, flushingKey, 0, -1).Result()
+	if err != nil {
+		return fmt.Errorf("Get flushing ids error. %w", err)
+	}
+	keys := append([]string{flushingKey, flushIdKey, committedKey}, prefixKeys(flushingPrefix, ids)...)
+	released, err := releaseScript.Run(ctx, c.rdb, keys, flushId).Int()
+	if err != nil {
+		return fmt.Errorf("Release flush error. %w", err)
+	}
+	if released == 0 {
+		c.log.Info("Flush %v was already released", flushId)
+	}
+	return nil
+}
+
+func prefixKeys(prefix string, ids []string) []string {
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = prefix + id
+	}
+	return keys
+}
+
+// The flush ids are part of the saved message ids, they must not repeat between instances
+func newFlushId() (string, error) {
+	random := make([]byte, 8)
+	if _, err := rand.Read(random); err != nil {
+		return "", fmt.Errorf("Flush id error. %w", err)
+	}
+	return fmt.Sprintf("flush-%v-%v", time.Now().UTC().Format("20060102150405"), hex.EncodeToString(random)), nil
+}
@@ -0,0 +1,103 @@
+package counter
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"ehgm.com.br/url-shortener/domain/model"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+// Redis counter on an in-process server, the clicks counted by 'counter' are flushed by 'pending'
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, *redisCounter) {
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Close)
+
+	rdb := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	return server, NewPendingClicks(&loggerMock{}, rdb).(*redisCounter)
+}
+
+func TestRedisTakeEmpty(t *testing.T) {
+	_, counter := newTestRedis(t)
+
+	flushId, counts, err := counter.Take(context.Background())
+	if err != nil || len(flushId) > 0 || len(counts) > 0 {
+		t.Errorf("Output is: %v %v %v. But should be an empty flush", flushId, counts, err)
+	}
+}
+
+func TestRedisFlush(t *testing.T) {
+	server, counter := newTestRedis(t)
+	ctx := context.Background()
+	ids := []string{"0aYS7JJ", "1q2w3e"}
+
+	counter.IncrementCounter(&model.ClickEvent{Id: "0aYS7JJ"})
+	counter.IncrementCounter(&model.ClickEvent{Id: "0aYS7JJ", Variant: "a"})
+	counter.IncrementCounter(&model.ClickEvent{Id: "1q2w3e"})
+
+	flushId, counts, err := counter.Take(ctx)
+	expected := []model.ClickCount{{Id: "0aYS7JJ", Clicks: 1}, {Id: "0aYS7JJ", Variant: "a", Clicks: 1}, {Id: "1q2w3e", Clicks: 1}}
+	if err != nil || len(flushId) <= 0 || !reflect.DeepEqual(counts, expected) {
+		t.Fatalf("Output is: %v %v %v. But should be: %v", flushId, counts, err, expected)
+	}
+
+	// The clicks of a redirect during the flush are counted apart, both are pending
+	counter.IncrementCounter(&model.ClickEvent{Id: "0aYS7JJ"})
+	pending, err := counter.Pending(ctx, ids)
+	expected = []model.ClickCount{{Id: "0aYS7JJ", Clicks: 2}, {Id: "0aYS7JJ", Variant: "a", Clicks: 1}, {Id: "1q2w3e", Clicks: 1}}
+	if err != nil || !reflect.DeepEqual(pending, expected) {
+		t.Errorf("Output is: %v %v. But should be: %v", pending, err, expected)
+	}
+
+	// A flush not released is taken again with the same clicks
+	again, counts, err := counter.Take(ctx)
+	expected = []model.ClickCount{{Id: "0aYS7JJ", Clicks: 1}, {Id: "0aYS7JJ", Variant: "a", Clicks: 1}, {Id: "1q2w3e", Clicks: 1}}
+	if err != nil || again != flushId || !reflect.DeepEqual(counts, expected) {
+		t.Errorf("Output is: %v %v %v. But should be: %v %v", again, counts, err, flushId, expected)
+	}
+
+	// Another flush cannot be committed or released, the saved one stops being pending
+	if err = counter.Commit(ctx, "flush-other"); err != nil {
+		t.Errorf("Output is: %s. But should not has error", err)
+	}
+	if server.Exists(committedKey) {
+		t.Errorf("Output is: committed. But another flush should not be committed")
+	}
+	if err = counter.Commit(ctx, flushId); err != nil {
+		t.Errorf("Output is: %s. But should not has error", err)
+	}
+	pending, err = counter.Pending(ctx, ids)
+	expected = []model.ClickCount{{Id: "0aYS7JJ", Clicks: 1}}
+	if err != nil || !reflect.DeepEqual(pending, expected) {
+		t.Errorf("Output is: %v %v. But should be: %v", pending, err, expected)
+	}
+	if err = counter.Release(ctx, "flush-other"); err != nil || !server.Exists(flushIdKey) {
+		t.Errorf("Output is: %v. But the flush should not be released by another one", err)
+	}
+
+	// Only the new clicks are left after the release
+	if err = counter.Release(ctx, flushId); err != nil {
+		t.Errorf("Output is: %s. But should not has error", err)
+	}
+	for _, key := range []string{flushingKey, flushIdKey, committedKey, flushingPrefix + "0aYS7JJ", flushingPrefix + "1q2w3e"} {
+		if server.Exists(key) {
+			t.Errorf("Output is: %v exists. But should be released", key)
+		}
+	}
+	pending, err = counter.Pending(ctx, ids)
+	if err != nil || !reflect.DeepEqual(pending, expected) {
+		t.Errorf("Output is: %v %v. But should be: %v", pending, err, expected)
+	}
+
+	next, counts, err := counter.Take(ctx)
+	if err != nil || len(next) <= 0 || next == flushId || !reflect.DeepEqual(counts, expected) {
+		t.Errorf("Output is: %v %v %v. But should be a new flush with: %v", next, counts, err, expected)
+	}
+}
@@ -0,0 +1,132 @@
+package geoip
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"ehgm.com.br/url-shortener/domain/ports"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// Only the country is read from the GeoIP2 / GeoLite2 Country or City records
+type countryRecord struct {
+	Country struct {
+		IsoCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	RegisteredCountry struct {
+		IsoCode string `maxminddb:"iso_code"`
+	} `maxminddb:"registered_country"`
+}
+
+// Struct that implements 'GeoLocator' interface
+type geoLocator struct {
+	log  ports.Logger
+	file string
+
+	mu      sync.RWMutex
+	reader  *maxminddb.Reader
+	modTime time.Time
+}
+
+// Get an instance of 'GeoLocator' using this method.
+// The database file is checked every 'reloadInterval' seconds and reloaded when changed, 0 disables it.
+// Without a database file every visitor has an unknown country
+func NewGeoLocator(log ports.Logger, file string, reloadInterval int) ports.GeoLocator {
+	g := &geoLocator{log: log, file: file}
+	if len(file) <= 0 {
+		log.Info("Geo targeting is disabled, GEOIP_DB is empty")
+		return g
+	}
+	g.reload()
+
+	if reloadInterval > 0 {
+		go g.watch(time.Duration(reloadInterval) * time.Second)
+	}
+	return g
+}
+
+// Returns the ISO 3166-1 alpha-2 code of the country, empty when it is unknown
+func (g *geoLocator) Country(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	if g.reader == nil {
+		return ""
+	}
+
+	var record countryRecord
+	if err := g.reader.Lookup(parsed, &record); err != nil {
+		g.log.Error("Failed to lookup the country of IP: %v. Cause: %s", ip, err)
+		return ""
+	}
+	if len(record.Country.IsoCode) > 0 {
+		return strings.ToUpper(record.Country.IsoCode)
+	}
+	return strings.ToUpper(record.RegisteredCountry.IsoCode)
+}
+
+func (g *geoLocator) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if g.changed() {
+			g.reload()
+		}
+	}
+}
+
+func (g *geoLocator) changed() bool {
+	info, err := os.Stat(g.file)
+	if err != nil {
+		return false
+	}
+
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return !info.ModTime().Equal(g.modTime)
+}
+
+// The new database is swapped in only when it opens, a broken file keeps the current one
+func (g *geoLocator) reload() {
+	info, err := os.Stat(g.file)
+	if err != nil {
+		g.log.Error("Failed to open GeoIP database: %v. Cause: %s", g.file, err)
+		return
+	}
+
+	// Read in memory instead of mapped, so a file rewritten in place cannot break the lookups
+	buffer, err := ioutil.ReadFile(g.file)
+	if err != nil {
+		g.log.Error("Failed to open GeoIP database: %v. Cause: %s", g.file, err)
+		return
+	}
+
+	reader, err := maxminddb.FromBytes(buffer)
+	if err != nil {
+		g.log.Error("Failed to open GeoIP database: %v. Cause: %s", g.file, err)
+
+		// Not retried until the file changes again
+		g.mu.Lock()
+		g.modTime = info.ModTime()
+		g.mu.Unlock()
+		return
+	}
+
+	g.mu.Lock()
+	g.reader, g.modTime = reader, info.ModTime()
+	g.mu.Unlock()
+
+	g.log.Info("Loaded GeoIP database: %v, type: %v, built at: %v", g.file, reader.Metadata.DatabaseType,
+		time.Unix(int64(reader.Metadata.BuildEpoch), 0).UTC())
+}
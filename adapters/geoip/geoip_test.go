@@ -0,0 +1,206 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Empty Logger
+type loggerMock struct{}
+
+func (l *loggerMock) Info(format string, v ...interface{})  {}
+func (l *loggerMock) Error(format string, v ...interface{}) {}
+func (l *loggerMock) Fatal(format string, v ...interface{}) {}
+
+// Minimal MaxMind DB writer, an IPv4 tree with 24 bits records and one country record for each network
+func buildDatabase(t *testing.T, networks map[string]string) []byte {
+	nodes := [][2]int{{-1, -1}}
+	var leaves []map[int]int
+	var data bytes.Buffer
+	offsets := map[string]int{}
+
+	leaves = append(leaves, map[int]int{})
+	for network, country := range networks {
+		_, ipNet, err := net.ParseCIDR(network)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := offsets[country]; !ok {
+			offsets[country] = data.Len()
+			writeMap(&data, 1)
+			writeString(&data, "country")
+			writeMap(&data, 1)
+			writeString(&data, "iso_code")
+			writeString(&data, country)
+		}
+
+		ones, _ := ipNet.Mask.Size()
+		ip := ipNet.IP.To4()
+		node := 0
+		for bit := 0; bit < ones; bit++ {
+			side := int(ip[bit/8]>>(7-uint(bit%8))) & 1
+			if bit == ones-1 {
+				leaves[node][side] = offsets[country]
+				break
+			}
+			if nodes[node][side] < 0 {
+				nodes = append(nodes, [2]int{-1, -1})
+				leaves = append(leaves, map[int]int{})
+				nodes[node][side] = len(nodes) - 1
+			}
+			node = nodes[node][side]
+		}
+	}
+
+	var db bytes.Buffer
+	count := len(nodes)
+	for i, node := range nodes {
+		for side := 0; side < 2; side++ {
+			record := count
+			if offset, ok := leaves[i][side]; ok {
+				record = count + 16 + offset
+			} else if node[side] >= 0 {
+				record = node[side]
+			}
+			db.Write([]byte{byte(record >> 16), byte(record >> 8), byte(record)})
+		}
+	}
+	db.Write(make([]byte, 16))
+	db.Write(data.Bytes())
+
+	db.WriteString("\xAB\xCD\xEFMaxMind.com")
+	writeMap(&db, 6)
+	writeString(&db, "node_count")
+	writeUint(&db, 6, uint64(count))
+	writeString(&db, "record_size")
+	writeUint(&db, 5, 24)
+	writeString(&db, "ip_version")
+	writeUint(&db, 5, 4)
+	writeString(&db, "database_type")
+	writeString(&db, "Test-Country")
+	writeString(&db, "binary_format_major_version")
+	writeUint(&db, 5, 2)
+	writeString(&db, "binary_format_minor_version")
+	writeUint(&db, 5, 0)
+	return db.Bytes()
+}
+
+func writeMap(b *bytes.Buffer, size int) {
+	b.WriteByte(byte(7<<5 | size))
+}
+
+func writeString(b *bytes.Buffer, value string) {
+	b.WriteByte(byte(2<<5 | len(value)))
+	b.WriteString(value)
+}
+
+func writeUint(b *bytes.Buffer, kind int, value uint64) {
+	raw := make([]byte, 8)
+	binary.BigEndian.PutUint64(raw, value)
+	raw = bytes.TrimLeft(raw, "\x00")
+	b.WriteByte(byte(kind<<5 | len(raw)))
+	b.Write(raw)
+}
+
+func TestCountry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "geoip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "country.mmdb")
+	db := buildDatabase(t, map[string]string{"177.0.0.0/8": "BR", "8.8.8.0/24": "us", "81.2.69.0/24": "GB"})
+	if err = ioutil.WriteFile(file, db, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	type Input struct {
+		file string
+		ip   string
+	}
+
+	type Output struct {
+		country string
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Should find the country": {
+			Input{file: file, ip: "177.10.20.30"},
+			Output{country: "BR"}},
+
+		"Test 02 - Should use upper case": {
+			Input{file: file, ip: "8.8.8.8"},
+			Output{country: "US"}},
+
+		"Test 03 - IPv4 mapped IPv6 address": {
+			Input{file: file, ip: "::ffff:81.2.69.160"},
+			Output{country: "GB"}},
+
+		"Test 04 - Address not in the database": {
+			Input{file: file, ip: "10.0.0.1"},
+			Output{country: ""}},
+
+		"Test 05 - Invalid address": {
+			Input{file: file, ip: "not-an-ip"},
+			Output{country: ""}},
+
+		"Test 06 - Database disabled": {
+			Input{file: "", ip: "177.10.20.30"},
+			Output{country: ""}},
+
+		"Test 07 - Database not found": {
+			Input{file: filepath.Join(dir, "missing.mmdb"), ip: "177.10.20.30"},
+			Output{country: ""}},
+	}
+
+	for i, test := range tests {
+		geoLocator := NewGeoLocator(&loggerMock{}, test.input.file, 0)
+		if output := geoLocator.Country(test.input.ip); output != test.output.country {
+			t.Errorf("#%s: Output is: %v. But should be: %v", i, output, test.output.country)
+		}
+	}
+}
+
+func TestReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "geoip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "country.mmdb")
+	if err = ioutil.WriteFile(file, buildDatabase(t, map[string]string{"177.0.0.0/8": "BR"}), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	g := NewGeoLocator(&loggerMock{}, file, 0).(*geoLocator)
+	if output := g.Country("177.1.1.1"); output != "BR" {
+		t.Errorf("Output is: %v. But should be: %v", output, "BR")
+	}
+
+	// A broken file keeps the current database
+	if err = ioutil.WriteFile(file, []byte("broken"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	g.reload()
+	if output := g.Country("177.1.1.1"); output != "BR" {
+		t.Errorf("Output is: %v. But should be: %v", output, "BR")
+	}
+
+	if err = ioutil.WriteFile(file, buildDatabase(t, map[string]string{"177.0.0.0/8": "PT"}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	g.reload()
+	if output := g.Country("177.1.1.1"); output != "PT" {
+		t.Errorf("Output is: %v. But should be: %v", output, "PT")
+	}
+}
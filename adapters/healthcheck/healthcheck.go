@@ -0,0 +1,108 @@
+package healthcheck
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"ehgm.com.br/url-shortener/domain/model"
+	"ehgm.com.br/url-shortener/domain/ports"
+)
+
+// Struct that implements 'HealthProber' interface
+type healthProber struct {
+	log       ports.Logger
+	client    *http.Client
+	hostDelay time.Duration
+
+	mu    sync.Mutex
+	hosts map[string]time.Time
+}
+
+// Get an instance of 'HealthProber' using this method.
+// Requests to the same host are spaced by at least 'hostDelay', to be polite with the destinations
+func NewHealthProber(log ports.Logger, client *http.Client, hostDelay time.Duration) ports.HealthProber {
+	return &healthProber{log: log, client: client, hostDelay: hostDelay, hosts: map[string]time.Time{}}
+}
+
+// Try a HEAD request first, many servers do not implement it so a GET is done when it fails
+func (p *healthProber) Probe(ctx context.Context, rawUrl string) *model.Health {
+	health := &model.Health{}
+
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		health.Error = err.Error()
+		health.CheckTime = time.Now().UTC()
+		return health
+	}
+
+	if err = p.wait(ctx, strings.ToLower(u.Hostname())); err != nil {
+		health.Error = err.Error()
+		health.CheckTime = time.Now().UTC()
+		return health
+	}
+
+	start := time.Now()
+	status, err := p.request(ctx, http.MethodHead, rawUrl)
+	if err != nil || status >= 400 {
+		start = time.Now()
+		status, err = p.request(ctx, http.MethodGet, rawUrl)
+	}
+
+	health.Status = status
+	health.Latency = time.Since(start).Milliseconds()
+	health.CheckTime = time.Now().UTC()
+	if err != nil {
+		health.Error = err.Error()
+	}
+	return health
+}
+
+func (p *healthProber) request(ctx context.Context, method, rawUrl string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, rawUrl, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", "url-shortener-health/1.0")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+// Reserve the next free slot of the host and sleep until it
+func (p *healthProber) wait(ctx context.Context, host string) error {
+	p.mu.Lock()
+	now := time.Now()
+	next := now
+	if last, ok := p.hosts[host]; ok && last.Add(p.hostDelay).After(now) {
+		next = last.Add(p.hostDelay)
+	}
+	p.hosts[host] = next
+
+	// Forget the hosts that are free again, so the map does not grow forever
+	if len(p.hosts) > 10000 {
+		for h, t := range p.hosts {
+			if t.Add(p.hostDelay).Before(now) {
+				delete(p.hosts, h)
+			}
+		}
+	}
+	p.mu.Unlock()
+
+	timer := time.NewTimer(next.Sub(now))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,108 @@
+package healthcheck
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"ehgm.com.br/url-shortener/config"
+)
+
+// Empty Logger
+type loggerMock struct{}
+
+func (l *loggerMock) Info(format string, v ...interface{})  {}
+func (l *loggerMock) Error(format string, v ...interface{}) {}
+func (l *loggerMock) Fatal(format string, v ...interface{}) {}
+
+func newDestination() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/no-head", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/gone", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusGone)
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(300 * time.Millisecond)
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestProbe(t *testing.T) {
+	server := newDestination()
+	defer server.Close()
+
+	prober := NewHealthProber(&loggerMock{}, config.NewHttpClient(200*time.Millisecond, 2, true), 0)
+
+	type Input struct {
+		url string
+	}
+
+	type Output struct {
+		status   int
+		hasError bool
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Should return a healthy status": {
+			Input{url: server.URL + "/ok"},
+			Output{status: 200}},
+
+		"Test 02 - Should use GET when HEAD is not allowed": {
+			Input{url: server.URL + "/no-head"},
+			Output{status: 200}},
+
+		"Test 03 - Should return the broken status": {
+			Input{url: server.URL + "/gone"},
+			Output{status: 410}},
+
+		"Test 04 - Should return error after the timeout": {
+			Input{url: server.URL + "/slow"},
+			Output{hasError: true}},
+
+		"Test 05 - Should return error for an invalid URL": {
+			Input{url: "http://[::1"},
+			Output{hasError: true}},
+	}
+
+	for i, test := range tests {
+		health := prober.Probe(context.Background(), test.input.url)
+
+		if test.output.hasError != (len(health.Error) > 0) {
+			t.Errorf("#%s: Output is: %s. But should has error: %v", i, health.Error, test.output.hasError)
+			continue
+		}
+		if health.Status != test.output.status {
+			t.Errorf("#%s: Output is: %v. But should be: %v", i, health.Status, test.output.status)
+		}
+		if health.CheckTime.IsZero() {
+			t.Errorf("#%s: Output is: %v. But should have a check time", i, health.CheckTime)
+		}
+	}
+}
+
+func TestProbeHostDelay(t *testing.T) {
+	server := newDestination()
+	defer server.Close()
+
+	delay := 100 * time.Millisecond
+	prober := NewHealthProber(&loggerMock{}, config.NewHttpClient(time.Second, 2, true), delay)
+
+	start := time.Now()
+	for j := 0; j < 3; j++ {
+		prober.Probe(context.Background(), server.URL+"/ok")
+	}
+
+	if elapsed := time.Since(start); elapsed < 2*delay {
+		t.Errorf("Output is: %v. But should be at least: %v", elapsed, 2*delay)
+	}
+}
@@ -0,0 +1,144 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"ehgm.com.br/url-shortener/adapters/spool"
+	"ehgm.com.br/url-shortener/domain/model"
+	"ehgm.com.br/url-shortener/domain/ports"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// A click not written after this time is spooled, it may be published twice
+const writeTimeout = 30 * time.Second
+
+// Part of 'kafka.Writer' used by the counter
+type messageWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// Struct that implements 'UrlCounter' interface
+type urlCounter struct {
+	log        ports.Logger
+	writer     messageWriter
+	clickSpool ports.ClickSpool
+
+	pending sync.WaitGroup
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// Get an instance of 'UrlCounter' using this method.
+// The clicks are written with the same data and attributes as in Pub/Sub, the attributes are the record headers
+// and the key is the url id. The clicks that fail to be written are saved in 'clickSpool', it can be nil
+func NewUrlCounter(log ports.Logger, writer *kafka.Writer, clickSpool ports.ClickSpool) ports.UrlCounter {
+	return newUrlCounter(log, writer, clickSpool)
+}
+
+func newUrlCounter(log ports.Logger, writer messageWriter, clickSpool ports.ClickSpool) *urlCounter {
+	c := &urlCounter{log: log, writer: writer, clickSpool: clickSpool,
+		stop: make(chan struct{}), stopped: make(chan struct{})}
+
+	go func() {
+		defer close(c.stopped)
+		spool.RunReplay(log, clickSpool, c.publishEvents, c.stop)
+	}()
+	return c
+}
+
+// The writer groups the clicks written at the same time, the redirect does not wait for it
+func (c *urlCounter) IncrementCounter(event *model.ClickEvent) {
+	message, err := clickMessage(event)
+	if err != nil {
+		c.log.Error("Error encoding message to Id: %v. Cause: %s", event.Id, err)
+		return
+	}
+
+	c.pending.Add(1)
+	go func() {
+		defer c.pending.Done()
+
+		ctx, cancel := context.WithTimeout(context.Background(), writeTimeout)
+		defer cancel()
+
+		if err := c.writer.WriteMessages(ctx, message); err != nil {
+			c.log.Error("Error sending message to Id: %v. Cause: %s", event.Id, err)
+			c.spoolEvent(event)
+			return
+		}
+		c.log.Info("Message sent successfully to Id: %v", event.Id)
+	}()
+}
+
+// Wait for the clicks being written and close the writer
+func (c *urlCounter) Close(ctx context.Context) error {
+	close(c.stop)
+
+	done := make(chan struct{})
+	go func() {
+		c.pending.Wait()
+		<-c.stopped
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return fmt.Errorf("Close counter error. %w", ctx.Err())
+	}
+
+	if err := c.writer.Close(); err != nil {
+		return fmt.Errorf("Close writer error. %w", err)
+	}
+	return nil
+}
+
+// Write the events in one call, the batch fails when any of them fails
+func (c *urlCounter) publishEvents(ctx context.Context, events []*model.ClickEvent) error {
+	messages := make([]kafka.Message, 0, len(events))
+	for _, event := range events {
+		message, err := clickMessage(event)
+		if err != nil {
+			c.log.Error("Dropping spooled click of Id: %v. Cause: %s", event.Id, err)
+			continue
+		}
+		messages = append(messages, message)
+	}
+
+	if err := c.writer.WriteMessages(ctx, messages...); err != nil {
+		return fmt.Errorf("Write spooled clicks error. %w", err)
+	}
+	return nil
+}
+
+func (c *urlCounter) spoolEvent(event *model.ClickEvent) {
+	if c.clickSpool == nil {
+		return
+	}
+	if err := c.clickSpool.Append(event); err != nil {
+		c.log.Error("Click of Id: %v lost, it cannot be spooled. Cause: %s", event.Id, err)
+	}
+}
+
+// The headers are sorted by key, so the same click always has the same record
+func clickMessage(event *model.ClickEvent) (kafka.Message, error) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return kafka.Message{}, err
+	}
+
+	headers := []kafka.Header{}
+	for key, value := range event.Attributes() {
+		headers = append(headers, kafka.Header{Key: key, Value: []byte(value)})
+	}
+	sort.Slice(headers, func(i, j int) bool { return headers[i].Key < headers[j].Key })
+
+	return kafka.Message{Key: []byte(event.Id), Value: data, Headers: headers}, nil
+}
@@ -0,0 +1,160 @@
+//go:build integration
+// +build integration
+
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"ehgm.com.br/url-shortener/adapters/spool"
+	"ehgm.com.br/url-shortener/config"
+	"ehgm.com.br/url-shortener/domain/model"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Run against a real broker with 'go test -tags integration ./adapters/kafka/', 'KAFKA_BROKERS' defaults to localhost:9092.
+// A broker can be started with 'docker run -p 9092:9092 apache/kafka'
+
+// Writer of the broker that fails while 'down' is set, the records written go through kafka-go
+type outageWriter struct {
+	mu     sync.Mutex
+	down   bool
+	writer *kafka.Writer
+}
+
+func (w *outageWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	w.mu.Lock()
+	down := w.down
+	w.mu.Unlock()
+
+	if down {
+		return errors.New("kafka: leader not available")
+	}
+	return w.writer.WriteMessages(ctx, msgs...)
+}
+
+func (w *outageWriter) Close() error {
+	return w.writer.Close()
+}
+
+func (w *outageWriter) setDown(down bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.down = down
+}
+
+// Creates a new topic with one partition, the records are read in the order they were written
+func newTestTopic(t *testing.T) ([]string, string) {
+	brokers := os.Getenv("KAFKA_BROKERS")
+	if len(brokers) <= 0 {
+		brokers = "localhost:9092"
+	}
+	addrs := strings.Split(brokers, ",")
+	topic := fmt.Sprintf("url-clicks-test-%v", time.Now().UnixNano())
+
+	conn, err := kafka.Dial("tcp", addrs[0])
+	if err != nil {
+		t.Fatalf("Output is: %s. But should connect", err)
+	}
+	defer conn.Close()
+
+	controller, err := conn.Controller()
+	if err != nil {
+		t.Fatalf("Output is: %s. But should find the controller", err)
+	}
+	controllerConn, err := kafka.Dial("tcp", fmt.Sprintf("%v:%v", controller.Host, controller.Port))
+	if err != nil {
+		t.Fatalf("Output is: %s. But should connect to the controller", err)
+	}
+	defer controllerConn.Close()
+
+	if err := controllerConn.CreateTopics(kafka.TopicConfig{Topic: topic, NumPartitions: 1, ReplicationFactor: 1}); err != nil {
+		t.Fatalf("Output is: %s. But should create the topic", err)
+	}
+	return addrs, topic
+}
+
+func readMessages(t *testing.T, addrs []string, topic string, count int) []kafka.Message {
+	reader := kafka.NewReader(kafka.ReaderConfig{Brokers: addrs, Topic: topic})
+	defer reader.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	messages := []kafka.Message{}
+	for len(messages) < count {
+		message, err := reader.ReadMessage(ctx)
+		if err != nil {
+			t.Fatalf("Output is: %s. But should read %v clicks", err, count)
+		}
+		messages = append(messages, message)
+	}
+	return messages
+}
+
+func TestUrlCounterBroker(t *testing.T) {
+	addrs, topic := newTestTopic(t)
+
+	counter := NewUrlCounter(&loggerMock{}, config.NewKafkaWriter(addrs, topic), nil)
+	event := &model.ClickEvent{Version: model.ClickEventVersion, Id: "0aYS7JJ", Variant: "a"}
+	counter.IncrementCounter(event)
+	if err := counter.Close(context.Background()); err != nil {
+		t.Fatalf("Output is: %s. But should not has error", err)
+	}
+
+	// The record read from the broker has the key, the headers and the JSON of the click
+	message := readMessages(t, addrs, topic, 1)[0]
+	expected, _ := clickMessage(event)
+	var decoded model.ClickEvent
+	if err := json.Unmarshal(message.Value, &decoded); err != nil || !reflect.DeepEqual(&decoded, event) {
+		t.Errorf("Output is: %v %v. But should be: %v", decoded, err, event)
+	}
+	if string(message.Key) != "0aYS7JJ" || !reflect.DeepEqual(message.Headers, expected.Headers) {
+		t.Errorf("Output is: %s %v. But should be: %s %v", message.Key, message.Headers, expected.Key, expected.Headers)
+	}
+}
+
+func TestUrlCounterBrokerSpool(t *testing.T) {
+	addrs, topic := newTestTopic(t)
+	clickSpool, err := spool.NewClickSpool(&loggerMock{}, t.TempDir(), 1<<20)
+	if err != nil {
+		t.Fatalf("Output is: %s. But should not has error", err)
+	}
+
+	writer := &outageWriter{down: true, writer: config.NewKafkaWriter(addrs, topic)}
+	counter := newUrlCounter(&loggerMock{}, writer, clickSpool)
+	counter.IncrementCounter(&model.ClickEvent{Version: model.ClickEventVersion, Id: "0aYS7JJ"})
+	counter.IncrementCounter(&model.ClickEvent{Version: model.ClickEventVersion, Id: "1q2w3e"})
+	counter.pending.Wait()
+	if events := clickSpool.Status().Events; events != 2 {
+		t.Fatalf("Output is: %v. But should spool 2 clicks", events)
+	}
+
+	// The replay writes the spooled clicks to the broker when it is back
+	writer.setDown(false)
+	deadline := time.Now().Add(30 * time.Second)
+	for clickSpool.Status().Events > 0 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if err := counter.Close(context.Background()); err != nil {
+		t.Fatalf("Output is: %s. But should not has error", err)
+	}
+
+	keys := []string{}
+	for _, message := range readMessages(t, addrs, topic, 2) {
+		keys = append(keys, string(message.Key))
+	}
+	if !reflect.DeepEqual(keys, []string{"0aYS7JJ", "1q2w3e"}) && !reflect.DeepEqual(keys, []string{"1q2w3e", "0aYS7JJ"}) {
+		t.Errorf("Output is: %v. But should read the spooled clicks", keys)
+	}
+}
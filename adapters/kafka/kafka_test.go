@@ -0,0 +1,120 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"ehgm.com.br/url-shortener/adapters/spool"
+	"ehgm.com.br/url-shortener/domain/model"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Empty Logger
+type loggerMock struct{}
+
+func (l *loggerMock) Info(format string, v ...interface{})  {}
+func (l *loggerMock) Error(format string, v ...interface{}) {}
+func (l *loggerMock) Fatal(format string, v ...interface{}) {}
+
+// Fake of the writer for the unit tests, keeps the written records and fails while 'down' is set
+type writerMock struct {
+	mu       sync.Mutex
+	down     bool
+	closed   bool
+	messages []kafka.Message
+}
+
+func (w *writerMock) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.down || w.closed {
+		return errors.New("kafka: leader not available")
+	}
+	w.messages = append(w.messages, msgs...)
+	return nil
+}
+
+func (w *writerMock) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closed = true
+	return nil
+}
+
+func (w *writerMock) setDown(down bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.down = down
+}
+
+func (w *writerMock) written() []kafka.Message {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]kafka.Message{}, w.messages...)
+}
+
+func TestClickMessage(t *testing.T) {
+	event := &model.ClickEvent{Version: model.ClickEventVersion, Id: "0aYS7JJ", Variant: "a", Platform: "ios"}
+	message, err := clickMessage(event)
+	if err != nil {
+		t.Fatalf("Output is: %s. But should not has error", err)
+	}
+
+	// Same data and attributes of the Pub/Sub messages, the key keeps the clicks of an url in order
+	var decoded model.ClickEvent
+	if err := json.Unmarshal(message.Value, &decoded); err != nil || !reflect.DeepEqual(&decoded, event) {
+		t.Errorf("Output is: %v %v. But should be: %v", decoded, err, event)
+	}
+	if string(message.Key) != "0aYS7JJ" {
+		t.Errorf("Output is: %s. But should be: %v", message.Key, "0aYS7JJ")
+	}
+	expected := []kafka.Header{{Key: "contentType", Value: []byte("application/json")}, {Key: "id", Value: []byte("0aYS7JJ")},
+		{Key: "platform", Value: []byte("ios")}, {Key: "variant", Value: []byte("a")}, {Key: "version", Value: []byte("1")}}
+	if !reflect.DeepEqual(message.Headers, expected) {
+		t.Errorf("Output is: %v. But should be: %v", message.Headers, expected)
+	}
+}
+
+func TestUrlCounterSpool(t *testing.T) {
+	writer := &writerMock{down: true}
+	clickSpool, err := spool.NewClickSpool(&loggerMock{}, t.TempDir(), 1<<20)
+	if err != nil {
+		t.Fatalf("Output is: %s. But should not has error", err)
+	}
+
+	counter := newUrlCounter(&loggerMock{}, writer, clickSpool)
+	counter.IncrementCounter(&model.ClickEvent{Version: model.ClickEventVersion, Id: "0aYS7JJ"})
+	counter.IncrementCounter(&model.ClickEvent{Version: model.ClickEventVersion, Id: "1q2w3e"})
+	counter.pending.Wait()
+	if events := clickSpool.Status().Events; events != 2 || len(writer.written()) != 0 {
+		t.Fatalf("Output is: %v. But should spool 2 clicks", events)
+	}
+
+	// The replay writes the spooled clicks when the broker is back
+	writer.setDown(false)
+	deadline := time.Now().Add(10 * time.Second)
+	for clickSpool.Status().Events > 0 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if err := counter.Close(context.Background()); err != nil {
+		t.Fatalf("Output is: %s. But should not has error", err)
+	}
+
+	keys := []string{}
+	for _, message := range writer.written() {
+		keys = append(keys, string(message.Key))
+	}
+	if !reflect.DeepEqual(keys, []string{"0aYS7JJ", "1q2w3e"}) && !reflect.DeepEqual(keys, []string{"1q2w3e", "0aYS7JJ"}) {
+		t.Errorf("Output is: %v. But should write the spooled clicks", keys)
+	}
+	if !writer.closed {
+		t.Errorf("Output is: %v. But should close the writer", writer.closed)
+	}
+}
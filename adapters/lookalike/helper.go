@@ -0,0 +1,127 @@
+package lookalike
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Characters commonly used to imitate latin letters, based on the Unicode confusables list
+var confusables = map[rune]string{
+	// Cyrillic
+	'а': "a", 'в': "b", 'с': "c", 'ԁ': "d", 'е': "e", 'һ': "h", 'і': "i", 'ј': "j", 'к': "k",
+	'м': "m", 'н': "h", 'о': "o", 'р': "p", 'ԛ': "q", 'ѕ': "s", 'т': "t", 'ц': "u", 'у': "y",
+	'х': "x", 'ԝ': "w", 'ӏ': "l",
+	// Greek
+	'α': "a", 'β': "b", 'ε': "e", 'η': "n", 'ι': "i", 'κ': "k", 'ν': "v", 'ο': "o", 'ρ': "p",
+	'τ': "t", 'υ': "u", 'χ': "x", 'ω': "w",
+	// Latin lookalikes
+	'ı': "i", 'ɡ': "g", 'ł': "l", 'ø': "o", 'ß': "b", 'ð': "d", 'ɑ': "a",
+	// ASCII lookalikes
+	'0': "o", '1': "l", 'I': "l", '|': "l", '3': "e", '5': "s", '$': "s", '@': "a",
+}
+
+// Sequences that render like a single letter
+var sequences = strings.NewReplacer("rn", "m", "vv", "w", "cl", "d")
+
+// Reduce a label to the latin letters it resembles, so visually equal labels have the same skeleton
+func skeleton(label string) string {
+	var b strings.Builder
+	for _, r := range label {
+		if v, ok := confusables[r]; ok {
+			b.WriteString(v)
+			continue
+		}
+		b.WriteString(strings.ToLower(string(removeAccent(r))))
+	}
+	return sequences.Replace(b.String())
+}
+
+// Map the most common accented latin letters to their base letter
+func removeAccent(r rune) rune {
+	switch {
+	case strings.ContainsRune("àáâãäåāăą", r):
+		return 'a'
+	case strings.ContainsRune("çćĉċč", r):
+		return 'c'
+	case strings.ContainsRune("èéêëēĕėęě", r):
+		return 'e'
+	case strings.ContainsRune("ìíîïĩīĭįı", r):
+		return 'i'
+	case strings.ContainsRune("ñńņňŉ", r):
+		return 'n'
+	case strings.ContainsRune("òóôõöōŏő", r):
+		return 'o'
+	case strings.ContainsRune("ùúûüũūŭůűų", r):
+		return 'u'
+	case strings.ContainsRune("ýÿŷ", r):
+		return 'y'
+	}
+	return r
+}
+
+var scripts = map[string]*unicode.RangeTable{
+	"Latin":    unicode.Latin,
+	"Cyrillic": unicode.Cyrillic,
+	"Greek":    unicode.Greek,
+	"Armenian": unicode.Armenian,
+	"Hebrew":   unicode.Hebrew,
+	"Arabic":   unicode.Arabic,
+	"Han":      unicode.Han,
+}
+
+// A label with letters from more than one script is a strong phishing signal
+func isMixedScript(label string) bool {
+	found := ""
+	for _, r := range label {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+
+		script := "Other"
+		for name, table := range scripts {
+			if unicode.Is(table, r) {
+				script = name
+				break
+			}
+		}
+
+		if len(found) > 0 && found != script {
+			return true
+		}
+		found = script
+	}
+	return false
+}
+
+// Levenshtein distance between two strings
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+func min(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
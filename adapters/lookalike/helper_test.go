@@ -0,0 +1,118 @@
+package lookalike
+
+import "testing"
+
+func TestSkeleton(t *testing.T) {
+	type Input struct {
+		label string
+	}
+
+	type Output struct {
+		skeleton string
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Latin label": {
+			Input{label: "paypal"},
+			Output{skeleton: "paypal"}},
+
+		"Test 02 - Upper case I": {
+			Input{label: "paypaI"},
+			Output{skeleton: "paypal"}},
+
+		"Test 03 - Cyrillic letters": {
+			Input{label: "pаypаl"},
+			Output{skeleton: "paypal"}},
+
+		"Test 04 - Digits and sequences": {
+			Input{label: "rnicros0ft"},
+			Output{skeleton: "microsoft"}},
+
+		"Test 05 - Accents": {
+			Input{label: "gôogle"},
+			Output{skeleton: "google"}},
+	}
+
+	for i, test := range tests {
+		output := skeleton(test.input.label)
+		if output != test.output.skeleton {
+			t.Errorf("#%s: Output is: %v. But should be: %v", i, output, test.output.skeleton)
+		}
+	}
+}
+
+func TestIsMixedScript(t *testing.T) {
+	type Input struct {
+		label string
+	}
+
+	type Output struct {
+		mixed bool
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Latin label": {
+			Input{label: "paypal-01"},
+			Output{mixed: false}},
+
+		"Test 02 - Cyrillic label": {
+			Input{label: "пример"},
+			Output{mixed: false}},
+
+		"Test 03 - Latin and Cyrillic label": {
+			Input{label: "pаypal"},
+			Output{mixed: true}},
+	}
+
+	for i, test := range tests {
+		output := isMixedScript(test.input.label)
+		if output != test.output.mixed {
+			t.Errorf("#%s: Output is: %v. But should be: %v", i, output, test.output.mixed)
+		}
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	type Input struct {
+		a string
+		b string
+	}
+
+	type Output struct {
+		distance int
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Equal": {
+			Input{a: "paypal", b: "paypal"},
+			Output{distance: 0}},
+
+		"Test 02 - Substitution": {
+			Input{a: "paypai", b: "paypal"},
+			Output{distance: 1}},
+
+		"Test 03 - Insertion and deletion": {
+			Input{a: "gogle", b: "googles"},
+			Output{distance: 2}},
+
+		"Test 04 - Empty": {
+			Input{a: "", b: "paypal"},
+			Output{distance: 6}},
+	}
+
+	for i, test := range tests {
+		output := editDistance(test.input.a, test.input.b)
+		if output != test.output.distance {
+			t.Errorf("#%s: Output is: %v. But should be: %v", i, output, test.output.distance)
+		}
+	}
+}
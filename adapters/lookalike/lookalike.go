@@ -0,0 +1,99 @@
+package lookalike
+
+import (
+	"net/url"
+	"strings"
+
+	"ehgm.com.br/url-shortener/domain/model"
+	"ehgm.com.br/url-shortener/domain/ports"
+
+	"golang.org/x/net/idna"
+)
+
+// Short brand names are too close to ordinary words to be compared by edit distance
+const minBrandLength = 4
+
+type brand struct {
+	domain   string
+	label    string
+	skeleton string
+}
+
+// Struct that implements 'UrlFilter' interface
+type lookalikeFilter struct {
+	log         ports.Logger
+	brands      []brand
+	maxDistance int
+}
+
+// Get an instance of 'UrlFilter' using this method.
+// Brands are domains like 'paypal.com', the destinations hosted on them or on their subdomains are never flagged
+func NewLookalikeFilter(log ports.Logger, brands []string, maxDistance int) ports.UrlFilter {
+	f := &lookalikeFilter{log: log, maxDistance: maxDistance}
+
+	for _, domain := range brands {
+		domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+		label := strings.Split(domain, ".")[0]
+		f.brands = append(f.brands, brand{domain: domain, label: label, skeleton: skeleton(label)})
+	}
+
+	log.Info("Loaded %v protected brands", len(f.brands))
+	return f
+}
+
+func (f *lookalikeFilter) Check(rawUrl string) error {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return &model.InvalidUrlError{Messsage: "URL does not have a valid format."}
+	}
+
+	host := strings.TrimSuffix(u.Hostname(), ".")
+	lower := strings.ToLower(host)
+	for _, b := range f.brands {
+		if lower == b.domain || strings.HasSuffix(lower, "."+b.domain) {
+			return nil
+		}
+	}
+
+	for _, label := range strings.Split(host, ".") {
+		label = decodeLabel(label)
+		for _, b := range f.brands {
+			if code := f.compare(label, b); len(code) > 0 {
+				return &model.LookalikeUrlError{Url: rawUrl, Brand: b.domain, Code: code}
+			}
+		}
+	}
+	return nil
+}
+
+// Returns the reason code when the label imitates the brand, or an empty string
+func (f *lookalikeFilter) compare(label string, b brand) string {
+	// The brand name itself under another domain is not a lookalike
+	if strings.ToLower(label) == b.label {
+		return ""
+	}
+
+	skel := skeleton(label)
+	switch {
+	case skel == b.skeleton && isMixedScript(label):
+		return model.ReasonMixedScript
+	case skel == b.skeleton:
+		return model.ReasonHomoglyph
+	case len(b.label) >= minBrandLength && len(skel) >= minBrandLength &&
+		editDistance(skel, b.skeleton) <= f.maxDistance:
+		return model.ReasonEditDistance
+	}
+	return ""
+}
+
+// Punycode labels (xn--) are decoded so the homoglyphs can be compared
+func decodeLabel(label string) string {
+	if !strings.HasPrefix(strings.ToLower(label), "xn--") {
+		return label
+	}
+	decoded, err := idna.Punycode.ToUnicode(strings.ToLower(label))
+	if err != nil {
+		return label
+	}
+	return decoded
+}
@@ -0,0 +1,66 @@
+package lookalike
+
+import (
+	"errors"
+	"testing"
+
+	"ehgm.com.br/url-shortener/domain/model"
+)
+
+// Empty Logger
+type loggerMock struct{}
+
+func (l *loggerMock) Info(format string, v ...interface{})  {}
+func (l *loggerMock) Error(format string, v ...interface{}) {}
+func (l *loggerMock) Fatal(format string, v ...interface{}) {}
+
+func TestCheck(t *testing.T) {
+	filter := NewLookalikeFilter(&loggerMock{}, []string{"paypal.com", "google.com"}, 1)
+
+	type Input struct {
+		rawUrl string
+	}
+
+	type Output struct {
+		code string
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Brand domain": {
+			Input{rawUrl: "https://www.paypal.com/login"},
+			Output{code: ""}},
+
+		"Test 02 - Unrelated domain": {
+			Input{rawUrl: "https://ehgm.com.br"},
+			Output{code: ""}},
+
+		"Test 03 - Upper case I homoglyph": {
+			Input{rawUrl: "https://paypaI.com"},
+			Output{code: model.ReasonHomoglyph}},
+
+		"Test 04 - Punycode mixed script": {
+			Input{rawUrl: "https://xn--pypal-4ve.com"},
+			Output{code: model.ReasonMixedScript}},
+
+		"Test 05 - Edit distance in subdomain": {
+			Input{rawUrl: "https://login.gooogle.net"},
+			Output{code: model.ReasonEditDistance}},
+	}
+
+	for i, test := range tests {
+		err := filter.Check(test.input.rawUrl)
+
+		var lookalike *model.LookalikeUrlError
+		switch {
+		case len(test.output.code) <= 0 && err != nil:
+			t.Errorf("#%s: Output is: %s. But should not has error", i, err)
+		case len(test.output.code) > 0 && !errors.As(err, &lookalike):
+			t.Errorf("#%s: Output is: %s. But should be a LookalikeUrlError", i, err)
+		case len(test.output.code) > 0 && lookalike.Code != test.output.code:
+			t.Errorf("#%s: Output is: %v. But should be: %v", i, lookalike.Code, test.output.code)
+		}
+	}
+}
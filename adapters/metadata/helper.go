@@ -0,0 +1,104 @@
+package metadata
+
+import (
+	"io"
+	"net/url"
+	"strings"
+
+	"ehgm.com.br/url-shortener/domain/model"
+
+	"golang.org/x/net/html"
+)
+
+// Read the head of the page looking for the title, description, favicon and Open Graph tags
+func parseMetadata(r io.Reader, base *url.URL) *model.Metadata {
+	metadata := &model.Metadata{}
+	var title, ogTitle, description, ogDescription string
+
+	tokenizer := html.NewTokenizer(r)
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			break
+		}
+
+		token := tokenizer.Token()
+		if tokenType == html.EndTagToken && token.Data == "head" {
+			break
+		}
+		if tokenType != html.StartTagToken && tokenType != html.SelfClosingTagToken {
+			continue
+		}
+
+		switch token.Data {
+		case "title":
+			if len(title) <= 0 && tokenizer.Next() == html.TextToken {
+				title = strings.TrimSpace(string(tokenizer.Text()))
+			}
+		case "meta":
+			name := strings.ToLower(attr(token, "name"))
+			property := strings.ToLower(attr(token, "property"))
+			content := strings.TrimSpace(attr(token, "content"))
+
+			switch {
+			case name == "description":
+				description = content
+			case property == "og:title":
+				ogTitle = content
+			case property == "og:description":
+				ogDescription = content
+			case property == "og:image" && len(metadata.Image) <= 0:
+				metadata.Image = resolve(base, content)
+			}
+		case "link":
+			rel := strings.Fields(strings.ToLower(attr(token, "rel")))
+			for _, v := range rel {
+				if v == "icon" && len(metadata.Favicon) <= 0 {
+					metadata.Favicon = resolve(base, attr(token, "href"))
+				}
+			}
+		}
+	}
+
+	metadata.Title = truncate(firstNotEmpty(ogTitle, title), 300)
+	metadata.Description = truncate(firstNotEmpty(ogDescription, description), 1000)
+	if len(metadata.Favicon) <= 0 {
+		metadata.Favicon = resolve(base, "/favicon.ico")
+	}
+	return metadata
+}
+
+func attr(token html.Token, key string) string {
+	for _, a := range token.Attr {
+		if strings.EqualFold(a.Key, key) {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// Relative links are resolved against the final url of the page, only http and https are kept
+func resolve(base *url.URL, ref string) string {
+	u, err := base.Parse(strings.TrimSpace(ref))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+	return u.String()
+}
+
+func firstNotEmpty(values ...string) string {
+	for _, v := range values {
+		if len(v) > 0 {
+			return v
+		}
+	}
+	return ""
+}
+
+func truncate(text string, size int) string {
+	runes := []rune(text)
+	if len(runes) > size {
+		return string(runes[:size])
+	}
+	return text
+}
@@ -0,0 +1,56 @@
+package metadata
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+
+	"ehgm.com.br/url-shortener/config"
+	"ehgm.com.br/url-shortener/domain/model"
+	"ehgm.com.br/url-shortener/domain/ports"
+)
+
+// Struct that implements 'MetadataFetcher' interface
+type metadataFetcher struct {
+	log      ports.Logger
+	client   *http.Client
+	maxBytes int64
+}
+
+// Get an instance of 'MetadataFetcher' using this method.
+// Private and loopback addresses are refused unless 'allowPrivate' is set, so users cannot make us scan our network
+func NewMetadataFetcher(log ports.Logger, timeout time.Duration, maxBytes int64, maxRedirects int, allowPrivate bool) ports.MetadataFetcher {
+	client := config.NewHttpClient(timeout, maxRedirects, allowPrivate)
+	return &metadataFetcher{log: log, client: client, maxBytes: maxBytes}
+}
+
+func (f *metadataFetcher) Fetch(ctx context.Context, rawUrl string) (*model.Metadata, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawUrl, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Fetch request error. %w", err)
+	}
+	req.Header.Set("User-Agent", "url-shortener-metadata/1.0")
+	req.Header.Set("Accept", "text/html")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Fetch error. %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("Fetch error, status code: %v", resp.StatusCode)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return nil, fmt.Errorf("Fetch error, content type is not HTML: %v", mediaType)
+	}
+
+	metadata := parseMetadata(io.LimitReader(resp.Body, f.maxBytes), resp.Request.URL)
+	metadata.FetchTime = time.Now().UTC()
+	return metadata, nil
+}
@@ -0,0 +1,130 @@
+package metadata
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Empty Logger
+type loggerMock struct{}
+
+func (l *loggerMock) Info(format string, v ...interface{})  {}
+func (l *loggerMock) Error(format string, v ...interface{}) {}
+func (l *loggerMock) Fatal(format string, v ...interface{}) {}
+
+func newDestination() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/page", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, `<html><head>
+			<title>Page &amp; title</title>
+			<meta name="description" content="Page description">
+			<meta property="og:image" content="/img/cover.png">
+			<link rel="shortcut icon" href="https://cdn.ehgm.com.br/icon.png">
+			</head><body><title>Not the title</title></body></html>`)
+	})
+	mux.HandleFunc("/open-graph", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<head><title>Title</title><meta property="og:title" content="OG title"></head>`)
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/redirect", http.StatusFound)
+	})
+	mux.HandleFunc("/json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{}`)
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(300 * time.Millisecond)
+	})
+	mux.HandleFunc("/big", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<head>"+strings.Repeat("<meta name=x>", 1000)+"<title>Too far</title></head>")
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestFetch(t *testing.T) {
+	server := newDestination()
+	defer server.Close()
+
+	fetcher := NewMetadataFetcher(&loggerMock{}, 200*time.Millisecond, 1024, 2, true)
+
+	type Input struct {
+		path string
+	}
+
+	type Output struct {
+		title       string
+		description string
+		favicon     string
+		image       string
+		hasError    bool
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Should read the page head": {
+			Input{path: "/page"},
+			Output{title: "Page & title", description: "Page description",
+				favicon: "https://cdn.ehgm.com.br/icon.png", image: server.URL + "/img/cover.png"}},
+
+		"Test 02 - Should prefer Open Graph and use the default favicon": {
+			Input{path: "/open-graph"},
+			Output{title: "OG title", favicon: server.URL + "/favicon.ico"}},
+
+		"Test 03 - Should stop after the size limit": {
+			Input{path: "/big"},
+			Output{title: "", favicon: server.URL + "/favicon.ico"}},
+
+		"Test 04 - Should return a redirect limit error": {
+			Input{path: "/redirect"},
+			Output{hasError: true}},
+
+		"Test 05 - Should return a content type error": {
+			Input{path: "/json"},
+			Output{hasError: true}},
+
+		"Test 06 - Should return a timeout error": {
+			Input{path: "/slow"},
+			Output{hasError: true}},
+
+		"Test 07 - Should return a not found error": {
+			Input{path: "/missing"},
+			Output{hasError: true}},
+	}
+
+	for i, test := range tests {
+		metadata, err := fetcher.Fetch(context.Background(), server.URL+test.input.path)
+
+		if test.output.hasError && err == nil {
+			t.Errorf("#%s: Output is: %s. But should has error: %v", i, err, test.output.hasError)
+			continue
+		}
+		if !test.output.hasError && err != nil {
+			t.Errorf("#%s: Output is: %s. But should not has error: %v", i, err, test.output.hasError)
+			continue
+		}
+		if !test.output.hasError && (metadata.Title != test.output.title || metadata.Description != test.output.description ||
+			metadata.Favicon != test.output.favicon || metadata.Image != test.output.image) {
+			t.Errorf("#%s: Output is: %+v. But should be: %+v", i, metadata, test.output)
+		}
+	}
+}
+
+func TestFetchPrivateAddress(t *testing.T) {
+	server := newDestination()
+	defer server.Close()
+
+	fetcher := NewMetadataFetcher(&loggerMock{}, time.Second, 1024, 2, false)
+	if _, err := fetcher.Fetch(context.Background(), server.URL+"/page"); err == nil {
+		t.Errorf("Output is: %s. But should has a private address error", err)
+	}
+}
@@ -0,0 +1,146 @@
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"ehgm.com.br/url-shortener/adapters/spool"
+	"ehgm.com.br/url-shortener/domain/model"
+	"ehgm.com.br/url-shortener/domain/ports"
+
+	"github.com/nats-io/nats.go"
+)
+
+// A click without ack after this time is spooled, it may be published twice
+const ackTimeout = 30 * time.Second
+
+// Struct that implements 'UrlCounter' interface
+type urlCounter struct {
+	log        ports.Logger
+	js         nats.JetStreamContext
+	subject    string
+	clickSpool ports.ClickSpool
+
+	pending sync.WaitGroup
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// Get an instance of 'UrlCounter' using this method.
+// The clicks are published to 'subject' of a JetStream stream with the same data and attributes as in Pub/Sub,
+// the attributes are the message headers. The clicks without ack are saved in 'clickSpool', it can be nil
+func NewUrlCounter(log ports.Logger, js nats.JetStreamContext, subject string, clickSpool ports.ClickSpool) ports.UrlCounter {
+	c := &urlCounter{log: log, js: js, subject: subject, clickSpool: clickSpool,
+		stop: make(chan struct{}), stopped: make(chan struct{})}
+
+	go func() {
+		defer close(c.stopped)
+		spool.RunReplay(log, clickSpool, c.publishEvents, c.stop)
+	}()
+	return c
+}
+
+// The redirect does not wait for the ack of the stream
+func (c *urlCounter) IncrementCounter(event *model.ClickEvent) {
+	future, err := c.publish(event)
+	if err != nil {
+		c.log.Error("Error sending message to Id: %v. Cause: %s", event.Id, err)
+		c.spoolEvent(event)
+		return
+	}
+
+	c.pending.Add(1)
+	go func() {
+		defer c.pending.Done()
+
+		if err := waitAck(context.Background(), future); err != nil {
+			c.log.Error("Error sending message to Id: %v. Cause: %s", event.Id, err)
+			c.spoolEvent(event)
+			return
+		}
+		c.log.Info("Message sent successfully to Id: %v", event.Id)
+	}()
+}
+
+// Wait for the acks of the published clicks, the connection is closed when the process ends
+func (c *urlCounter) Close(ctx context.Context) error {
+	close(c.stop)
+
+	done := make(chan struct{})
+	go func() {
+		c.pending.Wait()
+		<-c.stopped
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("Close counter error. %w", ctx.Err())
+	}
+}
+
+func (c *urlCounter) publish(event *model.ClickEvent) (nats.PubAckFuture, error) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("Encode click error. %w", err)
+	}
+
+	// The header keys are set directly, 'Set' would change the case of the attribute names
+	msg := nats.NewMsg(c.subject)
+	msg.Data = data
+	for key, value := range event.Attributes() {
+		msg.Header[key] = []string{value}
+	}
+
+	future, err := c.js.PublishMsgAsync(msg)
+	if err != nil {
+		return nil, fmt.Errorf("Publish click error. %w", err)
+	}
+	return future, nil
+}
+
+// Publish the events and wait for all of them, the batch fails when any of them fails
+func (c *urlCounter) publishEvents(ctx context.Context, events []*model.ClickEvent) error {
+	futures := make([]nats.PubAckFuture, 0, len(events))
+	for _, event := range events {
+		future, err := c.publish(event)
+		if err != nil {
+			return err
+		}
+		futures = append(futures, future)
+	}
+
+	for _, future := range futures {
+		if err := waitAck(ctx, future); err != nil {
+			return fmt.Errorf("Publish spooled click error. %w", err)
+		}
+	}
+	return nil
+}
+
+func (c *urlCounter) spoolEvent(event *model.ClickEvent) {
+	if c.clickSpool == nil {
+		return
+	}
+	if err := c.clickSpool.Append(event); err != nil {
+		c.log.Error("Click of Id: %v lost, it cannot be spooled. Cause: %s", event.Id, err)
+	}
+}
+
+func waitAck(ctx context.Context, future nats.PubAckFuture) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-future.Ok():
+		return nil
+	case err := <-future.Err():
+		return err
+	case <-time.After(ackTimeout):
+		return fmt.Errorf("no ack after %v", ackTimeout)
+	}
+}
@@ -0,0 +1,136 @@
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"ehgm.com.br/url-shortener/adapters/spool"
+	"ehgm.com.br/url-shortener/domain/model"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+)
+
+// Empty Logger
+type loggerMock struct{}
+
+func (l *loggerMock) Info(format string, v ...interface{})  {}
+func (l *loggerMock) Error(format string, v ...interface{}) {}
+func (l *loggerMock) Fatal(format string, v ...interface{}) {}
+
+// In process NATS server with JetStream, stopped at the end of the test
+func startServer(t *testing.T) nats.JetStreamContext {
+	s, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: -1, JetStream: true, StoreDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Output is: %s. But should start the server", err)
+	}
+	go s.Start()
+	t.Cleanup(s.Shutdown)
+	if !s.ReadyForConnections(5 * time.Second) {
+		t.Fatalf("Output is: not ready. But should start the server")
+	}
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatalf("Output is: %s. But should connect", err)
+	}
+	t.Cleanup(nc.Close)
+
+	js, err := nc.JetStream()
+	if err != nil {
+		t.Fatalf("Output is: %s. But should create the context", err)
+	}
+	return js
+}
+
+func addStream(t *testing.T, js nats.JetStreamContext) {
+	if _, err := js.AddStream(&nats.StreamConfig{Name: "CLICKS", Subjects: []string{"clicks"}, Storage: nats.MemoryStorage}); err != nil {
+		t.Fatalf("Output is: %s. But should create the stream", err)
+	}
+}
+
+// Events and headers of the messages in the stream
+func readStream(t *testing.T, js nats.JetStreamContext, count int) ([]model.ClickEvent, []nats.Header) {
+	sub, err := js.SubscribeSync("clicks", nats.DeliverAll())
+	if err != nil {
+		t.Fatalf("Output is: %s. But should subscribe", err)
+	}
+	defer sub.Unsubscribe()
+
+	events := []model.ClickEvent{}
+	headers := []nats.Header{}
+	for i := 0; i < count; i++ {
+		msg, err := sub.NextMsg(5 * time.Second)
+		if err != nil {
+			t.Fatalf("Output is: %s. But should read %v messages", err, count)
+		}
+		var event model.ClickEvent
+		if err := json.Unmarshal(msg.Data, &event); err != nil {
+			t.Fatalf("Output is: %s. But should be a click event", err)
+		}
+		events = append(events, event)
+		headers = append(headers, msg.Header)
+	}
+	return events, headers
+}
+
+func TestUrlCounter(t *testing.T) {
+	js := startServer(t)
+	addStream(t, js)
+
+	counter := NewUrlCounter(&loggerMock{}, js, "clicks", nil)
+	counter.IncrementCounter(&model.ClickEvent{Version: model.ClickEventVersion, Id: "0aYS7JJ", Variant: "a", Country: "BR"})
+	counter.IncrementCounter(&model.ClickEvent{Version: model.ClickEventVersion, Id: "1q2w3e"})
+	if err := counter.Close(context.Background()); err != nil {
+		t.Fatalf("Output is: %s. But should not has error", err)
+	}
+
+	// Same data and attributes of the Pub/Sub messages
+	events, headers := readStream(t, js, 2)
+	ids := []string{events[0].Id, events[1].Id}
+	if !reflect.DeepEqual(ids, []string{"0aYS7JJ", "1q2w3e"}) {
+		t.Errorf("Output is: %v. But should be: %v", ids, []string{"0aYS7JJ", "1q2w3e"})
+	}
+	expected := nats.Header{"id": {"0aYS7JJ"}, "version": {"1"}, "contentType": {"application/json"},
+		"variant": {"a"}, "country": {"BR"}}
+	if !reflect.DeepEqual(headers[0], expected) {
+		t.Errorf("Output is: %v. But should be: %v", headers[0], expected)
+	}
+}
+
+func TestUrlCounterSpool(t *testing.T) {
+	js := startServer(t)
+	clickSpool, err := spool.NewClickSpool(&loggerMock{}, t.TempDir(), 1<<20)
+	if err != nil {
+		t.Fatalf("Output is: %s. But should not has error", err)
+	}
+
+	// Without the stream there is no ack, the click is spooled
+	counter := NewUrlCounter(&loggerMock{}, js, "clicks", clickSpool)
+	counter.IncrementCounter(&model.ClickEvent{Version: model.ClickEventVersion, Id: "0aYS7JJ"})
+	deadline := time.Now().Add(5 * time.Second)
+	for clickSpool.Status().Events <= 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if events := clickSpool.Status().Events; events != 1 {
+		t.Fatalf("Output is: %v. But should spool 1 click", events)
+	}
+
+	// When the stream exists the spooled click is published by the replay
+	addStream(t, js)
+	deadline = time.Now().Add(10 * time.Second)
+	for clickSpool.Status().Events > 0 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if err := counter.Close(context.Background()); err != nil {
+		t.Fatalf("Output is: %s. But should not has error", err)
+	}
+
+	events, _ := readStream(t, js, 1)
+	if events[0].Id != "0aYS7JJ" || clickSpool.Status().Events != 0 {
+		t.Errorf("Output is: %v %v. But should publish the spooled click", events, clickSpool.Status())
+	}
+}
@@ -0,0 +1,44 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"ehgm.com.br/url-shortener/domain/model"
+	"ehgm.com.br/url-shortener/domain/ports"
+
+	"cloud.google.com/go/pubsub"
+)
+
+// Struct that implements 'EventPublisher' interface
+type eventPublisher struct {
+	log   ports.Logger
+	topic *pubsub.Topic
+}
+
+// Get an instance of 'EventPublisher' using this method.
+// The link id is the ordering key, the subscriptions with message ordering receive the events of a link in order
+func NewEventPublisher(log ports.Logger, ps *pubsub.Client, pubsubTopic string) ports.EventPublisher {
+	topic := ps.Topic(pubsubTopic)
+	topic.EnableMessageOrdering = true
+	return &eventPublisher{log: log, topic: topic}
+}
+
+func (p *eventPublisher) Publish(ctx context.Context, event *model.LinkEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("Marshal link event error. %w", err)
+	}
+
+	message := &pubsub.Message{Data: data, Attributes: event.Attributes(), OrderingKey: event.LinkId}
+	idMessage, err := p.topic.Publish(ctx, message).Get(ctx)
+	if err != nil {
+		// The key is paused after an error, the event is published again by the next relay
+		p.topic.ResumePublish(event.LinkId)
+		return fmt.Errorf("Publish link event error. %w", err)
+	}
+
+	p.log.Info("Message [%v] sent successfully with event %v of Id: %v", idMessage, event.Type, event.LinkId)
+	return nil
+}
@@ -2,7 +2,12 @@ package pubsub
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
 
+	"ehgm.com.br/url-shortener/adapters/spool"
+	"ehgm.com.br/url-shortener/domain/model"
 	"ehgm.com.br/url-shortener/domain/ports"
 
 	"cloud.google.com/go/pubsub"
@@ -10,25 +15,119 @@ import (
 
 // Struct that implements 'UrlCounter' interface
 type urlCounter struct {
-	log         ports.Logger
-	ps          *pubsub.Client
-	pubsubTopic string
+	log        ports.Logger
+	topic      *pubsub.Topic
+	clickSpool ports.ClickSpool
+	jsonData   bool
+
+	pending sync.WaitGroup
+	stop    chan struct{}
+	stopped chan struct{}
 }
 
-// Get an instance of 'UrlCounter' using this method
-func NewUrlCounter(log ports.Logger, ps *pubsub.Client, pubsubTopic string) ports.UrlCounter {
-	return &urlCounter{log: log, ps: ps, pubsubTopic: pubsubTopic}
+// Get an instance of 'UrlCounter' using this method.
+// The topic handle is shared, it groups the messages published at the same time.
+// The clicks that fail to be published are saved in 'clickSpool' and published again later, it can be nil.
+// The data is the JSON of the click when 'jsonData' is set, otherwise only the id as read by the older consumers
+func NewUrlCounter(log ports.Logger, ps *pubsub.Client, pubsubTopic string, clickSpool ports.ClickSpool, jsonData bool) ports.UrlCounter {
+	c := &urlCounter{log: log, topic: ps.Topic(pubsubTopic), clickSpool: clickSpool, jsonData: jsonData,
+		stop: make(chan struct{}), stopped: make(chan struct{})}
+
+	go func() {
+		defer close(c.stopped)
+		spool.RunReplay(log, clickSpool, c.publishEvents, c.stop)
+	}()
+	return c
 }
 
-func (c *urlCounter) IncrementCounter(id string) {
+// The redirect does not wait for the message to be sent
+func (c *urlCounter) IncrementCounter(event *model.ClickEvent) {
 	ctx := context.Background()
-	topic := c.ps.Topic(c.pubsubTopic)
-	result := topic.Publish(ctx, &pubsub.Message{Data: []byte(id)})
 
-	idMessage, err := result.Get(ctx)
+	message, err := c.newMessage(event)
+	if err != nil {
+		c.log.Error("Error encoding message to Id: %v. Cause: %s", event.Id, err)
+		return
+	}
+	result := c.topic.Publish(ctx, message)
+
+	c.pending.Add(1)
+	go func() {
+		defer c.pending.Done()
+
+		idMessage, err := result.Get(ctx)
+		if err != nil {
+			c.log.Error("Error sending message to Id: %v. Cause: %s", event.Id, err)
+			c.spoolEvent(event)
+		} else {
+			c.log.Info("Message [%v] sent successfully to Id: %v", idMessage, event.Id)
+		}
+	}()
+}
+
+// Send the messages waiting to be published, the ones that fail stay in the spool for the next run
+func (c *urlCounter) Close(ctx context.Context) error {
+	close(c.stop)
+
+	// Stop sends the messages waiting in the topic, it does not know the context
+	done := make(chan struct{})
+	go func() {
+		c.topic.Stop()
+		c.pending.Wait()
+		<-c.stopped
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("Close counter error. %w", ctx.Err())
+	}
+}
+
+func (c *urlCounter) spoolEvent(event *model.ClickEvent) {
+	if c.clickSpool == nil {
+		return
+	}
+	if err := c.clickSpool.Append(event); err != nil {
+		c.log.Error("Click of Id: %v lost, it cannot be spooled. Cause: %s", event.Id, err)
+	}
+}
+
+// The data is the versioned JSON of the click or only its id, the attributes let subscriptions filter without reading it.
+// The messages with the id have no 'version' attribute, so the consumers read their data as the id
+func (c *urlCounter) newMessage(event *model.ClickEvent) (*pubsub.Message, error) {
+	attributes := event.Attributes()
+	if !c.jsonData {
+		delete(attributes, "version")
+		delete(attributes, "contentType")
+		return &pubsub.Message{Data: []byte(event.Id), Attributes: attributes}, nil
+	}
+
+	data, err := json.Marshal(event)
 	if err != nil {
-		c.log.Error("Error sending message to Id: %v. Cause: %s", id, err)
-	} else {
-		c.log.Info("Message [%v] sent successfully to Id: %v", idMessage, id)
+		return nil, err
+	}
+	return &pubsub.Message{Data: data, Attributes: attributes}, nil
+}
+
+// Publish the events and wait for all of them, the batch fails when any of them fails
+func (c *urlCounter) publishEvents(ctx context.Context, events []*model.ClickEvent) error {
+	results := make([]*pubsub.PublishResult, 0, len(events))
+	for _, event := range events {
+		message, err := c.newMessage(event)
+		if err != nil {
+			c.log.Error("Dropping spooled click of Id: %v. Cause: %s", event.Id, err)
+			continue
+		}
+		results = append(results, c.topic.Publish(ctx, message))
+	}
+
+	for _, result := range results {
+		if _, err := result.Get(ctx); err != nil {
+			return fmt.Errorf("Publish spooled click error. %w", err)
+		}
 	}
+	return nil
 }
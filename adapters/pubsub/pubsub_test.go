@@ -0,0 +1,160 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"ehgm.com.br/url-shortener/domain/model"
+
+	"cloud.google.com/go/pubsub"
+	"cloud.google.com/go/pubsub/pstest"
+
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+)
+
+// Empty Logger
+type loggerMock struct{}
+
+func (l *loggerMock) Info(format string, v ...interface{})  {}
+func (l *loggerMock) Error(format string, v ...interface{}) {}
+func (l *loggerMock) Fatal(format string, v ...interface{}) {}
+
+// Keeps the appended clicks, nothing is replayed
+type clickSpoolMock struct {
+	mu     sync.Mutex
+	events []*model.ClickEvent
+}
+
+func (s *clickSpoolMock) Append(event *model.ClickEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event)
+	return nil
+}
+
+func (s *clickSpoolMock) Replay(ctx context.Context, publish func(ctx context.Context, events []*model.ClickEvent) error) (int, error) {
+	return 0, nil
+}
+
+func (s *clickSpoolMock) Status() *model.SpoolStatus {
+	return &model.SpoolStatus{}
+}
+
+// Client of an in-process Pub/Sub server, the topics are created by each test
+func newTestClient(t *testing.T) *pubsub.Client {
+	srv := pstest.NewServer()
+	t.Cleanup(func() { srv.Close() })
+
+	conn, err := grpc.Dial(srv.Addr, grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	client, err := pubsub.NewClient(context.Background(), "project", option.WithGRPCConn(conn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestNewMessage(t *testing.T) {
+	event := &model.ClickEvent{Version: model.ClickEventVersion, Id: "0aYS7JJ", Variant: "a", Country: "BR"}
+	versioned, _ := json.Marshal(event)
+
+	type Input struct {
+		jsonData bool
+	}
+
+	type Output struct {
+		data       string
+		attributes map[string]string
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Should send the id without version": {
+			Input{jsonData: false},
+			Output{data: "0aYS7JJ", attributes: map[string]string{"id": "0aYS7JJ", "variant": "a", "country": "BR"}}},
+
+		"Test 02 - Should send the versioned JSON": {
+			Input{jsonData: true},
+			Output{data: string(versioned), attributes: map[string]string{"id": "0aYS7JJ", "variant": "a", "country": "BR",
+				"version": "1", "contentType": "application/json"}}},
+	}
+
+	for i, test := range tests {
+		counter := &urlCounter{log: &loggerMock{}, jsonData: test.input.jsonData}
+		message, err := counter.newMessage(event)
+		if err != nil {
+			t.Errorf("#%s: Output is: %s. But should not has error", i, err)
+			continue
+		}
+		if string(message.Data) != test.output.data || !reflect.DeepEqual(message.Attributes, test.output.attributes) {
+			t.Errorf("#%s: Output is: %s %v. But should be: %s %v", i, message.Data, message.Attributes,
+				test.output.data, test.output.attributes)
+		}
+	}
+}
+
+func TestPublishFailure(t *testing.T) {
+	client := newTestClient(t)
+	clickSpool := &clickSpoolMock{}
+
+	// The topic does not exist, so the click cannot be published
+	counter := NewUrlCounter(&loggerMock{}, client, "clicks", clickSpool, false)
+	counter.IncrementCounter(&model.ClickEvent{Version: model.ClickEventVersion, Id: "0aYS7JJ"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := counter.Close(ctx); err != nil {
+		t.Fatalf("Output is: %s. But should not has error", err)
+	}
+	if len(clickSpool.events) != 1 || clickSpool.events[0].Id != "0aYS7JJ" {
+		t.Errorf("Output is: %v. But should be the spooled click", clickSpool.events)
+	}
+}
+
+func TestPublishEvents(t *testing.T) {
+	client := newTestClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	topic, err := client.CreateTopic(ctx, "clicks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, err := client.CreateSubscription(ctx, "consumer", pubsub.SubscriptionConfig{Topic: topic})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The spooled clicks are sent in the same format as the new ones
+	counter := &urlCounter{log: &loggerMock{}, topic: client.Topic("clicks")}
+	defer counter.topic.Stop()
+	if err = counter.publishEvents(ctx, []*model.ClickEvent{{Version: model.ClickEventVersion, Id: "0aYS7JJ"}}); err != nil {
+		t.Fatalf("Output is: %s. But should not has error", err)
+	}
+
+	var received *pubsub.Message
+	receiveCtx, stop := context.WithCancel(ctx)
+	err = sub.Receive(receiveCtx, func(ctx context.Context, message *pubsub.Message) {
+		message.Ack()
+		received = message
+		stop()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if received == nil || string(received.Data) != "0aYS7JJ" || len(received.Attributes["version"]) > 0 {
+		t.Errorf("Output is: %v. But should be the id without version", received)
+	}
+}
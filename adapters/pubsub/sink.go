@@ -0,0 +1,44 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"ehgm.com.br/url-shortener/domain/model"
+	"ehgm.com.br/url-shortener/domain/ports"
+
+	"cloud.google.com/go/pubsub"
+)
+
+// Struct that implements 'ClickSink' interface
+type clickSink struct {
+	log   ports.Logger
+	topic *pubsub.Topic
+}
+
+// Get an instance of 'ClickSink' using this method, the counts of each flush are sent as one message
+func NewClickSink(log ports.Logger, ps *pubsub.Client, pubsubTopic string) ports.ClickSink {
+	return &clickSink{log: log, topic: ps.Topic(pubsubTopic)}
+}
+
+func (s *clickSink) SaveCounts(ctx context.Context, counts []model.ClickCount) error {
+	data, err := json.Marshal(model.ClickBatch{Version: model.ClickEventVersion, Counts: counts})
+	if err != nil {
+		return fmt.Errorf("Marshal click batch error. %w", err)
+	}
+
+	message := &pubsub.Message{Data: data, Attributes: map[string]string{
+		"type":        model.ClickBatchType,
+		"version":     strconv.Itoa(model.ClickEventVersion),
+		"contentType": "application/json",
+	}}
+	idMessage, err := s.topic.Publish(ctx, message).Get(ctx)
+	if err != nil {
+		return fmt.Errorf("Publish click batch error. %w", err)
+	}
+
+	s.log.Info("Message [%v] sent successfully with %v counts", idMessage, len(counts))
+	return nil
+}
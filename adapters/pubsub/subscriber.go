@@ -0,0 +1,34 @@
+package pubsub
+
+import (
+	"context"
+
+	"ehgm.com.br/url-shortener/domain/model"
+	"ehgm.com.br/url-shortener/domain/ports"
+
+	"cloud.google.com/go/pubsub"
+)
+
+// Struct that implements 'ClickSubscriber' interface
+type clickSubscriber struct {
+	log          ports.Logger
+	ps           *pubsub.Client
+	subscription string
+	maxPending   int
+}
+
+// Get an instance of 'ClickSubscriber' using this method.
+// At most 'maxPending' messages are received and not yet acked, the messages wait for their batch to be saved
+func NewClickSubscriber(log ports.Logger, ps *pubsub.Client, subscription string, maxPending int) ports.ClickSubscriber {
+	return &clickSubscriber{log: log, ps: ps, subscription: subscription, maxPending: maxPending}
+}
+
+func (s *clickSubscriber) Receive(ctx context.Context, handle func(message *model.ClickMessage)) error {
+	sub := s.ps.Subscription(s.subscription)
+	sub.ReceiveSettings.MaxOutstandingMessages = s.maxPending
+
+	s.log.Info("Receiving clicks from subscription: %v", s.subscription)
+	return sub.Receive(ctx, func(ctx context.Context, m *pubsub.Message) {
+		handle(&model.ClickMessage{MessageId: m.ID, Data: m.Data, Attributes: m.Attributes, Ack: m.Ack, Nack: m.Nack})
+	})
+}
@@ -0,0 +1,85 @@
+package qrcode
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+
+	"ehgm.com.br/url-shortener/domain/model"
+)
+
+// Parse an 'RRGGBB' colour, the '#' prefix is optional
+func parseColor(value string) (color.RGBA, error) {
+	b, err := hex.DecodeString(strings.TrimPrefix(value, "#"))
+	if err != nil || len(b) != 3 {
+		return color.RGBA{}, &model.InvalidRequestError{Message: fmt.Sprintf("Colour %v is not a valid RRGGBB value", value)}
+	}
+	return color.RGBA{R: b[0], G: b[1], B: b[2], A: 0xff}, nil
+}
+
+// Surround the modules with 'margin' light modules, the quiet zone
+func addMargin(modules [][]bool, margin int) [][]bool {
+	size := len(modules) + 2*margin
+	result := make([][]bool, size)
+	for y := range result {
+		result[y] = make([]bool, size)
+		if y < margin || y >= margin+len(modules) {
+			continue
+		}
+		copy(result[y][margin:], modules[y-margin])
+	}
+	return result
+}
+
+// Draw the modules in an image of exactly 'size' pixels, it is never smaller than one pixel per module
+func renderPng(modules [][]bool, size int, fg, bg color.RGBA) ([]byte, error) {
+	if size < len(modules) {
+		size = len(modules)
+	}
+
+	img := image.NewPaletted(image.Rect(0, 0, size, size), color.Palette{bg, fg})
+	for y := 0; y < size; y++ {
+		row := modules[y*len(modules)/size]
+		for x := 0; x < size; x++ {
+			if row[x*len(modules)/size] {
+				img.SetColorIndex(x, y, 1)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Draw the modules as a single path, the consecutive dark modules of a row are joined
+func renderSvg(modules [][]bool, size int, fg, bg string) []byte {
+	var buf bytes.Buffer
+	n := len(modules)
+
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		size, size, n, n)
+	fmt.Fprintf(&buf, `<rect width="%d" height="%d" fill="#%s"/><path fill="#%s" d="`, n, n,
+		strings.TrimPrefix(bg, "#"), strings.TrimPrefix(fg, "#"))
+
+	for y, row := range modules {
+		for x := 0; x < n; x++ {
+			if !row[x] {
+				continue
+			}
+			start := x
+			for x < n && row[x] {
+				x++
+			}
+			fmt.Fprintf(&buf, "M%d %dh%dv1h-%dz", start, y, x-start, x-start)
+		}
+	}
+	buf.WriteString(`"/></svg>`)
+	return buf.Bytes()
+}
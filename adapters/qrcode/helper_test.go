@@ -0,0 +1,85 @@
+package qrcode
+
+import (
+	"image/color"
+	"strings"
+	"testing"
+)
+
+func TestParseColor(t *testing.T) {
+	type Input struct {
+		value string
+	}
+
+	type Output struct {
+		color    color.RGBA
+		hasError bool
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Should parse a colour": {
+			Input{value: "ff8000"},
+			Output{color: color.RGBA{R: 0xff, G: 0x80, B: 0x00, A: 0xff}}},
+
+		"Test 02 - Should parse a colour with #": {
+			Input{value: "#000000"},
+			Output{color: color.RGBA{A: 0xff}}},
+
+		"Test 03 - Should return error for a short colour": {
+			Input{value: "fff"},
+			Output{hasError: true}},
+
+		"Test 04 - Should return error for an invalid colour": {
+			Input{value: "red"},
+			Output{hasError: true}},
+	}
+
+	for i, test := range tests {
+		c, err := parseColor(test.input.value)
+
+		if test.output.hasError && err == nil {
+			t.Errorf("#%s: Output is: %s. But should has error: %v", i, err, test.output.hasError)
+			continue
+		}
+		if !test.output.hasError && err != nil {
+			t.Errorf("#%s: Output is: %s. But should not has error: %v", i, err, test.output.hasError)
+			continue
+		}
+		if c != test.output.color {
+			t.Errorf("#%s: Output is: %v. But should be: %v", i, c, test.output.color)
+		}
+	}
+}
+
+func TestAddMargin(t *testing.T) {
+	modules := [][]bool{{true, false}, {false, true}}
+
+	result := addMargin(modules, 2)
+	if len(result) != 6 || len(result[0]) != 6 {
+		t.Errorf("Output is: %vx%v. But should be: 6x6", len(result), len(result[0]))
+		return
+	}
+	for y, row := range result {
+		for x, dark := range row {
+			expected := (x == 2 && y == 2) || (x == 3 && y == 3)
+			if dark != expected {
+				t.Errorf("Output is: %v at %v,%v. But should be: %v", dark, x, y, expected)
+			}
+		}
+	}
+}
+
+func TestRenderSvg(t *testing.T) {
+	modules := [][]bool{{true, true, false}, {false, false, true}, {false, false, false}}
+
+	svg := string(renderSvg(modules, 300, "000000", "#ffffff"))
+
+	for _, expected := range []string{`width="300"`, `viewBox="0 0 3 3"`, `fill="#ffffff"`, `fill="#000000"`, "M0 0h2v1h-2z", "M2 1h1v1h-1z"} {
+		if !strings.Contains(svg, expected) {
+			t.Errorf("Output is: %v. But should contain: %v", svg, expected)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package qrcode
+
+import (
+	"fmt"
+	"strings"
+
+	"ehgm.com.br/url-shortener/domain/model"
+	"ehgm.com.br/url-shortener/domain/ports"
+
+	qr "github.com/skip2/go-qrcode"
+)
+
+var levels = map[string]qr.RecoveryLevel{
+	"L": qr.Low,
+	"M": qr.Medium,
+	"Q": qr.High,
+	"H": qr.Highest,
+}
+
+// Struct that implements 'QrEncoder' interface
+type qrEncoder struct {
+	log ports.Logger
+}
+
+// Get an instance of 'QrEncoder' using this method
+func NewQrEncoder(log ports.Logger) ports.QrEncoder {
+	return &qrEncoder{log: log}
+}
+
+// Encode the content as a PNG or SVG image, the library only builds the modules so
+// the size, margin and colours are drawn here
+func (e *qrEncoder) Encode(content string, options *model.QrOptions) ([]byte, error) {
+	level, ok := levels[strings.ToUpper(options.Level)]
+	if !ok {
+		return nil, &model.InvalidRequestError{Message: fmt.Sprintf("QR code error correction level %v is not valid", options.Level)}
+	}
+
+	fg, err := parseColor(options.Foreground)
+	if err != nil {
+		return nil, err
+	}
+	bg, err := parseColor(options.Background)
+	if err != nil {
+		return nil, err
+	}
+
+	code, err := qr.New(content, level)
+	if err != nil {
+		return nil, fmt.Errorf("Encode error. %w", err)
+	}
+	code.DisableBorder = true
+	modules := addMargin(code.Bitmap(), options.Margin)
+
+	switch strings.ToLower(options.Format) {
+	case "svg":
+		return renderSvg(modules, options.Size, options.Foreground, options.Background), nil
+	case "png":
+		image, err := renderPng(modules, options.Size, fg, bg)
+		if err != nil {
+			return nil, fmt.Errorf("Encode error. %w", err)
+		}
+		return image, nil
+	default:
+		return nil, &model.InvalidRequestError{Message: fmt.Sprintf("QR code format %v is not valid", options.Format)}
+	}
+}
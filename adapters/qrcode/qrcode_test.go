@@ -0,0 +1,79 @@
+package qrcode
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+
+	"ehgm.com.br/url-shortener/domain/model"
+)
+
+// Empty Logger
+type loggerMock struct{}
+
+func (l *loggerMock) Info(format string, v ...interface{})  {}
+func (l *loggerMock) Error(format string, v ...interface{}) {}
+func (l *loggerMock) Fatal(format string, v ...interface{}) {}
+
+func TestEncode(t *testing.T) {
+	type Input struct {
+		options model.QrOptions
+	}
+
+	type Output struct {
+		contentPrefix string
+		size          int
+		hasError      bool
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Should return a PNG with the size": {
+			Input{options: model.QrOptions{Format: "png", Size: 256, Margin: 4, Level: "M", Foreground: "000000", Background: "ffffff"}},
+			Output{contentPrefix: "\x89PNG", size: 256}},
+
+		"Test 02 - Should return an SVG": {
+			Input{options: model.QrOptions{Format: "svg", Size: 512, Margin: 0, Level: "H", Foreground: "1a2b3c", Background: "ffffff"}},
+			Output{contentPrefix: "<svg"}},
+
+		"Test 03 - Should return error for an invalid level": {
+			Input{options: model.QrOptions{Format: "png", Size: 256, Level: "X", Foreground: "000000", Background: "ffffff"}},
+			Output{hasError: true}},
+
+		"Test 04 - Should return error for an invalid colour": {
+			Input{options: model.QrOptions{Format: "png", Size: 256, Level: "L", Foreground: "black", Background: "ffffff"}},
+			Output{hasError: true}},
+
+		"Test 05 - Should return error for an invalid format": {
+			Input{options: model.QrOptions{Format: "gif", Size: 256, Level: "Q", Foreground: "000000", Background: "ffffff"}},
+			Output{hasError: true}},
+	}
+
+	encoder := NewQrEncoder(&loggerMock{})
+
+	for i, test := range tests {
+		image, err := encoder.Encode("https://ehgm.com.br/r/1q2w3e", &test.input.options)
+
+		if test.output.hasError && err == nil {
+			t.Errorf("#%s: Output is: %s. But should has error: %v", i, err, test.output.hasError)
+			continue
+		}
+		if !test.output.hasError && err != nil {
+			t.Errorf("#%s: Output is: %s. But should not has error: %v", i, err, test.output.hasError)
+			continue
+		}
+		if !strings.HasPrefix(string(image), test.output.contentPrefix) {
+			t.Errorf("#%s: Output is: %q. But should start with: %q", i, string(image[:4]), test.output.contentPrefix)
+			continue
+		}
+		if test.output.size > 0 {
+			config, err := png.DecodeConfig(bytes.NewReader(image))
+			if err != nil || config.Width != test.output.size || config.Height != test.output.size {
+				t.Errorf("#%s: Output is: %vx%v. But should be: %vx%v", i, config.Width, config.Height, test.output.size, test.output.size)
+			}
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"ehgm.com.br/url-shortener/domain/ports"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const keyPrefix = "ratelimit:"
+
+// Counts the requests of the key, the window starts with the first one
+var allowScript = redis.NewScript(`
+local count = redis.call('INCR', KEYS[1])
+if count == 1 then redis.call('PEXPIRE', KEYS[1], ARGV[1]) end
+return count
+`)
+
+// Struct that implements 'RateLimiter' interface
+type rateLimiter struct {
+	log    ports.Logger
+	rdb    *redis.Client
+	limit  int
+	window time.Duration
+}
+
+// Get an instance of 'RateLimiter' using this method.
+// Each key is allowed 'limit' requests by 'window', the counts are shared by all instances through Redis
+func NewRateLimiter(log ports.Logger, rdb *redis.Client, limit int, window time.Duration) ports.RateLimiter {
+	return &rateLimiter{log: log, rdb: rdb, limit: limit, window: window}
+}
+
+func (r *rateLimiter) Allow(ctx context.Context, key string) (bool, error) {
+	count, err := allowScript.Run(ctx, r.rdb, []string{keyPrefix + key}, r.window.Milliseconds()).Int()
+	if err != nil {
+		return false, fmt.Errorf("Allow error for key: %v. %w", key, err)
+	}
+	return count <= r.limit, nil
+}
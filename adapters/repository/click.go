@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"ehgm.com.br/url-shortener/domain/model"
+	"ehgm.com.br/url-shortener/domain/ports"
+
+	"cloud.google.com/go/firestore"
+)
+
+var clickMessageCollection = "clickMessages"
+
+// Each click writes its message id and the counters of its url, a transaction has at most 500 writes
+const clicksPerTransaction = 200
+
+// The message ids can be removed by a TTL policy on 'expireAt', Pub/Sub does not deliver them after 7 days
+const clickMessageTTL = 8 * 24 * time.Hour
+
+// Struct that implements 'ClickRepository' interface
+type clickRepository struct {
+	log ports.Logger
+	fdb *firestore.Client
+}
+
+// Get an instance of 'ClickRepository' using this method.
+// The counters are not cached with the urls, so the cache is kept when they change
+func NewClickRepository(log ports.Logger, fdb *firestore.Client) ports.ClickRepository {
+	return &clickRepository{log: log, fdb: fdb}
+}
+
+// Increment the counters of the clicks whose message was not applied yet, returns the number of applied clicks.
+// Clicks of removed urls are ignored
+func (r *clickRepository) ApplyClicks(ctx context.Context, clicks []model.Click) (int, error) {
+	applied := 0
+	for start := 0; start < len(clicks); start += clicksPerTransaction {
+		end := start + clicksPerTransaction
+		if end > len(clicks) {
+			end = len(clicks)
+		}
+
+		n, err := r.applyBatch(ctx, clicks[start:end], true)
+		if err != nil {
+			return applied, fmt.Errorf("ApplyClicks error after %v clicks. %w", applied, err)
+		}
+		applied += n
+	}
+	return applied, nil
+}
+
+// Increment the counters of the aggregated clicks of a server, they have no message id
+func (r *clickRepository) SaveCounts(ctx context.Context, counts []model.ClickCount) error {
+	clicks := make([]model.Click, len(counts))
+	for i, count := range counts {
+		clicks[i] = model.Click{Id: count.Id, Variant: count.Variant, Count: count.Clicks}
+	}
+
+	for start := 0; start < len(clicks); start += clicksPerTransaction {
+		end := start + clicksPerTransaction
+		if end > len(clicks) {
+			end = len(clicks)
+		}
+		if _, err := r.applyBatch(ctx, clicks[start:end], false); err != nil {
+			return fmt.Errorf("SaveCounts error. %w", err)
+		}
+	}
+	return nil
+}
+
+func (r *clickRepository) applyBatch(ctx context.Context, clicks []model.Click, idempotent bool) (int, error) {
+	var applied int
+
+	err := r.fdb.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		applied = 0
+
+		fresh := clicks
+		if idempotent {
+			var err error
+			if fresh, err = r.freshClicks(tx, clicks); err != nil {
+				return err
+			}
+		}
+		counts, ids := aggregateClicks(fresh)
+
+		urlRefs := make([]*firestore.DocumentRef, len(ids))
+		for i, id := range ids {
+			urlRefs[i] = r.fdb.Collection(urlCollection).Doc(id)
+		}
+		urls, err := tx.GetAll(urlRefs)
+		if err != nil {
+			return fmt.Errorf("Get urls error. %w", err)
+		}
+
+		// All reads of a transaction come before the writes
+		for i, doc := range urls {
+			if !doc.Exists() {
+				r.log.Info("Ignoring clicks of removed Id: %v", ids[i])
+				continue
+			}
+			count := counts[ids[i]]
+			fields := []firestore.Update{{Path: "clicks", Value: firestore.Increment(count.Clicks)}}
+			for variant, n := range count.Variants {
+				fields = append(fields, firestore.Update{FieldPath: firestore.FieldPath{"variantClicks", variant}, Value: firestore.Increment(n)})
+			}
+			if err := tx.Update(urlRefs[i], fields); err != nil {
+				return err
+			}
+			applied += int(count.Clicks)
+		}
+
+		if !idempotent {
+			return nil
+		}
+		now := time.Now()
+		for _, click := range fresh {
+			ref := r.fdb.Collection(clickMessageCollection).Doc(click.MessageId)
+			data := map[string]interface{}{"id": click.Id, "appliedAt": now, "expireAt": now.Add(clickMessageTTL)}
+			if err := tx.Create(ref, data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("Firestore transaction error. %w", err)
+	}
+	return applied, nil
+}
+
+// Clicks whose message was not applied yet, a message repeated in the batch is applied once
+func (r *clickRepository) freshClicks(tx *firestore.Transaction, clicks []model.Click) ([]model.Click, error) {
+	refs := make([]*firestore.DocumentRef, len(clicks))
+	for i, click := range clicks {
+		refs[i] = r.fdb.Collection(clickMessageCollection).Doc(click.MessageId)
+	}
+	messages, err := tx.GetAll(refs)
+	if err != nil {
+		return nil, fmt.Errorf("Get click messages error. %w", err)
+	}
+
+	fresh := []model.Click{}
+	unique := map[string]bool{}
+	for i, message := range messages {
+		if !message.Exists() && !unique[clicks[i].MessageId] {
+			unique[clicks[i].MessageId] = true
+			fresh = append(fresh, clicks[i])
+		}
+	}
+	return fresh, nil
+}
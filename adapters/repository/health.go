@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"ehgm.com.br/url-shortener/domain/model"
+	"ehgm.com.br/url-shortener/domain/ports"
+
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"cloud.google.com/go/firestore"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Get an instance of 'HealthRepository' using this method
+func NewHealthRepository(log ports.Logger,
+	fdb *firestore.Client,
+	rdb *redis.Client,
+	cacheTTL int) ports.HealthRepository {
+
+	return &urlRepository{log: log, fdb: fdb, rdb: rdb, cacheTTL: cacheTTL}
+}
+
+// The url is removed from cache only when the health 'changed' the redirect, the other checks keep it in cache.
+// It is removed instead of refreshed, so the checks do not put every url in cache
+func (r *urlRepository) SaveHealth(ctx context.Context, id string, health *model.Health, changed bool) error {
+	fields := []firestore.Update{{Path: "health", Value: health}}
+
+	_, err := r.fdb.Collection(urlCollection).Doc(id).Update(ctx, fields)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return &model.DocumentNotFoundError{Id: id}
+		}
+		return fmt.Errorf("SaveHealth Id error. %w", err)
+	}
+
+	if !changed {
+		return nil
+	}
+	if err = r.rdb.Del(ctx, id).Err(); err != nil {
+		r.log.Error("SaveHealth error removing Id from cache: %v. Cause: %s", id, err)
+	}
+	return nil
+}
+
+func (r *urlRepository) GetBroken(ctx context.Context, limit int) ([]model.ShortUrl, error) {
+	shortUrls := []model.ShortUrl{}
+
+	iter := r.fdb.Collection(urlCollection).Where("health.broken", "==", true).Limit(limit).Documents(ctx)
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return shortUrls, fmt.Errorf("GetBroken error on %v element. %w", len(shortUrls), err)
+		}
+		temp := model.ShortUrl{}
+		doc.DataTo(&temp)
+		temp.CreateTime = doc.CreateTime
+		shortUrls = append(shortUrls, temp)
+	}
+
+	r.log.Info("GetBroken found %v urls", len(shortUrls))
+	return shortUrls, nil
+}
@@ -2,8 +2,11 @@ package repository
 
 import (
 	"encoding/json"
+	"strings"
 
 	"ehgm.com.br/url-shortener/domain/model"
+
+	"cloud.google.com/go/firestore"
 )
 
 func structToJson(object interface{}) (string, error) {
@@ -16,3 +19,46 @@ func jsonToStruct(text string) (model.ShortUrl, error) {
 	err := json.Unmarshal([]byte(text), &object)
 	return object, err
 }
+
+// Clicks of each url, the ids are returned in the order of their first click
+type clickCount struct {
+	Clicks   int64
+	Variants map[string]int64
+}
+
+func aggregateClicks(clicks []model.Click) (map[string]*clickCount, []string) {
+	counts := map[string]*clickCount{}
+	ids := []string{}
+	for _, click := range clicks {
+		count, ok := counts[click.Id]
+		if !ok {
+			count = &clickCount{Variants: map[string]int64{}}
+			counts[click.Id] = count
+			ids = append(ids, click.Id)
+		}
+		count.Clicks += click.Count
+		if len(click.Variant) > 0 {
+			count.Variants[click.Variant] += click.Count
+		}
+	}
+	return counts, ids
+}
+
+// Event of the update of a link, disabling it is a 'disabled' event and any other change is an 'updated' one
+func updateEvent(id string, fields []firestore.Update, reason string) *model.LinkEvent {
+	event := &model.LinkEvent{Version: model.LinkEventVersion, Type: model.LinkUpdated, LinkId: id}
+	for _, field := range fields {
+		event.Fields = append(event.Fields, field.Path)
+
+		if strings.EqualFold(field.Path, "url") {
+			if url, ok := field.Value.(string); ok {
+				event.Url = url
+			}
+		}
+		if strings.EqualFold(field.Path, "enable") && field.Value == false {
+			event.Type = model.LinkDisabled
+			event.Reason = reason
+		}
+	}
+	return event
+}
@@ -1,10 +1,13 @@
 package repository
 
 import (
+	"reflect"
 	"testing"
 	"time"
 
 	"ehgm.com.br/url-shortener/domain/model"
+
+	"cloud.google.com/go/firestore"
 )
 
 func TestStructToJson(t *testing.T) {
@@ -97,8 +100,85 @@ func TestJsonToStruct(t *testing.T) {
 			t.Errorf("#%s: Output is: %s. But should not has error: %v", i, err, test.output.hasError)
 			continue
 		}
-		if err != nil && shortUrl == test.output.shortUrl {
+		if err != nil && reflect.DeepEqual(shortUrl, test.output.shortUrl) {
 			t.Errorf("#%s: Output %v: should be valid: %v", i, shortUrl, test.output.shortUrl)
 		}
 	}
 }
+
+func TestAggregateClicks(t *testing.T) {
+	type Input struct {
+		clicks []model.Click
+	}
+
+	type Output struct {
+		counts map[string]*clickCount
+		ids    []string
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Should count each url and variant": {
+			Input{clicks: []model.Click{
+				{MessageId: "m1", Id: "1q2w3e", Variant: "a", Count: 1},
+				{MessageId: "m2", Id: "0aYS7JJ", Count: 1},
+				{MessageId: "m3", Id: "1q2w3e", Variant: "b", Count: 1},
+				{MessageId: "m4", Id: "1q2w3e", Variant: "a", Count: 5}}},
+			Output{counts: map[string]*clickCount{
+				"1q2w3e":  {Clicks: 7, Variants: map[string]int64{"a": 6, "b": 1}},
+				"0aYS7JJ": {Clicks: 1, Variants: map[string]int64{}}},
+				ids: []string{"1q2w3e", "0aYS7JJ"}}},
+
+		"Test 02 - No clicks": {
+			Input{clicks: []model.Click{}},
+			Output{counts: map[string]*clickCount{}, ids: []string{}}},
+	}
+
+	for i, test := range tests {
+		counts, ids := aggregateClicks(test.input.clicks)
+		if !reflect.DeepEqual(counts, test.output.counts) || !reflect.DeepEqual(ids, test.output.ids) {
+			t.Errorf("#%s: Output is: %v %v. But should be: %v %v", i, counts, ids, test.output.counts, test.output.ids)
+		}
+	}
+}
+
+func TestUpdateEvent(t *testing.T) {
+	type Input struct {
+		fields []firestore.Update
+		reason string
+	}
+
+	type Output struct {
+		event *model.LinkEvent
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Should be an update with the new url": {
+			Input{fields: []firestore.Update{{Path: "url", Value: "https://ehgm.com.br"}, {Path: "forwardQuery", Value: true}}},
+			Output{&model.LinkEvent{Version: model.LinkEventVersion, Type: model.LinkUpdated, LinkId: "1q2w3e",
+				Url: "https://ehgm.com.br", Fields: []string{"url", "forwardQuery"}}}},
+
+		"Test 02 - Should be disabled with the reason": {
+			Input{fields: []firestore.Update{{Path: "enable", Value: false}, {Path: "moderation", Value: model.ReasonSuspended}},
+				reason: model.ReasonSuspended},
+			Output{&model.LinkEvent{Version: model.LinkEventVersion, Type: model.LinkDisabled, LinkId: "1q2w3e",
+				Fields: []string{"enable", "moderation"}, Reason: model.ReasonSuspended}}},
+
+		"Test 03 - Enabling is an update": {
+			Input{fields: []firestore.Update{{Path: "enable", Value: true}, {Path: "moderation", Value: firestore.Delete}}},
+			Output{&model.LinkEvent{Version: model.LinkEventVersion, Type: model.LinkUpdated, LinkId: "1q2w3e",
+				Fields: []string{"enable", "moderation"}}}},
+	}
+
+	for i, test := range tests {
+		event := updateEvent("1q2w3e", test.input.fields, test.input.reason)
+		if !reflect.DeepEqual(event, test.output.event) {
+			t.Errorf("#%s: Output is: %v. But should be: %v", i, event, test.output.event)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"ehgm.com.br/url-shortener/domain/model"
+	"ehgm.com.br/url-shortener/domain/ports"
+
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"cloud.google.com/go/firestore"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Reports are stored as a subcollection of the reported url
+var reportCollection = "reports"
+
+// Urls read by each query of a scan
+const scanPageSize = 500
+
+// Get an instance of 'ModerationRepository' using this method
+func NewModerationRepository(log ports.Logger,
+	fdb *firestore.Client,
+	rdb *redis.Client,
+	cacheTTL int) ports.ModerationRepository {
+
+	return &urlRepository{log: log, fdb: fdb, rdb: rdb, cacheTTL: cacheTTL}
+}
+
+// Save the report and put the url in the moderation queue, returns the number of reports of the url.
+// A second report with the same id is ignored, so one reporter cannot count many times
+func (r *urlRepository) SaveReport(ctx context.Context, report *model.Report) (int64, error) {
+	var reports int64
+	urlRef := r.fdb.Collection(urlCollection).Doc(report.UrlId)
+	reportRef := urlRef.Collection(reportCollection).Doc(report.Id)
+
+	err := r.fdb.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		dsnap, err := tx.Get(urlRef)
+		if err != nil {
+			if status.Code(err) == codes.NotFound {
+				return &model.DocumentNotFoundError{Id: report.UrlId}
+			}
+			return err
+		}
+
+		var shortUrl model.ShortUrl
+		dsnap.DataTo(&shortUrl)
+		reports = shortUrl.Reports
+
+		if _, err = tx.Get(reportRef); err == nil {
+			r.log.Info("Report %v already exists to Id: %v", report.Id, report.UrlId)
+			return nil
+		} else if status.Code(err) != codes.NotFound {
+			return err
+		}
+
+		reports++
+		fields := []firestore.Update{{Path: "reports", Value: reports}}
+		if len(shortUrl.Moderation) <= 0 {
+			fields = append(fields, firestore.Update{Path: "moderation", Value: model.ReasonReported})
+		}
+
+		if err = tx.Create(reportRef, report); err != nil {
+			return err
+		}
+		if err = r.createEvent(tx, updateEvent(report.UrlId, fields, model.ReasonReported)); err != nil {
+			return err
+		}
+		return tx.Update(urlRef, fields)
+	})
+	if err != nil {
+		return reports, fmt.Errorf("SaveReport error. %w", err)
+	}
+
+	go r.updateCache(report.UrlId)
+	return reports, nil
+}
+
+func (r *urlRepository) FindReports(ctx context.Context, id string, limit int) ([]model.Report, error) {
+	reports := []model.Report{}
+
+	iter := r.fdb.Collection(urlCollection).Doc(id).Collection(reportCollection).
+		OrderBy("createTime", firestore.Desc).Limit(limit).Documents(ctx)
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return reports, fmt.Errorf("FindReports error on %v element. %w", len(reports), err)
+		}
+		temp := model.Report{}
+		doc.DataTo(&temp)
+		reports = append(reports, temp)
+	}
+
+	r.log.Info("FindReports found %v reports to Id: %v", len(reports), id)
+	return reports, nil
+}
+
+// Urls waiting for a moderator are the ones with a moderation code
+func (r *urlRepository) GetQueue(ctx context.Context, limit int) ([]model.ShortUrl, error) {
+	shortUrls := []model.ShortUrl{}
+
+	iter := r.fdb.Collection(urlCollection).Where("moderation", ">", "").
+		OrderBy("moderation", firestore.Asc).OrderBy("reports", firestore.Desc).Limit(limit).Documents(ctx)
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return shortUrls, fmt.Errorf("GetQueue error on %v element. %w", len(shortUrls), err)
+		}
+		temp := model.ShortUrl{}
+		doc.DataTo(&temp)
+		temp.CreateTime = doc.CreateTime
+		shortUrls = append(shortUrls, temp)
+	}
+
+	r.log.Info("GetQueue found %v urls", len(shortUrls))
+	return shortUrls, nil
+}
+
+// Disable the url until a moderator reviews it
+func (r *urlRepository) Suspend(ctx context.Context, id string) error {
+	fields := []firestore.Update{
+		{Path: "enable", Value: false},
+		{Path: "moderation", Value: model.ReasonSuspended},
+	}
+	return r.updateFields(ctx, id, fields, model.ReasonSuspended)
+}
+
+// Remove the url from the moderation queue and reset its reports
+func (r *urlRepository) CloseModeration(ctx context.Context, id string, enable bool) error {
+	fields := []firestore.Update{
+		{Path: "enable", Value: enable},
+		{Path: "moderation", Value: firestore.Delete},
+		{Path: "reports", Value: firestore.Delete},
+	}
+	return r.updateFields(ctx, id, fields, "")
+}
+
+// The event of the change is committed with it, 'reason' is the moderation code when the url is disabled
+func (r *urlRepository) updateFields(ctx context.Context, id string, fields []firestore.Update, reason string) error {
+	batch := r.fdb.Batch()
+	batch.Update(r.fdb.Collection(urlCollection).Doc(id), fields)
+	r.addEvent(batch, updateEvent(id, fields, reason))
+
+	if _, err := batch.Commit(ctx); err != nil {
+		if status.Code(err) == codes.NotFound {
+			return &model.DocumentNotFoundError{Id: id}
+		}
+		return fmt.Errorf("Update Id error. %w", err)
+	}
+	r.log.Info("Id updated: %v", id)
+
+	go r.updateCache(id)
+	return nil
+}
+
+// Iterate over all urls reading only the fields needed by the background jobs, stops on the first error of 'fn'.
+// The urls are read in pages and 'fn' runs between them, so a slow 'fn' does not keep a query open past its deadline
+func (r *urlRepository) Scan(ctx context.Context, fn func(shortUrl *model.ShortUrl) error) error {
+	var last *firestore.DocumentSnapshot
+	for {
+		query := r.fdb.Collection(urlCollection).
+			Select("id", "url", "enable", "moderation", "fallbackUrl", "health").
+			OrderBy(firestore.DocumentID, firestore.Asc).Limit(scanPageSize)
+		if last != nil {
+			query = query.StartAfter(last)
+		}
+
+		docs, err := query.Documents(ctx).GetAll()
+		if err != nil {
+			return fmt.Errorf("Scan error. %w", err)
+		}
+		for _, doc := range docs {
+			temp := model.ShortUrl{}
+			doc.DataTo(&temp)
+			temp.Id = doc.Ref.ID
+			if err = fn(&temp); err != nil {
+				return err
+			}
+		}
+
+		if len(docs) < scanPageSize {
+			return nil
+		}
+		last = docs[len(docs)-1]
+	}
+}
+
+// Update many urls in one batch and remove them from cache, an empty moderation code removes the field.
+// Each url also writes its event, so a batch has up to 250 urls
+func (r *urlRepository) SetModeration(ctx context.Context, ids []string, enable bool, moderation string) error {
+	if len(ids) <= 0 {
+		return nil
+	}
+
+	var value interface{} = moderation
+	if len(moderation) <= 0 {
+		value = firestore.Delete
+	}
+
+	batch := r.fdb.Batch()
+	for _, id := range ids {
+		fields := []firestore.Update{
+			{Path: "enable", Value: enable},
+			{Path: "moderation", Value: value},
+		}
+		batch.Update(r.fdb.Collection(urlCollection).Doc(id), fields)
+		r.addEvent(batch, updateEvent(id, fields, moderation))
+	}
+	if _, err := batch.Commit(ctx); err != nil {
+		return fmt.Errorf("SetModeration batch error. %w", err)
+	}
+
+	if err := r.rdb.Del(ctx, ids...).Err(); err != nil {
+		r.log.Error("SetModeration error removing %v ids from cache. Cause: %s", len(ids), err)
+	}
+	r.log.Info("SetModeration updated %v ids", len(ids))
+	return nil
+}
@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"ehgm.com.br/url-shortener/domain/model"
+	"ehgm.com.br/url-shortener/domain/ports"
+
+	"google.golang.org/api/iterator"
+
+	"cloud.google.com/go/firestore"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Link events written in the same batch as the change of the link
+var outboxCollection = "outbox"
+
+// Delivered events are kept for a while, a TTL policy on 'expireAt' removes them
+const deliveredRetention = 7 * 24 * time.Hour
+
+// Event saved in the outbox, the delivery fields are only used by the relay.
+// A dead event is also 'delivered', so it leaves the pending ones, but it has no 'expireAt' and is kept
+type outboxEvent struct {
+	model.LinkEvent
+	Delivered   bool      `firestore:"delivered"`
+	DeliverTime time.Time `firestore:"deliverTime,omitempty"`
+	ExpireAt    time.Time `firestore:"expireAt,omitempty"`
+	Dead        bool      `firestore:"dead,omitempty"`
+}
+
+// Get an instance of 'OutboxRepository' using this method
+func NewOutboxRepository(log ports.Logger,
+	fdb *firestore.Client,
+	rdb *redis.Client,
+	cacheTTL int) ports.OutboxRepository {
+
+	return &urlRepository{log: log, fdb: fdb, rdb: rdb, cacheTTL: cacheTTL}
+}
+
+// Events not delivered yet, ordered by the time they were committed.
+// It needs a composite index of 'delivered' and 'time' in the outbox collection
+func (r *urlRepository) PendingEvents(ctx context.Context, limit int) ([]model.LinkEvent, error) {
+	events := []model.LinkEvent{}
+
+	iter := r.fdb.Collection(outboxCollection).Where("delivered", "==", false).
+		OrderBy("time", firestore.Asc).Limit(limit).Documents(ctx)
+	defer iter.Stop()
+
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return events, fmt.Errorf("PendingEvents error on %v element. %w", len(events), err)
+		}
+		temp := outboxEvent{}
+		doc.DataTo(&temp)
+		temp.Id = doc.Ref.ID
+		events = append(events, temp.LinkEvent)
+	}
+	return events, nil
+}
+
+func (r *urlRepository) MarkDelivered(ctx context.Context, ids []string) error {
+	if len(ids) <= 0 {
+		return nil
+	}
+
+	batch := r.fdb.Batch()
+	expireAt := time.Now().Add(deliveredRetention)
+	for _, id := range ids {
+		batch.Update(r.fdb.Collection(outboxCollection).Doc(id), []firestore.Update{
+			{Path: "delivered", Value: true},
+			{Path: "deliverTime", Value: firestore.ServerTimestamp},
+			{Path: "expireAt", Value: expireAt},
+		})
+	}
+	if _, err := batch.Commit(ctx); err != nil {
+		return fmt.Errorf("MarkDelivered batch error. %w", err)
+	}
+	return nil
+}
+
+// Count a failed publish of the events, they stay pending
+func (r *urlRepository) MarkFailed(ctx context.Context, ids []string) error {
+	if len(ids) <= 0 {
+		return nil
+	}
+
+	batch := r.fdb.Batch()
+	for _, id := range ids {
+		batch.Update(r.fdb.Collection(outboxCollection).Doc(id), []firestore.Update{
+			{Path: "attempts", Value: firestore.Increment(1)},
+		})
+	}
+	if _, err := batch.Commit(ctx); err != nil {
+		return fmt.Errorf("MarkFailed batch error. %w", err)
+	}
+	return nil
+}
+
+// The events are not published anymore, they are kept in the outbox to be inspected
+func (r *urlRepository) MarkDead(ctx context.Context, ids []string) error {
+	if len(ids) <= 0 {
+		return nil
+	}
+
+	batch := r.fdb.Batch()
+	for _, id := range ids {
+		batch.Update(r.fdb.Collection(outboxCollection).Doc(id), []firestore.Update{
+			{Path: "attempts", Value: firestore.Increment(1)},
+			{Path: "delivered", Value: true},
+			{Path: "dead", Value: true},
+			{Path: "deliverTime", Value: firestore.ServerTimestamp},
+		})
+	}
+	if _, err := batch.Commit(ctx); err != nil {
+		return fmt.Errorf("MarkDead batch error. %w", err)
+	}
+	r.log.Info("MarkDead gave up on %v events", len(ids))
+	return nil
+}
+
+// Add the event to the batch with a new id, it is committed with the change of the link
+func (r *urlRepository) addEvent(batch *firestore.WriteBatch, event *model.LinkEvent) {
+	docRef := r.fdb.Collection(outboxCollection).NewDoc()
+	batch.Create(docRef, &outboxEvent{LinkEvent: *event})
+}
+
+// Create the event in the transaction with a new id, it is committed with the change of the link
+func (r *urlRepository) createEvent(tx *firestore.Transaction, event *model.LinkEvent) error {
+	docRef := r.fdb.Collection(outboxCollection).NewDoc()
+	return tx.Create(docRef, &outboxEvent{LinkEvent: *event})
+}
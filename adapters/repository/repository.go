@@ -37,25 +37,26 @@ func NewUrlRepository(log ports.Logger,
 	return &urlRepository{log: log, fdb: fdb, rdb: rdb, cacheTTL: cacheTTL}
 }
 
-func (r *urlRepository) Save(ctx context.Context, id, url string, enable bool) error {
-	shortUrl := model.ShortUrl{
-		Id:     id,
-		Url:    url,
-		Enable: enable,
-		Clicks: 0,
-	}
+func (r *urlRepository) Save(ctx context.Context, shortUrl *model.ShortUrl) error {
+	id := shortUrl.Id
+
+	// The event is created only when the link is
+	batch := r.fdb.Batch()
+	batch.Create(r.fdb.Collection(urlCollection).Doc(id), shortUrl)
+	r.addEvent(batch, &model.LinkEvent{Version: model.LinkEventVersion, Type: model.LinkCreated, LinkId: id, Url: shortUrl.Url})
 
-	docRef, err := r.fdb.Collection(urlCollection).Doc(id).Create(ctx, shortUrl)
+	results, err := batch.Commit(ctx)
 	if err != nil {
 		if status.Code(err) == codes.AlreadyExists {
-			return &model.DocumentAlreadyExistsError{Id: id, Url: url}
+			return &model.DocumentAlreadyExistsError{Id: id, Url: shortUrl.Url}
 		}
 		return fmt.Errorf("Firestore creation error. %w", err)
 	}
 
-	shortUrl.CreateTime = docRef.UpdateTime
-	go r.putInCache(&shortUrl)
-	return err
+	cached := *shortUrl
+	cached.CreateTime = results[0].UpdateTime
+	go r.putInCache(&cached)
+	return nil
 }
 
 func (r *urlRepository) FindById(ctx context.Context, id string) (*model.ShortUrl, error) {
@@ -64,7 +65,7 @@ func (r *urlRepository) FindById(ctx context.Context, id string) (*model.ShortUr
 
 	// Trying find in cache
 	shortUrl = r.getFromCache(ctx, id)
-	if *shortUrl == (model.ShortUrl{}) {
+	if shortUrl.IsEmpty() {
 
 		// Trying find in NoSQL
 		shortUrl, err = r.getFromNoSQL(ctx, id)
@@ -79,10 +80,20 @@ func (r *urlRepository) FindById(ctx context.Context, id string) (*model.ShortUr
 	return shortUrl, nil
 }
 
+// The counters are read from NoSQL, they are not cached because the clicks change them all the time
+func (r *urlRepository) FindClicks(ctx context.Context, id string) (int64, map[string]int64, error) {
+	shortUrl, err := r.getFromNoSQL(ctx, id)
+	if err != nil {
+		return 0, nil, fmt.Errorf("FindClicks error. %w", err)
+	}
+	return shortUrl.Clicks, shortUrl.VariantClicks, nil
+}
+
 func (r *urlRepository) Update(ctx context.Context, id string, json map[string]interface{}) error {
 	fields := []firestore.Update{}
+	reason := ""
 
-	// Get the 2 allowed fields that can be updated
+	// Get the allowed fields that can be updated
 	for k, v := range json {
 		if strings.EqualFold(k, "url") {
 			fields = append(fields, firestore.Update{Path: k, Value: v})
@@ -90,14 +101,109 @@ func (r *urlRepository) Update(ctx context.Context, id string, json map[string]i
 		if strings.EqualFold(k, "enable") {
 			fields = append(fields, firestore.Update{Path: k, Value: v})
 		}
+		// Only set by the service when a new destination waits for moderation
+		if strings.EqualFold(k, "moderation") {
+			reason, _ = v.(string)
+			fields = append(fields, firestore.Update{Path: "moderation", Value: v})
+		}
+		if strings.EqualFold(k, "fallbackUrl") {
+			if v == nil || v == "" {
+				v = firestore.Delete
+			}
+			fields = append(fields, firestore.Update{Path: "fallbackUrl", Value: v})
+		}
+		if strings.EqualFold(k, "redirectType") {
+			if v == nil || v == "" {
+				v = firestore.Delete
+			}
+			fields = append(fields, firestore.Update{Path: "redirectType", Value: v})
+		}
+		if strings.EqualFold(k, "forwardQuery") {
+			fields = append(fields, firestore.Update{Path: "forwardQuery", Value: v})
+		}
+		if strings.EqualFold(k, "forwardPath") {
+			fields = append(fields, firestore.Update{Path: "forwardPath", Value: v})
+		}
+		if strings.EqualFold(k, "queryConflict") {
+			if v == nil || v == "" {
+				v = firestore.Delete
+			}
+			fields = append(fields, firestore.Update{Path: "queryConflict", Value: v})
+		}
+		if strings.EqualFold(k, "utm") {
+			if utm, ok := v.(*model.Utm); v == nil || (ok && utm == nil) {
+				v = firestore.Delete
+			}
+			fields = append(fields, firestore.Update{Path: "utm", Value: v})
+		}
+		if strings.EqualFold(k, "utmTemplate") {
+			if v == nil || v == "" {
+				v = firestore.Delete
+			}
+			fields = append(fields, firestore.Update{Path: "utmTemplate", Value: v})
+		}
+		if strings.EqualFold(k, "variants") {
+			if v == nil {
+				v = firestore.Delete
+			}
+			fields = append(fields, firestore.Update{Path: "variants", Value: v})
+		}
+		if strings.EqualFold(k, "stickyVariant") {
+			fields = append(fields, firestore.Update{Path: "stickyVariant", Value: v})
+		}
+		if strings.EqualFold(k, "geo") {
+			if v == nil {
+				v = firestore.Delete
+			}
+			fields = append(fields, firestore.Update{Path: "geo", Value: v})
+		}
+		if strings.EqualFold(k, "devices") {
+			if v == nil {
+				v = firestore.Delete
+			}
+			fields = append(fields, firestore.Update{Path: "devices", Value: v})
+		}
+		if strings.EqualFold(k, "languages") {
+			if v == nil {
+				v = firestore.Delete
+			}
+			fields = append(fields, firestore.Update{Path: "languages", Value: v})
+		}
+		if strings.EqualFold(k, "activeFrom") {
+			if v == nil {
+				v = firestore.Delete
+			}
+			fields = append(fields, firestore.Update{Path: "activeFrom", Value: v})
+		}
+		if strings.EqualFold(k, "activeUntil") {
+			if v == nil {
+				v = firestore.Delete
+			}
+			fields = append(fields, firestore.Update{Path: "activeUntil", Value: v})
+		}
+		if strings.EqualFold(k, "schedule") {
+			if v == nil {
+				v = firestore.Delete
+			}
+			fields = append(fields, firestore.Update{Path: "schedule", Value: v})
+		}
+		if strings.EqualFold(k, "rules") {
+			if v == nil {
+				v = firestore.Delete
+			}
+			fields = append(fields, firestore.Update{Path: "rules", Value: v})
+		}
 	}
 	if len(fields) <= 0 {
 		r.log.Info("No attribute to update to Id: %v", id)
 		return nil
 	}
 
-	_, err := r.fdb.Collection(urlCollection).Doc(id).Update(ctx, fields)
-	if err != nil {
+	batch := r.fdb.Batch()
+	batch.Update(r.fdb.Collection(urlCollection).Doc(id), fields)
+	r.addEvent(batch, updateEvent(id, fields, reason))
+
+	if _, err := batch.Commit(ctx); err != nil {
 		if status.Code(err) == codes.NotFound {
 			return &model.DocumentNotFoundError{Id: id}
 		}
@@ -132,6 +238,22 @@ func (r *urlRepository) GetStats(ctx context.Context, limit int) ([]model.ShortU
 	return shortUrls, nil
 }
 
+func (r *urlRepository) SaveMetadata(ctx context.Context, id string, metadata *model.Metadata) error {
+	fields := []firestore.Update{{Path: "metadata", Value: metadata}}
+
+	_, err := r.fdb.Collection(urlCollection).Doc(id).Update(ctx, fields)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return &model.DocumentNotFoundError{Id: id}
+		}
+		return fmt.Errorf("SaveMetadata Id error. %w", err)
+	}
+	r.log.Info("Metadata saved to Id: %v", id)
+
+	go r.updateCache(id)
+	return nil
+}
+
 func (r *urlRepository) getFromNoSQL(ctx context.Context, id string) (*model.ShortUrl, error) {
 	var shortUrl model.ShortUrl
 
@@ -172,7 +294,11 @@ func (r *urlRepository) putInCache(shortUrl *model.ShortUrl) {
 	id := shortUrl.Id
 	duration := time.Duration(r.cacheTTL) * time.Minute
 
-	value, err := structToJson(shortUrl)
+	// Without the counters, so the url stays in cache while it is clicked
+	cached := *shortUrl
+	cached.Clicks, cached.VariantClicks = 0, nil
+
+	value, err := structToJson(&cached)
 	if err != nil {
 		r.log.Error("structToJson error for Id: %v. Cause: %s", id, err)
 		return
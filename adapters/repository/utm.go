@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"ehgm.com.br/url-shortener/domain/model"
+	"ehgm.com.br/url-shortener/domain/ports"
+
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"cloud.google.com/go/firestore"
+)
+
+var utmTemplateCollection = "utm-templates"
+
+// Struct that implements 'UtmRepository' interface, the templates are few and not cached
+type utmRepository struct {
+	log ports.Logger
+	fdb *firestore.Client
+}
+
+// Get an instance of 'UtmRepository' using this method
+func NewUtmRepository(log ports.Logger, fdb *firestore.Client) ports.UtmRepository {
+	return &utmRepository{log: log, fdb: fdb}
+}
+
+// Create or replace the template with the same name
+func (r *utmRepository) SaveTemplate(ctx context.Context, template *model.UtmTemplate) error {
+	_, err := r.fdb.Collection(utmTemplateCollection).Doc(template.Name).Set(ctx, template)
+	if err != nil {
+		return fmt.Errorf("SaveTemplate error. %w", err)
+	}
+	r.log.Info("UTM template saved: %v", template.Name)
+	return nil
+}
+
+func (r *utmRepository) FindTemplate(ctx context.Context, name string) (*model.UtmTemplate, error) {
+	var template model.UtmTemplate
+
+	dsnap, err := r.fdb.Collection(utmTemplateCollection).Doc(name).Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, &model.DocumentNotFoundError{Id: name}
+		}
+		return nil, fmt.Errorf("FindTemplate error. %w", err)
+	}
+
+	dsnap.DataTo(&template)
+	return &template, nil
+}
+
+func (r *utmRepository) GetTemplates(ctx context.Context, limit int) ([]model.UtmTemplate, error) {
+	templates := []model.UtmTemplate{}
+
+	iter := r.fdb.Collection(utmTemplateCollection).OrderBy("name", firestore.Asc).Limit(limit).Documents(ctx)
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return templates, fmt.Errorf("GetTemplates error on %v element. %w", len(templates), err)
+		}
+		temp := model.UtmTemplate{}
+		doc.DataTo(&temp)
+		templates = append(templates, temp)
+	}
+	return templates, nil
+}
+
+// Links keep the params copied from the template
+func (r *utmRepository) DeleteTemplate(ctx context.Context, name string) error {
+	_, err := r.fdb.Collection(utmTemplateCollection).Doc(name).Delete(ctx, firestore.Exists)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return &model.DocumentNotFoundError{Id: name}
+		}
+		return fmt.Errorf("DeleteTemplate error. %w", err)
+	}
+	r.log.Info("UTM template deleted: %v", name)
+	return nil
+}
@@ -0,0 +1,221 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"ehgm.com.br/url-shortener/domain/model"
+	"ehgm.com.br/url-shortener/domain/ports"
+
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"cloud.google.com/go/firestore"
+)
+
+var webhookCollection = "webhooks"
+
+// Deliveries of all webhooks, the dispatcher reads the due ones of every webhook
+var deliveryCollection = "webhookDeliveries"
+
+// Writes of a Firestore batch
+const maxBatchWrites = 500
+
+// Struct that implements 'WebhookRepository' interface, the webhooks are few and not cached
+type webhookRepository struct {
+	log ports.Logger
+	fdb *firestore.Client
+}
+
+// Get an instance of 'WebhookRepository' using this method
+func NewWebhookRepository(log ports.Logger, fdb *firestore.Client) ports.WebhookRepository {
+	return &webhookRepository{log: log, fdb: fdb}
+}
+
+func (r *webhookRepository) SaveWebhook(ctx context.Context, webhook *model.Webhook) error {
+	_, err := r.fdb.Collection(webhookCollection).Doc(webhook.Id).Create(ctx, webhook)
+	if err != nil {
+		if status.Code(err) == codes.AlreadyExists {
+			return &model.DocumentAlreadyExistsError{Id: webhook.Id, Url: webhook.Url}
+		}
+		return fmt.Errorf("SaveWebhook error. %w", err)
+	}
+	r.log.Info("Webhook saved: %v", webhook.Id)
+	return nil
+}
+
+func (r *webhookRepository) FindWebhook(ctx context.Context, id string) (*model.Webhook, error) {
+	var webhook model.Webhook
+
+	dsnap, err := r.fdb.Collection(webhookCollection).Doc(id).Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, &model.DocumentNotFoundError{Id: id}
+		}
+		return nil, fmt.Errorf("FindWebhook error. %w", err)
+	}
+
+	dsnap.DataTo(&webhook)
+	return &webhook, nil
+}
+
+func (r *webhookRepository) GetWebhooks(ctx context.Context, limit int) ([]model.Webhook, error) {
+	webhooks := []model.Webhook{}
+
+	iter := r.fdb.Collection(webhookCollection).OrderBy("createTime", firestore.Asc).Limit(limit).Documents(ctx)
+	defer iter.Stop()
+
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return webhooks, fmt.Errorf("GetWebhooks error on %v element. %w", len(webhooks), err)
+		}
+		temp := model.Webhook{}
+		doc.DataTo(&temp)
+		webhooks = append(webhooks, temp)
+	}
+	return webhooks, nil
+}
+
+func (r *webhookRepository) UpdateWebhook(ctx context.Context, webhook *model.Webhook) error {
+	var events interface{} = webhook.Events
+	if len(webhook.Events) <= 0 {
+		events = firestore.Delete
+	}
+
+	_, err := r.fdb.Collection(webhookCollection).Doc(webhook.Id).Update(ctx, []firestore.Update{
+		{Path: "url", Value: webhook.Url},
+		{Path: "events", Value: events},
+		{Path: "enable", Value: webhook.Enable},
+		{Path: "secret", Value: webhook.Secret},
+	})
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return &model.DocumentNotFoundError{Id: webhook.Id}
+		}
+		return fmt.Errorf("UpdateWebhook error. %w", err)
+	}
+	r.log.Info("Webhook updated: %v", webhook.Id)
+	return nil
+}
+
+// The deliveries are kept, they are removed by the TTL policy
+func (r *webhookRepository) DeleteWebhook(ctx context.Context, id string) error {
+	_, err := r.fdb.Collection(webhookCollection).Doc(id).Delete(ctx, firestore.Exists)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return &model.DocumentNotFoundError{Id: id}
+		}
+		return fmt.Errorf("DeleteWebhook error. %w", err)
+	}
+	r.log.Info("Webhook deleted: %v", id)
+	return nil
+}
+
+// Create the deliveries in batches, when a batch has an existing delivery they are created one by one
+func (r *webhookRepository) AddDeliveries(ctx context.Context, deliveries []model.WebhookDelivery) error {
+	for start := 0; start < len(deliveries); start += maxBatchWrites {
+		end := start + maxBatchWrites
+		if end > len(deliveries) {
+			end = len(deliveries)
+		}
+
+		batch := r.fdb.Batch()
+		for i := start; i < end; i++ {
+			batch.Create(r.fdb.Collection(deliveryCollection).Doc(deliveries[i].Id), &deliveries[i])
+		}
+		_, err := batch.Commit(ctx)
+		if status.Code(err) == codes.AlreadyExists {
+			err = r.addEach(ctx, deliveries[start:end])
+		}
+		if err != nil {
+			return fmt.Errorf("AddDeliveries error after %v deliveries. %w", start, err)
+		}
+	}
+	return nil
+}
+
+func (r *webhookRepository) addEach(ctx context.Context, deliveries []model.WebhookDelivery) error {
+	for i := range deliveries {
+		_, err := r.fdb.Collection(deliveryCollection).Doc(deliveries[i].Id).Create(ctx, &deliveries[i])
+		if err != nil && status.Code(err) != codes.AlreadyExists {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *webhookRepository) SaveDelivery(ctx context.Context, delivery *model.WebhookDelivery) error {
+	_, err := r.fdb.Collection(deliveryCollection).Doc(delivery.Id).Set(ctx, delivery)
+	if err != nil {
+		return fmt.Errorf("SaveDelivery error. %w", err)
+	}
+	return nil
+}
+
+func (r *webhookRepository) FindDelivery(ctx context.Context, id string) (*model.WebhookDelivery, error) {
+	var delivery model.WebhookDelivery
+
+	dsnap, err := r.fdb.Collection(deliveryCollection).Doc(id).Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, &model.DocumentNotFoundError{Id: id}
+		}
+		return nil, fmt.Errorf("FindDelivery error. %w", err)
+	}
+
+	dsnap.DataTo(&delivery)
+	return &delivery, nil
+}
+
+// Pending deliveries whose next attempt is due, the oldest first.
+// It needs a composite index of 'status' and 'nextAttempt' in the deliveries collection
+func (r *webhookRepository) DueDeliveries(ctx context.Context, now time.Time, limit int) ([]model.WebhookDelivery, error) {
+	query := r.fdb.Collection(deliveryCollection).Where("status", "==", model.DeliveryPending).
+		Where("nextAttempt", "<=", now).OrderBy("nextAttempt", firestore.Asc).Limit(limit)
+	deliveries, err := r.getDeliveries(ctx, query)
+	if err != nil {
+		return deliveries, fmt.Errorf("DueDeliveries error. %w", err)
+	}
+	return deliveries, nil
+}
+
+// Most recent deliveries of the webhook. It needs a composite index of 'webhookId' and 'createTime',
+// and another one with 'status' between them to filter by status
+func (r *webhookRepository) GetDeliveries(ctx context.Context, webhookId, deliveryStatus string, limit int) ([]model.WebhookDelivery, error) {
+	query := r.fdb.Collection(deliveryCollection).Where("webhookId", "==", webhookId)
+	if len(deliveryStatus) > 0 {
+		query = query.Where("status", "==", deliveryStatus)
+	}
+	deliveries, err := r.getDeliveries(ctx, query.OrderBy("createTime", firestore.Desc).Limit(limit))
+	if err != nil {
+		return deliveries, fmt.Errorf("GetDeliveries error. %w", err)
+	}
+	return deliveries, nil
+}
+
+func (r *webhookRepository) getDeliveries(ctx context.Context, query firestore.Query) ([]model.WebhookDelivery, error) {
+	deliveries := []model.WebhookDelivery{}
+
+	iter := query.Documents(ctx)
+	defer iter.Stop()
+
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return deliveries, fmt.Errorf("Read error on %v element. %w", len(deliveries), err)
+		}
+		temp := model.WebhookDelivery{}
+		doc.DataTo(&temp)
+		deliveries = append(deliveries, temp)
+	}
+	return deliveries, nil
+}
@@ -0,0 +1,130 @@
+package spool
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"ehgm.com.br/url-shortener/domain/model"
+)
+
+// Each record has the payload size and its CRC-32C before the payload
+const headerBytes = 8
+
+// Larger records are not written by the spool, a larger size means the header is corrupted
+const maxRecordBytes = 64 << 10
+
+const (
+	segmentExt = ".seg"
+	cursorExt  = ".cursor"
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+var errCorrupted = errors.New("record checksum does not match")
+
+func encodeRecord(payload []byte) []byte {
+	record := make([]byte, headerBytes+len(payload))
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(record[4:8], crc32.Checksum(payload, crcTable))
+	copy(record[headerBytes:], payload)
+	return record
+}
+
+// Next payload of the reader and the record size, the size is zero at the end of the segment.
+// An incomplete record at the end is an error, it was being written when the process stopped
+func readRecord(reader *bufio.Reader) ([]byte, int64, error) {
+	header := make([]byte, headerBytes)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		if err == io.EOF {
+			return nil, 0, nil
+		}
+		return nil, 0, fmt.Errorf("incomplete record header. %w", err)
+	}
+
+	size := binary.BigEndian.Uint32(header[0:4])
+	if size > maxRecordBytes {
+		return nil, 0, fmt.Errorf("record of %v bytes. %w", size, errCorrupted)
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		return nil, 0, fmt.Errorf("incomplete record. %w", err)
+	}
+	if crc32.Checksum(payload, crcTable) != binary.BigEndian.Uint32(header[4:8]) {
+		return nil, 0, errCorrupted
+	}
+	return payload, int64(headerBytes + len(payload)), nil
+}
+
+// At most 'limit' events and their size, the events before a corrupted record are returned with the error
+func readBatch(reader *bufio.Reader, limit int) ([]*model.ClickEvent, int64, error) {
+	events := []*model.ClickEvent{}
+	var total int64
+	for len(events) < limit {
+		payload, size, err := readRecord(reader)
+		if err != nil {
+			return events, total, err
+		}
+		if size <= 0 {
+			break
+		}
+
+		var event model.ClickEvent
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return events, total, fmt.Errorf("Decode spool event error. %w", err)
+		}
+		events = append(events, &event)
+		total += size
+	}
+	return events, total, nil
+}
+
+// Number of complete records after 'offset'
+func countRecords(path string, offset int64) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+	reader := bufio.NewReader(file)
+
+	var count int64
+	for {
+		_, size, err := readRecord(reader)
+		if err != nil {
+			return count, err
+		}
+		if size <= 0 {
+			return count, nil
+		}
+		count++
+	}
+}
+
+// The names sort in the order of the segments
+func segmentName(seq uint64) string {
+	return fmt.Sprintf("%016d%v", seq, segmentExt)
+}
+
+func cursorName(seq uint64) string {
+	return fmt.Sprintf("%016d%v", seq, cursorExt)
+}
+
+func parseSegmentName(name string) (uint64, bool) {
+	if !strings.HasSuffix(name, segmentExt) {
+		return 0, false
+	}
+	seq, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 10, 64)
+	return seq, err == nil
+}
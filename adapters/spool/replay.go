@@ -0,0 +1,66 @@
+package spool
+
+import (
+	"context"
+	"time"
+
+	"ehgm.com.br/url-shortener/domain/model"
+	"ehgm.com.br/url-shortener/domain/ports"
+)
+
+// The spool is replayed after this delay, it doubles after each failure up to the maximum
+const (
+	minReplayDelay = time.Second
+	maxReplayDelay = 5 * time.Minute
+)
+
+// Publish the spooled clicks with 'publish' until 'stop' is closed, waiting longer after each failure
+// while the broker is down. Returns at once when there is no spool
+func RunReplay(log ports.Logger,
+	clickSpool ports.ClickSpool,
+	publish func(ctx context.Context, events []*model.ClickEvent) error,
+	stop <-chan struct{}) {
+
+	if clickSpool == nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-stop
+		cancel()
+	}()
+
+	delay := minReplayDelay
+	for {
+		select {
+		case <-stop:
+			return
+		case <-time.After(delay):
+		}
+
+		if clickSpool.Status().Events <= 0 {
+			delay = minReplayDelay
+			continue
+		}
+		published, err := clickSpool.Replay(ctx, publish)
+		if published > 0 {
+			log.Info("Published %v spooled clicks", published)
+		}
+		if err != nil {
+			delay = nextReplayDelay(delay)
+			log.Error("Failed to publish the spooled clicks, trying again in %v. Cause: %s", delay, err)
+			continue
+		}
+		delay = minReplayDelay
+	}
+}
+
+func nextReplayDelay(delay time.Duration) time.Duration {
+	delay *= 2
+	if delay > maxReplayDelay {
+		return maxReplayDelay
+	}
+	return delay
+}
@@ -0,0 +1,316 @@
+package spool
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"ehgm.com.br/url-shortener/domain/model"
+	"ehgm.com.br/url-shortener/domain/ports"
+)
+
+// A new segment is started when the current one reaches this size, replayed segments are removed whole
+const segmentBytes = 4 << 20
+
+// Events published together in a replay, the cursor is saved after each batch
+const replayBatch = 100
+
+// Spool segment, 'offset' is the size already replayed from its start
+type segment struct {
+	seq    uint64
+	size   int64
+	offset int64
+	events int64
+}
+
+// Struct that implements 'ClickSpool' interface
+type clickSpool struct {
+	log      ports.Logger
+	dir      string
+	maxBytes int64
+
+	mu        sync.Mutex
+	segments  []*segment
+	active    *os.File
+	bytes     int64
+	events    int64
+	dropped   int64
+	corrupted int64
+}
+
+// Get an instance of 'ClickSpool' using this method.
+// The events are appended to segment files in 'dir', at most 'maxBytes' are kept and the new events are dropped
+// when the spool is full. The segments of a previous run are replayed, a new segment is started for the new events
+func NewClickSpool(log ports.Logger, dir string, maxBytes int64) (ports.ClickSpool, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("Create spool directory error. %w", err)
+	}
+
+	s := &clickSpool{log: log, dir: dir, maxBytes: maxBytes}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *clickSpool) Append(event *model.ClickEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("Encode spool event error. %w", err)
+	}
+	record := encodeRecord(payload)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.bytes+int64(len(record)) > s.maxBytes {
+		s.dropped++
+		return fmt.Errorf("spool is full with %v bytes, click of Id: %v dropped", s.bytes, event.Id)
+	}
+
+	current := s.current()
+	if s.active == nil || current.size >= segmentBytes {
+		if err := s.roll(); err != nil {
+			return err
+		}
+		current = s.current()
+	}
+
+	// The record is on disk before the click is counted as spooled
+	if _, err := s.active.Write(record); err != nil {
+		return fmt.Errorf("Write spool segment error. %w", err)
+	}
+	if err := s.active.Sync(); err != nil {
+		return fmt.Errorf("Sync spool segment error. %w", err)
+	}
+	current.size += int64(len(record))
+	current.events++
+	s.bytes += int64(len(record))
+	s.events++
+	return nil
+}
+
+// Publish the events from the oldest segment until the spool is empty or 'publish' fails, returns the published events.
+// A batch that fails is published again in the next replay, so the events are published at least once
+func (s *clickSpool) Replay(ctx context.Context, publish func(ctx context.Context, events []*model.ClickEvent) error) (int, error) {
+	published := 0
+	for {
+		next := s.sealOldest()
+		if next == nil {
+			return published, nil
+		}
+
+		n, err := s.replaySegment(ctx, next, publish)
+		published += n
+		if err != nil {
+			return published, err
+		}
+		if err := s.remove(next); err != nil {
+			return published, err
+		}
+	}
+}
+
+func (s *clickSpool) Status() *model.SpoolStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return &model.SpoolStatus{Events: s.events, Bytes: s.bytes, Segments: len(s.segments), MaxBytes: s.maxBytes,
+		Dropped: s.dropped, Corrupted: s.corrupted}
+}
+
+// Oldest segment to replay, the current one is closed so the new events go to a new segment
+func (s *clickSpool) sealOldest() *segment {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.segments) <= 0 {
+		return nil
+	}
+	oldest := s.segments[0]
+	if oldest == s.current() && s.active != nil {
+		if oldest.events <= 0 {
+			return nil
+		}
+		if err := s.active.Close(); err != nil {
+			s.log.Error("Close spool segment error: %v. Cause: %s", oldest.seq, err)
+		}
+		s.active = nil
+	}
+	return oldest
+}
+
+func (s *clickSpool) replaySegment(ctx context.Context, seg *segment,
+	publish func(ctx context.Context, events []*model.ClickEvent) error) (int, error) {
+
+	file, err := os.Open(s.segmentPath(seg.seq))
+	if err != nil {
+		return 0, fmt.Errorf("Open spool segment error. %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Seek(seg.offset, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("Seek spool segment error. %w", err)
+	}
+	reader := bufio.NewReader(file)
+
+	published := 0
+	offset := seg.offset
+	for {
+		events, size, err := readBatch(reader, replayBatch)
+		if len(events) > 0 {
+			if err := publish(ctx, events); err != nil {
+				return published, fmt.Errorf("Publish spooled events error. %w", err)
+			}
+			published += len(events)
+		}
+		offset += size
+		s.advance(seg, offset, int64(len(events)))
+
+		if err != nil {
+			// The rest of the segment cannot be read, it is removed with the replayed events
+			s.log.Error("Skipping the rest of spool segment: %v at offset %v. Cause: %s", seg.seq, offset, err)
+			s.mu.Lock()
+			s.corrupted++
+			s.mu.Unlock()
+			return published, nil
+		}
+		if size <= 0 {
+			return published, nil
+		}
+		if err := s.saveCursor(seg.seq, offset); err != nil {
+			s.log.Error("Save spool cursor error: %v. Cause: %s", seg.seq, err)
+		}
+	}
+}
+
+// Events of the segment that were published, the segment size is kept until it is removed
+func (s *clickSpool) advance(seg *segment, offset, events int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seg.offset = offset
+	seg.events -= events
+	s.events -= events
+}
+
+func (s *clickSpool) remove(seg *segment) error {
+	if err := os.Remove(s.segmentPath(seg.seq)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Remove spool segment error. %w", err)
+	}
+	if err := os.Remove(s.cursorPath(seg.seq)); err != nil && !os.IsNotExist(err) {
+		s.log.Error("Remove spool cursor error: %v. Cause: %s", seg.seq, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.bytes -= seg.size
+	s.events -= seg.events
+	for i, other := range s.segments {
+		if other == seg {
+			s.segments = append(s.segments[:i], s.segments[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// The segment receiving the new events, nil when there is none
+func (s *clickSpool) current() *segment {
+	if len(s.segments) <= 0 {
+		return nil
+	}
+	return s.segments[len(s.segments)-1]
+}
+
+// Start a new segment after the last one
+func (s *clickSpool) roll() error {
+	if s.active != nil {
+		if err := s.active.Close(); err != nil {
+			s.log.Error("Close spool segment error. Cause: %s", err)
+		}
+		s.active = nil
+	}
+
+	seq := uint64(1)
+	if last := s.current(); last != nil {
+		seq = last.seq + 1
+	}
+	file, err := os.OpenFile(s.segmentPath(seq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("Create spool segment error. %w", err)
+	}
+	s.active = file
+	s.segments = append(s.segments, &segment{seq: seq})
+	return nil
+}
+
+// Read the segments of a previous run, their last record may be incomplete when the process was killed
+func (s *clickSpool) load() error {
+	paths, err := filepath.Glob(filepath.Join(s.dir, "*"+segmentExt))
+	if err != nil {
+		return fmt.Errorf("List spool segments error. %w", err)
+	}
+
+	for _, path := range paths {
+		seq, ok := parseSegmentName(filepath.Base(path))
+		if !ok {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("Stat spool segment error. %w", err)
+		}
+		seg := &segment{seq: seq, size: info.Size(), offset: s.loadCursor(seq)}
+		if seg.events, err = countRecords(path, seg.offset); err != nil {
+			s.log.Error("Spool segment %v has a corrupted record after %v events. Cause: %s", seq, seg.events, err)
+		}
+		s.segments = append(s.segments, seg)
+		s.bytes += seg.size
+		s.events += seg.events
+	}
+	sort.Slice(s.segments, func(i, j int) bool { return s.segments[i].seq < s.segments[j].seq })
+
+	if s.events > 0 {
+		s.log.Info("Spool has %v click events of a previous run in %v segments", s.events, len(s.segments))
+	}
+	return nil
+}
+
+func (s *clickSpool) saveCursor(seq uint64, offset int64) error {
+	path := s.cursorPath(seq)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(fmt.Sprint(offset)), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// The cursor is lost when it cannot be read, the segment is replayed from its start
+func (s *clickSpool) loadCursor(seq uint64) int64 {
+	data, err := os.ReadFile(s.cursorPath(seq))
+	if err != nil {
+		return 0
+	}
+	var offset int64
+	if _, err := fmt.Sscan(string(data), &offset); err != nil || offset < 0 {
+		s.log.Error("Invalid spool cursor of segment: %v, replaying it from the start", seq)
+		return 0
+	}
+	return offset
+}
+
+func (s *clickSpool) segmentPath(seq uint64) string {
+	return filepath.Join(s.dir, segmentName(seq))
+}
+
+func (s *clickSpool) cursorPath(seq uint64) string {
+	return filepath.Join(s.dir, cursorName(seq))
+}
@@ -0,0 +1,176 @@
+package spool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"ehgm.com.br/url-shortener/domain/model"
+)
+
+// Empty Logger
+type loggerMock struct{}
+
+func (l *loggerMock) Info(format string, v ...interface{})  {}
+func (l *loggerMock) Error(format string, v ...interface{}) {}
+func (l *loggerMock) Fatal(format string, v ...interface{}) {}
+
+// Keeps the ids of the published events, fails the first 'failures' batches
+type publisherMock struct {
+	failures int
+	ids      []string
+}
+
+func (p *publisherMock) publish(ctx context.Context, events []*model.ClickEvent) error {
+	if p.failures > 0 {
+		p.failures--
+		return errors.New("broker unavailable")
+	}
+	for _, event := range events {
+		p.ids = append(p.ids, event.Id)
+	}
+	return nil
+}
+
+func appendIds(t *testing.T, spool interface{ Append(*model.ClickEvent) error }, ids ...string) {
+	for _, id := range ids {
+		if err := spool.Append(&model.ClickEvent{Version: model.ClickEventVersion, Id: id}); err != nil {
+			t.Fatalf("Output is: %s. But should not has error", err)
+		}
+	}
+}
+
+func TestClickSpool(t *testing.T) {
+	type Input struct {
+		ids      []string
+		failures int
+		replays  int
+	}
+
+	type Output struct {
+		published []string
+		events    int64
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Should replay the events in order": {
+			Input{ids: []string{"a", "b", "c"}, replays: 1},
+			Output{published: []string{"a", "b", "c"}, events: 0}},
+
+		"Test 02 - Should keep the events when the broker fails": {
+			Input{ids: []string{"a", "b"}, failures: 1, replays: 1},
+			Output{published: nil, events: 2}},
+
+		"Test 03 - Should publish them when the broker recovers": {
+			Input{ids: []string{"a", "b"}, failures: 1, replays: 2},
+			Output{published: []string{"a", "b"}, events: 0}},
+	}
+
+	ctx := context.Background()
+
+	for i, test := range tests {
+		spool, err := NewClickSpool(&loggerMock{}, t.TempDir(), 1<<20)
+		if err != nil {
+			t.Fatalf("#%s: Output is: %s. But should not has error", i, err)
+		}
+		appendIds(t, spool, test.input.ids...)
+
+		publisher := &publisherMock{failures: test.input.failures}
+		for r := 0; r < test.input.replays; r++ {
+			spool.Replay(ctx, publisher.publish)
+		}
+
+		if !reflect.DeepEqual(publisher.ids, test.output.published) {
+			t.Errorf("#%s: Output is: %v. But should be: %v", i, publisher.ids, test.output.published)
+		}
+		if status := spool.Status(); status.Events != test.output.events {
+			t.Errorf("#%s: Output is: %v events. But should be: %v", i, status.Events, test.output.events)
+		}
+	}
+}
+
+func TestClickSpoolRestart(t *testing.T) {
+	dir := t.TempDir()
+	spool, err := NewClickSpool(&loggerMock{}, dir, 1<<20)
+	if err != nil {
+		t.Fatalf("Output is: %s. But should not has error", err)
+	}
+	appendIds(t, spool, "a", "b")
+
+	// The events of a previous run are replayed by the next one
+	restarted, err := NewClickSpool(&loggerMock{}, dir, 1<<20)
+	if err != nil {
+		t.Fatalf("Output is: %s. But should not has error", err)
+	}
+	appendIds(t, restarted, "c")
+	if status := restarted.Status(); status.Events != 3 || status.Segments != 2 {
+		t.Errorf("Output is: %v. But should have 3 events in 2 segments", status)
+	}
+
+	publisher := &publisherMock{}
+	if _, err := restarted.Replay(context.Background(), publisher.publish); err != nil {
+		t.Errorf("Output is: %s. But should not has error", err)
+	}
+	expected := []string{"a", "b", "c"}
+	if !reflect.DeepEqual(publisher.ids, expected) {
+		t.Errorf("Output is: %v. But should be: %v", publisher.ids, expected)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*"+segmentExt)); len(files) != 0 {
+		t.Errorf("Output is: %v. But the replayed segments should be removed", files)
+	}
+}
+
+func TestClickSpoolCorrupted(t *testing.T) {
+	dir := t.TempDir()
+	spool, err := NewClickSpool(&loggerMock{}, dir, 1<<20)
+	if err != nil {
+		t.Fatalf("Output is: %s. But should not has error", err)
+	}
+	appendIds(t, spool, "a", "b")
+
+	// A byte of the second record changes, and a record is left incomplete at the end
+	path := filepath.Join(dir, segmentName(1))
+	data, _ := os.ReadFile(path)
+	size := len(data) / 2
+	data[size+headerBytes+2] ^= 0xff
+	data = append(data, encodeRecord([]byte(`{"id":"c"}`))[:5]...)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("Output is: %s. But should not has error", err)
+	}
+
+	restarted, err := NewClickSpool(&loggerMock{}, dir, 1<<20)
+	if err != nil {
+		t.Fatalf("Output is: %s. But should not has error", err)
+	}
+	publisher := &publisherMock{}
+	restarted.Replay(context.Background(), publisher.publish)
+
+	status := restarted.Status()
+	if !reflect.DeepEqual(publisher.ids, []string{"a"}) || status.Corrupted != 1 || status.Events != 0 {
+		t.Errorf("Output is: %v %v. But should publish only the valid record", publisher.ids, status)
+	}
+}
+
+func TestClickSpoolMaxSize(t *testing.T) {
+	payload, _ := json.Marshal(&model.ClickEvent{Version: model.ClickEventVersion, Id: "a"})
+	record := int64(len(encodeRecord(payload)))
+	spool, err := NewClickSpool(&loggerMock{}, t.TempDir(), 2*record)
+	if err != nil {
+		t.Fatalf("Output is: %s. But should not has error", err)
+	}
+	appendIds(t, spool, "a", "b")
+
+	if err := spool.Append(&model.ClickEvent{Version: model.ClickEventVersion, Id: "c"}); err == nil {
+		t.Errorf("Output is: %v. But should has error", err)
+	}
+	if status := spool.Status(); status.Events != 2 || status.Dropped != 1 || status.Bytes > status.MaxBytes {
+		t.Errorf("Output is: %v. But should keep 2 events and drop 1", status)
+	}
+}
@@ -0,0 +1,69 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"ehgm.com.br/url-shortener/domain/model"
+	"ehgm.com.br/url-shortener/domain/ports"
+)
+
+// Bytes of the response read before closing it, so the connection can be reused
+const maxResponseBytes = 4096
+
+// Struct that implements 'WebhookSender' interface
+type webhookSender struct {
+	log    ports.Logger
+	client *http.Client
+}
+
+// Get an instance of 'WebhookSender' using this method.
+// The payload is sent with a POST, the delivery succeeds with any 2xx status
+func NewWebhookSender(log ports.Logger, client *http.Client) ports.WebhookSender {
+	return &webhookSender{log: log, client: client}
+}
+
+// The signature header is 't=<unix seconds>,v1=<hex HMAC-SHA256 of "<seconds>.<payload>">', the receivers
+// check it with their secret and reject old timestamps, so a captured request cannot be replayed later
+func (s *webhookSender) Send(ctx context.Context, webhook *model.Webhook, delivery *model.WebhookDelivery) (int, error) {
+	timestamp := time.Now().Unix()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.Url, strings.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "url-shortener-webhooks/1.0")
+	req.Header.Set("X-Webhook-Id", delivery.EventId)
+	req.Header.Set("X-Webhook-Event", delivery.Type)
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Webhook-Signature", signature(webhook.Secret, timestamp, delivery.Payload))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, maxResponseBytes))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook answered with status %v", resp.StatusCode)
+	}
+	s.log.Info("Delivery %v sent to webhook %v", delivery.Id, webhook.Id)
+	return resp.StatusCode, nil
+}
+
+func signature(secret string, timestamp int64, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.%s", timestamp, payload)
+	return fmt.Sprintf("t=%d,v1=%s", timestamp, hex.EncodeToString(mac.Sum(nil)))
+}
@@ -0,0 +1,96 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"ehgm.com.br/url-shortener/config"
+	"ehgm.com.br/url-shortener/domain/model"
+)
+
+// Empty Logger
+type loggerMock struct{}
+
+func (l *loggerMock) Info(format string, v ...interface{})  {}
+func (l *loggerMock) Error(format string, v ...interface{}) {}
+func (l *loggerMock) Fatal(format string, v ...interface{}) {}
+
+// Receiver that checks the signature like the integrations should, answers with 'status'
+func newReceiver(secret string, status int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		timestamp := r.Header.Get("X-Webhook-Timestamp")
+		seconds, _ := strconv.ParseInt(timestamp, 10, 64)
+
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(timestamp + "." + string(body)))
+		expected := "t=" + timestamp + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+
+		if !hmac.Equal([]byte(r.Header.Get("X-Webhook-Signature")), []byte(expected)) ||
+			time.Since(time.Unix(seconds, 0)) > 5*time.Minute {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Header.Get("X-Webhook-Id") != "e1" || r.Header.Get("X-Webhook-Event") != model.LinkCreated {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(status)
+	}))
+}
+
+func TestSend(t *testing.T) {
+	type Input struct {
+		secret string
+		status int
+	}
+
+	type Output struct {
+		status   int
+		hasError bool
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Should be accepted with a valid signature": {
+			Input{secret: "whsec_1q2w3e", status: http.StatusNoContent},
+			Output{status: http.StatusNoContent, hasError: false}},
+
+		"Test 02 - Should fail with other secret": {
+			Input{secret: "whsec_other", status: http.StatusOK},
+			Output{status: http.StatusUnauthorized, hasError: true}},
+
+		"Test 03 - Should fail when the receiver fails": {
+			Input{secret: "whsec_1q2w3e", status: http.StatusServiceUnavailable},
+			Output{status: http.StatusServiceUnavailable, hasError: true}},
+	}
+
+	sender := NewWebhookSender(&loggerMock{}, config.NewHttpClient(time.Second, 0, true))
+	delivery := &model.WebhookDelivery{Id: "w1-e1", WebhookId: "w1", EventId: "e1", Type: model.LinkCreated,
+		Payload: `{"id":"e1","type":"link.created","data":{"linkId":"0aYS7JJ"}}`}
+
+	for i, test := range tests {
+		receiver := newReceiver("whsec_1q2w3e", test.input.status)
+		webhook := &model.Webhook{Id: "w1", Url: receiver.URL, Secret: test.input.secret}
+
+		status, err := sender.Send(context.Background(), webhook, delivery)
+		receiver.Close()
+
+		if test.output.hasError != (err != nil) {
+			t.Errorf("#%s: Output is: %v. But should has error: %v", i, err, test.output.hasError)
+		}
+		if status != test.output.status {
+			t.Errorf("#%s: Output is: %v. But should be: %v", i, status, test.output.status)
+		}
+	}
+}
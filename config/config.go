@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
 
 	"ehgm.com.br/url-shortener/domain/ports"
 )
@@ -14,8 +15,91 @@ type EnvConfig struct {
 	RedisTTL    int
 	PubsubTopic string
 	IdLength    int
+
+	BlocklistFiles []string
+	AllowlistFiles []string
+	ListsReload    int
+
+	ProtectedBrands    []string
+	ModerateLookalikes bool
+	LookalikeDistance  int
+
+	AdminToken      string
+	ReportThreshold int64
+	ReportRateLimit int
+	BulkBatchSize   int
+
+	MetadataTimeout      int
+	MetadataMaxBytes     int64
+	MetadataMaxRedirects int
+
+	HealthInterval     int
+	HealthConcurrency  int
+	HealthHostDelay    int
+	HealthTimeout      int
+	HealthMaxRedirects int
+	HealthFailures     int
+
+	RedirectType   string
+	RedirectMaxAge int
+
+	GeoIpFile      string
+	GeoIpReload    int
+	TrustedProxies []string
+
+	RunMode            string
+	PubsubSubscription string
+	ConsumerWindow     int
+	ConsumerBatchSize  int
+
+	ClickCounter     string
+	ClickFormat      string
+	CounterQueueSize int
+	CounterBatchSize int
+	CounterInterval  int
+
+	SpoolDir     string
+	SpoolMaxSize int
+
+	NatsUrl      string
+	NatsStream   string
+	NatsSubject  string
+	KafkaBrokers []string
+	KafkaTopic   string
+
+	EventsTopic      string
+	RelayInterval    int
+	RelayBatchSize   int
+	RelayMaxAttempts int
+
+	WebhookTimeout     int
+	WebhookMaxAttempts int
 }
 
+// Where the clicks are sent, one event for each click or the counts of each url aggregated in memory
+const (
+	CounterPubSub      = "pubsub"
+	CounterPubSubBatch = "pubsub-batch"
+	CounterFirestore   = "firestore"
+	CounterRedis       = "redis"
+	CounterNats        = "nats"
+	CounterKafka       = "kafka"
+)
+
+// Data of the click messages published one by one to Pub/Sub, only the id is read by the older consumers
+const (
+	ClickFormatId   = "id"
+	ClickFormatJson = "json"
+)
+
+// Run modes of the binary, the consumer saves the clicks published by the servers
+// and the relay publishes the link events saved by them
+const (
+	RunModeServer   = "server"
+	RunModeConsumer = "consumer"
+	RunModeRelay    = "relay"
+)
+
 func NewEnvConfig(log ports.Logger) EnvConfig {
 	log.Info("Starting NewEnvConfig ...")
 
@@ -25,6 +109,52 @@ func NewEnvConfig(log ports.Logger) EnvConfig {
 	redisTTL := os.Getenv("REDIS_TTL")
 	psTopic := os.Getenv("PUBSUB_TOPIC")
 	idLenght := os.Getenv("ID_LENGHT")
+	blocklistFiles := os.Getenv("BLOCKLIST_FILES")
+	allowlistFiles := os.Getenv("ALLOWLIST_FILES")
+	listsReload := os.Getenv("LISTS_RELOAD")
+	protectedBrands := os.Getenv("PROTECTED_BRANDS")
+	lookalikeMode := os.Getenv("LOOKALIKE_MODE")
+	lookalikeDistance := os.Getenv("LOOKALIKE_DISTANCE")
+	adminToken := os.Getenv("ADMIN_TOKEN")
+	reportThreshold := os.Getenv("REPORT_THRESHOLD")
+	reportRateLimit := os.Getenv("REPORT_RATE_LIMIT")
+	bulkBatchSize := os.Getenv("BULK_BATCH_SIZE")
+	metadataTimeout := os.Getenv("METADATA_TIMEOUT")
+	metadataMaxBytes := os.Getenv("METADATA_MAX_BYTES")
+	metadataMaxRedirects := os.Getenv("METADATA_MAX_REDIRECTS")
+	healthInterval := os.Getenv("HEALTH_INTERVAL")
+	healthConcurrency := os.Getenv("HEALTH_CONCURRENCY")
+	healthHostDelay := os.Getenv("HEALTH_HOST_DELAY")
+	healthTimeout := os.Getenv("HEALTH_TIMEOUT")
+	healthMaxRedirects := os.Getenv("HEALTH_MAX_REDIRECTS")
+	healthFailures := os.Getenv("HEALTH_FAILURES")
+	redirectType := os.Getenv("REDIRECT_TYPE")
+	redirectMaxAge := os.Getenv("REDIRECT_MAX_AGE")
+	geoIpFile := os.Getenv("GEOIP_DB")
+	geoIpReload := os.Getenv("GEOIP_RELOAD")
+	trustedProxies := os.Getenv("TRUSTED_PROXIES")
+	runMode := os.Getenv("RUN_MODE")
+	psSubscription := os.Getenv("PUBSUB_SUBSCRIPTION")
+	consumerWindow := os.Getenv("CONSUMER_WINDOW")
+	consumerBatchSize := os.Getenv("CONSUMER_BATCH_SIZE")
+	clickCounter := os.Getenv("CLICK_COUNTER")
+	clickFormat := os.Getenv("CLICK_FORMAT")
+	counterQueueSize := os.Getenv("COUNTER_QUEUE_SIZE")
+	counterBatchSize := os.Getenv("COUNTER_BATCH_SIZE")
+	counterInterval := os.Getenv("COUNTER_INTERVAL")
+	spoolDir := os.Getenv("SPOOL_DIR")
+	spoolMaxSize := os.Getenv("SPOOL_MAX_SIZE")
+	natsUrl := os.Getenv("NATS_URL")
+	natsStream := os.Getenv("NATS_STREAM")
+	natsSubject := os.Getenv("NATS_SUBJECT")
+	kafkaBrokers := os.Getenv("KAFKA_BROKERS")
+	kafkaTopic := os.Getenv("KAFKA_TOPIC")
+	eventsTopic := os.Getenv("EVENTS_TOPIC")
+	relayInterval := os.Getenv("RELAY_INTERVAL")
+	relayBatchSize := os.Getenv("RELAY_BATCH_SIZE")
+	relayMaxAttempts := os.Getenv("RELAY_MAX_ATTEMPTS")
+	webhookTimeout := os.Getenv("WEBHOOK_TIMEOUT")
+	webhookMaxAttempts := os.Getenv("WEBHOOK_MAX_ATTEMPTS")
 
 	if len(project) <= 0 {
 		log.Fatal("Failed to load PROJECT_ID environment variable")
@@ -41,6 +171,9 @@ func NewEnvConfig(log ports.Logger) EnvConfig {
 	if len(redisPass) <= 0 {
 		log.Info("Using an empty Redis password")
 	}
+	if len(adminToken) <= 0 {
+		log.Info("Admin endpoints are disabled, ADMIN_TOKEN is empty")
+	}
 
 	parsedIdLenght, err := strconv.Atoi(idLenght)
 	if err != nil {
@@ -56,6 +189,264 @@ func NewEnvConfig(log ports.Logger) EnvConfig {
 		log.Info("Using Redis TTL: %v", ttl)
 	}
 
+	defaultReload := 30
+	reload, err := strconv.Atoi(listsReload)
+	if err != nil {
+		reload = defaultReload
+		log.Info("Using default lists reload interval: %vs. Cause: %s", defaultReload, err)
+	}
+
+	defaultDistance := 1
+	distance, err := strconv.Atoi(lookalikeDistance)
+	if err != nil {
+		distance = defaultDistance
+		log.Info("Using default lookalike edit distance: %v. Cause: %s", defaultDistance, err)
+	}
+
+	// 'reject' is the default, 'moderate' creates the link disabled waiting for a moderator
+	moderate := strings.EqualFold(lookalikeMode, "moderate")
+	log.Info("Using lookalike moderation mode: %v", moderate)
+
+	defaultThreshold := int64(5)
+	threshold, err := strconv.ParseInt(reportThreshold, 10, 64)
+	if err != nil {
+		threshold = defaultThreshold
+		log.Info("Using default report threshold: %v. Cause: %s", defaultThreshold, err)
+	}
+
+	defaultReportRateLimit := 10
+	rateLimit, err := strconv.Atoi(reportRateLimit)
+	if err != nil || rateLimit <= 0 {
+		rateLimit = defaultReportRateLimit
+		log.Info("Using default report rate limit: %v. Cause: %s", defaultReportRateLimit, err)
+	}
+
+	defaultBatchSize := 100
+	batchSize, err := strconv.Atoi(bulkBatchSize)
+	if err != nil {
+		batchSize = defaultBatchSize
+		log.Info("Using default bulk batch size: %v. Cause: %s", defaultBatchSize, err)
+	}
+
+	defaultMetadataTimeout := 5
+	mTimeout, err := strconv.Atoi(metadataTimeout)
+	if err != nil {
+		mTimeout = defaultMetadataTimeout
+		log.Info("Using default metadata timeout: %vs. Cause: %s", defaultMetadataTimeout, err)
+	}
+
+	defaultMetadataMaxBytes := int64(512 * 1024)
+	mMaxBytes, err := strconv.ParseInt(metadataMaxBytes, 10, 64)
+	if err != nil {
+		mMaxBytes = defaultMetadataMaxBytes
+		log.Info("Using default metadata max bytes: %v. Cause: %s", defaultMetadataMaxBytes, err)
+	}
+
+	defaultMetadataMaxRedirects := 3
+	mMaxRedirects, err := strconv.Atoi(metadataMaxRedirects)
+	if err != nil {
+		mMaxRedirects = defaultMetadataMaxRedirects
+		log.Info("Using default metadata max redirects: %v. Cause: %s", defaultMetadataMaxRedirects, err)
+	}
+
+	// 0 disables the periodic health checker
+	defaultHealthInterval := 60
+	hInterval, err := strconv.Atoi(healthInterval)
+	if err != nil {
+		hInterval = defaultHealthInterval
+		log.Info("Using default health check interval: %vmin. Cause: %s", defaultHealthInterval, err)
+	}
+
+	defaultHealthConcurrency := 10
+	hConcurrency, err := strconv.Atoi(healthConcurrency)
+	if err != nil {
+		hConcurrency = defaultHealthConcurrency
+		log.Info("Using default health check concurrency: %v. Cause: %s", defaultHealthConcurrency, err)
+	}
+
+	defaultHealthHostDelay := 1000
+	hHostDelay, err := strconv.Atoi(healthHostDelay)
+	if err != nil {
+		hHostDelay = defaultHealthHostDelay
+		log.Info("Using default health check host delay: %vms. Cause: %s", defaultHealthHostDelay, err)
+	}
+
+	defaultHealthTimeout := 10
+	hTimeout, err := strconv.Atoi(healthTimeout)
+	if err != nil {
+		hTimeout = defaultHealthTimeout
+		log.Info("Using default health check timeout: %vs. Cause: %s", defaultHealthTimeout, err)
+	}
+
+	defaultHealthMaxRedirects := 5
+	hMaxRedirects, err := strconv.Atoi(healthMaxRedirects)
+	if err != nil || hMaxRedirects < 0 {
+		hMaxRedirects = defaultHealthMaxRedirects
+		log.Info("Using default health check max redirects: %v. Cause: %s", defaultHealthMaxRedirects, err)
+	}
+
+	defaultHealthFailures := 3
+	hFailures, err := strconv.Atoi(healthFailures)
+	if err != nil {
+		hFailures = defaultHealthFailures
+		log.Info("Using default health check failures before fallback: %v. Cause: %s", defaultHealthFailures, err)
+	}
+
+	// 301, 302, 307, 308 or html, links can override it
+	defaultRedirectType := "302"
+	if len(redirectType) <= 0 {
+		redirectType = defaultRedirectType
+		log.Info("Using default redirect type: %v", defaultRedirectType)
+	}
+
+	defaultRedirectMaxAge := 86400
+	rMaxAge, err := strconv.Atoi(redirectMaxAge)
+	if err != nil {
+		rMaxAge = defaultRedirectMaxAge
+		log.Info("Using default permanent redirect max age: %vs. Cause: %s", defaultRedirectMaxAge, err)
+	}
+
+	defaultGeoIpReload := 60
+	gReload, err := strconv.Atoi(geoIpReload)
+	if err != nil {
+		gReload = defaultGeoIpReload
+		log.Info("Using default GeoIP database reload interval: %vs. Cause: %s", defaultGeoIpReload, err)
+	}
+
+	// Without trusted proxies the client IP is the address of the connection
+	if len(trustedProxies) <= 0 {
+		log.Info("No trusted proxies, the X-Forwarded-For header is ignored")
+	}
+
+	if len(runMode) <= 0 {
+		runMode = RunModeServer
+	}
+	runMode = strings.ToLower(runMode)
+	if runMode != RunModeServer && runMode != RunModeConsumer && runMode != RunModeRelay {
+		log.Fatal("Failed to load RUN_MODE environment variable, use server, consumer or relay")
+	}
+	if runMode == RunModeConsumer && len(psSubscription) <= 0 {
+		log.Fatal("Failed to load PUBSUB_SUBSCRIPTION environment variable")
+	}
+	if runMode == RunModeRelay && len(eventsTopic) <= 0 {
+		log.Info("EVENTS_TOPIC not set, the link events are only sent to the webhooks")
+	}
+
+	defaultConsumerWindow := 10
+	cWindow, err := strconv.Atoi(consumerWindow)
+	if err != nil || cWindow <= 0 {
+		cWindow = defaultConsumerWindow
+		log.Info("Using default consumer window: %vs. Cause: %s", defaultConsumerWindow, err)
+	}
+
+	defaultConsumerBatchSize := 1000
+	cBatchSize, err := strconv.Atoi(consumerBatchSize)
+	if err != nil || cBatchSize <= 0 {
+		cBatchSize = defaultConsumerBatchSize
+		log.Info("Using default consumer batch size: %v. Cause: %s", defaultConsumerBatchSize, err)
+	}
+
+	if len(clickCounter) <= 0 {
+		clickCounter = CounterPubSub
+	}
+	clickCounter = strings.ToLower(clickCounter)
+	if clickCounter != CounterPubSub && clickCounter != CounterPubSubBatch && clickCounter != CounterFirestore &&
+		clickCounter != CounterRedis && clickCounter != CounterNats && clickCounter != CounterKafka {
+		log.Fatal("Failed to load CLICK_COUNTER environment variable, use pubsub, pubsub-batch, firestore, redis, nats or kafka")
+	}
+	log.Info("Using click counter: %v", clickCounter)
+
+	clickFormat = strings.ToLower(clickFormat)
+	if len(clickFormat) <= 0 {
+		clickFormat = ClickFormatId
+	}
+	if clickFormat != ClickFormatId && clickFormat != ClickFormatJson {
+		log.Fatal("Failed to load CLICK_FORMAT environment variable, use id or json")
+	}
+
+	defaultCounterQueueSize := 10000
+	cQueueSize, err := strconv.Atoi(counterQueueSize)
+	if err != nil || cQueueSize <= 0 {
+		cQueueSize = defaultCounterQueueSize
+		log.Info("Using default counter queue size: %v. Cause: %s", defaultCounterQueueSize, err)
+	}
+
+	defaultCounterBatchSize := 500
+	cCounterBatchSize, err := strconv.Atoi(counterBatchSize)
+	if err != nil || cCounterBatchSize <= 0 {
+		cCounterBatchSize = defaultCounterBatchSize
+		log.Info("Using default counter batch size: %v. Cause: %s", defaultCounterBatchSize, err)
+	}
+
+	defaultCounterInterval := 5
+	cInterval, err := strconv.Atoi(counterInterval)
+	if err != nil || cInterval <= 0 {
+		cInterval = defaultCounterInterval
+		log.Info("Using default counter flush interval: %vs. Cause: %s", defaultCounterInterval, err)
+	}
+
+	if len(natsUrl) <= 0 {
+		natsUrl = "nats://127.0.0.1:4222"
+	}
+	if len(natsStream) <= 0 {
+		natsStream = "CLICKS"
+	}
+	if len(natsSubject) <= 0 {
+		natsSubject = psTopic
+	}
+	if clickCounter == CounterKafka && len(splitList(kafkaBrokers)) <= 0 {
+		log.Fatal("Failed to load KAFKA_BROKERS environment variable, it is required by the kafka counter")
+	}
+	if len(kafkaTopic) <= 0 {
+		kafkaTopic = psTopic
+	}
+
+	if len(spoolDir) <= 0 {
+		log.Info("SPOOL_DIR not set, clicks that fail to be published are lost")
+	}
+	defaultSpoolMaxSize := 100
+	sMaxSize, err := strconv.Atoi(spoolMaxSize)
+	if err != nil || sMaxSize <= 0 {
+		sMaxSize = defaultSpoolMaxSize
+		log.Info("Using default spool max size: %vMB. Cause: %s", defaultSpoolMaxSize, err)
+	}
+
+	defaultRelayInterval := 5
+	rInterval, err := strconv.Atoi(relayInterval)
+	if err != nil || rInterval <= 0 {
+		rInterval = defaultRelayInterval
+		log.Info("Using default relay interval: %vs. Cause: %s", defaultRelayInterval, err)
+	}
+
+	// The delivered events are marked in one Firestore batch, limited to 500 writes
+	defaultRelayBatchSize := 100
+	rBatchSize, err := strconv.Atoi(relayBatchSize)
+	if err != nil || rBatchSize <= 0 || rBatchSize > 500 {
+		rBatchSize = defaultRelayBatchSize
+		log.Info("Using default relay batch size: %v. Cause: %s", defaultRelayBatchSize, err)
+	}
+
+	defaultRelayMaxAttempts := 10
+	rMaxAttempts, err := strconv.Atoi(relayMaxAttempts)
+	if err != nil || rMaxAttempts <= 0 {
+		rMaxAttempts = defaultRelayMaxAttempts
+		log.Info("Using default relay max attempts: %v. Cause: %s", defaultRelayMaxAttempts, err)
+	}
+
+	defaultWebhookTimeout := 10
+	wTimeout, err := strconv.Atoi(webhookTimeout)
+	if err != nil || wTimeout <= 0 {
+		wTimeout = defaultWebhookTimeout
+		log.Info("Using default webhook timeout: %vs. Cause: %s", defaultWebhookTimeout, err)
+	}
+
+	defaultWebhookMaxAttempts := 8
+	wMaxAttempts, err := strconv.Atoi(webhookMaxAttempts)
+	if err != nil || wMaxAttempts <= 0 {
+		wMaxAttempts = defaultWebhookMaxAttempts
+		log.Info("Using default webhook max attempts: %v. Cause: %s", defaultWebhookMaxAttempts, err)
+	}
+
 	return EnvConfig{
 		ProjectId:   project,
 		RedisHost:   redisHost,
@@ -63,5 +454,75 @@ func NewEnvConfig(log ports.Logger) EnvConfig {
 		RedisTTL:    ttl,
 		PubsubTopic: psTopic,
 		IdLength:    parsedIdLenght,
+
+		BlocklistFiles: splitList(blocklistFiles),
+		AllowlistFiles: splitList(allowlistFiles),
+		ListsReload:    reload,
+
+		ProtectedBrands:    splitList(protectedBrands),
+		ModerateLookalikes: moderate,
+		LookalikeDistance:  distance,
+
+		AdminToken:      adminToken,
+		ReportThreshold: threshold,
+		ReportRateLimit: rateLimit,
+		BulkBatchSize:   batchSize,
+
+		MetadataTimeout:      mTimeout,
+		MetadataMaxBytes:     mMaxBytes,
+		MetadataMaxRedirects: mMaxRedirects,
+
+		HealthInterval:     hInterval,
+		HealthConcurrency:  hConcurrency,
+		HealthHostDelay:    hHostDelay,
+		HealthTimeout:      hTimeout,
+		HealthMaxRedirects: hMaxRedirects,
+		HealthFailures:     hFailures,
+
+		RedirectType:   strings.ToLower(redirectType),
+		RedirectMaxAge: rMaxAge,
+
+		GeoIpFile:      geoIpFile,
+		GeoIpReload:    gReload,
+		TrustedProxies: splitList(trustedProxies),
+
+		RunMode:            runMode,
+		PubsubSubscription: psSubscription,
+		ConsumerWindow:     cWindow,
+		ConsumerBatchSize:  cBatchSize,
+
+		ClickCounter:     clickCounter,
+		ClickFormat:      clickFormat,
+		CounterQueueSize: cQueueSize,
+		CounterBatchSize: cCounterBatchSize,
+		CounterInterval:  cInterval,
+
+		SpoolDir:     spoolDir,
+		SpoolMaxSize: sMaxSize,
+
+		NatsUrl:      natsUrl,
+		NatsStream:   natsStream,
+		NatsSubject:  natsSubject,
+		KafkaBrokers: splitList(kafkaBrokers),
+		KafkaTopic:   kafkaTopic,
+
+		EventsTopic:      eventsTopic,
+		RelayInterval:    rInterval,
+		RelayBatchSize:   rBatchSize,
+		RelayMaxAttempts: rMaxAttempts,
+
+		WebhookTimeout:     wTimeout,
+		WebhookMaxAttempts: wMaxAttempts,
+	}
+}
+
+// Split a comma separated environment variable ignoring empty values
+func splitList(value string) []string {
+	values := []string{}
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); len(v) > 0 {
+			values = append(values, v)
+		}
 	}
+	return values
 }
@@ -0,0 +1,18 @@
+package config
+
+import (
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// The clicks of an id go to the same partition, a write succeeds when all in-sync replicas have it
+func NewKafkaWriter(brokers []string, topic string) *kafka.Writer {
+	return &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		BatchTimeout: 50 * time.Millisecond,
+	}
+}
@@ -0,0 +1,31 @@
+package config
+
+import (
+	"errors"
+
+	"ehgm.com.br/url-shortener/domain/ports"
+
+	"github.com/nats-io/nats.go"
+)
+
+// Connect to NATS and create the JetStream stream of the clicks when it does not exist
+func NewJetStream(log ports.Logger, url, stream, subject string) nats.JetStreamContext {
+	nc, err := nats.Connect(url, nats.Name("url-shortener"), nats.MaxReconnects(-1))
+	if err != nil {
+		log.Fatal("Failed to connect to NATS: %s", err)
+	}
+
+	js, err := nc.JetStream()
+	if err != nil {
+		log.Fatal("Failed to create JetStream context: %s", err)
+	}
+
+	_, err = js.StreamInfo(stream)
+	if errors.Is(err, nats.ErrStreamNotFound) {
+		_, err = js.AddStream(&nats.StreamConfig{Name: stream, Subjects: []string{subject}, Storage: nats.FileStorage})
+	}
+	if err != nil {
+		log.Fatal("Failed to load JetStream stream %v: %s", stream, err)
+	}
+	return js
+}
@@ -1,13 +1,456 @@
 package model
 
 import (
+	"strconv"
 	"time"
 )
 
+// Redirect types of a link, 'html' renders a page with a meta refresh and a script instead of a 3xx status
+const (
+	RedirectMoved     = "301"
+	RedirectFound     = "302"
+	RedirectTemporary = "307"
+	RedirectPermanent = "308"
+	RedirectHtml      = "html"
+)
+
+var RedirectTypes = map[string]bool{
+	RedirectMoved:     true,
+	RedirectFound:     true,
+	RedirectTemporary: true,
+	RedirectPermanent: true,
+	RedirectHtml:      true,
+}
+
+// Policies when a forwarded query param is also in the destination
+const (
+	QueryKeep     = "keep"
+	QueryOverride = "override"
+	QueryAppend   = "append"
+)
+
+var QueryConflicts = map[string]bool{
+	QueryKeep:     true,
+	QueryOverride: true,
+	QueryAppend:   true,
+}
+
+// Platforms of the visitors with their own destination, found in the User-Agent
+const (
+	PlatformIos     = "ios"
+	PlatformAndroid = "android"
+	PlatformDesktop = "desktop"
+)
+
+var Platforms = map[string]bool{
+	PlatformIos:     true,
+	PlatformAndroid: true,
+	PlatformDesktop: true,
+}
+
+// State of a link outside of its activation window at the time of the visit
+const (
+	WindowPending = "pending"
+	WindowExpired = "expired"
+)
+
 type ShortUrl struct {
 	Id         string    `json:"id" firestore:"id"`
 	Url        string    `json:"url" firestore:"url"`
 	CreateTime time.Time `json:"createTime,omitempty" firestore:"createTime,omitempty"`
 	Enable     bool      `json:"enable" firestore:"enable"`
 	Clicks     int64     `json:"clicks" firestore:"clicks"`
+	Moderation string    `json:"moderation,omitempty" firestore:"moderation,omitempty"`
+	Reports    int64     `json:"reports,omitempty" firestore:"reports,omitempty"`
+	Metadata   *Metadata `json:"metadata,omitempty" firestore:"metadata,omitempty"`
+
+	FallbackUrl string  `json:"fallbackUrl,omitempty" firestore:"fallbackUrl,omitempty"`
+	Health      *Health `json:"health,omitempty" firestore:"health,omitempty"`
+
+	RedirectType string `json:"redirectType,omitempty" firestore:"redirectType,omitempty"`
+
+	ForwardQuery  bool   `json:"forwardQuery,omitempty" firestore:"forwardQuery,omitempty"`
+	QueryConflict string `json:"queryConflict,omitempty" firestore:"queryConflict,omitempty"`
+	ForwardPath   bool   `json:"forwardPath,omitempty" firestore:"forwardPath,omitempty"`
+
+	Utm         *Utm   `json:"utm,omitempty" firestore:"utm,omitempty"`
+	UtmTemplate string `json:"utmTemplate,omitempty" firestore:"utmTemplate,omitempty"`
+
+	Variants      []Variant        `json:"variants,omitempty" firestore:"variants,omitempty"`
+	StickyVariant bool             `json:"stickyVariant,omitempty" firestore:"stickyVariant,omitempty"`
+	VariantClicks map[string]int64 `json:"variantClicks,omitempty" firestore:"variantClicks,omitempty"`
+
+	Geo     map[string]string     `json:"geo,omitempty" firestore:"geo,omitempty"`
+	Devices map[string]DeviceRule `json:"devices,omitempty" firestore:"devices,omitempty"`
+
+	Languages map[string]string `json:"languages,omitempty" firestore:"languages,omitempty"`
+
+	ActiveFrom  *time.Time     `json:"activeFrom,omitempty" firestore:"activeFrom,omitempty"`
+	ActiveUntil *time.Time     `json:"activeUntil,omitempty" firestore:"activeUntil,omitempty"`
+	Schedule    []ScheduledUrl `json:"schedule,omitempty" firestore:"schedule,omitempty"`
+
+	Rules []Rule `json:"rules,omitempty" firestore:"rules,omitempty"`
+}
+
+// A url not found in cache is empty, every saved url has a destination
+func (s *ShortUrl) IsEmpty() bool {
+	return len(s.Url) <= 0
+}
+
+// Destination of an A/B test, each visit gets a variant in proportion to its weight
+type Variant struct {
+	Id     string `json:"id" firestore:"id"`
+	Url    string `json:"url" firestore:"url"`
+	Weight int    `json:"weight" firestore:"weight"`
+}
+
+// Destination of a platform, the deep link opens the app and the url is used when it is not installed
+type DeviceRule struct {
+	Url      string `json:"url,omitempty" firestore:"url,omitempty"`
+	DeepLink string `json:"deepLink,omitempty" firestore:"deepLink,omitempty"`
+}
+
+// Future destination of a link, the url replaces the destination from the time on
+type ScheduledUrl struct {
+	At  time.Time `json:"at" firestore:"at"`
+	Url string    `json:"url" firestore:"url"`
+}
+
+// Ordered rule of a link, the first one whose condition is true chooses the destination
+type Rule struct {
+	Name string `json:"name,omitempty" firestore:"name,omitempty"`
+	When string `json:"when" firestore:"when"`
+	Url  string `json:"url" firestore:"url"`
+}
+
+// Result of the rules of a link for a visit, without redirecting
+type RuleEvaluation struct {
+	Matched bool         `json:"matched"`
+	Rule    int          `json:"rule,omitempty"`
+	Name    string       `json:"name,omitempty"`
+	Url     string       `json:"url"`
+	Results []RuleResult `json:"results"`
+}
+
+// Value of the condition of each rule, the error is filled when the rule cannot be compiled
+type RuleResult struct {
+	Rule  int    `json:"rule"`
+	Name  string `json:"name,omitempty"`
+	Value bool   `json:"value"`
+	Error string `json:"error,omitempty"`
+}
+
+// UTM params of a link, they are merged into the destination on redirect
+type Utm struct {
+	Source   string `json:"source,omitempty" firestore:"source,omitempty"`
+	Medium   string `json:"medium,omitempty" firestore:"medium,omitempty"`
+	Campaign string `json:"campaign,omitempty" firestore:"campaign,omitempty"`
+	Term     string `json:"term,omitempty" firestore:"term,omitempty"`
+	Content  string `json:"content,omitempty" firestore:"content,omitempty"`
+}
+
+// Named UTM params reused by many links, the params are copied to the link when it uses the template
+type UtmTemplate struct {
+	Name       string    `json:"name" firestore:"name"`
+	Utm        Utm       `json:"utm" firestore:"utm"`
+	CreateTime time.Time `json:"createTime,omitempty" firestore:"createTime,omitempty"`
+}
+
+// Attributes of the redirect request used to build the destination
+type Visit struct {
+	Path      string
+	Query     string
+	Variant   string
+	Ip        string
+	Country   string
+	Platform  string
+	Language  string
+	Referrer  string
+	Cookies   map[string]string
+	UserAgent string
+	RequestId string
+
+	// Time of the visit, only set by the dry runs of the rules
+	Time time.Time
+}
+
+// Version of the click events, increased when a field changes its meaning or is removed
+const ClickEventVersion = 1
+
+// Click of a short url sent to the counters, the ip is anonymised before leaving the service
+type ClickEvent struct {
+	Version     int       `json:"version"`
+	Id          string    `json:"id"`
+	Timestamp   time.Time `json:"timestamp"`
+	RequestId   string    `json:"requestId,omitempty"`
+	Destination string    `json:"destination"`
+	Variant     string    `json:"variant,omitempty"`
+	Referrer    string    `json:"referrer,omitempty"`
+	UserAgent   string    `json:"userAgent,omitempty"`
+	Ip          string    `json:"ip,omitempty"`
+	Country     string    `json:"country,omitempty"`
+	Platform    string    `json:"platform,omitempty"`
+}
+
+// Message attributes of the click in every broker, they let the subscribers filter without reading the data
+func (e *ClickEvent) Attributes() map[string]string {
+	attributes := map[string]string{
+		"id":          e.Id,
+		"version":     strconv.Itoa(e.Version),
+		"contentType": "application/json",
+	}
+	if len(e.Variant) > 0 {
+		attributes["variant"] = e.Variant
+	}
+	if len(e.Country) > 0 {
+		attributes["country"] = e.Country
+	}
+	if len(e.Platform) > 0 {
+		attributes["platform"] = e.Platform
+	}
+	return attributes
+}
+
+// Message read from the click queue, it is acked only after its click is saved
+type ClickMessage struct {
+	MessageId  string
+	Data       []byte
+	Attributes map[string]string
+	Ack        func()
+	Nack       func()
+}
+
+// Click of a message, the message id makes the increments idempotent
+type Click struct {
+	MessageId string
+	Id        string
+	Variant   string
+	Count     int64
+}
+
+// Clicks of an url and variant aggregated by a server before being sent
+type ClickCount struct {
+	Id      string `json:"id"`
+	Variant string `json:"variant,omitempty"`
+	Clicks  int64  `json:"clicks"`
+}
+
+// Clicks of a link in a consumer window, the data of the 'link.clicked' events
+type LinkClicks struct {
+	Id       string           `json:"id"`
+	Clicks   int64            `json:"clicks"`
+	Variants map[string]int64 `json:"variants,omitempty"`
+}
+
+// Type attribute of the messages with aggregated clicks, the click events have no type
+const ClickBatchType = "batch"
+
+// Message with the aggregated clicks of a server, it has the same version of the click events
+type ClickBatch struct {
+	Version int          `json:"version"`
+	Counts  []ClickCount `json:"counts"`
+}
+
+// Version of the link events, increased when a field changes its meaning or is removed
+const LinkEventVersion = 1
+
+// Types of the link events. The links are not deleted by the API yet, 'deleted' is reserved for it
+const (
+	LinkCreated  = "link.created"
+	LinkUpdated  = "link.updated"
+	LinkDisabled = "link.disabled"
+	LinkDeleted  = "link.deleted"
+)
+
+// Change of a link, saved in the outbox together with the change and published after it is committed.
+// The time is set by the database on commit, the events of a link are published in this order
+type LinkEvent struct {
+	Version int       `json:"version" firestore:"version"`
+	Id      string    `json:"id" firestore:"-"`
+	Type    string    `json:"type" firestore:"type"`
+	LinkId  string    `json:"linkId" firestore:"linkId"`
+	Time    time.Time `json:"time" firestore:"time,serverTimestamp"`
+	Url     string    `json:"url,omitempty" firestore:"url,omitempty"`
+	Fields  []string  `json:"fields,omitempty" firestore:"fields,omitempty"`
+	Reason  string    `json:"reason,omitempty" firestore:"reason,omitempty"`
+
+	// Failed publishes of the event, only used by the relay
+	Attempts int `json:"-" firestore:"attempts"`
+}
+
+// Message attributes of the link event, they let the subscribers filter without reading the data
+func (e *LinkEvent) Attributes() map[string]string {
+	return map[string]string{
+		"id":          e.Id,
+		"type":        e.Type,
+		"linkId":      e.LinkId,
+		"version":     strconv.Itoa(e.Version),
+		"contentType": "application/json",
+	}
+}
+
+// Types of the webhook events besides the link events, the clicks are the ones saved by the consumer
+const (
+	LinkClicked = "link.clicked"
+	WebhookTest = "webhook.test"
+)
+
+// Event types a webhook can subscribe to
+var WebhookEvents = map[string]bool{
+	LinkCreated:  true,
+	LinkUpdated:  true,
+	LinkDisabled: true,
+	LinkDeleted:  true,
+	LinkClicked:  true,
+}
+
+// Endpoint notified of the events, without events it receives all of them.
+// The secret signs the requests, it is only returned when the webhook is created or rotated
+type Webhook struct {
+	Id         string    `json:"id" firestore:"id"`
+	Url        string    `json:"url" firestore:"url"`
+	Events     []string  `json:"events,omitempty" firestore:"events,omitempty"`
+	Enable     bool      `json:"enable" firestore:"enable"`
+	Secret     string    `json:"secret,omitempty" firestore:"secret"`
+	CreateTime time.Time `json:"createTime" firestore:"createTime"`
+}
+
+func (w *Webhook) Accepts(eventType string) bool {
+	if len(w.Events) <= 0 {
+		return true
+	}
+	for _, event := range w.Events {
+		if event == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Attributes changed by an update of a webhook, the nil ones are kept
+type WebhookUpdate struct {
+	Url    *string
+	Events *[]string
+	Enable *bool
+}
+
+// Body of the webhook requests, 'data' is the link event or the clicks of the url
+type WebhookEvent struct {
+	Id   string      `json:"id"`
+	Type string      `json:"type"`
+	Time time.Time   `json:"time"`
+	Data interface{} `json:"data"`
+}
+
+// Status of a delivery, a pending one is sent until it succeeds or runs out of attempts and is dead.
+// The test deliveries are sent once, they end delivered or failed
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+	DeliveryDead      = "dead"
+)
+
+// Delivery of an event to a webhook with the result of its last attempt, the payload is the signed body
+type WebhookDelivery struct {
+	Id          string     `json:"id" firestore:"id"`
+	WebhookId   string     `json:"webhookId" firestore:"webhookId"`
+	EventId     string     `json:"eventId" firestore:"eventId"`
+	Type        string     `json:"type" firestore:"type"`
+	Payload     string     `json:"payload" firestore:"payload"`
+	Status      string     `json:"status" firestore:"status"`
+	Attempts    int        `json:"attempts" firestore:"attempts"`
+	StatusCode  int        `json:"statusCode,omitempty" firestore:"statusCode,omitempty"`
+	Error       string     `json:"error,omitempty" firestore:"error,omitempty"`
+	CreateTime  time.Time  `json:"createTime" firestore:"createTime"`
+	NextAttempt time.Time  `json:"nextAttempt" firestore:"nextAttempt"`
+	DeliverTime *time.Time `json:"deliverTime,omitempty" firestore:"deliverTime,omitempty"`
+	ExpireAt    time.Time  `json:"-" firestore:"expireAt"`
+}
+
+// Destination of a redirect and how the client is sent to it
+type Redirect struct {
+	Url      string
+	Enable   bool
+	Type     string
+	Variant  string
+	Sticky   bool
+	Targeted bool
+	DeepLink string
+
+	Window     string
+	ActiveFrom *time.Time
+	ValidFor   time.Duration
+}
+
+// Details of the destination page, filled in background after the url is saved
+type Metadata struct {
+	Title       string    `json:"title,omitempty" firestore:"title,omitempty"`
+	Description string    `json:"description,omitempty" firestore:"description,omitempty"`
+	Favicon     string    `json:"favicon,omitempty" firestore:"favicon,omitempty"`
+	Image       string    `json:"image,omitempty" firestore:"image,omitempty"`
+	FetchTime   time.Time `json:"fetchTime" firestore:"fetchTime"`
+}
+
+// Options of a QR code image, the colours are hexadecimal 'RRGGBB' values
+type QrOptions struct {
+	Format     string
+	Size       int
+	Margin     int
+	Level      string
+	Foreground string
+	Background string
+}
+
+// Result of the last destination check, 'Failures' counts the consecutive broken checks.
+// When 'Fallback' is set the redirect uses the fallback url
+type Health struct {
+	Status    int       `json:"status" firestore:"status"`
+	Latency   int64     `json:"latency" firestore:"latency"`
+	Error     string    `json:"error,omitempty" firestore:"error,omitempty"`
+	Broken    bool      `json:"broken" firestore:"broken"`
+	Failures  int       `json:"failures" firestore:"failures"`
+	Fallback  bool      `json:"fallback" firestore:"fallback"`
+	CheckTime time.Time `json:"checkTime" firestore:"checkTime"`
+}
+
+const (
+	StatusOk       = "ok"
+	StatusDegraded = "degraded"
+)
+
+// Health of the service, degraded while there are clicks waiting to be published
+type ServiceStatus struct {
+	Status string       `json:"status"`
+	Spool  *SpoolStatus `json:"spool,omitempty"`
+}
+
+// Click events saved on disk because they could not be published.
+// 'Dropped' clicks did not fit in the spool and 'Corrupted' ones failed the checksum
+type SpoolStatus struct {
+	Events    int64 `json:"events"`
+	Bytes     int64 `json:"bytes"`
+	Segments  int   `json:"segments"`
+	MaxBytes  int64 `json:"maxBytes"`
+	Dropped   int64 `json:"dropped"`
+	Corrupted int64 `json:"corrupted"`
+}
+
+type Report struct {
+	Id         string    `json:"id" firestore:"id"`
+	UrlId      string    `json:"urlId" firestore:"urlId"`
+	Reason     string    `json:"reason" firestore:"reason"`
+	Comment    string    `json:"comment,omitempty" firestore:"comment,omitempty"`
+	CreateTime time.Time `json:"createTime" firestore:"createTime"`
+}
+
+// Summary of a bulk enable or disable by destination domain
+type BulkResult struct {
+	Domain  string   `json:"domain"`
+	Suffix  bool     `json:"suffix"`
+	Enable  bool     `json:"enable"`
+	DryRun  bool     `json:"dryRun"`
+	Matched int      `json:"matched"`
+	Updated int      `json:"updated"`
+	Ids     []string `json:"ids"`
 }
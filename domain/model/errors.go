@@ -2,6 +2,30 @@ package model
 
 import "fmt"
 
+// Reason codes returned to the clients when a destination is refused
+const (
+	ReasonBlocklisted  = "BLOCKLISTED"
+	ReasonHomoglyph    = "HOMOGLYPH"
+	ReasonMixedScript  = "MIXED_SCRIPT"
+	ReasonEditDistance = "EDIT_DISTANCE"
+)
+
+// Moderation codes of reported or bulk disabled urls, only 'REPORTED' keeps the url enabled
+const (
+	ReasonReported  = "REPORTED"
+	ReasonSuspended = "SUSPENDED"
+	ReasonDomain    = "DOMAIN_DISABLED"
+)
+
+// Reasons accepted from the public when reporting an url
+var ReportReasons = map[string]bool{
+	"malware":  true,
+	"phishing": true,
+	"spam":     true,
+	"illegal":  true,
+	"other":    true,
+}
+
 type DocumentAlreadyExistsError struct {
 	Id  string
 	Url string
@@ -26,3 +50,58 @@ type InvalidUrlError struct {
 func (e *InvalidUrlError) Error() string {
 	return fmt.Sprintf(e.Messsage)
 }
+
+type BlockedUrlError struct {
+	Url    string
+	Reason string
+}
+
+func (e *BlockedUrlError) Error() string {
+	return fmt.Sprintf("URL %v is blocked: %v", e.Url, e.Reason)
+}
+
+// Held is set when the url was saved disabled, waiting for a moderator
+type LookalikeUrlError struct {
+	Url   string
+	Brand string
+	Code  string
+	Held  bool
+}
+
+func (e *LookalikeUrlError) Error() string {
+	return fmt.Sprintf("URL %v looks like the protected brand %v: %v", e.Url, e.Brand, e.Code)
+}
+
+type InvalidRequestError struct {
+	Message string
+}
+
+func (e *InvalidRequestError) Error() string {
+	return e.Message
+}
+
+type TooManyRequestsError struct {
+	Message string
+}
+
+func (e *TooManyRequestsError) Error() string {
+	return e.Message
+}
+
+type InvalidRuleError struct {
+	Rule    int
+	Name    string
+	Column  int
+	Message string
+}
+
+func (e *InvalidRuleError) Error() string {
+	rule := fmt.Sprintf("Rule %v", e.Rule)
+	if len(e.Name) > 0 {
+		rule = fmt.Sprintf("Rule %v (%v)", e.Rule, e.Name)
+	}
+	if e.Column > 0 {
+		return fmt.Sprintf("%v is not valid: %v at column %v", rule, e.Message, e.Column)
+	}
+	return fmt.Sprintf("%v is not valid: %v", rule, e.Message)
+}
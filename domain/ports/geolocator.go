@@ -0,0 +1,5 @@
+package ports
+
+type GeoLocator interface {
+	Country(ip string) string
+}
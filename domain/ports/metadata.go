@@ -0,0 +1,11 @@
+package ports
+
+import (
+	"context"
+
+	"ehgm.com.br/url-shortener/domain/model"
+)
+
+type MetadataFetcher interface {
+	Fetch(ctx context.Context, rawUrl string) (*model.Metadata, error)
+}
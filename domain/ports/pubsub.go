@@ -1,5 +1,47 @@
 package ports
 
+import (
+	"context"
+
+	"ehgm.com.br/url-shortener/domain/model"
+)
+
 type UrlCounter interface {
-	IncrementCounter(id string)
+	IncrementCounter(event *model.ClickEvent)
+	Close(ctx context.Context) error
+}
+
+// Click events kept on disk until they are published, 'Replay' removes them when 'publish' succeeds
+type ClickSpool interface {
+	Append(event *model.ClickEvent) error
+	Replay(ctx context.Context, publish func(ctx context.Context, events []*model.ClickEvent) error) (int, error)
+	Status() *model.SpoolStatus
+}
+
+type ClickSink interface {
+	SaveCounts(ctx context.Context, counts []model.ClickCount) error
+}
+
+type ClickSubscriber interface {
+	Receive(ctx context.Context, handle func(message *model.ClickMessage)) error
+}
+
+// Clicks counted in real time that are not saved in the repository yet.
+// The clicks of a variant are also clicks of its url, like in 'ClickCount'
+type PendingClicks interface {
+	Pending(ctx context.Context, ids []string) ([]model.ClickCount, error)
+	TopPending(ctx context.Context, limit int) ([]string, error)
+	Take(ctx context.Context) (string, []model.ClickCount, error)
+	Commit(ctx context.Context, flushId string) error
+	Release(ctx context.Context, flushId string) error
+}
+
+// Publishes the link events, the events of the same link are delivered in the order they are published
+type EventPublisher interface {
+	Publish(ctx context.Context, event *model.LinkEvent) error
+}
+
+// Receives the clicks saved by the consumer
+type ClickPublisher interface {
+	PublishClicks(ctx context.Context, clicks []model.Click) error
 }
@@ -0,0 +1,7 @@
+package ports
+
+import "ehgm.com.br/url-shortener/domain/model"
+
+type QrEncoder interface {
+	Encode(content string, options *model.QrOptions) ([]byte, error)
+}
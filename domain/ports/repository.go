@@ -2,13 +2,66 @@ package ports
 
 import (
 	"context"
+	"time"
 
 	"ehgm.com.br/url-shortener/domain/model"
 )
 
 type UrlRepository interface {
-	Save(ctx context.Context, id, url string, enable bool) error
+	Save(ctx context.Context, shortUrl *model.ShortUrl) error
 	FindById(ctx context.Context, id string) (*model.ShortUrl, error)
+	FindClicks(ctx context.Context, id string) (int64, map[string]int64, error)
 	Update(ctx context.Context, id string, json map[string]interface{}) error
 	GetStats(ctx context.Context, limit int) ([]model.ShortUrl, error)
+	SaveMetadata(ctx context.Context, id string, metadata *model.Metadata) error
+}
+
+type ModerationRepository interface {
+	SaveReport(ctx context.Context, report *model.Report) (int64, error)
+	FindReports(ctx context.Context, id string, limit int) ([]model.Report, error)
+	GetQueue(ctx context.Context, limit int) ([]model.ShortUrl, error)
+	Suspend(ctx context.Context, id string) error
+	CloseModeration(ctx context.Context, id string, enable bool) error
+	Scan(ctx context.Context, fn func(shortUrl *model.ShortUrl) error) error
+	SetModeration(ctx context.Context, ids []string, enable bool, moderation string) error
+}
+
+type HealthRepository interface {
+	Scan(ctx context.Context, fn func(shortUrl *model.ShortUrl) error) error
+	SaveHealth(ctx context.Context, id string, health *model.Health, changed bool) error
+	GetBroken(ctx context.Context, limit int) ([]model.ShortUrl, error)
+}
+
+type UtmRepository interface {
+	SaveTemplate(ctx context.Context, template *model.UtmTemplate) error
+	FindTemplate(ctx context.Context, name string) (*model.UtmTemplate, error)
+	GetTemplates(ctx context.Context, limit int) ([]model.UtmTemplate, error)
+	DeleteTemplate(ctx context.Context, name string) error
+}
+
+type ClickRepository interface {
+	ApplyClicks(ctx context.Context, clicks []model.Click) (int, error)
+	SaveCounts(ctx context.Context, counts []model.ClickCount) error
+}
+
+// Link events saved with the changes of the links, the pending ones are returned in commit order
+type OutboxRepository interface {
+	PendingEvents(ctx context.Context, limit int) ([]model.LinkEvent, error)
+	MarkDelivered(ctx context.Context, ids []string) error
+	MarkFailed(ctx context.Context, ids []string) error
+	MarkDead(ctx context.Context, ids []string) error
+}
+
+// Webhooks and their deliveries, 'AddDeliveries' skips the ones that already exist
+type WebhookRepository interface {
+	SaveWebhook(ctx context.Context, webhook *model.Webhook) error
+	FindWebhook(ctx context.Context, id string) (*model.Webhook, error)
+	GetWebhooks(ctx context.Context, limit int) ([]model.Webhook, error)
+	UpdateWebhook(ctx context.Context, webhook *model.Webhook) error
+	DeleteWebhook(ctx context.Context, id string) error
+	AddDeliveries(ctx context.Context, deliveries []model.WebhookDelivery) error
+	SaveDelivery(ctx context.Context, delivery *model.WebhookDelivery) error
+	FindDelivery(ctx context.Context, id string) (*model.WebhookDelivery, error)
+	DueDeliveries(ctx context.Context, now time.Time, limit int) ([]model.WebhookDelivery, error)
+	GetDeliveries(ctx context.Context, webhookId, status string, limit int) ([]model.WebhookDelivery, error)
 }
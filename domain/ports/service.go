@@ -2,14 +2,74 @@ package ports
 
 import (
 	"context"
+	"time"
 
 	"ehgm.com.br/url-shortener/domain/model"
 )
 
 type UrlService interface {
-	GenerateId(ctx context.Context, url string) (string, error)
+	GenerateId(ctx context.Context, shortUrl *model.ShortUrl) (string, error)
 	GetUrl(ctx context.Context, id string) (*model.ShortUrl, error)
-	GetUrlToRedirect(ctx context.Context, id string) (string, bool, error)
+	GetUrlToPreview(ctx context.Context, id string) (*model.ShortUrl, error)
+	GetUrlToRedirect(ctx context.Context, id string, visit *model.Visit) (*model.Redirect, error)
 	UpdateUrl(ctx context.Context, id string, json map[string]interface{}) error
+	EvaluateRules(ctx context.Context, id string, visit *model.Visit, rules []model.Rule) (*model.RuleEvaluation, error)
 	GetStats(ctx context.Context, limit int) ([]model.ShortUrl, error)
 }
+
+type ModerationService interface {
+	ReportUrl(ctx context.Context, id, reason, comment, reporter string) error
+	GetQueue(ctx context.Context, limit int) ([]model.ShortUrl, error)
+	GetReports(ctx context.Context, id string, limit int) ([]model.Report, error)
+	Dismiss(ctx context.Context, id string) error
+	Disable(ctx context.Context, id string) error
+	SetEnableByDomain(ctx context.Context, domain string, suffix, enable, dryRun bool) (*model.BulkResult, error)
+}
+
+type HealthService interface {
+	Run(ctx context.Context, interval time.Duration)
+	CheckAll(ctx context.Context) (int, error)
+	GetBroken(ctx context.Context, limit int) ([]model.ShortUrl, error)
+	Status(ctx context.Context) *model.ServiceStatus
+}
+
+type ClickConsumer interface {
+	Run(ctx context.Context) error
+}
+
+type QrCodeService interface {
+	GetQrCode(ctx context.Context, id, shortUrl string, options *model.QrOptions) ([]byte, error)
+}
+
+type UtmService interface {
+	SaveTemplate(ctx context.Context, template *model.UtmTemplate) error
+	GetTemplate(ctx context.Context, name string) (*model.UtmTemplate, error)
+	GetTemplates(ctx context.Context, limit int) ([]model.UtmTemplate, error)
+	DeleteTemplate(ctx context.Context, name string) error
+}
+
+type ClickFlusher interface {
+	Run(ctx context.Context) error
+}
+
+type EventRelay interface {
+	Run(ctx context.Context) error
+}
+
+type WebhookService interface {
+	SaveWebhook(ctx context.Context, webhook *model.Webhook) error
+	GetWebhook(ctx context.Context, id string) (*model.Webhook, error)
+	GetWebhooks(ctx context.Context, limit int) ([]model.Webhook, error)
+	UpdateWebhook(ctx context.Context, id string, update *model.WebhookUpdate) (*model.Webhook, error)
+	RotateSecret(ctx context.Context, id string) (*model.Webhook, error)
+	DeleteWebhook(ctx context.Context, id string) error
+	GetDeliveries(ctx context.Context, id, status string, limit int) ([]model.WebhookDelivery, error)
+	RetryDelivery(ctx context.Context, id, deliveryId string) (*model.WebhookDelivery, error)
+	TestWebhook(ctx context.Context, id string) (*model.WebhookDelivery, error)
+	Publish(ctx context.Context, event *model.LinkEvent) error
+	PublishClicks(ctx context.Context, clicks []model.Click) error
+}
+
+type WebhookDispatcher interface {
+	Run(ctx context.Context) error
+}
@@ -0,0 +1,5 @@
+package ports
+
+type UrlFilter interface {
+	Check(rawUrl string) error
+}
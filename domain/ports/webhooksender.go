@@ -0,0 +1,12 @@
+package ports
+
+import (
+	"context"
+
+	"ehgm.com.br/url-shortener/domain/model"
+)
+
+// Sends the payload of the delivery signed with the secret of the webhook, returns the status of the response
+type WebhookSender interface {
+	Send(ctx context.Context, webhook *model.Webhook, delivery *model.WebhookDelivery) (int, error)
+}
@@ -0,0 +1,240 @@
+package usecases
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"ehgm.com.br/url-shortener/domain/model"
+	"ehgm.com.br/url-shortener/domain/ports"
+)
+
+// Applied message ids are remembered for a while, so redeliveries are acked without reaching the repository
+const seenMessagesFor = 10 * time.Minute
+
+// Clicks of a message, a batch message has the clicks of many urls
+type pendingClick struct {
+	clicks  []model.Click
+	message *model.ClickMessage
+}
+
+// Struct that implements 'ClickConsumer' interface
+type clickConsumer struct {
+	log             ports.Logger
+	subscriber      ports.ClickSubscriber
+	clickRepository ports.ClickRepository
+	clickPublisher  ports.ClickPublisher
+	window          time.Duration
+	batchSize       int
+
+	mu      sync.Mutex
+	pending []pendingClick
+	size    int
+	seen    map[string]time.Time
+	full    chan struct{}
+}
+
+// Get an instance of 'ClickConsumer' using this method.
+// The clicks received in each 'window' are saved together, or earlier when 'batchSize' clicks are waiting.
+// The messages are acked only after their clicks are saved, a failed batch is delivered again.
+// The saved clicks are also sent to 'clickPublisher', it can be nil
+func NewClickConsumer(log ports.Logger,
+	subscriber ports.ClickSubscriber,
+	clickRepository ports.ClickRepository,
+	window time.Duration,
+	batchSize int,
+	clickPublisher ports.ClickPublisher) ports.ClickConsumer {
+
+	if batchSize <= 0 {
+		batchSize = 1
+	}
+
+	return &clickConsumer{log: log, subscriber: subscriber, clickRepository: clickRepository, clickPublisher: clickPublisher,
+		window: window, batchSize: batchSize, seen: map[string]time.Time{}, full: make(chan struct{}, 1)}
+}
+
+// Receive the clicks until the context is done, the pending clicks are saved before returning
+func (c *clickConsumer) Run(ctx context.Context) error {
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		c.flushLoop(stop)
+	}()
+
+	err := c.subscriber.Receive(ctx, c.receive)
+
+	close(stop)
+	<-stopped
+	c.flush(context.Background())
+
+	if err != nil {
+		return fmt.Errorf("Receive clicks error. %w", err)
+	}
+	return nil
+}
+
+func (c *clickConsumer) flushLoop(stop chan struct{}) {
+	ticker := time.NewTicker(c.window)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		case <-c.full:
+		}
+		c.flush(context.Background())
+	}
+}
+
+// Invalid messages are acked and dropped, they would never be saved
+func (c *clickConsumer) receive(message *model.ClickMessage) {
+	clicks, err := parseClickMessage(message)
+	if err != nil {
+		c.log.Error("Dropping invalid click message: %v. Cause: %s", message.MessageId, err)
+		message.Ack()
+		return
+	}
+
+	c.mu.Lock()
+	if _, ok := c.seen[message.MessageId]; ok {
+		c.mu.Unlock()
+		message.Ack()
+		return
+	}
+	c.pending = append(c.pending, pendingClick{clicks: clicks, message: message})
+	c.size += len(clicks)
+	full := c.size >= c.batchSize
+	c.mu.Unlock()
+
+	if full {
+		select {
+		case c.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Save the pending clicks in batches, returns the number of saved clicks
+func (c *clickConsumer) flush(ctx context.Context) int {
+	c.mu.Lock()
+	pending := c.pending
+	c.pending, c.size = nil, 0
+	c.pruneSeen(time.Now())
+	c.mu.Unlock()
+
+	applied, start, size := 0, 0, 0
+	for end := range pending {
+		size += len(pending[end].clicks)
+		if size >= c.batchSize || end == len(pending)-1 {
+			applied += c.apply(ctx, pending[start:end+1])
+			start, size = end+1, 0
+		}
+	}
+	return applied
+}
+
+func (c *clickConsumer) apply(ctx context.Context, batch []pendingClick) int {
+	// A message delivered twice in the same window is saved once
+	clicks := []model.Click{}
+	unique := map[string]bool{}
+	for _, p := range batch {
+		if !unique[p.message.MessageId] {
+			unique[p.message.MessageId] = true
+			clicks = append(clicks, p.clicks...)
+		}
+	}
+
+	applied, err := c.clickRepository.ApplyClicks(ctx, clicks)
+	if err != nil {
+		c.log.Error("Failed to save %v clicks, they will be delivered again. Cause: %s", len(clicks), err)
+		for _, p := range batch {
+			p.message.Nack()
+		}
+		return 0
+	}
+
+	// The clicks are saved, a failed publish only loses their notifications and does not deliver them again
+	if c.clickPublisher != nil {
+		if err := c.clickPublisher.PublishClicks(ctx, clicks); err != nil {
+			c.log.Error("Failed to publish %v saved clicks, their events are lost. Cause: %s", len(clicks), err)
+		}
+	}
+
+	now := time.Now()
+	c.mu.Lock()
+	for id := range unique {
+		c.seen[id] = now
+	}
+	c.mu.Unlock()
+
+	for _, p := range batch {
+		p.message.Ack()
+	}
+	c.log.Info("Saved %v clicks of %v messages", applied, len(batch))
+	return applied
+}
+
+func (c *clickConsumer) pruneSeen(now time.Time) {
+	for id, at := range c.seen {
+		if now.Sub(at) > seenMessagesFor {
+			delete(c.seen, id)
+		}
+	}
+}
+
+// Versioned messages have the click event as JSON, the older ones only have the id as data.
+// The clicks of a batch message get the message id with their position
+func parseClickMessage(message *model.ClickMessage) ([]model.Click, error) {
+	if len(message.MessageId) <= 0 {
+		return nil, fmt.Errorf("message without id")
+	}
+	click := model.Click{MessageId: message.MessageId, Variant: message.Attributes["variant"], Count: 1}
+
+	_, versioned := message.Attributes["version"]
+	switch {
+	case !versioned:
+		click.Id = string(message.Data)
+	case message.Attributes["type"] == model.ClickBatchType:
+		var batch model.ClickBatch
+		if err := json.Unmarshal(message.Data, &batch); err != nil {
+			return nil, fmt.Errorf("Unmarshal click batch error. %w", err)
+		}
+		if batch.Version > model.ClickEventVersion {
+			return nil, fmt.Errorf("click batch version %v is not supported", batch.Version)
+		}
+
+		clicks := []model.Click{}
+		for i, count := range batch.Counts {
+			if !validClickId(count.Id) || count.Clicks <= 0 {
+				return nil, fmt.Errorf("click count %v is not valid", i)
+			}
+			clicks = append(clicks, model.Click{MessageId: fmt.Sprintf("%v-%v", message.MessageId, i),
+				Id: count.Id, Variant: count.Variant, Count: count.Clicks})
+		}
+		return clicks, nil
+	default:
+		var event model.ClickEvent
+		if err := json.Unmarshal(message.Data, &event); err != nil {
+			return nil, fmt.Errorf("Unmarshal click event error. %w", err)
+		}
+		if event.Version > model.ClickEventVersion {
+			return nil, fmt.Errorf("click event version %v is not supported", event.Version)
+		}
+		click.Id, click.Variant = event.Id, event.Variant
+	}
+
+	if !validClickId(click.Id) {
+		return nil, fmt.Errorf("click with an invalid id")
+	}
+	return []model.Click{click}, nil
+}
+
+func validClickId(id string) bool {
+	return len(id) > 0 && len(id) <= 64 && !strings.Contains(id, "/")
+}
@@ -0,0 +1,252 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"ehgm.com.br/url-shortener/domain/model"
+)
+
+// In process subscriber, delivers the messages and waits for the context
+type clickSubscriberMock struct {
+	messages []*model.ClickMessage
+}
+
+func (s *clickSubscriberMock) Receive(ctx context.Context, handle func(message *model.ClickMessage)) error {
+	for _, message := range s.messages {
+		handle(message)
+	}
+	<-ctx.Done()
+	return nil
+}
+
+// Saves the clicks in memory, skipping the applied message ids like the repository
+type clickRepositoryMock struct {
+	mu       sync.Mutex
+	fail     bool
+	applied  map[string]bool
+	clicks   map[string]int64
+	variants map[string]int64
+	batches  int
+}
+
+func (r *clickRepositoryMock) ApplyClicks(ctx context.Context, clicks []model.Click) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.batches++
+	if r.fail {
+		return 0, errors.New("unavailable")
+	}
+	applied := 0
+	for _, click := range clicks {
+		if r.applied[click.MessageId] {
+			continue
+		}
+		r.applied[click.MessageId] = true
+		r.clicks[click.Id] += click.Count
+		if len(click.Variant) > 0 {
+			r.variants[click.Id+"/"+click.Variant] += click.Count
+		}
+		applied += int(click.Count)
+	}
+	return applied, nil
+}
+
+func (r *clickRepositoryMock) SaveCounts(ctx context.Context, counts []model.ClickCount) error {
+	return nil
+}
+
+// Keeps the message ids of the published clicks
+type clickPublisherMock struct {
+	fail bool
+	ids  []string
+}
+
+func (p *clickPublisherMock) PublishClicks(ctx context.Context, clicks []model.Click) error {
+	if p.fail {
+		return errors.New("unavailable")
+	}
+	for _, click := range clicks {
+		p.ids = append(p.ids, click.MessageId)
+	}
+	return nil
+}
+
+// Message that records if it was acked or nacked
+type ackRecorder struct {
+	mu    sync.Mutex
+	acked []string
+	nack  []string
+}
+
+func (a *ackRecorder) message(messageId string, data string, attributes map[string]string) *model.ClickMessage {
+	return &model.ClickMessage{MessageId: messageId, Data: []byte(data), Attributes: attributes,
+		Ack: func() {
+			a.mu.Lock()
+			defer a.mu.Unlock()
+			a.acked = append(a.acked, messageId)
+		},
+		Nack: func() {
+			a.mu.Lock()
+			defer a.mu.Unlock()
+			a.nack = append(a.nack, messageId)
+		}}
+}
+
+func TestClickConsumer(t *testing.T) {
+	event := `{"version":1,"id":"1q2w3e","timestamp":"2021-11-26T10:30:00Z","destination":"https://ehgm.com.br","variant":"a"}`
+	versioned := map[string]string{"version": "1", "variant": "a"}
+
+	type Input struct {
+		messages     func(a *ackRecorder) []*model.ClickMessage
+		fail         bool
+		publishFails bool
+	}
+
+	type Output struct {
+		clicks    map[string]int64
+		variants  map[string]int64
+		acked     []string
+		nack      []string
+		published []string
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Should count the versioned and the old messages": {
+			Input{messages: func(a *ackRecorder) []*model.ClickMessage {
+				return []*model.ClickMessage{
+					a.message("m1", event, versioned),
+					a.message("m2", event, versioned),
+					a.message("m3", "0aYS7JJ", nil),
+					a.message("m4", "0aYS7JJ", map[string]string{"variant": "b"})}
+			}},
+			Output{clicks: map[string]int64{"1q2w3e": 2, "0aYS7JJ": 2},
+				variants: map[string]int64{"1q2w3e/a": 2, "0aYS7JJ/b": 1},
+				acked:    []string{"m1", "m2", "m3", "m4"}, nack: nil, published: []string{"m1", "m2", "m3", "m4"}}},
+
+		"Test 02 - Redelivered messages are counted once": {
+			Input{messages: func(a *ackRecorder) []*model.ClickMessage {
+				return []*model.ClickMessage{
+					a.message("m1", event, versioned),
+					a.message("m1", event, versioned),
+					a.message("m2", event, versioned)}
+			}},
+			Output{clicks: map[string]int64{"1q2w3e": 2}, variants: map[string]int64{"1q2w3e/a": 2},
+				acked: []string{"m1", "m1", "m2"}, nack: nil, published: []string{"m1", "m2"}}},
+
+		"Test 03 - Invalid messages are dropped": {
+			Input{messages: func(a *ackRecorder) []*model.ClickMessage {
+				return []*model.ClickMessage{
+					a.message("m1", "{", versioned),
+					a.message("m2", `{"version":99,"id":"1q2w3e"}`, versioned),
+					a.message("m3", "", nil),
+					a.message("m4", "0aYS7JJ", nil)}
+			}},
+			Output{clicks: map[string]int64{"0aYS7JJ": 1}, variants: map[string]int64{},
+				acked: []string{"m1", "m2", "m3", "m4"}, nack: nil, published: []string{"m4"}}},
+
+		"Test 04 - Should count the batch messages": {
+			Input{messages: func(a *ackRecorder) []*model.ClickMessage {
+				batch := map[string]string{"version": "1", "type": model.ClickBatchType}
+				return []*model.ClickMessage{
+					a.message("m1", `{"version":1,"counts":[{"id":"1q2w3e","variant":"a","clicks":3},{"id":"0aYS7JJ","clicks":2}]}`, batch),
+					a.message("m1", `{"version":1,"counts":[{"id":"1q2w3e","variant":"a","clicks":3},{"id":"0aYS7JJ","clicks":2}]}`, batch),
+					a.message("m2", `{"version":1,"counts":[{"id":"0aYS7JJ","clicks":-1}]}`, batch)}
+			}},
+			Output{clicks: map[string]int64{"1q2w3e": 3, "0aYS7JJ": 2}, variants: map[string]int64{"1q2w3e/a": 3},
+				acked: []string{"m1", "m1", "m2"}, nack: nil, published: []string{"m1-0", "m1-1"}}},
+
+		"Test 05 - Failed batches are delivered again": {
+			Input{messages: func(a *ackRecorder) []*model.ClickMessage {
+				return []*model.ClickMessage{a.message("m1", event, versioned), a.message("m2", "0aYS7JJ", nil)}
+			}, fail: true},
+			Output{clicks: map[string]int64{}, variants: map[string]int64{},
+				acked: nil, nack: []string{"m1", "m2"}, published: nil}},
+
+		"Test 06 - Saved clicks are acked when they are not published": {
+			Input{messages: func(a *ackRecorder) []*model.ClickMessage {
+				return []*model.ClickMessage{a.message("m1", event, versioned)}
+			}, publishFails: true},
+			Output{clicks: map[string]int64{"1q2w3e": 1}, variants: map[string]int64{"1q2w3e/a": 1},
+				acked: []string{"m1"}, nack: nil, published: nil}},
+	}
+
+	for i, test := range tests {
+		recorder := &ackRecorder{}
+		subscriber := &clickSubscriberMock{messages: test.input.messages(recorder)}
+		repo := &clickRepositoryMock{fail: test.input.fail, applied: map[string]bool{}, clicks: map[string]int64{}, variants: map[string]int64{}}
+
+		publisher := &clickPublisherMock{fail: test.input.publishFails}
+
+		// The window never ends during the test, the clicks are saved when the consumer stops
+		consumer := NewClickConsumer(&loggerMock{}, subscriber, repo, time.Hour, 100, publisher)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if err := consumer.Run(ctx); err != nil {
+			t.Errorf("#%s: Output is: %s. But should not has error", i, err)
+			continue
+		}
+
+		sort.Strings(recorder.acked)
+		sort.Strings(recorder.nack)
+		if !reflect.DeepEqual(repo.clicks, test.output.clicks) || !reflect.DeepEqual(repo.variants, test.output.variants) {
+			t.Errorf("#%s: Output is: %v %v. But should be: %v %v", i, repo.clicks, repo.variants, test.output.clicks, test.output.variants)
+		}
+		if !reflect.DeepEqual(recorder.acked, test.output.acked) || !reflect.DeepEqual(recorder.nack, test.output.nack) {
+			t.Errorf("#%s: Output is: acked %v nacked %v. But should be: acked %v nacked %v", i,
+				recorder.acked, recorder.nack, test.output.acked, test.output.nack)
+		}
+		sort.Strings(publisher.ids)
+		if !reflect.DeepEqual(publisher.ids, test.output.published) {
+			t.Errorf("#%s: Output is: %v. But should be: %v", i, publisher.ids, test.output.published)
+		}
+	}
+}
+
+func TestClickConsumerBatches(t *testing.T) {
+	recorder := &ackRecorder{}
+	messages := []*model.ClickMessage{}
+	for _, id := range []string{"m1", "m2", "m3", "m4", "m5"} {
+		messages = append(messages, recorder.message(id, "0aYS7JJ", nil))
+	}
+
+	// A full batch is saved before the window ends
+	repo := &clickRepositoryMock{applied: map[string]bool{}, clicks: map[string]int64{}, variants: map[string]int64{}}
+	consumer := NewClickConsumer(&loggerMock{}, &clickSubscriberMock{messages: messages}, repo, time.Hour, 2, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- consumer.Run(ctx) }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		repo.mu.Lock()
+		clicks := repo.clicks["0aYS7JJ"]
+		repo.mu.Unlock()
+		if clicks >= 2 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Output is: %s. But should not has error", err)
+	}
+
+	// The last click is saved when stopping, in batches of at most 2 clicks
+	if repo.clicks["0aYS7JJ"] != 5 || repo.batches < 3 {
+		t.Errorf("Output is: %v clicks in %v batches. But should be: 5 clicks in 3 batches", repo.clicks["0aYS7JJ"], repo.batches)
+	}
+	if len(recorder.acked) != 5 {
+		t.Errorf("Output is: %v. But should ack all the messages", recorder.acked)
+	}
+}
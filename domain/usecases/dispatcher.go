@@ -0,0 +1,173 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"ehgm.com.br/url-shortener/domain/model"
+	"ehgm.com.br/url-shortener/domain/ports"
+)
+
+// Deliveries sent at the same time
+const webhookConcurrency = 10
+
+// Wait before the second attempt, doubled after each failure up to the max
+const (
+	firstRetryDelay = time.Minute
+	maxRetryDelay   = 6 * time.Hour
+)
+
+// Struct that implements 'WebhookDispatcher' interface
+type webhookDispatcher struct {
+	log               ports.Logger
+	webhookRepository ports.WebhookRepository
+	webhookSender     ports.WebhookSender
+	clock             ports.Clock
+	interval          time.Duration
+	batchSize         int
+	maxAttempts       int
+}
+
+// Get an instance of 'WebhookDispatcher' using this method.
+// The due deliveries are sent every 'interval' in batches of 'batchSize', only one dispatcher should run.
+// A failed delivery is sent again with exponential backoff, after 'maxAttempts' it is dead
+func NewWebhookDispatcher(log ports.Logger,
+	webhookRepository ports.WebhookRepository,
+	webhookSender ports.WebhookSender,
+	clock ports.Clock,
+	interval time.Duration,
+	batchSize int,
+	maxAttempts int) ports.WebhookDispatcher {
+
+	if maxAttempts <= 0 {
+		maxAttempts = 1
+	}
+
+	return &webhookDispatcher{log: log, webhookRepository: webhookRepository, webhookSender: webhookSender,
+		clock: clock, interval: interval, batchSize: batchSize, maxAttempts: maxAttempts}
+}
+
+// Send the due deliveries until the context is done
+func (d *webhookDispatcher) Run(ctx context.Context) error {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			// A full batch may have more deliveries waiting
+			for {
+				sent, err := d.dispatch(ctx)
+				if err != nil {
+					d.log.Error("Failed to send the webhook deliveries, trying again later. Cause: %s", err)
+					break
+				}
+				if sent < d.batchSize || ctx.Err() != nil {
+					break
+				}
+			}
+		}
+	}
+}
+
+// Returns the number of deliveries saved with their result, each webhook is read once
+func (d *webhookDispatcher) dispatch(ctx context.Context) (int, error) {
+	deliveries, err := d.webhookRepository.DueDeliveries(ctx, d.clock.Now().UTC(), d.batchSize)
+	if err != nil {
+		return 0, fmt.Errorf("DueDeliveries error. %w", err)
+	}
+
+	webhooks := map[string]*model.Webhook{}
+	for _, delivery := range deliveries {
+		if _, ok := webhooks[delivery.WebhookId]; ok {
+			continue
+		}
+		webhook, err := d.webhookRepository.FindWebhook(ctx, delivery.WebhookId)
+		var notFound *model.DocumentNotFoundError
+		if err != nil && !errors.As(err, &notFound) {
+			return 0, fmt.Errorf("FindWebhook error for Id: %v. %w", delivery.WebhookId, err)
+		}
+		webhooks[delivery.WebhookId] = webhook
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	saved := 0
+	sem := make(chan struct{}, webhookConcurrency)
+	for i := range deliveries {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(delivery *model.WebhookDelivery) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if d.deliver(ctx, webhooks[delivery.WebhookId], delivery) {
+				mu.Lock()
+				saved++
+				mu.Unlock()
+			}
+		}(&deliveries[i])
+	}
+	wg.Wait()
+
+	if len(deliveries) > 0 {
+		d.log.Info("Sent %v of %v webhook deliveries", saved, len(deliveries))
+	}
+	return saved, nil
+}
+
+// Send the delivery and save the result, the deliveries of deleted or disabled webhooks are dead.
+// When the result is not saved the delivery is sent again, the receivers use the event id to skip it
+func (d *webhookDispatcher) deliver(ctx context.Context, webhook *model.Webhook, delivery *model.WebhookDelivery) bool {
+	now := d.clock.Now().UTC()
+
+	switch {
+	case webhook == nil:
+		delivery.Status = model.DeliveryDead
+		delivery.Error = "webhook deleted"
+	case !webhook.Enable:
+		delivery.Status = model.DeliveryDead
+		delivery.Error = "webhook disabled"
+	default:
+		code, err := d.webhookSender.Send(ctx, webhook, delivery)
+		delivery.Attempts++
+		delivery.StatusCode = code
+		if err == nil {
+			delivery.Status = model.DeliveryDelivered
+			delivery.Error = ""
+			delivery.DeliverTime = &now
+		} else if delivery.Attempts >= d.maxAttempts {
+			delivery.Status = model.DeliveryDead
+			delivery.Error = err.Error()
+		} else {
+			delivery.Error = err.Error()
+			delivery.NextAttempt = now.Add(retryDelay(delivery.Attempts))
+		}
+	}
+
+	if err := d.webhookRepository.SaveDelivery(ctx, delivery); err != nil {
+		d.log.Error("Error saving delivery %v with status %v. Cause: %s", delivery.Id, delivery.Status, err)
+		return false
+	}
+	if delivery.Status == model.DeliveryDead {
+		d.log.Error("Delivery %v of webhook %v is dead after %v attempts: %v", delivery.Id, delivery.WebhookId,
+			delivery.Attempts, delivery.Error)
+	}
+	return true
+}
+
+// Wait after the failed attempts, 1 minute after the first one and doubled up to 6 hours
+func retryDelay(attempts int) time.Duration {
+	delay := firstRetryDelay
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return delay
+}
@@ -0,0 +1,78 @@
+package usecases
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"ehgm.com.br/url-shortener/domain/ports"
+)
+
+// Time limit of the flush done when stopping
+const finalFlushTimeout = 30 * time.Second
+
+// Struct that implements 'ClickFlusher' interface
+type clickFlusher struct {
+	log             ports.Logger
+	pendingClicks   ports.PendingClicks
+	clickRepository ports.ClickRepository
+	interval        time.Duration
+}
+
+// Get an instance of 'ClickFlusher' using this method.
+// The pending clicks are saved in the repository every 'interval', a failed flush is tried again with the same clicks
+func NewClickFlusher(log ports.Logger,
+	pendingClicks ports.PendingClicks,
+	clickRepository ports.ClickRepository,
+	interval time.Duration) ports.ClickFlusher {
+
+	return &clickFlusher{log: log, pendingClicks: pendingClicks, clickRepository: clickRepository, interval: interval}
+}
+
+// Save the pending clicks until the context is done, they are saved once more before returning
+func (f *clickFlusher) Run(ctx context.Context) error {
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			finalCtx, cancel := context.WithTimeout(context.Background(), finalFlushTimeout)
+			defer cancel()
+			if _, err := f.flush(finalCtx); err != nil {
+				return fmt.Errorf("Final flush error. %w", err)
+			}
+			return nil
+		case <-ticker.C:
+			if _, err := f.flush(ctx); err != nil {
+				f.log.Error("Failed to save the pending clicks, trying again later. Cause: %s", err)
+			}
+		}
+	}
+}
+
+// Returns the number of saved clicks, the clicks of a flush already applied are skipped by the repository
+func (f *clickFlusher) flush(ctx context.Context) (int, error) {
+	flushId, counts, err := f.pendingClicks.Take(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("Take pending clicks error. %w", err)
+	}
+	if len(counts) <= 0 {
+		return 0, nil
+	}
+
+	applied, err := f.clickRepository.ApplyClicks(ctx, flushClicks(flushId, counts))
+	if err != nil {
+		return 0, fmt.Errorf("ApplyClicks error for flush: %v. %w", flushId, err)
+	}
+	// The saved clicks stop being pending before they are released, so they are not counted twice
+	if err := f.pendingClicks.Commit(ctx, flushId); err != nil {
+		return applied, fmt.Errorf("Commit pending clicks error for flush: %v. %w", flushId, err)
+	}
+	if err := f.pendingClicks.Release(ctx, flushId); err != nil {
+		return applied, fmt.Errorf("Release pending clicks error for flush: %v. %w", flushId, err)
+	}
+
+	f.log.Info("Saved %v pending clicks of %v urls and variants", applied, len(counts))
+	return applied, nil
+}
@@ -0,0 +1,124 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"ehgm.com.br/url-shortener/domain/model"
+)
+
+// Returns the same clicks until they are released, like a flush in progress
+type clickStoreMock struct {
+	counts       []model.ClickCount
+	releaseFails bool
+	committed    string
+	released     int
+}
+
+func (s *clickStoreMock) Pending(ctx context.Context, ids []string) ([]model.ClickCount, error) {
+	return s.counts, nil
+}
+
+func (s *clickStoreMock) TopPending(ctx context.Context, limit int) ([]string, error) {
+	return nil, nil
+}
+
+func (s *clickStoreMock) Take(ctx context.Context) (string, []model.ClickCount, error) {
+	return "f1", s.counts, nil
+}
+
+func (s *clickStoreMock) Commit(ctx context.Context, flushId string) error {
+	s.committed = flushId
+	return nil
+}
+
+func (s *clickStoreMock) Release(ctx context.Context, flushId string) error {
+	if s.releaseFails {
+		return errors.New("unavailable")
+	}
+	s.counts = nil
+	s.released++
+	return nil
+}
+
+func TestClickFlusher(t *testing.T) {
+	counts := []model.ClickCount{{Id: "0aYS7JJ", Clicks: 2}, {Id: "1q2w3e", Variant: "a", Clicks: 3}}
+
+	type Input struct {
+		fail         bool
+		releaseFails bool
+	}
+
+	type Output struct {
+		clicks    map[string]int64
+		variants  map[string]int64
+		committed string
+		released  int
+		hasError  bool
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Should save and release the pending clicks": {
+			Input{},
+			Output{clicks: map[string]int64{"0aYS7JJ": 2, "1q2w3e": 3}, variants: map[string]int64{"1q2w3e/a": 3},
+				committed: "f1", released: 1, hasError: false}},
+
+		"Test 02 - Should keep the clicks when they are not saved": {
+			Input{fail: true},
+			Output{clicks: map[string]int64{}, variants: map[string]int64{}, committed: "", released: 0, hasError: true}},
+
+		"Test 03 - A flush tried again is saved once": {
+			Input{releaseFails: true},
+			Output{clicks: map[string]int64{"0aYS7JJ": 2, "1q2w3e": 3}, variants: map[string]int64{"1q2w3e/a": 3},
+				committed: "f1", released: 0, hasError: true}},
+	}
+
+	ctx := context.Background()
+
+	for i, test := range tests {
+		store := &clickStoreMock{counts: counts, releaseFails: test.input.releaseFails}
+		repo := &clickRepositoryMock{fail: test.input.fail, applied: map[string]bool{}, clicks: map[string]int64{}, variants: map[string]int64{}}
+		flusher := &clickFlusher{log: &loggerMock{}, pendingClicks: store, clickRepository: repo, interval: time.Hour}
+
+		// The second flush gets the same clicks when the first was not released
+		_, err := flusher.flush(ctx)
+		if _, again := flusher.flush(ctx); err == nil {
+			err = again
+		}
+
+		if test.output.hasError != (err != nil) {
+			t.Errorf("#%s: Output is: %v. But should has error: %v", i, err, test.output.hasError)
+		}
+		if !reflect.DeepEqual(repo.clicks, test.output.clicks) || !reflect.DeepEqual(repo.variants, test.output.variants) {
+			t.Errorf("#%s: Output is: %v %v. But should be: %v %v", i, repo.clicks, repo.variants, test.output.clicks, test.output.variants)
+		}
+		if store.committed != test.output.committed {
+			t.Errorf("#%s: Output is: %v committed. But should be: %v", i, store.committed, test.output.committed)
+		}
+		if store.released != test.output.released {
+			t.Errorf("#%s: Output is: %v releases. But should be: %v", i, store.released, test.output.released)
+		}
+	}
+}
+
+func TestClickFlusherRun(t *testing.T) {
+	store := &clickStoreMock{counts: []model.ClickCount{{Id: "0aYS7JJ", Clicks: 4}}}
+	repo := &clickRepositoryMock{applied: map[string]bool{}, clicks: map[string]int64{}, variants: map[string]int64{}}
+	flusher := NewClickFlusher(&loggerMock{}, store, repo, time.Hour)
+
+	// The interval never ends during the test, the clicks are saved when stopping
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := flusher.Run(ctx); err != nil {
+		t.Fatalf("Output is: %s. But should not has error", err)
+	}
+	if repo.clicks["0aYS7JJ"] != 4 || store.released != 1 {
+		t.Errorf("Output is: %v clicks, %v releases. But should be: 4 clicks, 1 release", repo.clicks["0aYS7JJ"], store.released)
+	}
+}
@@ -0,0 +1,153 @@
+package usecases
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"ehgm.com.br/url-shortener/domain/model"
+	"ehgm.com.br/url-shortener/domain/ports"
+)
+
+// Struct that implements 'HealthService' interface
+type healthService struct {
+	log              ports.Logger
+	healthRepository ports.HealthRepository
+	healthProber     ports.HealthProber
+	concurrency      int
+	maxFailures      int
+	clickSpool       ports.ClickSpool
+}
+
+// Get an instance of 'HealthService' using this method.
+// At most 'concurrency' destinations are checked at once, after 'maxFailures' consecutive
+// broken checks the redirect uses the fallback url of the link, when there is one.
+// The 'clickSpool' is nil when the unpublished clicks are not saved on disk
+func NewHealthService(log ports.Logger,
+	healthRepository ports.HealthRepository,
+	healthProber ports.HealthProber,
+	concurrency int,
+	maxFailures int,
+	clickSpool ports.ClickSpool) ports.HealthService {
+
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	return &healthService{log: log, healthRepository: healthRepository, healthProber: healthProber,
+		concurrency: concurrency, maxFailures: maxFailures, clickSpool: clickSpool}
+}
+
+// Check all destinations every 'interval' until the context is done
+func (s *healthService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			checked, err := s.CheckAll(ctx)
+			if err != nil {
+				s.log.Error("Health check error after %v urls. Cause: %s", checked, err)
+			}
+		}
+	}
+}
+
+// Check the destinations of all enabled urls, returns the number of checked urls
+func (s *healthService) CheckAll(ctx context.Context) (int, error) {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var checked int
+	sem := make(chan struct{}, s.concurrency)
+
+	err := s.healthRepository.Scan(ctx, func(shortUrl *model.ShortUrl) error {
+		if !shortUrl.Enable {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case sem <- struct{}{}:
+		}
+
+		wg.Add(1)
+		go func(shortUrl model.ShortUrl) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			if err := s.check(ctx, &shortUrl); err != nil {
+				s.log.Error("Health check error for Id: %v. Cause: %s", shortUrl.Id, err)
+				return
+			}
+			mu.Lock()
+			checked++
+			mu.Unlock()
+		}(*shortUrl)
+		return nil
+	})
+	wg.Wait()
+
+	s.log.Info("Health check finished, %v urls checked", checked)
+	if err != nil {
+		return checked, fmt.Errorf("CheckAll error. %w", err)
+	}
+	return checked, nil
+}
+
+func (s *healthService) check(ctx context.Context, shortUrl *model.ShortUrl) error {
+	health := s.healthProber.Probe(ctx, shortUrl.Url)
+	health.Broken = len(health.Error) > 0 || health.Status >= 400
+
+	if health.Broken {
+		health.Failures = 1
+		if shortUrl.Health != nil {
+			health.Failures = shortUrl.Health.Failures + 1
+		}
+	}
+	health.Fallback = health.Broken && len(shortUrl.FallbackUrl) > 0 && health.Failures >= s.maxFailures
+
+	previous := model.Health{}
+	if shortUrl.Health != nil {
+		previous = *shortUrl.Health
+	}
+	if health.Fallback && !previous.Fallback {
+		s.log.Info("Id %v is using the fallback url after %v failures", shortUrl.Id, health.Failures)
+	}
+
+	// Only the broken and fallback states change the redirect, the cached url is kept while they are the same
+	changed := health.Broken != previous.Broken || health.Fallback != previous.Fallback
+	return s.healthRepository.SaveHealth(ctx, shortUrl.Id, health, changed)
+}
+
+func (s *healthService) GetBroken(ctx context.Context, limit int) ([]model.ShortUrl, error) {
+	var defaultLimit = 10
+
+	if limit > 0 {
+		defaultLimit = limit
+	}
+
+	shortUrls, err := s.healthRepository.GetBroken(ctx, defaultLimit)
+	if err != nil {
+		return nil, fmt.Errorf("GetBroken error using limit: %v. %w", defaultLimit, err)
+	}
+	return shortUrls, nil
+}
+
+// The service is degraded while clicks wait in the spool, the broker is down or was until recently
+func (s *healthService) Status(ctx context.Context) *model.ServiceStatus {
+	status := &model.ServiceStatus{Status: model.StatusOk}
+	if s.clickSpool == nil {
+		return status
+	}
+
+	status.Spool = s.clickSpool.Status()
+	if status.Spool.Events > 0 {
+		status.Status = model.StatusDegraded
+	}
+	return status
+}
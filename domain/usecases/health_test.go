@@ -0,0 +1,285 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+
+	"ehgm.com.br/url-shortener/domain/model"
+	"ehgm.com.br/url-shortener/domain/ports"
+)
+
+// Empty HealthRepository
+type healthRepositoryMock struct {
+	scanFn       func(ctx context.Context, fn func(shortUrl *model.ShortUrl) error) error
+	saveHealthFn func(ctx context.Context, id string, health *model.Health, changed bool) error
+	getBrokenFn  func(ctx context.Context, limit int) ([]model.ShortUrl, error)
+}
+
+func (r *healthRepositoryMock) Scan(ctx context.Context, fn func(shortUrl *model.ShortUrl) error) error {
+	if r.scanFn != nil {
+		return r.scanFn(ctx, fn)
+	}
+	return nil
+}
+
+func (r *healthRepositoryMock) SaveHealth(ctx context.Context, id string, health *model.Health, changed bool) error {
+	if r.saveHealthFn != nil {
+		return r.saveHealthFn(ctx, id, health, changed)
+	}
+	return nil
+}
+
+func (r *healthRepositoryMock) GetBroken(ctx context.Context, limit int) ([]model.ShortUrl, error) {
+	if r.getBrokenFn != nil {
+		return r.getBrokenFn(ctx, limit)
+	}
+	return []model.ShortUrl{}, nil
+}
+
+// Empty HealthProber
+type healthProberMock struct {
+	probeFn func(ctx context.Context, rawUrl string) *model.Health
+}
+
+func (p *healthProberMock) Probe(ctx context.Context, rawUrl string) *model.Health {
+	if p.probeFn != nil {
+		return p.probeFn(ctx, rawUrl)
+	}
+	return &model.Health{Status: 200}
+}
+
+func TestCheckAll(t *testing.T) {
+	type Input struct {
+		shortUrls []model.ShortUrl
+		status    int
+		probeErr  string
+		scanErr   error
+	}
+
+	type Output struct {
+		checked  int
+		health   map[string]model.Health
+		changed  map[string]bool
+		hasError bool
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Should check only enabled urls": {
+			Input{
+				shortUrls: []model.ShortUrl{
+					{Id: "1q2w3e", Url: "https://ehgm.com.br", Enable: true},
+					{Id: "4r5t6y", Url: "https://ehgm.com.br", Enable: false}},
+				status: 200},
+			Output{
+				checked: 1,
+				health:  map[string]model.Health{"1q2w3e": {Status: 200}},
+				changed: map[string]bool{}}},
+
+		"Test 02 - Should count the consecutive failures": {
+			Input{
+				shortUrls: []model.ShortUrl{
+					{Id: "1q2w3e", Url: "https://ehgm.com.br", Enable: true, Health: &model.Health{Broken: true, Failures: 1}},
+					{Id: "4r5t6y", Url: "https://ehgm.com.br", Enable: true}},
+				status: 404},
+			Output{
+				checked: 2,
+				health: map[string]model.Health{
+					"1q2w3e": {Status: 404, Broken: true, Failures: 2},
+					"4r5t6y": {Status: 404, Broken: true, Failures: 1}},
+				changed: map[string]bool{"4r5t6y": true}}},
+
+		"Test 03 - Should use the fallback after the max failures": {
+			Input{
+				shortUrls: []model.ShortUrl{
+					{Id: "1q2w3e", Url: "https://ehgm.com.br", Enable: true, FallbackUrl: "https://ehgm.com.br/home",
+						Health: &model.Health{Broken: true, Failures: 2}},
+					{Id: "4r5t6y", Url: "https://ehgm.com.br", Enable: true, Health: &model.Health{Broken: true, Failures: 2}}},
+				probeErr: "connection refused"},
+			Output{
+				checked: 2,
+				health: map[string]model.Health{
+					"1q2w3e": {Error: "connection refused", Broken: true, Failures: 3, Fallback: true},
+					"4r5t6y": {Error: "connection refused", Broken: true, Failures: 3}},
+				changed: map[string]bool{"1q2w3e": true}}},
+
+		"Test 04 - Should reset the failures of a healthy destination": {
+			Input{
+				shortUrls: []model.ShortUrl{
+					{Id: "1q2w3e", Url: "https://ehgm.com.br", Enable: true, FallbackUrl: "https://ehgm.com.br/home",
+						Health: &model.Health{Broken: true, Failures: 5, Fallback: true}}},
+				status: 200},
+			Output{
+				checked: 1,
+				health:  map[string]model.Health{"1q2w3e": {Status: 200}},
+				changed: map[string]bool{"1q2w3e": true}}},
+
+		"Test 05 - Should return error": {
+			Input{
+				scanErr: errors.New("Scan error")},
+			Output{
+				hasError: true}},
+	}
+
+	ctx := context.Background()
+
+	for i, test := range tests {
+		var mu sync.Mutex
+		saved := map[string]model.Health{}
+		changed := map[string]bool{}
+
+		repo := &healthRepositoryMock{
+			scanFn: func(ctx context.Context, fn func(shortUrl *model.ShortUrl) error) error {
+				for j := range test.input.shortUrls {
+					if err := fn(&test.input.shortUrls[j]); err != nil {
+						return err
+					}
+				}
+				return test.input.scanErr
+			},
+			saveHealthFn: func(ctx context.Context, id string, health *model.Health, uncache bool) error {
+				mu.Lock()
+				defer mu.Unlock()
+				saved[id] = *health
+				if uncache {
+					changed[id] = true
+				}
+				return nil
+			}}
+		prober := &healthProberMock{
+			probeFn: func(ctx context.Context, rawUrl string) *model.Health {
+				return &model.Health{Status: test.input.status, Error: test.input.probeErr}
+			}}
+
+		healthService := NewHealthService(&loggerMock{}, repo, prober, 2, 3, nil)
+		checked, err := healthService.CheckAll(ctx)
+
+		if test.output.hasError && err == nil {
+			t.Errorf("#%s: Output is: %s. But should has error: %v", i, err, test.output.hasError)
+			continue
+		}
+		if !test.output.hasError && err != nil {
+			t.Errorf("#%s: Output is: %s. But should not has error: %v", i, err, test.output.hasError)
+			continue
+		}
+		if checked != test.output.checked {
+			t.Errorf("#%s: Output is: %v. But should be: %v", i, checked, test.output.checked)
+		}
+		if !test.output.hasError && len(saved) != len(test.output.health) {
+			t.Errorf("#%s: Output is: %v. But should be: %v", i, saved, test.output.health)
+			continue
+		}
+		for id, health := range test.output.health {
+			if saved[id] != health {
+				t.Errorf("#%s: Output is: %+v. But should be: %+v", i, saved[id], health)
+			}
+		}
+		if !test.output.hasError && !reflect.DeepEqual(changed, test.output.changed) {
+			t.Errorf("#%s: Output is: %v. But should be: %v", i, changed, test.output.changed)
+		}
+	}
+}
+
+func TestGetBroken(t *testing.T) {
+	type Input struct {
+		limit int
+	}
+
+	type Output struct {
+		limit int
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Should use the default limit": {
+			Input{limit: 0},
+			Output{limit: 10}},
+
+		"Test 02 - Should use the limit": {
+			Input{limit: 50},
+			Output{limit: 50}},
+	}
+
+	ctx := context.Background()
+
+	for i, test := range tests {
+		var used int
+		repo := &healthRepositoryMock{
+			getBrokenFn: func(ctx context.Context, limit int) ([]model.ShortUrl, error) {
+				used = limit
+				return []model.ShortUrl{}, nil
+			}}
+
+		healthService := NewHealthService(&loggerMock{}, repo, &healthProberMock{}, 1, 3, nil)
+		if _, err := healthService.GetBroken(ctx, test.input.limit); err != nil {
+			t.Errorf("#%s: Output is: %s. But should not has error", i, err)
+			continue
+		}
+		if used != test.output.limit {
+			t.Errorf("#%s: Output is: %v. But should be: %v", i, used, test.output.limit)
+		}
+	}
+}
+
+// Spool with a fixed status
+type clickSpoolMock struct {
+	status model.SpoolStatus
+}
+
+func (s *clickSpoolMock) Append(event *model.ClickEvent) error {
+	return nil
+}
+
+func (s *clickSpoolMock) Replay(ctx context.Context, publish func(ctx context.Context, events []*model.ClickEvent) error) (int, error) {
+	return 0, nil
+}
+
+func (s *clickSpoolMock) Status() *model.SpoolStatus {
+	status := s.status
+	return &status
+}
+
+func TestHealthStatus(t *testing.T) {
+	type Input struct {
+		clickSpool ports.ClickSpool
+	}
+
+	type Output struct {
+		status string
+		spool  bool
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Should be ok without spool": {
+			Input{clickSpool: nil},
+			Output{status: model.StatusOk, spool: false}},
+
+		"Test 02 - Should be ok with an empty spool": {
+			Input{clickSpool: &clickSpoolMock{status: model.SpoolStatus{Segments: 1, MaxBytes: 100}}},
+			Output{status: model.StatusOk, spool: true}},
+
+		"Test 03 - Should be degraded with clicks in the spool": {
+			Input{clickSpool: &clickSpoolMock{status: model.SpoolStatus{Events: 3, Bytes: 300, Segments: 1, MaxBytes: 1000}}},
+			Output{status: model.StatusDegraded, spool: true}},
+	}
+
+	ctx := context.Background()
+
+	for i, test := range tests {
+		healthService := NewHealthService(&loggerMock{}, &healthRepositoryMock{}, &healthProberMock{}, 1, 3, test.input.clickSpool)
+		status := healthService.Status(ctx)
+		if status.Status != test.output.status || (status.Spool != nil) != test.output.spool {
+			t.Errorf("#%s: Output is: %v %v. But should be: %v %v", i, status.Status, status.Spool, test.output.status, test.output.spool)
+		}
+	}
+}
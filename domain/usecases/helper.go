@@ -0,0 +1,769 @@
+package usecases
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"ehgm.com.br/url-shortener/domain/model"
+)
+
+var utmTemplateName = regexp.MustCompile("^[a-z0-9_-]{1,64}$")
+
+var variantId = regexp.MustCompile("^[a-zA-Z0-9_-]{1,32}$")
+
+var countryCode = regexp.MustCompile("^[A-Z]{2}$")
+
+var languageTag = regexp.MustCompile("^[a-zA-Z]{1,8}(-[a-zA-Z0-9]{1,8})*$")
+
+var deepLinkScheme = regexp.MustCompile("^[a-z][a-z0-9+.-]*$")
+
+// Schemes that run code or read local content in the browser are never used as deep links
+var unsafeSchemes = map[string]bool{"javascript": true, "vbscript": true, "data": true, "file": true, "blob": true, "about": true}
+
+// Check the options of a new url, the destination itself is checked by the filters
+func validateOptions(shortUrl *model.ShortUrl) error {
+	if len(shortUrl.RedirectType) > 0 && !model.RedirectTypes[shortUrl.RedirectType] {
+		return &model.InvalidRequestError{Message: fmt.Sprintf("Redirect type %v is not valid", shortUrl.RedirectType)}
+	}
+	if len(shortUrl.QueryConflict) > 0 && !model.QueryConflicts[shortUrl.QueryConflict] {
+		return &model.InvalidRequestError{Message: fmt.Sprintf("Query conflict policy %v is not valid", shortUrl.QueryConflict)}
+	}
+	return nil
+}
+
+// Check the options of an update, empty values remove the option
+func validateUpdate(json map[string]interface{}) error {
+	for k, v := range json {
+		if v == nil || v == "" {
+			continue
+		}
+
+		switch {
+		case strings.EqualFold(k, "redirectType"):
+			if value, ok := v.(string); !ok || !model.RedirectTypes[value] {
+				return &model.InvalidRequestError{Message: fmt.Sprintf("Redirect type %v is not valid", v)}
+			}
+		case strings.EqualFold(k, "queryConflict"):
+			if value, ok := v.(string); !ok || !model.QueryConflicts[value] {
+				return &model.InvalidRequestError{Message: fmt.Sprintf("Query conflict policy %v is not valid", v)}
+			}
+		case strings.EqualFold(k, "forwardQuery"), strings.EqualFold(k, "forwardPath"), strings.EqualFold(k, "stickyVariant"):
+			if _, ok := v.(bool); !ok {
+				return &model.InvalidRequestError{Message: fmt.Sprintf("%v must be a boolean", k)}
+			}
+		}
+	}
+	return nil
+}
+
+// Forward the path suffix and the query params of the visit to the destination, when the link allows it
+func buildDestination(destination string, shortUrl *model.ShortUrl, visit *model.Visit) (string, error) {
+	if shortUrl.Utm == nil && (visit == nil || (!shortUrl.ForwardQuery && !shortUrl.ForwardPath)) {
+		return destination, nil
+	}
+	if visit == nil {
+		visit = &model.Visit{}
+	}
+
+	u, err := url.Parse(destination)
+	if err != nil {
+		return "", &model.InvalidUrlError{Messsage: fmt.Sprintf("Destination %v is not valid", destination)}
+	}
+
+	if shortUrl.ForwardPath && len(visit.Path) > 0 {
+		// Cleaning from the root, the suffix never goes above the destination path
+		rest := path.Clean("/" + visit.Path)
+		if strings.HasSuffix(visit.Path, "/") && rest != "/" {
+			rest += "/"
+		}
+		if rest != "/" {
+			if len(u.RawPath) > 0 {
+				u.RawPath = strings.TrimSuffix(u.RawPath, "/") + (&url.URL{Path: rest}).EscapedPath()
+			}
+			u.Path = strings.TrimSuffix(u.Path, "/") + rest
+		}
+	}
+
+	// The UTM params of the link are more specific than the ones in the destination
+	if shortUrl.Utm != nil {
+		u.RawQuery = mergeQuery(u.RawQuery, utmQuery(shortUrl.Utm), model.QueryOverride)
+	}
+
+	if shortUrl.ForwardQuery && len(visit.Query) > 0 {
+		u.RawQuery = mergeQuery(u.RawQuery, visit.Query, shortUrl.QueryConflict)
+	}
+	return u.String(), nil
+}
+
+// Merge the query params keeping their order and encoding, 'keep' is the default conflict policy
+func mergeQuery(destination, incoming, conflict string) string {
+	destinationKeys := queryKeys(destination)
+	incomingKeys := queryKeys(incoming)
+	params := []string{}
+
+	for _, param := range splitQuery(destination) {
+		if conflict == model.QueryOverride && incomingKeys[queryKey(param)] {
+			continue
+		}
+		params = append(params, param)
+	}
+	for _, param := range splitQuery(incoming) {
+		if (conflict == model.QueryKeep || len(conflict) <= 0) && destinationKeys[queryKey(param)] {
+			continue
+		}
+		params = append(params, param)
+	}
+	return strings.Join(params, "&")
+}
+
+func splitQuery(query string) []string {
+	params := []string{}
+	for _, param := range strings.Split(query, "&") {
+		if len(param) > 0 {
+			params = append(params, param)
+		}
+	}
+	return params
+}
+
+func queryKeys(query string) map[string]bool {
+	keys := map[string]bool{}
+	for _, param := range splitQuery(query) {
+		keys[queryKey(param)] = true
+	}
+	return keys
+}
+
+func queryKey(param string) string {
+	key := strings.SplitN(param, "=", 2)[0]
+	if unescaped, err := url.QueryUnescape(key); err == nil {
+		return unescaped
+	}
+	return key
+}
+
+func utmQuery(utm *model.Utm) string {
+	params := []string{}
+	for _, param := range [][2]string{
+		{"utm_source", utm.Source},
+		{"utm_medium", utm.Medium},
+		{"utm_campaign", utm.Campaign},
+		{"utm_term", utm.Term},
+		{"utm_content", utm.Content},
+	} {
+		if len(param[1]) > 0 {
+			params = append(params, param[0]+"="+url.QueryEscape(param[1]))
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+func validateUtm(utm *model.Utm) error {
+	for _, value := range []string{utm.Source, utm.Medium, utm.Campaign, utm.Term, utm.Content} {
+		if len(value) > 256 {
+			return &model.InvalidRequestError{Message: "UTM params cannot be longer than 256 characters"}
+		}
+	}
+	return nil
+}
+
+// The non empty params of 'over' replace the params of 'base'
+func overlayUtm(base, over model.Utm) model.Utm {
+	if len(over.Source) > 0 {
+		base.Source = over.Source
+	}
+	if len(over.Medium) > 0 {
+		base.Medium = over.Medium
+	}
+	if len(over.Campaign) > 0 {
+		base.Campaign = over.Campaign
+	}
+	if len(over.Term) > 0 {
+		base.Term = over.Term
+	}
+	if len(over.Content) > 0 {
+		base.Content = over.Content
+	}
+	return base
+}
+
+// Apply a JSON merge patch to the UTM params, an empty or null param removes it
+func patchUtm(base model.Utm, patch interface{}) (model.Utm, error) {
+	if patch == nil {
+		return model.Utm{}, nil
+	}
+	fields, ok := patch.(map[string]interface{})
+	if !ok {
+		return base, &model.InvalidRequestError{Message: "UTM params must be an object"}
+	}
+
+	params := map[string]*string{
+		"source":   &base.Source,
+		"medium":   &base.Medium,
+		"campaign": &base.Campaign,
+		"term":     &base.Term,
+		"content":  &base.Content,
+	}
+	for k, v := range fields {
+		param, ok := params[strings.ToLower(k)]
+		if !ok {
+			return base, &model.InvalidRequestError{Message: fmt.Sprintf("UTM param %v is not valid", k)}
+		}
+		if v == nil {
+			*param = ""
+			continue
+		}
+		value, ok := v.(string)
+		if !ok {
+			return base, &model.InvalidRequestError{Message: fmt.Sprintf("UTM param %v must be a string", k)}
+		}
+		*param = value
+	}
+	return base, validateUtm(&base)
+}
+
+// Check the weights and ids of the variants, the variants without id are named by their position
+func validateVariants(variants []model.Variant) error {
+	if len(variants) > 10 {
+		return &model.InvalidRequestError{Message: "A url cannot have more than 10 variants"}
+	}
+
+	total := 0
+	ids := map[string]bool{}
+	for i := range variants {
+		if variants[i].Weight < 0 {
+			return &model.InvalidRequestError{Message: "Variant weight cannot be negative"}
+		}
+		if len(variants[i].Url) <= 0 {
+			return &model.InvalidRequestError{Message: "Variant url cannot be empty"}
+		}
+		if len(variants[i].Id) <= 0 {
+			variants[i].Id = fmt.Sprintf("v%d", i+1)
+		}
+		if !variantId.MatchString(variants[i].Id) || ids[variants[i].Id] {
+			return &model.InvalidRequestError{Message: fmt.Sprintf("Variant id %v is not valid or repeated", variants[i].Id)}
+		}
+		ids[variants[i].Id] = true
+		total += variants[i].Weight
+	}
+
+	if len(variants) > 0 && total <= 0 {
+		return &model.InvalidRequestError{Message: "At least one variant must have a positive weight"}
+	}
+	return nil
+}
+
+// Read the variants of an update, the JSON decoder gives a list of objects
+func parseVariants(value interface{}) ([]model.Variant, error) {
+	variants := []model.Variant{}
+	if value == nil {
+		return variants, nil
+	}
+
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil, &model.InvalidRequestError{Message: "Variants must be a list"}
+	}
+	for _, item := range list {
+		fields, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, &model.InvalidRequestError{Message: "Variant must be an object"}
+		}
+
+		variant := model.Variant{}
+		for k, v := range fields {
+			switch strings.ToLower(k) {
+			case "id":
+				variant.Id, ok = v.(string)
+			case "url":
+				variant.Url, ok = v.(string)
+			case "weight":
+				var weight float64
+				weight, ok = v.(float64)
+				variant.Weight = int(weight)
+				ok = ok && weight == float64(variant.Weight)
+			default:
+				ok = false
+			}
+			if !ok {
+				return nil, &model.InvalidRequestError{Message: fmt.Sprintf("Variant attribute %v is not valid", k)}
+			}
+		}
+		variants = append(variants, variant)
+	}
+	return variants, nil
+}
+
+// Pick the variant where 'r', between 0 and 1, falls in the sum of the weights
+func weightedVariant(variants []model.Variant, r float64) *model.Variant {
+	total := 0
+	for _, variant := range variants {
+		total += variant.Weight
+	}
+
+	point := r * float64(total)
+	for i := range variants {
+		if point < float64(variants[i].Weight) {
+			return &variants[i]
+		}
+		point -= float64(variants[i].Weight)
+	}
+
+	// Rounding at the end of the range, the last variant with weight is used
+	for i := len(variants) - 1; i >= 0; i-- {
+		if variants[i].Weight > 0 {
+			return &variants[i]
+		}
+	}
+	return &variants[len(variants)-1]
+}
+
+// Check the geo rules and return them with the country codes in upper case
+func validateGeo(geo map[string]string) (map[string]string, error) {
+	if len(geo) > 250 {
+		return nil, &model.InvalidRequestError{Message: "A url cannot have more than 250 geo rules"}
+	}
+
+	rules := map[string]string{}
+	for country, url := range geo {
+		code := strings.ToUpper(strings.TrimSpace(country))
+		if !countryCode.MatchString(code) {
+			return nil, &model.InvalidRequestError{Message: fmt.Sprintf("Country %v is not a valid ISO 3166-1 alpha-2 code", country)}
+		}
+		if _, ok := rules[code]; ok {
+			return nil, &model.InvalidRequestError{Message: fmt.Sprintf("Country %v is repeated", code)}
+		}
+		if len(url) <= 0 {
+			return nil, &model.InvalidRequestError{Message: fmt.Sprintf("Geo url of country %v cannot be empty", code)}
+		}
+		rules[code] = url
+	}
+	return rules, nil
+}
+
+// Read the geo rules of an update, the JSON decoder gives an object of strings
+func parseGeo(value interface{}) (map[string]string, error) {
+	geo := map[string]string{}
+	if value == nil {
+		return geo, nil
+	}
+
+	fields, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, &model.InvalidRequestError{Message: "Geo rules must be an object"}
+	}
+	for k, v := range fields {
+		url, ok := v.(string)
+		if !ok {
+			return nil, &model.InvalidRequestError{Message: fmt.Sprintf("Geo url of country %v must be a string", k)}
+		}
+		geo[k] = url
+	}
+	return validateGeo(geo)
+}
+
+// Check the platforms and destinations of the device rules, a rule needs an url or a deep link
+func validateDevices(devices map[string]model.DeviceRule) error {
+	for platform, rule := range devices {
+		if !model.Platforms[platform] {
+			return &model.InvalidRequestError{Message: fmt.Sprintf("Platform %v is not valid", platform)}
+		}
+		if len(rule.Url) <= 0 && len(rule.DeepLink) <= 0 {
+			return &model.InvalidRequestError{Message: fmt.Sprintf("Device rule of %v needs an url or a deep link", platform)}
+		}
+		if platform == model.PlatformDesktop && len(rule.DeepLink) > 0 {
+			return &model.InvalidRequestError{Message: "Desktop device rule cannot have a deep link"}
+		}
+		if len(rule.DeepLink) > 0 {
+			if err := validateDeepLink(rule.DeepLink); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Deep links can use app schemes like 'myapp://' or 'intent://', and universal links with https
+func validateDeepLink(link string) error {
+	if len(link) > 2048 {
+		return &model.InvalidRequestError{Message: "Deep link cannot be longer than 2048 characters"}
+	}
+
+	u, err := url.Parse(link)
+	if err != nil || !deepLinkScheme.MatchString(strings.ToLower(u.Scheme)) || unsafeSchemes[strings.ToLower(u.Scheme)] {
+		return &model.InvalidRequestError{Message: fmt.Sprintf("Deep link %v is not valid", link)}
+	}
+	return nil
+}
+
+// Read the device rules of an update, the JSON decoder gives an object of objects
+func parseDevices(value interface{}) (map[string]model.DeviceRule, error) {
+	devices := map[string]model.DeviceRule{}
+	if value == nil {
+		return devices, nil
+	}
+
+	platforms, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, &model.InvalidRequestError{Message: "Device rules must be an object"}
+	}
+	for platform, item := range platforms {
+		fields, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, &model.InvalidRequestError{Message: fmt.Sprintf("Device rule of %v must be an object", platform)}
+		}
+
+		key := strings.ToLower(platform)
+		if _, ok := devices[key]; ok {
+			return nil, &model.InvalidRequestError{Message: fmt.Sprintf("Platform %v is repeated", key)}
+		}
+
+		rule := model.DeviceRule{}
+		for k, v := range fields {
+			switch strings.ToLower(k) {
+			case "url":
+				rule.Url, ok = v.(string)
+			case "deeplink":
+				rule.DeepLink, ok = v.(string)
+			default:
+				ok = false
+			}
+			if !ok {
+				return nil, &model.InvalidRequestError{Message: fmt.Sprintf("Device rule attribute %v is not valid", k)}
+			}
+		}
+		devices[key] = rule
+	}
+	return devices, validateDevices(devices)
+}
+
+// Check the language rules and return them with the tags in their usual case, like 'pt-BR' and 'zh-Hant'
+func validateLanguages(languages map[string]string) (map[string]string, error) {
+	if len(languages) > 100 {
+		return nil, &model.InvalidRequestError{Message: "A url cannot have more than 100 language rules"}
+	}
+
+	rules := map[string]string{}
+	for language, url := range languages {
+		tag := strings.TrimSpace(language)
+		if !languageTag.MatchString(tag) {
+			return nil, &model.InvalidRequestError{Message: fmt.Sprintf("Language %v is not a valid language tag", language)}
+		}
+		tag = formatLanguage(tag)
+		if _, ok := rules[tag]; ok {
+			return nil, &model.InvalidRequestError{Message: fmt.Sprintf("Language %v is repeated", tag)}
+		}
+		if len(url) <= 0 {
+			return nil, &model.InvalidRequestError{Message: fmt.Sprintf("Language url of %v cannot be empty", tag)}
+		}
+		rules[tag] = url
+	}
+	return rules, nil
+}
+
+// Language in lower case, region in upper case and script in title case
+func formatLanguage(tag string) string {
+	parts := strings.Split(strings.ToLower(tag), "-")
+	for i := 1; i < len(parts); i++ {
+		switch {
+		case len(parts[i]) == 2 || (len(parts[i]) == 3 && parts[i][0] >= '0' && parts[i][0] <= '9'):
+			parts[i] = strings.ToUpper(parts[i])
+		case len(parts[i]) == 4:
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+	return strings.Join(parts, "-")
+}
+
+// Read the language rules of an update, the JSON decoder gives an object of strings
+func parseLanguages(value interface{}) (map[string]string, error) {
+	languages := map[string]string{}
+	if value == nil {
+		return languages, nil
+	}
+
+	fields, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, &model.InvalidRequestError{Message: "Language rules must be an object"}
+	}
+	for k, v := range fields {
+		url, ok := v.(string)
+		if !ok {
+			return nil, &model.InvalidRequestError{Message: fmt.Sprintf("Language url of %v must be a string", k)}
+		}
+		languages[k] = url
+	}
+	return validateLanguages(languages)
+}
+
+// Languages of an 'Accept-Language' header from the most to the least wanted, the ones with q=0 are refused
+func parseAcceptLanguage(header string) []string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+
+	var ranges []weighted
+	for i, item := range strings.Split(header, ",") {
+		// A client cannot make the negotiation slow with a huge header
+		if i >= 32 {
+			break
+		}
+
+		params := strings.Split(item, ";")
+		tag := strings.ToLower(strings.TrimSpace(params[0]))
+		if tag != "*" && !languageTag.MatchString(tag) {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if !strings.HasPrefix(param, "q=") {
+				continue
+			}
+			value, err := strconv.ParseFloat(param[2:], 64)
+			if err != nil || value < 0 || value > 1 {
+				value = 0
+			}
+			q = value
+		}
+		if q > 0 {
+			ranges = append(ranges, weighted{tag: tag, q: q})
+		}
+	}
+
+	// Languages with the same quality keep the order of the header
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].q > ranges[j].q })
+
+	tags := make([]string, 0, len(ranges))
+	for _, r := range ranges {
+		tags = append(tags, r.tag)
+	}
+	return tags
+}
+
+// Find the rule of the most wanted language. Each language is looked up removing its last subtags, 'pt-BR' matches
+// 'pt', and then any rule of the same primary language, 'pt' matches 'pt-BR'. A '*' or no match uses the default destination
+func matchLanguage(rules map[string]string, header string) string {
+	if len(rules) <= 0 {
+		return ""
+	}
+
+	lower := make(map[string]string, len(rules))
+	tags := make([]string, 0, len(rules))
+	for tag, url := range rules {
+		lower[strings.ToLower(tag)] = url
+		tags = append(tags, strings.ToLower(tag))
+	}
+	sort.Strings(tags)
+
+	for _, wanted := range parseAcceptLanguage(header) {
+		if wanted == "*" {
+			return ""
+		}
+
+		for tag := wanted; len(tag) > 0; {
+			if url, ok := lower[tag]; ok {
+				return url
+			}
+			end := strings.LastIndex(tag, "-")
+			if end < 0 {
+				break
+			}
+			tag = tag[:end]
+		}
+
+		primary := strings.SplitN(wanted, "-", 2)[0]
+		for _, tag := range tags {
+			if strings.SplitN(tag, "-", 2)[0] == primary {
+				return lower[tag]
+			}
+		}
+	}
+	return ""
+}
+
+// Check the activation window and sort the scheduled destinations by time
+func validateSchedule(activeFrom, activeUntil *time.Time, schedule []model.ScheduledUrl) error {
+	if activeFrom != nil && activeUntil != nil && !activeFrom.Before(*activeUntil) {
+		return &model.InvalidRequestError{Message: "Active from must be before active until"}
+	}
+	if len(schedule) > 50 {
+		return &model.InvalidRequestError{Message: "A url cannot have more than 50 scheduled destinations"}
+	}
+
+	sort.SliceStable(schedule, func(i, j int) bool { return schedule[i].At.Before(schedule[j].At) })
+	for i := range schedule {
+		if schedule[i].At.IsZero() {
+			return &model.InvalidRequestError{Message: "Scheduled destination needs a time"}
+		}
+		if len(schedule[i].Url) <= 0 {
+			return &model.InvalidRequestError{Message: "Scheduled destination url cannot be empty"}
+		}
+		if i > 0 && schedule[i].At.Equal(schedule[i-1].At) {
+			return &model.InvalidRequestError{Message: fmt.Sprintf("Scheduled time %v is repeated", schedule[i].At.Format(time.RFC3339))}
+		}
+	}
+	return nil
+}
+
+// Read a time of an update, in RFC 3339 format. A null time removes it
+func parseTime(key string, value interface{}) (*time.Time, error) {
+	if value == nil || value == "" {
+		return nil, nil
+	}
+
+	text, ok := value.(string)
+	if !ok {
+		return nil, &model.InvalidRequestError{Message: fmt.Sprintf("%v must be a RFC 3339 time", key)}
+	}
+	parsed, err := time.Parse(time.RFC3339, text)
+	if err != nil {
+		return nil, &model.InvalidRequestError{Message: fmt.Sprintf("%v must be a RFC 3339 time", key)}
+	}
+	return &parsed, nil
+}
+
+// Read the scheduled destinations of an update, the JSON decoder gives a list of objects
+func parseSchedule(value interface{}) ([]model.ScheduledUrl, error) {
+	schedule := []model.ScheduledUrl{}
+	if value == nil {
+		return schedule, nil
+	}
+
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil, &model.InvalidRequestError{Message: "Schedule must be a list"}
+	}
+	for _, item := range list {
+		fields, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, &model.InvalidRequestError{Message: "Scheduled destination must be an object"}
+		}
+
+		scheduled := model.ScheduledUrl{}
+		for k, v := range fields {
+			switch strings.ToLower(k) {
+			case "at":
+				at, err := parseTime("Scheduled time", v)
+				if err != nil {
+					return nil, err
+				}
+				ok = at != nil
+				if ok {
+					scheduled.At = *at
+				}
+			case "url":
+				scheduled.Url, ok = v.(string)
+			default:
+				ok = false
+			}
+			if !ok {
+				return nil, &model.InvalidRequestError{Message: fmt.Sprintf("Scheduled destination attribute %v is not valid", k)}
+			}
+		}
+		schedule = append(schedule, scheduled)
+	}
+	return schedule, nil
+}
+
+// Returns the state of a link outside of its activation window, or an empty string while it is active
+func activeWindow(shortUrl *model.ShortUrl, now time.Time) string {
+	if shortUrl.ActiveFrom != nil && now.Before(*shortUrl.ActiveFrom) {
+		return model.WindowPending
+	}
+	if shortUrl.ActiveUntil != nil && !now.Before(*shortUrl.ActiveUntil) {
+		return model.WindowExpired
+	}
+	return ""
+}
+
+// The last scheduled destination whose time has come replaces the url, the schedule is sorted by time
+func scheduledUrl(shortUrl *model.ShortUrl, now time.Time) string {
+	url := shortUrl.Url
+	for _, scheduled := range shortUrl.Schedule {
+		if now.Before(scheduled.At) {
+			break
+		}
+		url = scheduled.Url
+	}
+	return url
+}
+
+// Time until the destination of the link changes by its schedule or window, 0 when it never changes
+func nextChange(shortUrl *model.ShortUrl, now time.Time) time.Duration {
+	var next time.Duration
+	times := []*time.Time{shortUrl.ActiveUntil}
+	for i := range shortUrl.Schedule {
+		times = append(times, &shortUrl.Schedule[i].At)
+	}
+
+	for _, at := range times {
+		if at == nil || !at.After(now) {
+			continue
+		}
+		if until := at.Sub(now); next <= 0 || until < next {
+			next = until
+		}
+	}
+	return next
+}
+
+// Keep only the network of the ip, the last octet of IPv4 and the last 80 bits of IPv6 are zeroed
+func anonymizeIp(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return parsed.Mask(net.CIDRMask(48, 128)).String()
+}
+
+// Add the pending counts of the url to its saved ones, the variant clicks are copied before being changed
+func addPendingClicks(shortUrl *model.ShortUrl, counts []model.ClickCount) {
+	variantClicks := map[string]int64{}
+	for variant, clicks := range shortUrl.VariantClicks {
+		variantClicks[variant] = clicks
+	}
+
+	for _, count := range counts {
+		if count.Id != shortUrl.Id {
+			continue
+		}
+		shortUrl.Clicks += count.Clicks
+		if len(count.Variant) > 0 {
+			variantClicks[count.Variant] += count.Clicks
+		}
+	}
+	if len(variantClicks) > 0 {
+		shortUrl.VariantClicks = variantClicks
+	}
+}
+
+// The most clicked urls first, at most 'limit' of them
+func rankByClicks(shortUrls []model.ShortUrl, limit int) []model.ShortUrl {
+	sort.SliceStable(shortUrls, func(i, j int) bool { return shortUrls[i].Clicks > shortUrls[j].Clicks })
+	if len(shortUrls) > limit {
+		shortUrls = shortUrls[:limit]
+	}
+	return shortUrls
+}
+
+// Each count becomes a click with an id derived from the flush, so a flush tried again is applied once
+func flushClicks(flushId string, counts []model.ClickCount) []model.Click {
+	clicks := make([]model.Click, len(counts))
+	for i, count := range counts {
+		clicks[i] = model.Click{MessageId: fmt.Sprintf("%v-%v", flushId, i), Id: count.Id, Variant: count.Variant, Count: count.Clicks}
+	}
+	return clicks
+}
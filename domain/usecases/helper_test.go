@@ -0,0 +1,664 @@
+package usecases
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"ehgm.com.br/url-shortener/domain/model"
+)
+
+func TestBuildDestination(t *testing.T) {
+	type Input struct {
+		destination string
+		shortUrl    model.ShortUrl
+		visit       model.Visit
+	}
+
+	type Output struct {
+		url string
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Should not forward by default": {
+			Input{destination: "https://ehgm.com.br/a?x=1",
+				shortUrl: model.ShortUrl{},
+				visit:    model.Visit{Path: "/b", Query: "utm_source=mail"}},
+			Output{url: "https://ehgm.com.br/a?x=1"}},
+
+		"Test 02 - Should forward the query": {
+			Input{destination: "https://ehgm.com.br/a?x=1",
+				shortUrl: model.ShortUrl{ForwardQuery: true},
+				visit:    model.Visit{Path: "/b", Query: "utm_source=mail&y=2"}},
+			Output{url: "https://ehgm.com.br/a?x=1&utm_source=mail&y=2"}},
+
+		"Test 03 - Should keep the destination params": {
+			Input{destination: "https://ehgm.com.br/a?x=1&y=1",
+				shortUrl: model.ShortUrl{ForwardQuery: true, QueryConflict: model.QueryKeep},
+				visit:    model.Visit{Query: "y=2&z=3"}},
+			Output{url: "https://ehgm.com.br/a?x=1&y=1&z=3"}},
+
+		"Test 04 - Should override the destination params": {
+			Input{destination: "https://ehgm.com.br/a?x=1&y=1",
+				shortUrl: model.ShortUrl{ForwardQuery: true, QueryConflict: model.QueryOverride},
+				visit:    model.Visit{Query: "y=2&z=3"}},
+			Output{url: "https://ehgm.com.br/a?x=1&y=2&z=3"}},
+
+		"Test 05 - Should append the params": {
+			Input{destination: "https://ehgm.com.br/a?x=1&y=1",
+				shortUrl: model.ShortUrl{ForwardQuery: true, QueryConflict: model.QueryAppend},
+				visit:    model.Visit{Query: "y=2"}},
+			Output{url: "https://ehgm.com.br/a?x=1&y=1&y=2"}},
+
+		"Test 06 - Should forward the path": {
+			Input{destination: "https://ehgm.com.br/docs/",
+				shortUrl: model.ShortUrl{ForwardPath: true},
+				visit:    model.Visit{Path: "/api/v1/", Query: "x=1"}},
+			Output{url: "https://ehgm.com.br/docs/api/v1/"}},
+
+		"Test 07 - Should not go above the destination path": {
+			Input{destination: "https://ehgm.com.br/docs",
+				shortUrl: model.ShortUrl{ForwardPath: true},
+				visit:    model.Visit{Path: "/../../admin"}},
+			Output{url: "https://ehgm.com.br/docs/admin"}},
+
+		"Test 08 - Should forward the path and query before the fragment": {
+			Input{destination: "https://ehgm.com.br/docs?x=1#top",
+				shortUrl: model.ShortUrl{ForwardPath: true, ForwardQuery: true},
+				visit:    model.Visit{Path: "/a b", Query: "q=%C3%A9"}},
+			Output{url: "https://ehgm.com.br/docs/a%20b?x=1&q=%C3%A9#top"}},
+
+		"Test 09 - Should ignore an empty path": {
+			Input{destination: "https://ehgm.com.br/docs",
+				shortUrl: model.ShortUrl{ForwardPath: true},
+				visit:    model.Visit{Path: "/"}},
+			Output{url: "https://ehgm.com.br/docs"}},
+
+		"Test 10 - Should add the UTM params": {
+			Input{destination: "https://ehgm.com.br/docs?utm_source=old&x=1",
+				shortUrl: model.ShortUrl{Utm: &model.Utm{Source: "news letter", Campaign: "black-friday"}},
+				visit:    model.Visit{Query: "y=2"}},
+			Output{url: "https://ehgm.com.br/docs?x=1&utm_source=news+letter&utm_campaign=black-friday"}},
+
+		"Test 11 - Should keep the UTM params of the link": {
+			Input{destination: "https://ehgm.com.br/docs",
+				shortUrl: model.ShortUrl{Utm: &model.Utm{Source: "newsletter"}, ForwardQuery: true},
+				visit:    model.Visit{Query: "utm_source=twitter&utm_medium=social"}},
+			Output{url: "https://ehgm.com.br/docs?utm_source=newsletter&utm_medium=social"}},
+	}
+
+	for i, test := range tests {
+		url, err := buildDestination(test.input.destination, &test.input.shortUrl, &test.input.visit)
+		if err != nil {
+			t.Errorf("#%s: Output is: %s. But should not has error", i, err)
+			continue
+		}
+		if url != test.output.url {
+			t.Errorf("#%s: Output is: %v. But should be: %v", i, url, test.output.url)
+		}
+	}
+}
+
+func TestValidateUpdate(t *testing.T) {
+	type Input struct {
+		json map[string]interface{}
+	}
+
+	type Output struct {
+		hasError bool
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Valid options": {
+			Input{json: map[string]interface{}{"redirectType": "308", "queryConflict": "append", "forwardQuery": true, "forwardPath": false}},
+			Output{hasError: false}},
+
+		"Test 02 - Empty options": {
+			Input{json: map[string]interface{}{"redirectType": "", "queryConflict": nil}},
+			Output{hasError: false}},
+
+		"Test 03 - Invalid query conflict policy": {
+			Input{json: map[string]interface{}{"queryConflict": "replace"}},
+			Output{hasError: true}},
+
+		"Test 04 - Invalid forward path": {
+			Input{json: map[string]interface{}{"forwardPath": "yes"}},
+			Output{hasError: true}},
+	}
+
+	for i, test := range tests {
+		err := validateUpdate(test.input.json)
+		if test.output.hasError && err == nil {
+			t.Errorf("#%s: Output is: %s. But should has error: %v", i, err, test.output.hasError)
+			continue
+		}
+		if !test.output.hasError && err != nil {
+			t.Errorf("#%s: Output is: %s. But should not has error: %v", i, err, test.output.hasError)
+		}
+	}
+}
+
+func TestWeightedVariant(t *testing.T) {
+	variants := []model.Variant{
+		{Id: "a", Url: "https://ehgm.com.br/a", Weight: 1},
+		{Id: "b", Url: "https://ehgm.com.br/b", Weight: 0},
+		{Id: "c", Url: "https://ehgm.com.br/c", Weight: 3},
+	}
+
+	type Input struct {
+		r float64
+	}
+
+	type Output struct {
+		id string
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Should pick the first variant": {
+			Input{r: 0},
+			Output{id: "a"}},
+
+		"Test 02 - Should skip the variant without weight": {
+			Input{r: 0.25},
+			Output{id: "c"}},
+
+		"Test 03 - Should pick the last variant": {
+			Input{r: 0.99},
+			Output{id: "c"}},
+
+		"Test 04 - Should pick a variant at the end of the range": {
+			Input{r: 1},
+			Output{id: "c"}},
+	}
+
+	for i, test := range tests {
+		variant := weightedVariant(variants, test.input.r)
+		if variant.Id != test.output.id {
+			t.Errorf("#%s: Output is: %v. But should be: %v", i, variant.Id, test.output.id)
+		}
+	}
+}
+
+func TestValidateVariants(t *testing.T) {
+	type Input struct {
+		variants []model.Variant
+	}
+
+	type Output struct {
+		ids      []string
+		hasError bool
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Should name the variants without id": {
+			Input{variants: []model.Variant{{Url: "https://ehgm.com.br/a", Weight: 1}, {Id: "blue", Url: "https://ehgm.com.br/b", Weight: 1}}},
+			Output{ids: []string{"v1", "blue"}}},
+
+		"Test 02 - Should return error for repeated ids": {
+			Input{variants: []model.Variant{{Id: "a", Url: "https://ehgm.com.br/a", Weight: 1}, {Id: "a", Url: "https://ehgm.com.br/b", Weight: 1}}},
+			Output{hasError: true}},
+
+		"Test 03 - Should return error without weight": {
+			Input{variants: []model.Variant{{Url: "https://ehgm.com.br/a", Weight: 0}}},
+			Output{hasError: true}},
+
+		"Test 04 - Should return error for a negative weight": {
+			Input{variants: []model.Variant{{Url: "https://ehgm.com.br/a", Weight: 2}, {Url: "https://ehgm.com.br/b", Weight: -1}}},
+			Output{hasError: true}},
+
+		"Test 05 - Should return error for an empty url": {
+			Input{variants: []model.Variant{{Weight: 1}}},
+			Output{hasError: true}},
+	}
+
+	for i, test := range tests {
+		err := validateVariants(test.input.variants)
+		if test.output.hasError && err == nil {
+			t.Errorf("#%s: Output is: %s. But should has error: %v", i, err, test.output.hasError)
+			continue
+		}
+		if !test.output.hasError && err != nil {
+			t.Errorf("#%s: Output is: %s. But should not has error: %v", i, err, test.output.hasError)
+			continue
+		}
+		for j, id := range test.output.ids {
+			if test.input.variants[j].Id != id {
+				t.Errorf("#%s: Output is: %v. But should be: %v", i, test.input.variants[j].Id, id)
+			}
+		}
+	}
+}
+
+func TestParseVariants(t *testing.T) {
+	type Input struct {
+		value interface{}
+	}
+
+	type Output struct {
+		variants []model.Variant
+		hasError bool
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Should read the variants": {
+			Input{value: []interface{}{map[string]interface{}{"id": "a", "url": "https://ehgm.com.br/a", "weight": float64(3)}}},
+			Output{variants: []model.Variant{{Id: "a", Url: "https://ehgm.com.br/a", Weight: 3}}}},
+
+		"Test 02 - Should remove the variants": {
+			Input{value: nil},
+			Output{variants: []model.Variant{}}},
+
+		"Test 03 - Should return error for a decimal weight": {
+			Input{value: []interface{}{map[string]interface{}{"url": "https://ehgm.com.br/a", "weight": 1.5}}},
+			Output{hasError: true}},
+
+		"Test 04 - Should return error for an unknown attribute": {
+			Input{value: []interface{}{map[string]interface{}{"url": "https://ehgm.com.br/a", "clicks": float64(1)}}},
+			Output{hasError: true}},
+
+		"Test 05 - Should return error for an object": {
+			Input{value: map[string]interface{}{"url": "https://ehgm.com.br/a"}},
+			Output{hasError: true}},
+	}
+
+	for i, test := range tests {
+		variants, err := parseVariants(test.input.value)
+		if test.output.hasError && err == nil {
+			t.Errorf("#%s: Output is: %s. But should has error: %v", i, err, test.output.hasError)
+			continue
+		}
+		if !test.output.hasError && err != nil {
+			t.Errorf("#%s: Output is: %s. But should not has error: %v", i, err, test.output.hasError)
+			continue
+		}
+		if !test.output.hasError && !reflect.DeepEqual(variants, test.output.variants) {
+			t.Errorf("#%s: Output is: %v. But should be: %v", i, variants, test.output.variants)
+		}
+	}
+}
+
+func TestParseGeo(t *testing.T) {
+	type Input struct {
+		value interface{}
+	}
+
+	type Output struct {
+		geo      map[string]string
+		hasError bool
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Should use upper case countries": {
+			Input{value: map[string]interface{}{"br": "https://ehgm.com.br/br", "US": "https://ehgm.com.br/us"}},
+			Output{geo: map[string]string{"BR": "https://ehgm.com.br/br", "US": "https://ehgm.com.br/us"}}},
+
+		"Test 02 - Null removes the rules": {
+			Input{value: nil},
+			Output{geo: map[string]string{}}},
+
+		"Test 03 - Invalid country": {
+			Input{value: map[string]interface{}{"BRA": "https://ehgm.com.br/br"}},
+			Output{hasError: true}},
+
+		"Test 04 - Repeated country": {
+			Input{value: map[string]interface{}{"br": "https://ehgm.com.br/br", "BR": "https://ehgm.com.br"}},
+			Output{hasError: true}},
+
+		"Test 05 - Invalid url type": {
+			Input{value: map[string]interface{}{"BR": 10}},
+			Output{hasError: true}},
+
+		"Test 06 - Empty url": {
+			Input{value: map[string]interface{}{"BR": ""}},
+			Output{hasError: true}},
+
+		"Test 07 - Not an object": {
+			Input{value: []interface{}{"BR"}},
+			Output{hasError: true}},
+	}
+
+	for i, test := range tests {
+		geo, err := parseGeo(test.input.value)
+		if test.output.hasError && err == nil {
+			t.Errorf("#%s: Output is: %s. But should has error: %v", i, err, test.output.hasError)
+			continue
+		}
+		if !test.output.hasError && err != nil {
+			t.Errorf("#%s: Output is: %s. But should not has error: %v", i, err, test.output.hasError)
+			continue
+		}
+		if !test.output.hasError && !reflect.DeepEqual(geo, test.output.geo) {
+			t.Errorf("#%s: Output is: %v. But should be: %v", i, geo, test.output.geo)
+		}
+	}
+}
+
+func TestParseDevices(t *testing.T) {
+	type Input struct {
+		value interface{}
+	}
+
+	type Output struct {
+		devices  map[string]model.DeviceRule
+		hasError bool
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Should read the rules": {
+			Input{value: map[string]interface{}{
+				"iOS":     map[string]interface{}{"url": "https://apps.apple.com/app/id1", "deepLink": "myapp://home"},
+				"android": map[string]interface{}{"deepLink": "intent://home#Intent;scheme=myapp;package=br.com.ehgm;end"},
+				"desktop": map[string]interface{}{"url": "https://ehgm.com.br"}}},
+			Output{devices: map[string]model.DeviceRule{
+				"ios":     {Url: "https://apps.apple.com/app/id1", DeepLink: "myapp://home"},
+				"android": {DeepLink: "intent://home#Intent;scheme=myapp;package=br.com.ehgm;end"},
+				"desktop": {Url: "https://ehgm.com.br"}}}},
+
+		"Test 02 - Null removes the rules": {
+			Input{value: nil},
+			Output{devices: map[string]model.DeviceRule{}}},
+
+		"Test 03 - Invalid platform": {
+			Input{value: map[string]interface{}{"windows": map[string]interface{}{"url": "https://ehgm.com.br"}}},
+			Output{hasError: true}},
+
+		"Test 04 - Rule without destination": {
+			Input{value: map[string]interface{}{"ios": map[string]interface{}{}}},
+			Output{hasError: true}},
+
+		"Test 05 - Unsafe deep link": {
+			Input{value: map[string]interface{}{"ios": map[string]interface{}{"deepLink": "javascript:alert(1)"}}},
+			Output{hasError: true}},
+
+		"Test 06 - Deep link without scheme": {
+			Input{value: map[string]interface{}{"android": map[string]interface{}{"deepLink": "home/page"}}},
+			Output{hasError: true}},
+
+		"Test 07 - Desktop deep link": {
+			Input{value: map[string]interface{}{"desktop": map[string]interface{}{"deepLink": "myapp://home"}}},
+			Output{hasError: true}},
+
+		"Test 08 - Unknown attribute": {
+			Input{value: map[string]interface{}{"ios": map[string]interface{}{"store": "https://apps.apple.com"}}},
+			Output{hasError: true}},
+
+		"Test 09 - Repeated platform": {
+			Input{value: map[string]interface{}{
+				"ios": map[string]interface{}{"url": "https://apps.apple.com/app/id1"},
+				"IOS": map[string]interface{}{"url": "https://apps.apple.com/app/id2"}}},
+			Output{hasError: true}},
+	}
+
+	for i, test := range tests {
+		devices, err := parseDevices(test.input.value)
+		if test.output.hasError && err == nil {
+			t.Errorf("#%s: Output is: %s. But should has error: %v", i, err, test.output.hasError)
+			continue
+		}
+		if !test.output.hasError && err != nil {
+			t.Errorf("#%s: Output is: %s. But should not has error: %v", i, err, test.output.hasError)
+			continue
+		}
+		if !test.output.hasError && !reflect.DeepEqual(devices, test.output.devices) {
+			t.Errorf("#%s: Output is: %v. But should be: %v", i, devices, test.output.devices)
+		}
+	}
+}
+
+func TestMatchLanguage(t *testing.T) {
+	rules := map[string]string{
+		"pt-BR": "https://ehgm.com.br/pt-br",
+		"pt-PT": "https://ehgm.com.br/pt-pt",
+		"en":    "https://ehgm.com.br/en",
+		"es":    "https://ehgm.com.br/es",
+	}
+
+	type Input struct {
+		header string
+	}
+
+	type Output struct {
+		url string
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Exact language": {
+			Input{header: "pt-BR"},
+			Output{url: "https://ehgm.com.br/pt-br"}},
+
+		"Test 02 - Case insensitive": {
+			Input{header: "PT-pt"},
+			Output{url: "https://ehgm.com.br/pt-pt"}},
+
+		"Test 03 - Region removed": {
+			Input{header: "en-US,en;q=0.9"},
+			Output{url: "https://ehgm.com.br/en"}},
+
+		"Test 04 - Highest quality wins": {
+			Input{header: "en;q=0.5, es;q=0.8, fr"},
+			Output{url: "https://ehgm.com.br/es"}},
+
+		"Test 05 - Same primary language": {
+			Input{header: "pt, en;q=0.9"},
+			Output{url: "https://ehgm.com.br/pt-br"}},
+
+		"Test 06 - Refused language": {
+			Input{header: "es;q=0, en;q=0.1"},
+			Output{url: "https://ehgm.com.br/en"}},
+
+		"Test 07 - Wildcard uses the default": {
+			Input{header: "fr, *;q=0.5, en;q=0.1"},
+			Output{url: ""}},
+
+		"Test 08 - No match uses the default": {
+			Input{header: "fr-FR, de;q=0.8"},
+			Output{url: ""}},
+
+		"Test 09 - Invalid quality is refused": {
+			Input{header: "es;q=2, en;q=0.3"},
+			Output{url: "https://ehgm.com.br/en"}},
+
+		"Test 10 - Empty header": {
+			Input{header: ""},
+			Output{url: ""}},
+	}
+
+	for i, test := range tests {
+		if url := matchLanguage(rules, test.input.header); url != test.output.url {
+			t.Errorf("#%s: Output is: %v. But should be: %v", i, url, test.output.url)
+		}
+	}
+}
+
+func TestParseLanguages(t *testing.T) {
+	type Input struct {
+		value interface{}
+	}
+
+	type Output struct {
+		languages map[string]string
+		hasError  bool
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Should format the tags": {
+			Input{value: map[string]interface{}{"PT-br": "https://ehgm.com.br/pt", "zh-hant-tw": "https://ehgm.com.br/zh", "es-419": "https://ehgm.com.br/es"}},
+			Output{languages: map[string]string{"pt-BR": "https://ehgm.com.br/pt", "zh-Hant-TW": "https://ehgm.com.br/zh", "es-419": "https://ehgm.com.br/es"}}},
+
+		"Test 02 - Null removes the rules": {
+			Input{value: nil},
+			Output{languages: map[string]string{}}},
+
+		"Test 03 - Invalid tag": {
+			Input{value: map[string]interface{}{"pt_BR": "https://ehgm.com.br/pt"}},
+			Output{hasError: true}},
+
+		"Test 04 - Repeated tag": {
+			Input{value: map[string]interface{}{"en": "https://ehgm.com.br/en", "EN": "https://ehgm.com.br"}},
+			Output{hasError: true}},
+
+		"Test 05 - Invalid url type": {
+			Input{value: map[string]interface{}{"en": true}},
+			Output{hasError: true}},
+	}
+
+	for i, test := range tests {
+		languages, err := parseLanguages(test.input.value)
+		if test.output.hasError && err == nil {
+			t.Errorf("#%s: Output is: %s. But should has error: %v", i, err, test.output.hasError)
+			continue
+		}
+		if !test.output.hasError && err != nil {
+			t.Errorf("#%s: Output is: %s. But should not has error: %v", i, err, test.output.hasError)
+			continue
+		}
+		if !test.output.hasError && !reflect.DeepEqual(languages, test.output.languages) {
+			t.Errorf("#%s: Output is: %v. But should be: %v", i, languages, test.output.languages)
+		}
+	}
+}
+
+func TestParseSchedule(t *testing.T) {
+	type Input struct {
+		value interface{}
+	}
+
+	type Output struct {
+		schedule []model.ScheduledUrl
+		hasError bool
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Should sort by time": {
+			Input{value: []interface{}{
+				map[string]interface{}{"at": "2021-11-27T00:00:00Z", "url": "https://ehgm.com.br/day2"},
+				map[string]interface{}{"at": "2021-11-26T12:00:00-03:00", "url": "https://ehgm.com.br/day1"}}},
+			Output{schedule: []model.ScheduledUrl{
+				{At: time.Date(2021, 11, 26, 12, 0, 0, 0, time.FixedZone("", -3*3600)), Url: "https://ehgm.com.br/day1"},
+				{At: time.Date(2021, 11, 27, 0, 0, 0, 0, time.UTC), Url: "https://ehgm.com.br/day2"}}}},
+
+		"Test 02 - Null removes the schedule": {
+			Input{value: nil},
+			Output{schedule: []model.ScheduledUrl{}}},
+
+		"Test 03 - Invalid time": {
+			Input{value: []interface{}{map[string]interface{}{"at": "27/11/2021", "url": "https://ehgm.com.br"}}},
+			Output{hasError: true}},
+
+		"Test 04 - Missing time": {
+			Input{value: []interface{}{map[string]interface{}{"url": "https://ehgm.com.br"}}},
+			Output{hasError: true}},
+
+		"Test 05 - Repeated time": {
+			Input{value: []interface{}{
+				map[string]interface{}{"at": "2021-11-27T00:00:00Z", "url": "https://ehgm.com.br/a"},
+				map[string]interface{}{"at": "2021-11-26T21:00:00-03:00", "url": "https://ehgm.com.br/b"}}},
+			Output{hasError: true}},
+	}
+
+	for i, test := range tests {
+		schedule, err := parseSchedule(test.input.value)
+		if err == nil {
+			err = validateSchedule(nil, nil, schedule)
+		}
+		if test.output.hasError && err == nil {
+			t.Errorf("#%s: Output is: %s. But should has error: %v", i, err, test.output.hasError)
+			continue
+		}
+		if !test.output.hasError && err != nil {
+			t.Errorf("#%s: Output is: %s. But should not has error: %v", i, err, test.output.hasError)
+			continue
+		}
+		if test.output.hasError {
+			continue
+		}
+		if len(schedule) != len(test.output.schedule) {
+			t.Errorf("#%s: Output is: %v. But should be: %v", i, schedule, test.output.schedule)
+			continue
+		}
+		for j := range schedule {
+			if !schedule[j].At.Equal(test.output.schedule[j].At) || schedule[j].Url != test.output.schedule[j].Url {
+				t.Errorf("#%s: Output is: %v. But should be: %v", i, schedule, test.output.schedule)
+			}
+		}
+	}
+}
+
+func TestPatchWindow(t *testing.T) {
+	type Input struct {
+		json map[string]interface{}
+	}
+
+	type Output struct {
+		json     map[string]interface{}
+		hasError bool
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Should parse the times": {
+			Input{json: map[string]interface{}{"activeFrom": "2021-11-26T00:00:00Z", "ActiveUntil": "2021-11-29T00:00:00Z"}},
+			Output{json: map[string]interface{}{
+				"activeFrom":  time.Date(2021, 11, 26, 0, 0, 0, 0, time.UTC),
+				"activeUntil": time.Date(2021, 11, 29, 0, 0, 0, 0, time.UTC)}}},
+
+		"Test 02 - Null removes the time": {
+			Input{json: map[string]interface{}{"activeUntil": nil, "enable": true}},
+			Output{json: map[string]interface{}{"activeUntil": nil, "enable": true}}},
+
+		"Test 03 - End before the start": {
+			Input{json: map[string]interface{}{"activeFrom": "2021-11-29T00:00:00Z", "activeUntil": "2021-11-26T00:00:00Z"}},
+			Output{hasError: true}},
+
+		"Test 04 - Invalid time": {
+			Input{json: map[string]interface{}{"activeFrom": 1637884800}},
+			Output{hasError: true}},
+	}
+
+	for i, test := range tests {
+		err := patchWindow(test.input.json)
+		if test.output.hasError && err == nil {
+			t.Errorf("#%s: Output is: %s. But should has error: %v", i, err, test.output.hasError)
+			continue
+		}
+		if !test.output.hasError && err != nil {
+			t.Errorf("#%s: Output is: %s. But should not has error: %v", i, err, test.output.hasError)
+			continue
+		}
+		if !test.output.hasError && !reflect.DeepEqual(test.input.json, test.output.json) {
+			t.Errorf("#%s: Output is: %v. But should be: %v", i, test.input.json, test.output.json)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package usecases
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"ehgm.com.br/url-shortener/domain/model"
+	"ehgm.com.br/url-shortener/domain/ports"
+)
+
+// Struct that implements 'ModerationService' interface
+type moderationService struct {
+	log                  ports.Logger
+	urlRepository        ports.UrlRepository
+	moderationRepository ports.ModerationRepository
+	reportLimiter        ports.RateLimiter
+	reportThreshold      int64
+	batchSize            int
+}
+
+// Get an instance of 'ModerationService' using this method.
+// Urls reaching 'reportThreshold' reports are disabled until a moderator reviews them, 0 disables it.
+// The 'reportLimiter' limits the reports of each reporter, so one client cannot suspend urls alone.
+// Bulk operations update at most 'batchSize' urls at once
+func NewModerationService(log ports.Logger,
+	urlRepository ports.UrlRepository,
+	moderationRepository ports.ModerationRepository,
+	reportLimiter ports.RateLimiter,
+	reportThreshold int64,
+	batchSize int) ports.ModerationService {
+
+	// Firestore batches are limited to 500 writes, each url writes its update and its event
+	if batchSize <= 0 || batchSize > 250 {
+		batchSize = 250
+	}
+
+	return &moderationService{log: log, urlRepository: urlRepository,
+		moderationRepository: moderationRepository, reportLimiter: reportLimiter, reportThreshold: reportThreshold,
+		batchSize: batchSize}
+}
+
+func (s *moderationService) ReportUrl(ctx context.Context, id, reason, comment, reporter string) error {
+	reason = strings.ToLower(reason)
+	if !model.ReportReasons[reason] {
+		return &model.InvalidRequestError{Message: fmt.Sprintf("Report reason %v is not valid", reason)}
+	}
+	if len(comment) > 1024 {
+		return &model.InvalidRequestError{Message: "Report comment cannot be longer than 1024 characters"}
+	}
+
+	allowed, err := s.reportLimiter.Allow(ctx, "report:"+reporter)
+	if err != nil {
+		return fmt.Errorf("ReportUrl error for Id: %v. %w", id, err)
+	}
+	if !allowed {
+		return &model.TooManyRequestsError{Message: "Too many reports, try again later"}
+	}
+
+	shortUrl, err := s.urlRepository.FindById(ctx, id)
+	if err != nil {
+		return fmt.Errorf("ReportUrl error for Id: %v. %w", id, err)
+	}
+
+	// The reporter is only kept as a hash in the report id
+	hash := sha256.Sum256([]byte(id + ":" + reporter))
+	report := &model.Report{
+		Id:         hex.EncodeToString(hash[:10]),
+		UrlId:      id,
+		Reason:     reason,
+		Comment:    comment,
+		CreateTime: time.Now().UTC(),
+	}
+
+	reports, err := s.moderationRepository.SaveReport(ctx, report)
+	if err != nil {
+		return fmt.Errorf("ReportUrl error for Id: %v. %w", id, err)
+	}
+	s.log.Info("Id %v reported as %v, total reports: %v", id, reason, reports)
+
+	if s.reportThreshold > 0 && reports >= s.reportThreshold && shortUrl.Enable {
+		if err = s.moderationRepository.Suspend(ctx, id); err != nil {
+			return fmt.Errorf("Suspend error for Id: %v. %w", id, err)
+		}
+		s.log.Info("Id %v suspended after %v reports", id, reports)
+	}
+	return nil
+}
+
+func (s *moderationService) GetQueue(ctx context.Context, limit int) ([]model.ShortUrl, error) {
+	var defaultLimit = 10
+
+	if limit > 0 {
+		defaultLimit = limit
+	}
+
+	shortUrls, err := s.moderationRepository.GetQueue(ctx, defaultLimit)
+	if err != nil {
+		return nil, fmt.Errorf("GetQueue error using limit: %v. %w", defaultLimit, err)
+	}
+	return shortUrls, nil
+}
+
+func (s *moderationService) GetReports(ctx context.Context, id string, limit int) ([]model.Report, error) {
+	var defaultLimit = 10
+
+	if limit > 0 {
+		defaultLimit = limit
+	}
+
+	reports, err := s.moderationRepository.FindReports(ctx, id, defaultLimit)
+	if err != nil {
+		return nil, fmt.Errorf("GetReports error for Id: %v. %w", id, err)
+	}
+	return reports, nil
+}
+
+// The reports are unfounded, the url is enabled again when it was disabled by the moderation
+func (s *moderationService) Dismiss(ctx context.Context, id string) error {
+	shortUrl, err := s.urlRepository.FindById(ctx, id)
+	if err != nil {
+		return fmt.Errorf("Dismiss error for Id: %v. %w", id, err)
+	}
+
+	enable := shortUrl.Enable
+	if len(shortUrl.Moderation) > 0 && shortUrl.Moderation != model.ReasonReported {
+		enable = true
+	}
+
+	if err = s.moderationRepository.CloseModeration(ctx, id, enable); err != nil {
+		return fmt.Errorf("Dismiss error for Id: %v. %w", id, err)
+	}
+	return nil
+}
+
+func (s *moderationService) Disable(ctx context.Context, id string) error {
+	if err := s.moderationRepository.CloseModeration(ctx, id, false); err != nil {
+		return fmt.Errorf("Disable error for Id: %v. %w", id, err)
+	}
+	return nil
+}
+
+// Disable or enable again all urls with the destination host equal to 'domain', or ending with it when 'suffix' is set.
+// Only urls disabled by a previous bulk operation are enabled again, a dry run only reports the matched urls
+func (s *moderationService) SetEnableByDomain(ctx context.Context, domain string, suffix, enable, dryRun bool) (*model.BulkResult, error) {
+	domain = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+	if len(domain) <= 0 {
+		return nil, &model.InvalidRequestError{Message: "Domain cannot be empty"}
+	}
+
+	result := &model.BulkResult{Domain: domain, Suffix: suffix, Enable: enable, DryRun: dryRun, Ids: []string{}}
+
+	// The urls waiting for a moderator keep their code, so they stay in the queue and a bulk enable skips them
+	codes := []string{}
+	idsByCode := map[string][]string{}
+
+	err := s.moderationRepository.Scan(ctx, func(shortUrl *model.ShortUrl) error {
+		u, err := url.Parse(shortUrl.Url)
+		if err != nil {
+			return nil
+		}
+
+		host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+		if host != domain && !(suffix && strings.HasSuffix(host, "."+domain)) {
+			return nil
+		}
+
+		result.Matched++
+		if enable == shortUrl.Enable || (enable && shortUrl.Moderation != model.ReasonDomain) {
+			return nil
+		}
+		result.Ids = append(result.Ids, shortUrl.Id)
+
+		code := model.ReasonDomain
+		if enable {
+			code = ""
+		} else if len(shortUrl.Moderation) > 0 {
+			code = shortUrl.Moderation
+		}
+		if _, ok := idsByCode[code]; !ok {
+			codes = append(codes, code)
+		}
+		idsByCode[code] = append(idsByCode[code], shortUrl.Id)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("SetEnableByDomain error for domain: %v. %w", domain, err)
+	}
+
+	if dryRun {
+		s.log.Info("Dry run of domain %v matched %v urls, %v to update", domain, result.Matched, len(result.Ids))
+		return result, nil
+	}
+
+	for _, code := range codes {
+		ids := idsByCode[code]
+		for start := 0; start < len(ids); start += s.batchSize {
+			end := start + s.batchSize
+			if end > len(ids) {
+				end = len(ids)
+			}
+
+			if err = s.moderationRepository.SetModeration(ctx, ids[start:end], enable, code); err != nil {
+				return result, fmt.Errorf("SetEnableByDomain error for domain: %v after %v updates. %w", domain, result.Updated, err)
+			}
+			result.Updated += end - start
+		}
+	}
+
+	s.log.Info("Domain %v matched %v urls, %v updated to enable: %v", domain, result.Matched, result.Updated, enable)
+	return result, nil
+}
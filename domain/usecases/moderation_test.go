@@ -0,0 +1,324 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"ehgm.com.br/url-shortener/domain/model"
+)
+
+// Empty ModerationRepository
+type moderationRepositoryMock struct {
+	saveReportFn      func(ctx context.Context, report *model.Report) (int64, error)
+	suspendFn         func(ctx context.Context, id string) error
+	closeModerationFn func(ctx context.Context, id string, enable bool) error
+	scanFn            func(ctx context.Context, fn func(shortUrl *model.ShortUrl) error) error
+	setModerationFn   func(ctx context.Context, ids []string, enable bool, moderation string) error
+}
+
+func (r *moderationRepositoryMock) SaveReport(ctx context.Context, report *model.Report) (int64, error) {
+	if r.saveReportFn != nil {
+		return r.saveReportFn(ctx, report)
+	}
+	return 1, nil
+}
+
+func (r *moderationRepositoryMock) FindReports(ctx context.Context, id string, limit int) ([]model.Report, error) {
+	return []model.Report{}, nil
+}
+
+func (r *moderationRepositoryMock) GetQueue(ctx context.Context, limit int) ([]model.ShortUrl, error) {
+	return []model.ShortUrl{}, nil
+}
+
+func (r *moderationRepositoryMock) Suspend(ctx context.Context, id string) error {
+	if r.suspendFn != nil {
+		return r.suspendFn(ctx, id)
+	}
+	return nil
+}
+
+func (r *moderationRepositoryMock) CloseModeration(ctx context.Context, id string, enable bool) error {
+	if r.closeModerationFn != nil {
+		return r.closeModerationFn(ctx, id, enable)
+	}
+	return nil
+}
+
+func (r *moderationRepositoryMock) Scan(ctx context.Context, fn func(shortUrl *model.ShortUrl) error) error {
+	if r.scanFn != nil {
+		return r.scanFn(ctx, fn)
+	}
+	return nil
+}
+
+func (r *moderationRepositoryMock) SetModeration(ctx context.Context, ids []string, enable bool, moderation string) error {
+	if r.setModerationFn != nil {
+		return r.setModerationFn(ctx, ids, enable, moderation)
+	}
+	return nil
+}
+
+// Allows or refuses all the requests
+type rateLimiterMock struct {
+	allow bool
+}
+
+func (r *rateLimiterMock) Allow(ctx context.Context, key string) (bool, error) {
+	return r.allow, nil
+}
+
+func TestReportUrl(t *testing.T) {
+	type Input struct {
+		reason  string
+		reports int64
+		enable  bool
+		limited bool
+	}
+
+	type Output struct {
+		suspended bool
+		hasError  bool
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Should save the report": {
+			Input{reason: "phishing", reports: 1, enable: true},
+			Output{suspended: false, hasError: false}},
+
+		"Test 02 - Should suspend the url at the threshold": {
+			Input{reason: "Malware", reports: 3, enable: true},
+			Output{suspended: true, hasError: false}},
+
+		"Test 03 - Should not suspend a disabled url": {
+			Input{reason: "spam", reports: 5, enable: false},
+			Output{suspended: false, hasError: false}},
+
+		"Test 04 - Should return an invalid reason error": {
+			Input{reason: "boring", reports: 1, enable: true},
+			Output{suspended: false, hasError: true}},
+
+		"Test 05 - Should refuse the report over the rate limit": {
+			Input{reason: "phishing", reports: 5, enable: true, limited: true},
+			Output{suspended: false, hasError: true}},
+	}
+
+	ctx := context.Background()
+
+	for i, test := range tests {
+		var suspended bool
+		repo := &urlRepositoryMock{
+			findByIdFn: func(ctx context.Context, id string) (*model.ShortUrl, error) {
+				return &model.ShortUrl{Id: id, Url: "https://ehgm.com.br", Enable: test.input.enable}, nil
+			}}
+		moderationRepo := &moderationRepositoryMock{
+			saveReportFn: func(ctx context.Context, report *model.Report) (int64, error) {
+				return test.input.reports, nil
+			},
+			suspendFn: func(ctx context.Context, id string) error {
+				suspended = true
+				return nil
+			}}
+
+		limiter := &rateLimiterMock{allow: !test.input.limited}
+		moderationService := NewModerationService(&loggerMock{}, repo, moderationRepo, limiter, 3, 100)
+		err := moderationService.ReportUrl(ctx, "1q2w3e", test.input.reason, "", "127.0.0.1")
+
+		if test.output.hasError && err == nil {
+			t.Errorf("#%s: Output is: %s. But should has error: %v", i, err, test.output.hasError)
+			continue
+		}
+		if !test.output.hasError && err != nil {
+			t.Errorf("#%s: Output is: %s. But should not has error: %v", i, err, test.output.hasError)
+			continue
+		}
+		if suspended != test.output.suspended {
+			t.Errorf("#%s: Output is: %v. But should be: %v", i, suspended, test.output.suspended)
+		}
+	}
+}
+
+func TestDismiss(t *testing.T) {
+	type Input struct {
+		shortUrl model.ShortUrl
+	}
+
+	type Output struct {
+		enable bool
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Should keep a reported url enabled": {
+			Input{shortUrl: model.ShortUrl{Enable: true, Moderation: model.ReasonReported}},
+			Output{enable: true}},
+
+		"Test 02 - Should enable a suspended url": {
+			Input{shortUrl: model.ShortUrl{Enable: false, Moderation: model.ReasonSuspended}},
+			Output{enable: true}},
+
+		"Test 03 - Should keep a reported url disabled by the owner": {
+			Input{shortUrl: model.ShortUrl{Enable: false, Moderation: model.ReasonReported}},
+			Output{enable: false}},
+	}
+
+	ctx := context.Background()
+
+	for i, test := range tests {
+		shortUrl := test.input.shortUrl
+		var enabled bool
+		repo := &urlRepositoryMock{
+			findByIdFn: func(ctx context.Context, id string) (*model.ShortUrl, error) {
+				return &shortUrl, nil
+			}}
+		moderationRepo := &moderationRepositoryMock{
+			closeModerationFn: func(ctx context.Context, id string, enable bool) error {
+				enabled = enable
+				return nil
+			}}
+
+		moderationService := NewModerationService(&loggerMock{}, repo, moderationRepo, &rateLimiterMock{allow: true}, 3, 100)
+		if err := moderationService.Dismiss(ctx, "1q2w3e"); err != nil {
+			t.Errorf("#%s: Output is: %s. But should not has error", i, err)
+			continue
+		}
+		if enabled != test.output.enable {
+			t.Errorf("#%s: Output is: %v. But should be: %v", i, enabled, test.output.enable)
+		}
+	}
+}
+
+func TestDisable(t *testing.T) {
+	moderationRepo := &moderationRepositoryMock{
+		closeModerationFn: func(ctx context.Context, id string, enable bool) error {
+			if enable {
+				return errors.New("Should be disabled")
+			}
+			return nil
+		}}
+
+	moderationService := NewModerationService(&loggerMock{}, &urlRepositoryMock{}, moderationRepo, &rateLimiterMock{allow: true}, 3, 100)
+	if err := moderationService.Disable(context.Background(), "1q2w3e"); err != nil {
+		t.Errorf("Output is: %s. But should not has error", err)
+	}
+}
+
+func TestSetEnableByDomain(t *testing.T) {
+	shortUrls := []model.ShortUrl{
+		{Id: "1", Url: "https://evil.com/login", Enable: true},
+		{Id: "2", Url: "https://www.EVIL.com", Enable: true},
+		{Id: "3", Url: "https://notevil.com", Enable: true},
+		{Id: "4", Url: "https://evil.com", Enable: false},
+		{Id: "5", Url: "https://shop.evil.com", Enable: false, Moderation: model.ReasonDomain},
+		{Id: "6", Url: "https://evil.com/a", Enable: true},
+		{Id: "7", Url: "https://evil.com/b", Enable: true, Moderation: model.ReasonReported},
+	}
+
+	type Input struct {
+		domain string
+		suffix bool
+		enable bool
+		dryRun bool
+	}
+
+	type Output struct {
+		matched    int
+		updated    int
+		batches    int
+		moderation map[string]string
+		hasError   bool
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Should disable the exact domain in batches": {
+			Input{domain: "evil.com", suffix: false, enable: false},
+			Output{matched: 4, updated: 3, batches: 2}},
+
+		"Test 02 - Should disable the domain and subdomains": {
+			Input{domain: "Evil.com.", suffix: true, enable: false},
+			Output{matched: 6, updated: 4, batches: 3}},
+
+		"Test 03 - Should only enable the urls disabled by domain": {
+			Input{domain: "evil.com", suffix: true, enable: true},
+			Output{matched: 6, updated: 1, batches: 1, moderation: map[string]string{"5": ""}}},
+
+		"Test 04 - Should not update in dry run": {
+			Input{domain: "evil.com", suffix: true, enable: false, dryRun: true},
+			Output{matched: 6, updated: 0, batches: 0}},
+
+		"Test 05 - Should return an empty domain error": {
+			Input{domain: " "},
+			Output{hasError: true}},
+
+		"Test 06 - Should keep the moderation code of a reported url": {
+			Input{domain: "evil.com", suffix: false, enable: false},
+			Output{matched: 4, updated: 3, batches: 2,
+				moderation: map[string]string{"1": model.ReasonDomain, "6": model.ReasonDomain, "7": model.ReasonReported}}},
+	}
+
+	ctx := context.Background()
+
+	for i, test := range tests {
+		var batches int
+		moderation := map[string]string{}
+		moderationRepo := &moderationRepositoryMock{
+			scanFn: func(ctx context.Context, fn func(shortUrl *model.ShortUrl) error) error {
+				for _, shortUrl := range shortUrls {
+					temp := shortUrl
+					if err := fn(&temp); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			setModerationFn: func(ctx context.Context, ids []string, enable bool, code string) error {
+				batches++
+				if len(ids) > 2 {
+					return errors.New("Batch size error")
+				}
+				for _, id := range ids {
+					moderation[id] = code
+				}
+				return nil
+			}}
+
+		moderationService := NewModerationService(&loggerMock{}, &urlRepositoryMock{}, moderationRepo, &rateLimiterMock{allow: true}, 3, 2)
+		result, err := moderationService.SetEnableByDomain(ctx, test.input.domain, test.input.suffix, test.input.enable, test.input.dryRun)
+
+		if test.output.hasError && err == nil {
+			t.Errorf("#%s: Output is: %s. But should has error: %v", i, err, test.output.hasError)
+			continue
+		}
+		if !test.output.hasError && err != nil {
+			t.Errorf("#%s: Output is: %s. But should not has error: %v", i, err, test.output.hasError)
+			continue
+		}
+		if !test.output.hasError && (result.Matched != test.output.matched || result.Updated != test.output.updated || batches != test.output.batches) {
+			t.Errorf("#%s: Output is: %v / %v / %v. But should be: %v / %v / %v", i,
+				result.Matched, result.Updated, batches, test.output.matched, test.output.updated, test.output.batches)
+		}
+		if test.output.moderation != nil && !reflect.DeepEqual(moderation, test.output.moderation) {
+			t.Errorf("#%s: Output is: %v. But should be: %v", i, moderation, test.output.moderation)
+		}
+	}
+}
+
+func TestBulkBatchSize(t *testing.T) {
+	// Each url writes its update and its event, a Firestore batch has up to 500 writes
+	for _, batchSize := range []int{0, 251, 500} {
+		service := NewModerationService(&loggerMock{}, &urlRepositoryMock{}, &moderationRepositoryMock{}, &rateLimiterMock{allow: true}, 3, batchSize)
+		if size := service.(*moderationService).batchSize; size != 250 {
+			t.Errorf("Output is: %v. But should be: %v", size, 250)
+		}
+	}
+}
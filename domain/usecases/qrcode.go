@@ -0,0 +1,38 @@
+package usecases
+
+import (
+	"context"
+	"fmt"
+
+	"ehgm.com.br/url-shortener/domain/model"
+	"ehgm.com.br/url-shortener/domain/ports"
+)
+
+// Struct that implements 'QrCodeService' interface
+type qrCodeService struct {
+	log           ports.Logger
+	urlRepository ports.UrlRepository
+	qrEncoder     ports.QrEncoder
+}
+
+// Get an instance of 'QrCodeService' using this method
+func NewQrCodeService(log ports.Logger, urlRepository ports.UrlRepository, qrEncoder ports.QrEncoder) ports.QrCodeService {
+	return &qrCodeService{log: log, urlRepository: urlRepository, qrEncoder: qrEncoder}
+}
+
+// Encode the short url of an existing id, the destination is not used so the printed code never changes
+func (s *qrCodeService) GetQrCode(ctx context.Context, id, shortUrl string, options *model.QrOptions) ([]byte, error) {
+	found, err := s.urlRepository.FindById(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("GetQrCode error for Id: %v. %w", id, err)
+	}
+	if found.IsEmpty() {
+		return nil, &model.DocumentNotFoundError{Id: id}
+	}
+
+	image, err := s.qrEncoder.Encode(shortUrl, options)
+	if err != nil {
+		return nil, fmt.Errorf("GetQrCode error for Id: %v. %w", id, err)
+	}
+	return image, nil
+}
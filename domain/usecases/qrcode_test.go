@@ -0,0 +1,99 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"ehgm.com.br/url-shortener/domain/model"
+	"ehgm.com.br/url-shortener/domain/ports"
+)
+
+// Empty QrEncoder
+type qrEncoderMock struct {
+	encodeFn func(content string, options *model.QrOptions) ([]byte, error)
+}
+
+func (e *qrEncoderMock) Encode(content string, options *model.QrOptions) ([]byte, error) {
+	if e.encodeFn != nil {
+		return e.encodeFn(content, options)
+	}
+	return []byte(content), nil
+}
+
+func TestGetQrCode(t *testing.T) {
+	type Input struct {
+		repo      ports.UrlRepository
+		qrEncoder ports.QrEncoder
+	}
+
+	type Output struct {
+		image    string
+		notFound bool
+		hasError bool
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Should encode the short URL": {
+			Input{
+				repo: &urlRepositoryMock{
+					findByIdFn: func(ctx context.Context, id string) (*model.ShortUrl, error) {
+						return &model.ShortUrl{Id: id, Url: "https://ehgm.com.br", Enable: true}, nil
+					}},
+				qrEncoder: &qrEncoderMock{}},
+			Output{image: "https://ehgm.com.br/r/1q2w3e"}},
+
+		"Test 02 - Should return not found": {
+			Input{
+				repo: &urlRepositoryMock{
+					findByIdFn: func(ctx context.Context, id string) (*model.ShortUrl, error) {
+						return &model.ShortUrl{}, &model.DocumentNotFoundError{Id: id}
+					}},
+				qrEncoder: &qrEncoderMock{}},
+			Output{notFound: true, hasError: true}},
+
+		"Test 03 - Should return not found for an empty URL": {
+			Input{
+				repo:      &urlRepositoryMock{},
+				qrEncoder: &qrEncoderMock{}},
+			Output{notFound: true, hasError: true}},
+
+		"Test 04 - Should return error": {
+			Input{
+				repo: &urlRepositoryMock{
+					findByIdFn: func(ctx context.Context, id string) (*model.ShortUrl, error) {
+						return &model.ShortUrl{Id: id, Url: "https://ehgm.com.br"}, nil
+					}},
+				qrEncoder: &qrEncoderMock{
+					encodeFn: func(content string, options *model.QrOptions) ([]byte, error) {
+						return nil, errors.New("Encode error")
+					}}},
+			Output{hasError: true}},
+	}
+
+	ctx := context.Background()
+
+	for i, test := range tests {
+		qrCodeService := NewQrCodeService(&loggerMock{}, test.input.repo, test.input.qrEncoder)
+		image, err := qrCodeService.GetQrCode(ctx, "1q2w3e", "https://ehgm.com.br/r/1q2w3e", &model.QrOptions{})
+
+		if test.output.hasError && err == nil {
+			t.Errorf("#%s: Output is: %s. But should has error: %v", i, err, test.output.hasError)
+			continue
+		}
+		if !test.output.hasError && err != nil {
+			t.Errorf("#%s: Output is: %s. But should not has error: %v", i, err, test.output.hasError)
+			continue
+		}
+		var notFound *model.DocumentNotFoundError
+		if errors.As(err, &notFound) != test.output.notFound {
+			t.Errorf("#%s: Output is: %s. But should be not found: %v", i, err, test.output.notFound)
+		}
+		if string(image) != test.output.image {
+			t.Errorf("#%s: Output is: %s. But should be: %s", i, image, test.output.image)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package usecases
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"ehgm.com.br/url-shortener/domain/model"
+	"ehgm.com.br/url-shortener/domain/ports"
+)
+
+// Struct that implements 'EventRelay' interface
+type eventRelay struct {
+	log              ports.Logger
+	outboxRepository ports.OutboxRepository
+	eventPublishers  []ports.EventPublisher
+	interval         time.Duration
+	batchSize        int
+	maxAttempts      int
+}
+
+// Get an instance of 'EventRelay' using this method.
+// The pending events are published to all 'eventPublishers' every 'interval' in batches of 'batchSize',
+// only one relay should run. The events are published at least once, an event that fails in one publisher
+// is published again to all of them, the subscribers use the event id to skip the repeated ones.
+// After 'maxAttempts' failed publishes the event is dead, so it does not hold the events behind it forever
+func NewEventRelay(log ports.Logger,
+	outboxRepository ports.OutboxRepository,
+	eventPublishers []ports.EventPublisher,
+	interval time.Duration,
+	batchSize int,
+	maxAttempts int) ports.EventRelay {
+
+	return &eventRelay{log: log, outboxRepository: outboxRepository, eventPublishers: eventPublishers,
+		interval: interval, batchSize: batchSize, maxAttempts: maxAttempts}
+}
+
+// Publish the pending events until the context is done
+func (r *eventRelay) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			// A full batch may have more events waiting
+			for {
+				delivered, pending, err := r.relay(ctx)
+				if err != nil {
+					r.log.Error("Failed to relay the link events, trying again later. Cause: %s", err)
+					break
+				}
+				if pending < r.batchSize || delivered <= 0 || ctx.Err() != nil {
+					break
+				}
+			}
+		}
+	}
+}
+
+// Returns the number of delivered and pending events. When an event fails the next ones of its link wait
+// for the next relay, so the events of a link are never published out of order. A dead event is skipped
+// and the next ones of its link are published
+func (r *eventRelay) relay(ctx context.Context) (int, int, error) {
+	events, err := r.outboxRepository.PendingEvents(ctx, r.batchSize)
+	if err != nil {
+		return 0, 0, fmt.Errorf("PendingEvents error. %w", err)
+	}
+
+	blocked := map[string]bool{}
+	ids := []string{}
+	failed := []string{}
+	dead := []string{}
+	for i := range events {
+		event := &events[i]
+		if blocked[event.LinkId] {
+			continue
+		}
+		if err := r.publish(ctx, event); err != nil {
+			if event.Attempts+1 >= r.maxAttempts {
+				r.log.Error("Giving up event %v of Id: %v after %v attempts. Cause: %s", event.Id, event.LinkId, event.Attempts+1, err)
+				dead = append(dead, event.Id)
+				continue
+			}
+			r.log.Error("Error publishing event %v of Id: %v. Cause: %s", event.Id, event.LinkId, err)
+			failed = append(failed, event.Id)
+			blocked[event.LinkId] = true
+			continue
+		}
+		ids = append(ids, event.Id)
+	}
+
+	if err := r.outboxRepository.MarkDelivered(ctx, ids); err != nil {
+		return 0, len(events), fmt.Errorf("MarkDelivered error for %v events. %w", len(ids), err)
+	}
+	if err := r.outboxRepository.MarkDead(ctx, dead); err != nil {
+		return len(ids), len(events), fmt.Errorf("MarkDead error for %v events. %w", len(dead), err)
+	}
+	if err := r.outboxRepository.MarkFailed(ctx, failed); err != nil {
+		r.log.Error("Failed to count the attempts of %v events. Cause: %s", len(failed), err)
+	}
+	if len(events) > 0 {
+		r.log.Info("Relayed %v of %v link events", len(ids), len(events))
+	}
+	return len(ids), len(events), nil
+}
+
+func (r *eventRelay) publish(ctx context.Context, event *model.LinkEvent) error {
+	for _, eventPublisher := range r.eventPublishers {
+		if err := eventPublisher.Publish(ctx, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"ehgm.com.br/url-shortener/domain/model"
+	"ehgm.com.br/url-shortener/domain/ports"
+)
+
+// Returns the events not marked as delivered or dead, in the order they were saved
+type outboxMock struct {
+	events    []model.LinkEvent
+	delivered map[string]bool
+	attempts  map[string]int
+	dead      map[string]bool
+	markFails bool
+}
+
+func (o *outboxMock) PendingEvents(ctx context.Context, limit int) ([]model.LinkEvent, error) {
+	events := []model.LinkEvent{}
+	for _, event := range o.events {
+		if !o.delivered[event.Id] && !o.dead[event.Id] && len(events) < limit {
+			event.Attempts = o.attempts[event.Id]
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (o *outboxMock) MarkDelivered(ctx context.Context, ids []string) error {
+	if o.markFails {
+		return errors.New("unavailable")
+	}
+	for _, id := range ids {
+		o.delivered[id] = true
+	}
+	return nil
+}
+
+func (o *outboxMock) MarkFailed(ctx context.Context, ids []string) error {
+	for _, id := range ids {
+		o.attempts[id]++
+	}
+	return nil
+}
+
+func (o *outboxMock) MarkDead(ctx context.Context, ids []string) error {
+	for _, id := range ids {
+		o.attempts[id]++
+		o.dead[id] = true
+	}
+	return nil
+}
+
+// Keeps the ids of the published events, the events in 'fails' are not published
+type eventPublisherMock struct {
+	fails     map[string]bool
+	published []string
+}
+
+func (p *eventPublisherMock) Publish(ctx context.Context, event *model.LinkEvent) error {
+	if p.fails[event.Id] {
+		return errors.New("topic unavailable")
+	}
+	p.published = append(p.published, event.Id)
+	return nil
+}
+
+func TestEventRelay(t *testing.T) {
+	events := []model.LinkEvent{
+		{Id: "e1", LinkId: "0aYS7JJ", Type: model.LinkCreated},
+		{Id: "e2", LinkId: "1q2w3e", Type: model.LinkCreated},
+		{Id: "e3", LinkId: "0aYS7JJ", Type: model.LinkUpdated},
+		{Id: "e4", LinkId: "1q2w3e", Type: model.LinkDisabled},
+	}
+
+	type Input struct {
+		fails     map[string]bool
+		markFails bool
+	}
+
+	type Output struct {
+		published []string
+		delivered map[string]bool
+		hasError  bool
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Should publish and mark all events": {
+			Input{},
+			Output{published: []string{"e1", "e2", "e3", "e4"},
+				delivered: map[string]bool{"e1": true, "e2": true, "e3": true, "e4": true}, hasError: false}},
+
+		"Test 02 - Should hold the next events of a link that failed": {
+			Input{fails: map[string]bool{"e1": true}},
+			Output{published: []string{"e2", "e4"}, delivered: map[string]bool{"e2": true, "e4": true}, hasError: false}},
+
+		"Test 03 - Should keep them pending when the mark fails": {
+			Input{markFails: true},
+			Output{published: []string{"e1", "e2", "e3", "e4"}, delivered: map[string]bool{}, hasError: true}},
+	}
+
+	ctx := context.Background()
+
+	for i, test := range tests {
+		outbox := &outboxMock{events: events, delivered: map[string]bool{}, attempts: map[string]int{}, dead: map[string]bool{},
+			markFails: test.input.markFails}
+		publisher := &eventPublisherMock{fails: test.input.fails}
+		relay := &eventRelay{log: &loggerMock{}, outboxRepository: outbox,
+			eventPublishers: []ports.EventPublisher{publisher}, interval: time.Hour, batchSize: 10, maxAttempts: 10}
+
+		_, _, err := relay.relay(ctx)
+		if test.output.hasError != (err != nil) {
+			t.Errorf("#%s: Output is: %v. But should has error: %v", i, err, test.output.hasError)
+		}
+		if !reflect.DeepEqual(publisher.published, test.output.published) {
+			t.Errorf("#%s: Output is: %v. But should be: %v", i, publisher.published, test.output.published)
+		}
+		if !reflect.DeepEqual(outbox.delivered, test.output.delivered) {
+			t.Errorf("#%s: Output is: %v. But should be: %v", i, outbox.delivered, test.output.delivered)
+		}
+	}
+}
+
+func TestEventRelayDead(t *testing.T) {
+	events := []model.LinkEvent{
+		{Id: "e1", LinkId: "0aYS7JJ", Type: model.LinkCreated},
+		{Id: "e2", LinkId: "0aYS7JJ", Type: model.LinkUpdated},
+	}
+	outbox := &outboxMock{events: events, delivered: map[string]bool{}, attempts: map[string]int{}, dead: map[string]bool{}}
+	publisher := &eventPublisherMock{fails: map[string]bool{"e1": true}}
+	relay := &eventRelay{log: &loggerMock{}, outboxRepository: outbox,
+		eventPublishers: []ports.EventPublisher{publisher}, interval: time.Hour, batchSize: 10, maxAttempts: 3}
+	ctx := context.Background()
+
+	// The event that keeps failing holds its link until the last attempt
+	for i := 0; i < 2; i++ {
+		if _, _, err := relay.relay(ctx); err != nil {
+			t.Fatalf("Output is: %s. But should not has error", err)
+		}
+	}
+	if len(publisher.published) > 0 || outbox.attempts["e1"] != 2 || outbox.dead["e1"] {
+		t.Fatalf("Output is: %v %v %v. But should hold the link with 2 attempts", publisher.published, outbox.attempts, outbox.dead)
+	}
+
+	// Then it is dead and the next event of the link is published
+	if _, _, err := relay.relay(ctx); err != nil {
+		t.Fatalf("Output is: %s. But should not has error", err)
+	}
+	if !reflect.DeepEqual(publisher.published, []string{"e2"}) || outbox.attempts["e1"] != 3 || !outbox.dead["e1"] ||
+		outbox.delivered["e1"] {
+		t.Errorf("Output is: %v %v %v. But should be: [e2] with e1 dead", publisher.published, outbox.attempts, outbox.dead)
+	}
+	if _, pending, _ := relay.relay(ctx); pending != 0 {
+		t.Errorf("Output is: %v. But should not has pending events", pending)
+	}
+}
+
+func TestEventRelayRun(t *testing.T) {
+	outbox := &outboxMock{delivered: map[string]bool{}, attempts: map[string]int{}, dead: map[string]bool{}}
+	for _, id := range []string{"e1", "e2", "e3", "e4", "e5"} {
+		outbox.events = append(outbox.events, model.LinkEvent{Id: id, LinkId: "0aYS7JJ"})
+	}
+	publisher := &eventPublisherMock{}
+	relay := NewEventRelay(&loggerMock{}, outbox, []ports.EventPublisher{publisher}, 10*time.Millisecond, 2, 10)
+
+	// The full batches are relayed one after the other in the same tick
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := relay.Run(ctx); err != nil {
+		t.Fatalf("Output is: %s. But should not has error", err)
+	}
+
+	expected := []string{"e1", "e2", "e3", "e4", "e5"}
+	if !reflect.DeepEqual(publisher.published, expected) {
+		t.Errorf("Output is: %v. But should be: %v", publisher.published, expected)
+	}
+}
@@ -0,0 +1,788 @@
+package usecases
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"ehgm.com.br/url-shortener/domain/model"
+)
+
+// Limits of the rules, a rule cannot make the redirect slow
+const (
+	maxRules          = 20
+	maxRuleLength     = 1024
+	maxRuleDepth      = 32
+	maxRuleNameLength = 64
+)
+
+// Compiled rules kept in memory, the cache is cleared when full
+const maxCachedRules = 10000
+
+// Kinds of the values of an expression, the rules are type checked when compiled
+type valueKind int
+
+const (
+	kindString valueKind = iota
+	kindNumber
+	kindBool
+	kindTime
+	kindList
+)
+
+func (k valueKind) String() string {
+	return [...]string{"string", "number", "boolean", "time", "list"}[k]
+}
+
+// Attributes of the visit that can be used in the expressions
+var ruleAttributes = map[string]valueKind{
+	"country":  kindString,
+	"device":   kindString,
+	"language": kindString,
+	"referrer": kindString,
+	"path":     kindString,
+	"weekday":  kindString,
+	"hour":     kindNumber,
+	"time":     kindTime,
+}
+
+// Kinds of the arguments of each function
+type ruleFunction struct {
+	args []valueKind
+}
+
+var comparisonOperators = map[string]bool{"==": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true}
+
+// Functions that can be used in the expressions
+var ruleFunctions = map[string]ruleFunction{
+	"query":      {args: []valueKind{kindString}},
+	"cookie":     {args: []valueKind{kindString}},
+	"lower":      {args: []valueKind{kindString}},
+	"host":       {args: []valueKind{kindString}},
+	"startsWith": {args: []valueKind{kindString, kindString}},
+	"endsWith":   {args: []valueKind{kindString, kindString}},
+	"contains":   {args: []valueKind{kindString, kindString}},
+	"matches":    {args: []valueKind{kindString, kindString}},
+}
+
+// Attributes of a visit seen by the rules, the country is found only when a rule uses it
+type ruleContext struct {
+	visit    *model.Visit
+	now      time.Time
+	query    url.Values
+	language string
+	country  func() string
+}
+
+func newRuleContext(visit *model.Visit, now time.Time, country func() string) *ruleContext {
+	if visit == nil {
+		visit = &model.Visit{}
+	}
+	if !visit.Time.IsZero() {
+		now = visit.Time
+	}
+
+	c := &ruleContext{visit: visit, now: now.UTC(), country: country}
+	c.query, _ = url.ParseQuery(visit.Query)
+	if languages := parseAcceptLanguage(visit.Language); len(languages) > 0 && languages[0] != "*" {
+		c.language = languages[0]
+	}
+	return c
+}
+
+func (c *ruleContext) attribute(name string) interface{} {
+	switch name {
+	case "country":
+		return c.country()
+	case "device":
+		return c.visit.Platform
+	case "language":
+		return c.language
+	case "referrer":
+		return c.visit.Referrer
+	case "path":
+		return c.visit.Path
+	case "weekday":
+		return strings.ToLower(c.now.Weekday().String()[:3])
+	case "hour":
+		return float64(c.now.Hour())
+	case "time":
+		return c.now
+	}
+	return nil
+}
+
+// Condition of a compiled rule
+type ruleCondition func(c *ruleContext) bool
+
+// Typed node of an expression
+type ruleExpr struct {
+	kind    valueKind
+	literal bool
+	eval    func(c *ruleContext) interface{}
+}
+
+type ruleToken struct {
+	kind   string
+	text   string
+	column int
+}
+
+// Error of a rule expression with the column where it was found
+type ruleSyntaxError struct {
+	column  int
+	message string
+}
+
+func (e *ruleSyntaxError) Error() string {
+	return fmt.Sprintf("%v at column %v", e.message, e.column)
+}
+
+// Compile the expression of a rule, the errors tell what is wrong and where
+func compileRule(expression string) (ruleCondition, error) {
+	if len(strings.TrimSpace(expression)) <= 0 {
+		return nil, &ruleSyntaxError{column: 1, message: "empty expression"}
+	}
+	if len(expression) > maxRuleLength {
+		return nil, &ruleSyntaxError{column: maxRuleLength, message: fmt.Sprintf("expression longer than %v characters", maxRuleLength)}
+	}
+
+	tokens, err := tokenizeRule(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &ruleParser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if token := p.peek(); token.kind != "eof" {
+		return nil, &ruleSyntaxError{column: token.column, message: fmt.Sprintf("unexpected %q", token.text)}
+	}
+	if expr.kind != kindBool {
+		return nil, &ruleSyntaxError{column: 1, message: fmt.Sprintf("expression must be a boolean, not a %v", expr.kind)}
+	}
+
+	return func(c *ruleContext) bool { return expr.eval(c).(bool) }, nil
+}
+
+func tokenizeRule(expression string) ([]ruleToken, error) {
+	var tokens []ruleToken
+	runes := []rune(expression)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		column := i + 1
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, ruleToken{kind: "ident", text: string(runes[start:i]), column: column})
+		case unicode.IsDigit(r):
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, ruleToken{kind: "number", text: string(runes[start:i]), column: column})
+		case r == '"' || r == '\'':
+			var text strings.Builder
+			closed := false
+			for i++; i < len(runes); i++ {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+					text.WriteRune(runes[i])
+					continue
+				}
+				if runes[i] == r {
+					closed = true
+					i++
+					break
+				}
+				text.WriteRune(runes[i])
+			}
+			if !closed {
+				return nil, &ruleSyntaxError{column: column, message: "string not closed"}
+			}
+			tokens = append(tokens, ruleToken{kind: "string", text: text.String(), column: column})
+		default:
+			operator := ""
+			for _, op := range []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", "(", ")", "[", "]", ","} {
+				if strings.HasPrefix(string(runes[i:]), op) {
+					operator = op
+					break
+				}
+			}
+			if len(operator) <= 0 {
+				return nil, &ruleSyntaxError{column: column, message: fmt.Sprintf("unexpected character %q", r)}
+			}
+			i += len(operator)
+			tokens = append(tokens, ruleToken{kind: "op", text: operator, column: column})
+		}
+	}
+	return append(tokens, ruleToken{kind: "eof", text: "end of the expression", column: len(runes) + 1}), nil
+}
+
+// Recursive descent parser, from the lowest precedence: ||, &&, !, comparisons and the values
+type ruleParser struct {
+	tokens []ruleToken
+	pos    int
+	depth  int
+}
+
+func (p *ruleParser) peek() ruleToken {
+	return p.tokens[p.pos]
+}
+
+func (p *ruleParser) next() ruleToken {
+	token := p.tokens[p.pos]
+	if token.kind != "eof" {
+		p.pos++
+	}
+	return token
+}
+
+func (p *ruleParser) isOp(text string) bool {
+	token := p.peek()
+	return token.kind == "op" && token.text == text
+}
+
+func (p *ruleParser) expect(text string) error {
+	if token := p.next(); token.kind != "op" || token.text != text {
+		return &ruleSyntaxError{column: token.column, message: fmt.Sprintf("expected %q but found %q", text, token.text)}
+	}
+	return nil
+}
+
+func (p *ruleParser) enter() error {
+	if p.depth++; p.depth > maxRuleDepth {
+		return &ruleSyntaxError{column: p.peek().column, message: fmt.Sprintf("expression nested more than %v levels", maxRuleDepth)}
+	}
+	return nil
+}
+
+func (p *ruleParser) parseOr() (*ruleExpr, error) {
+	return p.parseLogical("||", p.parseAnd)
+}
+
+func (p *ruleParser) parseAnd() (*ruleExpr, error) {
+	return p.parseLogical("&&", p.parseNot)
+}
+
+func (p *ruleParser) parseLogical(op string, operand func() (*ruleExpr, error)) (*ruleExpr, error) {
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isOp(op) {
+		token := p.next()
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		if left.kind != kindBool || right.kind != kindBool {
+			return nil, &ruleSyntaxError{column: token.column, message: fmt.Sprintf("operator %v needs booleans, not %v and %v", op, left.kind, right.kind)}
+		}
+
+		l, r := left.eval, right.eval
+		if op == "&&" {
+			left = &ruleExpr{kind: kindBool, eval: func(c *ruleContext) interface{} { return l(c).(bool) && r(c).(bool) }}
+		} else {
+			left = &ruleExpr{kind: kindBool, eval: func(c *ruleContext) interface{} { return l(c).(bool) || r(c).(bool) }}
+		}
+	}
+	return left, nil
+}
+
+func (p *ruleParser) parseNot() (*ruleExpr, error) {
+	if !p.isOp("!") {
+		return p.parseComparison()
+	}
+
+	token := p.next()
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	operand, err := p.parseNot()
+	p.depth--
+	if err != nil {
+		return nil, err
+	}
+	if operand.kind != kindBool {
+		return nil, &ruleSyntaxError{column: token.column, message: fmt.Sprintf("operator ! needs a boolean, not a %v", operand.kind)}
+	}
+	return &ruleExpr{kind: kindBool, eval: func(c *ruleContext) interface{} { return !operand.eval(c).(bool) }}, nil
+}
+
+func (p *ruleParser) parseComparison() (*ruleExpr, error) {
+	left, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+
+	token := p.peek()
+	isComparison := token.kind == "op" && comparisonOperators[token.text]
+	isIn := token.kind == "ident" && token.text == "in"
+	if !isComparison && !isIn {
+		return left, nil
+	}
+	p.next()
+
+	right, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	if isIn {
+		return compileIn(token, left, right)
+	}
+	return compileComparison(token, left, right)
+}
+
+func (p *ruleParser) parseValue() (*ruleExpr, error) {
+	token := p.next()
+
+	switch {
+	case token.kind == "string":
+		value := token.text
+		return &ruleExpr{kind: kindString, literal: true, eval: func(c *ruleContext) interface{} { return value }}, nil
+	case token.kind == "number":
+		value, err := strconv.ParseFloat(token.text, 64)
+		if err != nil {
+			return nil, &ruleSyntaxError{column: token.column, message: fmt.Sprintf("invalid number %q", token.text)}
+		}
+		return &ruleExpr{kind: kindNumber, literal: true, eval: func(c *ruleContext) interface{} { return value }}, nil
+	case token.kind == "ident" && (token.text == "true" || token.text == "false"):
+		value := token.text == "true"
+		return &ruleExpr{kind: kindBool, literal: true, eval: func(c *ruleContext) interface{} { return value }}, nil
+	case token.kind == "ident" && p.isOp("("):
+		return p.parseCall(token)
+	case token.kind == "ident":
+		kind, ok := ruleAttributes[token.text]
+		if !ok {
+			return nil, &ruleSyntaxError{column: token.column, message: fmt.Sprintf("unknown attribute %q, use one of %v", token.text, attributeNames())}
+		}
+		name := token.text
+		return &ruleExpr{kind: kind, eval: func(c *ruleContext) interface{} { return c.attribute(name) }}, nil
+	case token.kind == "op" && token.text == "(":
+		if err := p.enter(); err != nil {
+			return nil, err
+		}
+		expr, err := p.parseOr()
+		p.depth--
+		if err != nil {
+			return nil, err
+		}
+		return expr, p.expect(")")
+	case token.kind == "op" && token.text == "[":
+		return p.parseList(token)
+	}
+	return nil, &ruleSyntaxError{column: token.column, message: fmt.Sprintf("expected a value but found %q", token.text)}
+}
+
+func (p *ruleParser) parseList(open ruleToken) (*ruleExpr, error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer func() { p.depth-- }()
+
+	var items []*ruleExpr
+	for !p.isOp("]") {
+		if len(items) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		token := p.peek()
+		item, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		if item.kind == kindList || item.kind == kindBool {
+			return nil, &ruleSyntaxError{column: token.column, message: fmt.Sprintf("list items cannot be a %v", item.kind)}
+		}
+		if len(items) > 0 && item.kind != items[0].kind {
+			return nil, &ruleSyntaxError{column: token.column, message: fmt.Sprintf("list items must be a %v, not a %v", items[0].kind, item.kind)}
+		}
+		items = append(items, item)
+	}
+	p.next()
+
+	if len(items) <= 0 {
+		return nil, &ruleSyntaxError{column: open.column, message: "list cannot be empty"}
+	}
+	return &ruleExpr{kind: kindList, eval: func(c *ruleContext) interface{} {
+		values := make([]interface{}, len(items))
+		for i, item := range items {
+			values[i] = item.eval(c)
+		}
+		return values
+	}}, nil
+}
+
+func (p *ruleParser) parseCall(name ruleToken) (*ruleExpr, error) {
+	function, ok := ruleFunctions[name.text]
+	if !ok {
+		return nil, &ruleSyntaxError{column: name.column, message: fmt.Sprintf("unknown function %q, use one of %v", name.text, functionNames())}
+	}
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer func() { p.depth-- }()
+	p.next()
+
+	var args []*ruleExpr
+	for !p.isOp(")") {
+		if len(args) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		token := p.peek()
+		arg, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if len(args) < len(function.args) && arg.kind != function.args[len(args)] {
+			return nil, &ruleSyntaxError{column: token.column, message: fmt.Sprintf("argument %v of %v must be a %v, not a %v",
+				len(args)+1, name.text, function.args[len(args)], arg.kind)}
+		}
+		args = append(args, arg)
+	}
+	p.next()
+
+	if len(args) != len(function.args) {
+		return nil, &ruleSyntaxError{column: name.column, message: fmt.Sprintf("%v needs %v arguments, not %v", name.text, len(function.args), len(args))}
+	}
+	return compileCall(name, args)
+}
+
+func compileCall(name ruleToken, args []*ruleExpr) (*ruleExpr, error) {
+	arg := func(c *ruleContext, i int) string { return args[i].eval(c).(string) }
+	text := func(f func(c *ruleContext) string) *ruleExpr {
+		return &ruleExpr{kind: kindString, eval: func(c *ruleContext) interface{} { return f(c) }}
+	}
+	check := func(f func(c *ruleContext) bool) *ruleExpr {
+		return &ruleExpr{kind: kindBool, eval: func(c *ruleContext) interface{} { return f(c) }}
+	}
+
+	switch name.text {
+	case "query":
+		return text(func(c *ruleContext) string { return c.query.Get(arg(c, 0)) }), nil
+	case "cookie":
+		return text(func(c *ruleContext) string { return c.visit.Cookies[arg(c, 0)] }), nil
+	case "lower":
+		return text(func(c *ruleContext) string { return strings.ToLower(arg(c, 0)) }), nil
+	case "host":
+		return text(func(c *ruleContext) string {
+			u, err := url.Parse(arg(c, 0))
+			if err != nil {
+				return ""
+			}
+			return strings.ToLower(u.Hostname())
+		}), nil
+	case "startsWith":
+		return check(func(c *ruleContext) bool { return strings.HasPrefix(arg(c, 0), arg(c, 1)) }), nil
+	case "endsWith":
+		return check(func(c *ruleContext) bool { return strings.HasSuffix(arg(c, 0), arg(c, 1)) }), nil
+	case "contains":
+		return check(func(c *ruleContext) bool { return strings.Contains(arg(c, 0), arg(c, 1)) }), nil
+	case "matches":
+		// The pattern is compiled once, Go regular expressions run in linear time
+		if !args[1].literal {
+			return nil, &ruleSyntaxError{column: name.column, message: "the pattern of matches must be a string"}
+		}
+		pattern, err := regexp.Compile(args[1].eval(nil).(string))
+		if err != nil {
+			return nil, &ruleSyntaxError{column: name.column, message: fmt.Sprintf("invalid pattern of matches: %v", err)}
+		}
+		return check(func(c *ruleContext) bool { return pattern.MatchString(arg(c, 0)) }), nil
+	}
+	return nil, &ruleSyntaxError{column: name.column, message: fmt.Sprintf("unknown function %q", name.text)}
+}
+
+// Strings are compared ignoring the case, times can be compared with RFC 3339 strings
+func compileComparison(op ruleToken, left, right *ruleExpr) (*ruleExpr, error) {
+	var err error
+	if left, right, err = timeOperands(op, left, right); err != nil {
+		return nil, err
+	}
+
+	if left.kind != right.kind || left.kind == kindList {
+		return nil, &ruleSyntaxError{column: op.column, message: fmt.Sprintf("cannot compare a %v with a %v", left.kind, right.kind)}
+	}
+	ordered := op.text != "==" && op.text != "!="
+	if ordered && left.kind != kindNumber && left.kind != kindTime {
+		return nil, &ruleSyntaxError{column: op.column, message: fmt.Sprintf("operator %v needs numbers or times, not a %v", op.text, left.kind)}
+	}
+
+	kind := left.kind
+	return &ruleExpr{kind: kindBool, eval: func(c *ruleContext) interface{} {
+		order := compareValues(kind, left.eval(c), right.eval(c))
+		switch op.text {
+		case "==":
+			return order == 0
+		case "!=":
+			return order != 0
+		case "<":
+			return order < 0
+		case "<=":
+			return order <= 0
+		case ">":
+			return order > 0
+		default:
+			return order >= 0
+		}
+	}}, nil
+}
+
+func compileIn(op ruleToken, left, right *ruleExpr) (*ruleExpr, error) {
+	if right.kind != kindList {
+		return nil, &ruleSyntaxError{column: op.column, message: fmt.Sprintf("operator in needs a list, not a %v", right.kind)}
+	}
+	if left.kind != kindString && left.kind != kindNumber {
+		return nil, &ruleSyntaxError{column: op.column, message: fmt.Sprintf("operator in needs a string or a number, not a %v", left.kind)}
+	}
+
+	kind := left.kind
+	return &ruleExpr{kind: kindBool, eval: func(c *ruleContext) interface{} {
+		value := left.eval(c)
+		for _, item := range right.eval(c).([]interface{}) {
+			if !sameKind(kind, item) {
+				continue
+			}
+			if compareValues(kind, value, item) == 0 {
+				return true
+			}
+		}
+		return false
+	}}, nil
+}
+
+// A string literal compared with a time is parsed as a RFC 3339 time
+func timeOperands(op ruleToken, left, right *ruleExpr) (*ruleExpr, *ruleExpr, error) {
+	toTime := func(expr *ruleExpr) (*ruleExpr, error) {
+		if !expr.literal {
+			return nil, &ruleSyntaxError{column: op.column, message: "a time can only be compared with a string literal"}
+		}
+		value, err := time.Parse(time.RFC3339, expr.eval(nil).(string))
+		if err != nil {
+			return nil, &ruleSyntaxError{column: op.column, message: fmt.Sprintf("%q is not a RFC 3339 time", expr.eval(nil))}
+		}
+		return &ruleExpr{kind: kindTime, literal: true, eval: func(c *ruleContext) interface{} { return value }}, nil
+	}
+
+	var err error
+	if left.kind == kindTime && right.kind == kindString {
+		right, err = toTime(right)
+	} else if right.kind == kindTime && left.kind == kindString {
+		left, err = toTime(left)
+	}
+	return left, right, err
+}
+
+func sameKind(kind valueKind, value interface{}) bool {
+	switch value.(type) {
+	case string:
+		return kind == kindString
+	case float64:
+		return kind == kindNumber
+	}
+	return false
+}
+
+func compareValues(kind valueKind, left, right interface{}) int {
+	switch kind {
+	case kindNumber:
+		l, r := left.(float64), right.(float64)
+		if l < r {
+			return -1
+		} else if l > r {
+			return 1
+		}
+		return 0
+	case kindTime:
+		l, r := left.(time.Time), right.(time.Time)
+		if l.Before(r) {
+			return -1
+		} else if l.After(r) {
+			return 1
+		}
+		return 0
+	case kindBool:
+		if left.(bool) == right.(bool) {
+			return 0
+		}
+		return 1
+	default:
+		if strings.EqualFold(left.(string), right.(string)) {
+			return 0
+		}
+		return strings.Compare(strings.ToLower(left.(string)), strings.ToLower(right.(string)))
+	}
+}
+
+func attributeNames() string {
+	return "country, device, language, referrer, path, weekday, hour and time"
+}
+
+func functionNames() string {
+	return "query, cookie, lower, host, startsWith, endsWith, contains and matches"
+}
+
+// Check the rules of a link, the error tells which rule is wrong
+func validateRules(rules []model.Rule) error {
+	if len(rules) > maxRules {
+		return &model.InvalidRequestError{Message: fmt.Sprintf("A url cannot have more than %v rules", maxRules)}
+	}
+
+	for i, rule := range rules {
+		if len(rule.Name) > maxRuleNameLength {
+			return &model.InvalidRuleError{Rule: i + 1, Name: rule.Name, Message: fmt.Sprintf("name longer than %v characters", maxRuleNameLength)}
+		}
+		if len(rule.Url) <= 0 {
+			return &model.InvalidRuleError{Rule: i + 1, Name: rule.Name, Message: "url cannot be empty"}
+		}
+		if _, err := compileRule(rule.When); err != nil {
+			invalid := &model.InvalidRuleError{Rule: i + 1, Name: rule.Name, Message: err.Error()}
+			if syntax, ok := err.(*ruleSyntaxError); ok {
+				invalid.Column, invalid.Message = syntax.column, syntax.message
+			}
+			return invalid
+		}
+	}
+	return nil
+}
+
+// Read the rules of an update, the JSON decoder gives a list of objects
+func parseRules(value interface{}) ([]model.Rule, error) {
+	rules := []model.Rule{}
+	if value == nil {
+		return rules, nil
+	}
+
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil, &model.InvalidRequestError{Message: "Rules must be a list"}
+	}
+	for _, item := range list {
+		fields, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, &model.InvalidRequestError{Message: "Rule must be an object"}
+		}
+
+		rule := model.Rule{}
+		for k, v := range fields {
+			switch strings.ToLower(k) {
+			case "name":
+				rule.Name, ok = v.(string)
+			case "when":
+				rule.When, ok = v.(string)
+			case "url":
+				rule.Url, ok = v.(string)
+			default:
+				ok = false
+			}
+			if !ok {
+				return nil, &model.InvalidRequestError{Message: fmt.Sprintf("Rule attribute %v is not valid", k)}
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// Rule of a link with its compiled condition, the error of a rule that does not compile is kept
+type compiledRule struct {
+	rule      *model.Rule
+	condition ruleCondition
+	err       error
+}
+
+func compileRules(rules []model.Rule) []compiledRule {
+	compiled := make([]compiledRule, len(rules))
+	for i := range rules {
+		condition, err := compileRule(rules[i].When)
+		compiled[i] = compiledRule{rule: &rules[i], condition: condition, err: err}
+	}
+	return compiled
+}
+
+// Conditions compiled by link id and expression, so the redirects do not compile the rules again.
+// An updated rule has a new expression, the old one is removed when the cache is cleared
+type ruleCache struct {
+	mu         sync.RWMutex
+	conditions map[string]compiledRule
+}
+
+func newRuleCache() *ruleCache {
+	return &ruleCache{conditions: map[string]compiledRule{}}
+}
+
+// Compile the rules of the link, only the expressions not found in cache are compiled
+func (r *ruleCache) compile(id string, rules []model.Rule) []compiledRule {
+	compiled := make([]compiledRule, len(rules))
+	for i := range rules {
+		key := id + "\x00" + rules[i].When
+
+		r.mu.RLock()
+		cached, ok := r.conditions[key]
+		r.mu.RUnlock()
+
+		if !ok {
+			cached.condition, cached.err = compileRule(rules[i].When)
+			r.mu.Lock()
+			if len(r.conditions) >= maxCachedRules {
+				r.conditions = map[string]compiledRule{}
+			}
+			r.conditions[key] = cached
+			r.mu.Unlock()
+		}
+		cached.rule = &rules[i]
+		compiled[i] = cached
+	}
+	return compiled
+}
+
+// Evaluate the rules in order, all of them are evaluated so the result shows each one
+func evaluateRules(rules []compiledRule, c *ruleContext) *model.RuleEvaluation {
+	evaluation := &model.RuleEvaluation{Results: []model.RuleResult{}}
+	for i, compiled := range rules {
+		result := model.RuleResult{Rule: i + 1, Name: compiled.rule.Name}
+
+		if compiled.err != nil {
+			result.Error = compiled.err.Error()
+		} else {
+			result.Value = compiled.condition(c)
+		}
+		evaluation.Results = append(evaluation.Results, result)
+
+		if result.Value && !evaluation.Matched {
+			evaluation.Matched = true
+			evaluation.Rule = i + 1
+			evaluation.Name = compiled.rule.Name
+			evaluation.Url = compiled.rule.Url
+		}
+	}
+	return evaluation
+}
+
+// The first rule whose condition is true chooses the destination, it stops at the first match
+func matchRule(rules []compiledRule, c *ruleContext) *model.Rule {
+	for _, compiled := range rules {
+		if compiled.err == nil && compiled.condition(c) {
+			return compiled.rule
+		}
+	}
+	return nil
+}
@@ -0,0 +1,349 @@
+package usecases
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"ehgm.com.br/url-shortener/domain/model"
+)
+
+func TestCompileRule(t *testing.T) {
+	type Input struct {
+		expression string
+	}
+
+	type Output struct {
+		err string
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Valid expression": {
+			Input{expression: `country in ["BR", "PT"] && (device == "ios" || query("ref") != "")`},
+			Output{err: ""}},
+
+		"Test 02 - Empty expression": {
+			Input{expression: "  "},
+			Output{err: "empty expression at column 1"}},
+
+		"Test 03 - Unknown attribute": {
+			Input{expression: `city == "Lisbon"`},
+			Output{err: `unknown attribute "city"`}},
+
+		"Test 04 - Unknown function": {
+			Input{expression: `header("x") == "1"`},
+			Output{err: `unknown function "header"`}},
+
+		"Test 05 - String not closed": {
+			Input{expression: `country == "BR`},
+			Output{err: "string not closed at column 12"}},
+
+		"Test 06 - Not a boolean": {
+			Input{expression: `country`},
+			Output{err: "expression must be a boolean, not a string"}},
+
+		"Test 07 - Compare different kinds": {
+			Input{expression: `hour == "10"`},
+			Output{err: "cannot compare a number with a string at column 6"}},
+
+		"Test 08 - Order of strings": {
+			Input{expression: `country > "BR"`},
+			Output{err: "operator > needs numbers or times, not a string"}},
+
+		"Test 09 - Invalid time": {
+			Input{expression: `time > "tomorrow"`},
+			Output{err: `"tomorrow" is not a RFC 3339 time`}},
+
+		"Test 10 - Invalid pattern": {
+			Input{expression: `matches(referrer, "(")`},
+			Output{err: "invalid pattern of matches"}},
+
+		"Test 11 - Pattern must be a string": {
+			Input{expression: `matches(referrer, query("p"))`},
+			Output{err: "the pattern of matches must be a string"}},
+
+		"Test 12 - Wrong number of arguments": {
+			Input{expression: `startsWith(path)`},
+			Output{err: "startsWith needs 2 arguments, not 1"}},
+
+		"Test 13 - Wrong argument kind": {
+			Input{expression: `contains(path, 1)`},
+			Output{err: "argument 2 of contains must be a string, not a number"}},
+
+		"Test 14 - Mixed list": {
+			Input{expression: `country in ["BR", 1]`},
+			Output{err: "list items must be a string, not a number"}},
+
+		"Test 15 - Unexpected token": {
+			Input{expression: `device == "ios" "android"`},
+			Output{err: `unexpected "android" at column 17`}},
+
+		"Test 16 - Unexpected character": {
+			Input{expression: `device = "ios"`},
+			Output{err: "unexpected character '=' at column 8"}},
+
+		"Test 17 - Nested too deep": {
+			Input{expression: strings.Repeat("(", 40) + "true" + strings.Repeat(")", 40)},
+			Output{err: "expression nested more than 32 levels"}},
+
+		"Test 18 - Too long": {
+			Input{expression: strings.Repeat("true && ", 200) + "true"},
+			Output{err: "expression longer than 1024 characters"}},
+
+		"Test 19 - Logical operator with a string": {
+			Input{expression: `device && true`},
+			Output{err: "operator && needs booleans, not string and boolean"}},
+	}
+
+	for i, test := range tests {
+		_, err := compileRule(test.input.expression)
+		if len(test.output.err) <= 0 {
+			if err != nil {
+				t.Errorf("#%s: Output is: %s. But should not has error", i, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), test.output.err) {
+			t.Errorf("#%s: Output is: %v. But should be: %v", i, err, test.output.err)
+		}
+	}
+}
+
+func TestEvaluateRule(t *testing.T) {
+	now := time.Date(2021, 11, 26, 10, 30, 0, 0, time.UTC)
+	visit := &model.Visit{
+		Platform: model.PlatformIos,
+		Language: "pt-BR,pt;q=0.9,en;q=0.8",
+		Referrer: "https://www.Google.com/search?q=ehgm",
+		Path:     "/docs/api",
+		Query:    "utm_source=mail&ref=Partner",
+		Cookies:  map[string]string{"plan": "premium"},
+	}
+
+	type Input struct {
+		expression string
+	}
+
+	type Output struct {
+		value bool
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Country ignoring the case": {
+			Input{expression: `country == "br"`},
+			Output{value: true}},
+
+		"Test 02 - Country in a list": {
+			Input{expression: `country in ["PT", "ES"]`},
+			Output{value: false}},
+
+		"Test 03 - Device and language": {
+			Input{expression: `device == "ios" && language == "pt-BR"`},
+			Output{value: true}},
+
+		"Test 04 - Host of the referrer": {
+			Input{expression: `host(referrer) in ["google.com", "www.google.com"]`},
+			Output{value: true}},
+
+		"Test 05 - Query param": {
+			Input{expression: `query("utm_source") == "mail" && lower(query("ref")) == "partner"`},
+			Output{value: true}},
+
+		"Test 06 - Missing query param": {
+			Input{expression: `query("missing") != ""`},
+			Output{value: false}},
+
+		"Test 07 - Cookie": {
+			Input{expression: `cookie("plan") == "premium" && cookie("other") == ""`},
+			Output{value: true}},
+
+		"Test 08 - Time window": {
+			Input{expression: `time >= "2021-11-26T00:00:00Z" && time < "2021-11-27T00:00:00Z"`},
+			Output{value: true}},
+
+		"Test 09 - Time with an offset": {
+			Input{expression: `time < "2021-11-26T07:00:00-03:00"`},
+			Output{value: false}},
+
+		"Test 10 - Hour and weekday": {
+			Input{expression: `hour >= 9 && hour < 18 && weekday in ["fri", "sat"]`},
+			Output{value: true}},
+
+		"Test 11 - Path functions": {
+			Input{expression: `startsWith(path, "/docs") && endsWith(path, "api") && contains(path, "cs/a")`},
+			Output{value: true}},
+
+		"Test 12 - Matches": {
+			Input{expression: `matches(referrer, "^https://(www\\.)?[Gg]oogle\\.")`},
+			Output{value: true}},
+
+		"Test 13 - Not and precedence": {
+			Input{expression: `!(device == "android") && false || true`},
+			Output{value: true}},
+
+		"Test 14 - Not binds tighter than and": {
+			Input{expression: `!true && false`},
+			Output{value: false}},
+	}
+
+	for i, test := range tests {
+		condition, err := compileRule(test.input.expression)
+		if err != nil {
+			t.Errorf("#%s: Output is: %s. But should not has error", i, err)
+			continue
+		}
+		c := newRuleContext(visit, now, func() string { return "BR" })
+		if output := condition(c); output != test.output.value {
+			t.Errorf("#%s: Output is: %v. But should be: %v", i, output, test.output.value)
+		}
+	}
+}
+
+func TestValidateRules(t *testing.T) {
+	type Input struct {
+		rules []model.Rule
+	}
+
+	type Output struct {
+		err string
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Valid rules": {
+			Input{rules: []model.Rule{{Name: "brazil", When: `country == "BR"`, Url: "https://ehgm.com.br/br"}}},
+			Output{err: ""}},
+
+		"Test 02 - Should tell the rule and the column": {
+			Input{rules: []model.Rule{
+				{When: `country == "BR"`, Url: "https://ehgm.com.br/br"},
+				{Name: "mobile", When: `device = "ios"`, Url: "https://ehgm.com.br/ios"}}},
+			Output{err: `Rule 2 (mobile) is not valid: unexpected character '=' at column 8`}},
+
+		"Test 03 - Rule without url": {
+			Input{rules: []model.Rule{{When: `true`}}},
+			Output{err: "Rule 1 is not valid: url cannot be empty"}},
+
+		"Test 04 - Too many rules": {
+			Input{rules: make([]model.Rule, 21)},
+			Output{err: "A url cannot have more than 20 rules"}},
+	}
+
+	for i, test := range tests {
+		err := validateRules(test.input.rules)
+		if len(test.output.err) <= 0 {
+			if err != nil {
+				t.Errorf("#%s: Output is: %s. But should not has error", i, err)
+			}
+			continue
+		}
+		if err == nil || err.Error() != test.output.err {
+			t.Errorf("#%s: Output is: %v. But should be: %v", i, err, test.output.err)
+		}
+	}
+}
+
+func TestParseRules(t *testing.T) {
+	type Input struct {
+		value interface{}
+	}
+
+	type Output struct {
+		rules []model.Rule
+		err   bool
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Should parse the rules": {
+			Input{value: []interface{}{map[string]interface{}{"name": "br", "when": `country == "BR"`, "url": "https://ehgm.com.br/br"}}},
+			Output{rules: []model.Rule{{Name: "br", When: `country == "BR"`, Url: "https://ehgm.com.br/br"}}}},
+
+		"Test 02 - Null removes the rules": {
+			Input{value: nil},
+			Output{rules: []model.Rule{}}},
+
+		"Test 03 - Not a list": {
+			Input{value: map[string]interface{}{}},
+			Output{err: true}},
+
+		"Test 04 - Unknown attribute": {
+			Input{value: []interface{}{map[string]interface{}{"if": "true", "url": "https://ehgm.com.br"}}},
+			Output{err: true}},
+	}
+
+	for i, test := range tests {
+		rules, err := parseRules(test.input.value)
+		var invalid *model.InvalidRequestError
+		if test.output.err {
+			if !errors.As(err, &invalid) {
+				t.Errorf("#%s: Output is: %v. But should be: %v", i, err, "InvalidRequestError")
+			}
+			continue
+		}
+		if err != nil || len(rules) != len(test.output.rules) || (len(rules) > 0 && rules[0] != test.output.rules[0]) {
+			t.Errorf("#%s: Output is: %v. But should be: %v", i, rules, test.output.rules)
+		}
+	}
+}
+
+func TestRuleCache(t *testing.T) {
+	rules := []model.Rule{
+		{Name: "br", When: `country == "BR"`, Url: "https://ehgm.com.br/br"},
+		{Name: "broken", When: `country ==`, Url: "https://ehgm.com.br/broken"}}
+	visit := &model.Visit{Country: "BR"}
+	cache := newRuleCache()
+
+	type Input struct {
+		id    string
+		rules []model.Rule
+	}
+
+	type Output struct {
+		url    string
+		cached int
+	}
+
+	tests := []struct {
+		name   string
+		input  Input
+		output Output
+	}{
+		{"Test 01 - Should compile the rules of the link",
+			Input{id: "1q2w3e", rules: rules},
+			Output{url: "https://ehgm.com.br/br", cached: 2}},
+
+		{"Test 02 - Should reuse the compiled rules",
+			Input{id: "1q2w3e", rules: rules},
+			Output{url: "https://ehgm.com.br/br", cached: 2}},
+
+		{"Test 03 - Should compile an updated rule",
+			Input{id: "1q2w3e", rules: []model.Rule{{When: `country == "US"`, Url: "https://ehgm.com.br/us"}}},
+			Output{url: "", cached: 3}},
+	}
+
+	for _, test := range tests {
+		c := newRuleContext(visit, time.Now(), func() string { return visit.Country })
+		url := ""
+		if rule := matchRule(cache.compile(test.input.id, test.input.rules), c); rule != nil {
+			url = rule.Url
+		}
+		if url != test.output.url {
+			t.Errorf("#%s: Output is: %v. But should be: %v", test.name, url, test.output.url)
+		}
+		if len(cache.conditions) != test.output.cached {
+			t.Errorf("#%s: Output is: %v. But should be: %v", test.name, len(cache.conditions), test.output.cached)
+		}
+	}
+}
@@ -4,6 +4,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
 
 	"ehgm.com.br/url-shortener/domain/model"
 	"ehgm.com.br/url-shortener/domain/ports"
@@ -15,20 +19,105 @@ type urlService struct {
 	idGenerator   ports.IdGenerator
 	urlRepository ports.UrlRepository
 	urlCounter    ports.UrlCounter
+	urlFilter     ports.UrlFilter
+
+	lookalikeFilter    ports.UrlFilter
+	moderateLookalikes bool
+
+	metadataFetcher ports.MetadataFetcher
+	redirectType    string
+	utmRepository   ports.UtmRepository
+	geoLocator      ports.GeoLocator
+	clock           ports.Clock
+	pendingClicks   ports.PendingClicks
+	ruleCache       *ruleCache
+
+	randomMu sync.Mutex
+	random   *rand.Rand
 }
 
-// Get an instance of 'UrlService' using this method
+// Get an instance of 'UrlService' using this method.
+// Links without their own redirect type use 'redirectType', the activation windows and schedules use 'clock'.
+// The clicks of 'pendingClicks' are added to the saved ones, it is nil when the counter has no pending clicks
 func NewUrlService(log ports.Logger,
 	idGenerator ports.IdGenerator,
 	urlRepository ports.UrlRepository,
-	urlCounter ports.UrlCounter) ports.UrlService {
+	urlCounter ports.UrlCounter,
+	urlFilter ports.UrlFilter,
+	lookalikeFilter ports.UrlFilter,
+	moderateLookalikes bool,
+	metadataFetcher ports.MetadataFetcher,
+	redirectType string,
+	utmRepository ports.UtmRepository,
+	geoLocator ports.GeoLocator,
+	clock ports.Clock,
+	pendingClicks ports.PendingClicks) ports.UrlService {
+
+	if !model.RedirectTypes[redirectType] {
+		redirectType = model.RedirectFound
+	}
 
-	return &urlService{log: log, idGenerator: idGenerator, urlRepository: urlRepository, urlCounter: urlCounter}
+	return &urlService{log: log, idGenerator: idGenerator, urlRepository: urlRepository, urlCounter: urlCounter,
+		urlFilter: urlFilter, lookalikeFilter: lookalikeFilter, moderateLookalikes: moderateLookalikes,
+		metadataFetcher: metadataFetcher, redirectType: redirectType, utmRepository: utmRepository,
+		geoLocator: geoLocator, clock: clock, pendingClicks: pendingClicks, ruleCache: newRuleCache(),
+		random: rand.New(rand.NewSource(time.Now().UnixNano()))}
 }
 
-func (s *urlService) GenerateId(ctx context.Context, url string) (string, error) {
+// Save the requested url with a new id, the id, state and moderation attributes are set here
+func (s *urlService) GenerateId(ctx context.Context, shortUrl *model.ShortUrl) (string, error) {
 	var id string
 	var err error
+	url := shortUrl.Url
+
+	if err = s.urlFilter.Check(url); err != nil {
+		return "", fmt.Errorf("Check Url %v error. %w", url, err)
+	}
+	if err = validateOptions(shortUrl); err != nil {
+		return "", fmt.Errorf("Validate Url %v options error. %w", url, err)
+	}
+	if err = s.resolveUtm(ctx, shortUrl); err != nil {
+		return "", fmt.Errorf("Resolve Url %v UTM error. %w", url, err)
+	}
+	if err = s.checkVariants(shortUrl.Variants); err != nil {
+		return "", fmt.Errorf("Check Url %v variants error. %w", url, err)
+	}
+	shortUrl.VariantClicks = nil
+	if shortUrl.Geo, err = s.checkGeo(shortUrl.Geo); err != nil {
+		return "", fmt.Errorf("Check Url %v geo rules error. %w", url, err)
+	}
+	if err = s.checkDevices(shortUrl.Devices); err != nil {
+		return "", fmt.Errorf("Check Url %v device rules error. %w", url, err)
+	}
+	if shortUrl.Languages, err = s.checkLanguages(shortUrl.Languages); err != nil {
+		return "", fmt.Errorf("Check Url %v language rules error. %w", url, err)
+	}
+	if err = validateSchedule(shortUrl.ActiveFrom, shortUrl.ActiveUntil, shortUrl.Schedule); err != nil {
+		return "", fmt.Errorf("Check Url %v schedule error. %w", url, err)
+	}
+	if err = s.checkScheduleUrls(shortUrl.Schedule); err != nil {
+		return "", fmt.Errorf("Check Url %v schedule error. %w", url, err)
+	}
+	if err = s.checkRules(shortUrl.Rules); err != nil {
+		return "", fmt.Errorf("Check Url %v rules error. %w", url, err)
+	}
+
+	shortUrl.Enable = true
+	shortUrl.Moderation = ""
+
+	// Lookalike destinations can be saved disabled, waiting for a moderator instead of being rejected
+	var moderation error
+	if err = s.lookalikeFilter.Check(url); err != nil {
+		var lookalike *model.LookalikeUrlError
+		if !s.moderateLookalikes || !errors.As(err, &lookalike) {
+			return "", fmt.Errorf("Check lookalike Url %v error. %w", url, err)
+		}
+		s.log.Info("Url %v held for moderation. Cause: %s", url, err)
+		lookalike.Held = true
+		shortUrl.Enable = false
+		shortUrl.Moderation = lookalike.Code
+		moderation = err
+	}
 
 	// If already exist, generate other id end try again
 	// This will rarely happen, we have 4.398.046.511.104 different ids (4.3 Trillion)
@@ -38,7 +127,8 @@ func (s *urlService) GenerateId(ctx context.Context, url string) (string, error)
 			return "", fmt.Errorf("Nano Id generation error. %w", err)
 		}
 
-		err = s.urlRepository.Save(ctx, id, url, true)
+		shortUrl.Id = id
+		err = s.urlRepository.Save(ctx, shortUrl)
 		if err != nil {
 			var docExist *model.DocumentAlreadyExistsError
 
@@ -51,41 +141,235 @@ func (s *urlService) GenerateId(ctx context.Context, url string) (string, error)
 		}
 
 		s.log.Info("Successfully generated id: %v for Url: %v", id, url)
+		go s.fetchMetadata(id, url)
 		break
 	}
+
+	// The id is also returned, the link exists but is disabled
+	if err == nil && moderation != nil {
+		return id, fmt.Errorf("Url %v pending moderation. %w", url, moderation)
+	}
 	return id, err
 }
 
+// The cached urls have no counters, the saved clicks are read apart and the pending ones are added to them
 func (s *urlService) GetUrl(ctx context.Context, id string) (*model.ShortUrl, error) {
 	shortUrl, err := s.urlRepository.FindById(ctx, id)
 	if err != nil {
 		return shortUrl, fmt.Errorf("GetUrl error for Id: %v. %w", id, err)
 	}
+	if shortUrl.Clicks, shortUrl.VariantClicks, err = s.urlRepository.FindClicks(ctx, id); err != nil {
+		return shortUrl, fmt.Errorf("GetUrl error for Id: %v. %w", id, err)
+	}
+
+	counts := s.findPendingClicks(ctx, []string{id})
+	addPendingClicks(shortUrl, counts)
 	return shortUrl, nil
 }
 
-func (s *urlService) GetUrlToRedirect(ctx context.Context, id string) (string, bool, error) {
+// The preview shows the destination, so a listed one is blocked like the redirect
+func (s *urlService) GetUrlToPreview(ctx context.Context, id string) (*model.ShortUrl, error) {
+	shortUrl, err := s.GetUrl(ctx, id)
+	if err != nil {
+		return shortUrl, fmt.Errorf("GetUrlToPreview error for Id: %v. %w", id, err)
+	}
+	if shortUrl.IsEmpty() {
+		return shortUrl, nil
+	}
+	if err = s.urlFilter.Check(shortUrl.Url); err != nil {
+		return shortUrl, fmt.Errorf("GetUrlToPreview error for Id: %v. %w", id, err)
+	}
+	return shortUrl, nil
+}
+
+func (s *urlService) GetUrlToRedirect(ctx context.Context, id string, visit *model.Visit) (*model.Redirect, error) {
 	shortUrl, err := s.urlRepository.FindById(ctx, id)
 	if err != nil {
-		return "", false, fmt.Errorf("GetUrlToRedirect error for Id: %v. %w", id, err)
+		return nil, fmt.Errorf("GetUrlToRedirect error for Id: %v. %w", id, err)
 	}
 
-	var url string
-	if *shortUrl != (model.ShortUrl{}) {
-		url = shortUrl.Url
-		go s.urlCounter.IncrementCounter(id)
+	redirect := &model.Redirect{Enable: shortUrl.Enable, Type: shortUrl.RedirectType}
+	if len(redirect.Type) <= 0 {
+		redirect.Type = s.redirectType
 	}
-	return url, shortUrl.Enable, nil
+
+	if !shortUrl.IsEmpty() {
+		// Outside of the window the visitor gets a page instead of the destination, the visit is not counted
+		now := s.clock.Now()
+		if window := activeWindow(shortUrl, now); len(window) > 0 && shortUrl.Enable {
+			redirect.Window = window
+			redirect.ActiveFrom = shortUrl.ActiveFrom
+			return redirect, nil
+		}
+		redirect.ValidFor = nextChange(shortUrl, now)
+
+		destination := scheduledUrl(shortUrl, now)
+		if shortUrl.Health != nil && shortUrl.Health.Fallback && len(shortUrl.FallbackUrl) > 0 {
+			destination = shortUrl.FallbackUrl
+		} else if rule := s.ruleDestination(shortUrl, visit, now); rule != nil {
+			destination = rule.Url
+		} else if rule, ok := deviceRule(shortUrl, visit); ok {
+			if len(rule.Url) > 0 {
+				destination = rule.Url
+			}
+			redirect.DeepLink = rule.DeepLink
+		} else if languageUrl := languageDestination(shortUrl, visit); len(languageUrl) > 0 {
+			destination = languageUrl
+		} else if geoUrl := s.geoDestination(shortUrl, visit); len(geoUrl) > 0 {
+			destination = geoUrl
+		} else if len(shortUrl.Variants) > 0 {
+			variant := s.pickVariant(shortUrl, visit)
+			destination = variant.Url
+			redirect.Variant = variant.Id
+			redirect.Sticky = shortUrl.StickyVariant
+		}
+		redirect.Targeted = len(shortUrl.Rules) > 0 || len(shortUrl.Devices) > 0 || len(shortUrl.Languages) > 0 ||
+			len(shortUrl.Geo) > 0 || len(shortUrl.Variants) > 0
+
+		if redirect.Url, err = buildDestination(destination, shortUrl, visit); err != nil {
+			return redirect, fmt.Errorf("GetUrlToRedirect error for Id: %v. %w", id, err)
+		}
+
+		// Links created before the destination was listed must not redirect anymore
+		if err = s.urlFilter.Check(redirect.Url); err != nil {
+			return redirect, fmt.Errorf("GetUrlToRedirect error for Id: %v. %w", id, err)
+		}
+		if len(redirect.DeepLink) > 0 {
+			if err = s.urlFilter.Check(redirect.DeepLink); err != nil {
+				return redirect, fmt.Errorf("GetUrlToRedirect error for Id: %v. %w", id, err)
+			}
+		}
+		// The counters do not wait for the click to be saved, a full buffer slows down the redirects
+		s.urlCounter.IncrementCounter(s.newClickEvent(id, visit, redirect, now))
+	}
+	return redirect, nil
 }
 
 func (s *urlService) UpdateUrl(ctx context.Context, id string, json map[string]interface{}) error {
-	err := s.urlRepository.Update(ctx, id, json)
+	if err := validateUpdate(json); err != nil {
+		return fmt.Errorf("UpdateUrl error for Id: %v. %w", id, err)
+	}
+
+	json, err := s.patchUtm(ctx, id, json)
+	if err != nil {
+		return fmt.Errorf("UpdateUrl error for Id: %v. %w", id, err)
+	}
+	if err = s.patchVariants(json); err != nil {
+		return fmt.Errorf("UpdateUrl error for Id: %v. %w", id, err)
+	}
+	if err = s.patchGeo(json); err != nil {
+		return fmt.Errorf("UpdateUrl error for Id: %v. %w", id, err)
+	}
+	if err = s.patchDevices(json); err != nil {
+		return fmt.Errorf("UpdateUrl error for Id: %v. %w", id, err)
+	}
+	if err = s.patchLanguages(json); err != nil {
+		return fmt.Errorf("UpdateUrl error for Id: %v. %w", id, err)
+	}
+	if err = patchWindow(json); err != nil {
+		return fmt.Errorf("UpdateUrl error for Id: %v. %w", id, err)
+	}
+	if err = s.patchSchedule(json); err != nil {
+		return fmt.Errorf("UpdateUrl error for Id: %v. %w", id, err)
+	}
+	if err = s.patchRules(json); err != nil {
+		return fmt.Errorf("UpdateUrl error for Id: %v. %w", id, err)
+	}
+
+	held, err := s.moderateUpdate(json)
+	if err != nil {
+		return fmt.Errorf("UpdateUrl error for Id: %v. %w", id, err)
+	}
+
+	err = s.urlRepository.Update(ctx, id, json)
 	if err != nil {
 		return fmt.Errorf("UpdateUrl error for Id: %v. %w", id, err)
 	}
+
+	for k, v := range json {
+		if url, ok := v.(string); ok && strings.EqualFold(k, "url") {
+			go s.fetchMetadata(id, url)
+		}
+	}
+	if held != nil {
+		return fmt.Errorf("UpdateUrl held Id: %v for moderation. %w", id, held)
+	}
 	return nil
 }
 
+// The new destinations of an update are checked like when the url is created, the moderation code is never sent.
+// A lookalike one disables the url waiting for a moderator, it is returned to tell the url was held
+func (s *urlService) moderateUpdate(json map[string]interface{}) (*model.LookalikeUrlError, error) {
+	urls := []string{}
+	for k, v := range json {
+		if strings.EqualFold(k, "moderation") {
+			delete(json, k)
+			continue
+		}
+		url, ok := v.(string)
+		if ok && len(url) > 0 && (strings.EqualFold(k, "url") || strings.EqualFold(k, "fallbackUrl")) {
+			urls = append(urls, url)
+		}
+	}
+
+	var held *model.LookalikeUrlError
+	for _, url := range urls {
+		if err := s.urlFilter.Check(url); err != nil {
+			return nil, err
+		}
+		err := s.lookalikeFilter.Check(url)
+		if err == nil {
+			continue
+		}
+		var lookalike *model.LookalikeUrlError
+		if !s.moderateLookalikes || !errors.As(err, &lookalike) {
+			return nil, fmt.Errorf("Check lookalike Url %v error. %w", url, err)
+		}
+		s.log.Info("Url %v held for moderation. Cause: %s", url, err)
+		lookalike.Held = true
+		held = lookalike
+	}
+	if held == nil {
+		return nil, nil
+	}
+
+	for k := range json {
+		if strings.EqualFold(k, "enable") {
+			delete(json, k)
+		}
+	}
+	json["enable"] = false
+	json["moderation"] = held.Code
+	return held, nil
+}
+
+// Dry run of the rules for a visit, the given rules are used instead of the link ones when not nil.
+// The visit is not counted and the destination is not checked
+func (s *urlService) EvaluateRules(ctx context.Context, id string, visit *model.Visit, rules []model.Rule) (*model.RuleEvaluation, error) {
+	shortUrl, err := s.urlRepository.FindById(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("EvaluateRules error for Id: %v. %w", id, err)
+	}
+	if shortUrl.IsEmpty() {
+		return nil, fmt.Errorf("EvaluateRules error for Id: %v. %w", id, &model.DocumentNotFoundError{Id: id})
+	}
+
+	var compiled []compiledRule
+	if rules == nil {
+		compiled = s.ruleCache.compile(id, shortUrl.Rules)
+	} else if err = validateRules(rules); err != nil {
+		return nil, fmt.Errorf("EvaluateRules error for Id: %v. %w", id, err)
+	} else {
+		compiled = compileRules(rules)
+	}
+
+	evaluation := evaluateRules(compiled, s.newRuleContext(visit, s.clock.Now()))
+	if !evaluation.Matched {
+		evaluation.Url = scheduledUrl(shortUrl, s.clock.Now())
+	}
+	return evaluation, nil
+}
+
 func (s *urlService) GetStats(ctx context.Context, limit int) ([]model.ShortUrl, error) {
 	var defaultLimit = 10
 
@@ -99,5 +383,487 @@ func (s *urlService) GetStats(ctx context.Context, limit int) ([]model.ShortUrl,
 	if err != nil {
 		return nil, fmt.Errorf("GetStats error using limit: %v. %w", defaultLimit, err)
 	}
-	return shortUrls, nil
+	return s.addPendingStats(ctx, shortUrls, defaultLimit), nil
+}
+
+// Enrich the url with the destination page details, runs in background so the errors are only logged
+func (s *urlService) fetchMetadata(id, url string) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	metadata, err := s.metadataFetcher.Fetch(ctx, url)
+	if err != nil {
+		s.log.Error("fetchMetadata error for Id: %v. Cause: %s", id, err)
+		return
+	}
+
+	if err = s.urlRepository.SaveMetadata(ctx, id, metadata); err != nil {
+		s.log.Error("fetchMetadata error saving Id: %v. Cause: %s", id, err)
+	}
+}
+
+// Copy the params of the UTM template to the url, the params sent with the url replace the template ones
+func (s *urlService) resolveUtm(ctx context.Context, shortUrl *model.ShortUrl) error {
+	var utm model.Utm
+
+	if len(shortUrl.UtmTemplate) > 0 {
+		template, err := s.findUtmTemplate(ctx, shortUrl.UtmTemplate)
+		if err != nil {
+			return err
+		}
+		utm = template.Utm
+	}
+	if shortUrl.Utm != nil {
+		utm = overlayUtm(utm, *shortUrl.Utm)
+	}
+	if err := validateUtm(&utm); err != nil {
+		return err
+	}
+
+	shortUrl.Utm = nil
+	if utm != (model.Utm{}) {
+		shortUrl.Utm = &utm
+	}
+	return nil
+}
+
+// The UTM params of an update are merged with the current ones, returns a copy of the update with the merged params
+func (s *urlService) patchUtm(ctx context.Context, id string, json map[string]interface{}) (map[string]interface{}, error) {
+	var utmPatch, templatePatch interface{}
+	var hasUtm, hasTemplate bool
+	update := map[string]interface{}{}
+
+	for k, v := range json {
+		switch {
+		case strings.EqualFold(k, "utm"):
+			utmPatch, hasUtm = v, true
+		case strings.EqualFold(k, "utmTemplate"):
+			templatePatch, hasTemplate = v, true
+		default:
+			update[k] = v
+		}
+	}
+	if !hasUtm && !hasTemplate {
+		return update, nil
+	}
+
+	shortUrl, err := s.urlRepository.FindById(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var utm model.Utm
+	if shortUrl.Utm != nil {
+		utm = *shortUrl.Utm
+	}
+
+	// A new template replaces the current params, removing the template keeps them
+	if hasTemplate {
+		name, ok := templatePatch.(string)
+		if templatePatch != nil && !ok {
+			return nil, &model.InvalidRequestError{Message: "UTM template must be a string"}
+		}
+		if len(name) > 0 {
+			template, err := s.findUtmTemplate(ctx, name)
+			if err != nil {
+				return nil, err
+			}
+			utm = template.Utm
+			update["utmTemplate"] = name
+		} else {
+			update["utmTemplate"] = nil
+		}
+	}
+
+	if hasUtm {
+		if utm, err = patchUtm(utm, utmPatch); err != nil {
+			return nil, err
+		}
+	}
+
+	update["utm"] = nil
+	if utm != (model.Utm{}) {
+		update["utm"] = &utm
+	}
+	return update, nil
+}
+
+func (s *urlService) findUtmTemplate(ctx context.Context, name string) (*model.UtmTemplate, error) {
+	template, err := s.utmRepository.FindTemplate(ctx, name)
+	if err != nil {
+		var notFound *model.DocumentNotFoundError
+		if errors.As(err, &notFound) {
+			return nil, &model.InvalidRequestError{Message: fmt.Sprintf("UTM template %v not found", name)}
+		}
+		return nil, fmt.Errorf("FindTemplate error for name: %v. %w", name, err)
+	}
+	return template, nil
+}
+
+// The variant of a sticky link is kept while it is still in the link, other visits get a weighted random variant
+func (s *urlService) pickVariant(shortUrl *model.ShortUrl, visit *model.Visit) *model.Variant {
+	if shortUrl.StickyVariant && visit != nil && len(visit.Variant) > 0 {
+		for i := range shortUrl.Variants {
+			if shortUrl.Variants[i].Id == visit.Variant && shortUrl.Variants[i].Weight > 0 {
+				return &shortUrl.Variants[i]
+			}
+		}
+	}
+
+	s.randomMu.Lock()
+	r := s.random.Float64()
+	s.randomMu.Unlock()
+	return weightedVariant(shortUrl.Variants, r)
+}
+
+// The urls of the targeting options go through the same checks as the destination, empty ones are skipped.
+// A lookalike target url is always refused, only the main destination can wait for moderation
+func (s *urlService) checkTargetUrls(urls ...string) error {
+	for _, url := range urls {
+		if len(url) <= 0 {
+			continue
+		}
+		if err := s.urlFilter.Check(url); err != nil {
+			return err
+		}
+		if err := s.lookalikeFilter.Check(url); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Replace the option 'key' of an update by the value returned by 'check', a nil value removes the option
+func patchOption(json map[string]interface{}, key string, check func(value interface{}) (interface{}, error)) error {
+	for k, v := range json {
+		if !strings.EqualFold(k, key) {
+			continue
+		}
+
+		value, err := check(v)
+		if err != nil {
+			return err
+		}
+
+		delete(json, k)
+		json[key] = value
+		return nil
+	}
+	return nil
+}
+
+func (s *urlService) checkVariants(variants []model.Variant) error {
+	if err := validateVariants(variants); err != nil {
+		return err
+	}
+	urls := []string{}
+	for _, variant := range variants {
+		urls = append(urls, variant.Url)
+	}
+	return s.checkTargetUrls(urls...)
+}
+
+// Replace the variants of an update by the checked ones, an empty list removes them
+func (s *urlService) patchVariants(json map[string]interface{}) error {
+	return patchOption(json, "variants", func(value interface{}) (interface{}, error) {
+		variants, err := parseVariants(value)
+		if err != nil {
+			return nil, err
+		}
+		if err = s.checkVariants(variants); err != nil || len(variants) <= 0 {
+			return nil, err
+		}
+		return variants, nil
+	})
+}
+
+// The country of the visit is resolved only for links with geo rules, other countries get the default destination
+func (s *urlService) geoDestination(shortUrl *model.ShortUrl, visit *model.Visit) string {
+	if len(shortUrl.Geo) <= 0 || visit == nil {
+		return ""
+	}
+	if len(visit.Country) <= 0 {
+		visit.Country = s.geoLocator.Country(visit.Ip)
+	}
+	return shortUrl.Geo[visit.Country]
+}
+
+// Returns the rules with upper case countries
+func (s *urlService) checkGeo(geo map[string]string) (map[string]string, error) {
+	rules, err := validateGeo(geo)
+	if err != nil || len(rules) <= 0 {
+		return nil, err
+	}
+	return rules, s.checkTargetUrls(mapUrls(rules)...)
+}
+
+func mapUrls(rules map[string]string) []string {
+	urls := []string{}
+	for _, url := range rules {
+		urls = append(urls, url)
+	}
+	return urls
+}
+
+// Replace the geo rules of an update by the checked ones, an empty object removes them
+func (s *urlService) patchGeo(json map[string]interface{}) error {
+	return patchOption(json, "geo", func(value interface{}) (interface{}, error) {
+		geo, err := parseGeo(value)
+		if err != nil {
+			return nil, err
+		}
+		if geo, err = s.checkGeo(geo); err != nil || len(geo) <= 0 {
+			return nil, err
+		}
+		return geo, nil
+	})
+}
+
+// The rule of the visitor platform, a rule with only a deep link falls back to the url of the link
+func deviceRule(shortUrl *model.ShortUrl, visit *model.Visit) (model.DeviceRule, bool) {
+	if visit == nil || len(visit.Platform) <= 0 {
+		return model.DeviceRule{}, false
+	}
+	rule, ok := shortUrl.Devices[visit.Platform]
+	return rule, ok
+}
+
+// The deep links are checked with the urls
+func (s *urlService) checkDevices(devices map[string]model.DeviceRule) error {
+	if err := validateDevices(devices); err != nil {
+		return err
+	}
+	urls := []string{}
+	for _, rule := range devices {
+		urls = append(urls, rule.Url, rule.DeepLink)
+	}
+	return s.checkTargetUrls(urls...)
+}
+
+// Replace the device rules of an update by the checked ones, an empty object removes them
+func (s *urlService) patchDevices(json map[string]interface{}) error {
+	return patchOption(json, "devices", func(value interface{}) (interface{}, error) {
+		devices, err := parseDevices(value)
+		if err != nil {
+			return nil, err
+		}
+		if err = s.checkDevices(devices); err != nil || len(devices) <= 0 {
+			return nil, err
+		}
+		return devices, nil
+	})
+}
+
+func languageDestination(shortUrl *model.ShortUrl, visit *model.Visit) string {
+	if visit == nil {
+		return ""
+	}
+	return matchLanguage(shortUrl.Languages, visit.Language)
+}
+
+// Returns the rules with formatted tags
+func (s *urlService) checkLanguages(languages map[string]string) (map[string]string, error) {
+	rules, err := validateLanguages(languages)
+	if err != nil || len(rules) <= 0 {
+		return nil, err
+	}
+	return rules, s.checkTargetUrls(mapUrls(rules)...)
+}
+
+// Replace the language rules of an update by the checked ones, an empty object removes them
+func (s *urlService) patchLanguages(json map[string]interface{}) error {
+	return patchOption(json, "languages", func(value interface{}) (interface{}, error) {
+		languages, err := parseLanguages(value)
+		if err != nil {
+			return nil, err
+		}
+		if languages, err = s.checkLanguages(languages); err != nil || len(languages) <= 0 {
+			return nil, err
+		}
+		return languages, nil
+	})
+}
+
+func (s *urlService) checkScheduleUrls(schedule []model.ScheduledUrl) error {
+	urls := []string{}
+	for _, scheduled := range schedule {
+		urls = append(urls, scheduled.Url)
+	}
+	return s.checkTargetUrls(urls...)
+}
+
+// Replace the scheduled destinations of an update by the checked ones, an empty list removes them
+func (s *urlService) patchSchedule(json map[string]interface{}) error {
+	return patchOption(json, "schedule", func(value interface{}) (interface{}, error) {
+		schedule, err := parseSchedule(value)
+		if err != nil {
+			return nil, err
+		}
+		if err = validateSchedule(nil, nil, schedule); err != nil {
+			return nil, err
+		}
+		if err = s.checkScheduleUrls(schedule); err != nil || len(schedule) <= 0 {
+			return nil, err
+		}
+		return schedule, nil
+	})
+}
+
+// Replace the window times of an update by parsed times, a null time removes it.
+// The order is checked when both times are updated, a window that ends before it starts is never active
+func patchWindow(json map[string]interface{}) error {
+	var window [2]*time.Time
+	var updated [2]bool
+
+	for k, v := range json {
+		i := 0
+		switch {
+		case strings.EqualFold(k, "activeFrom"):
+			i = 0
+		case strings.EqualFold(k, "activeUntil"):
+			i = 1
+		default:
+			continue
+		}
+
+		at, err := parseTime(k, v)
+		if err != nil {
+			return err
+		}
+		delete(json, k)
+		window[i], updated[i] = at, true
+	}
+
+	for i, key := range []string{"activeFrom", "activeUntil"} {
+		if !updated[i] {
+			continue
+		}
+		json[key] = nil
+		if window[i] != nil {
+			json[key] = *window[i]
+		}
+	}
+	return validateSchedule(window[0], window[1], nil)
+}
+
+// The click keeps the country of the visit, looked up when no targeting option needed it, and only a prefix of the ip
+func (s *urlService) newClickEvent(id string, visit *model.Visit, redirect *model.Redirect, now time.Time) *model.ClickEvent {
+	event := &model.ClickEvent{
+		Version:     model.ClickEventVersion,
+		Id:          id,
+		Timestamp:   now.UTC(),
+		Destination: redirect.Url,
+		Variant:     redirect.Variant,
+	}
+	if visit == nil {
+		return event
+	}
+
+	if len(visit.Country) <= 0 && len(visit.Ip) > 0 {
+		visit.Country = s.geoLocator.Country(visit.Ip)
+	}
+	event.RequestId = visit.RequestId
+	event.Referrer = visit.Referrer
+	event.UserAgent = visit.UserAgent
+	event.Ip = anonymizeIp(visit.Ip)
+	event.Country = visit.Country
+	event.Platform = visit.Platform
+	return event
+}
+
+// The country of the visit is looked up only when a rule uses it
+func (s *urlService) newRuleContext(visit *model.Visit, now time.Time) *ruleContext {
+	var c *ruleContext
+	c = newRuleContext(visit, now, func() string {
+		if len(c.visit.Country) <= 0 {
+			c.visit.Country = s.geoLocator.Country(c.visit.Ip)
+		}
+		return c.visit.Country
+	})
+	return c
+}
+
+func (s *urlService) ruleDestination(shortUrl *model.ShortUrl, visit *model.Visit, now time.Time) *model.Rule {
+	if len(shortUrl.Rules) <= 0 {
+		return nil
+	}
+	return matchRule(s.ruleCache.compile(shortUrl.Id, shortUrl.Rules), s.newRuleContext(visit, now))
+}
+
+func (s *urlService) checkRules(rules []model.Rule) error {
+	if err := validateRules(rules); err != nil {
+		return err
+	}
+	urls := []string{}
+	for _, rule := range rules {
+		urls = append(urls, rule.Url)
+	}
+	return s.checkTargetUrls(urls...)
+}
+
+// Replace the rules of an update by the checked ones, an empty list removes them
+func (s *urlService) patchRules(json map[string]interface{}) error {
+	return patchOption(json, "rules", func(value interface{}) (interface{}, error) {
+		rules, err := parseRules(value)
+		if err != nil {
+			return nil, err
+		}
+		if err = s.checkRules(rules); err != nil || len(rules) <= 0 {
+			return nil, err
+		}
+		return rules, nil
+	})
+}
+
+// Pending clicks of the ids, the saved counters are used alone when they cannot be found
+func (s *urlService) findPendingClicks(ctx context.Context, ids []string) []model.ClickCount {
+	if s.pendingClicks == nil || len(ids) <= 0 {
+		return nil
+	}
+
+	counts, err := s.pendingClicks.Pending(ctx, ids)
+	if err != nil {
+		s.log.Error("Failed to get the pending clicks of Ids: %v. Cause: %s", ids, err)
+		return nil
+	}
+	return counts
+}
+
+// The urls with most pending clicks can pass the saved top urls, they are added before ranking again
+func (s *urlService) addPendingStats(ctx context.Context, shortUrls []model.ShortUrl, limit int) []model.ShortUrl {
+	if s.pendingClicks == nil {
+		return shortUrls
+	}
+
+	top, err := s.pendingClicks.TopPending(ctx, limit)
+	if err != nil {
+		s.log.Error("Failed to get the urls with most pending clicks. Cause: %s", err)
+		return shortUrls
+	}
+
+	ids := []string{}
+	listed := map[string]bool{}
+	for _, shortUrl := range shortUrls {
+		ids = append(ids, shortUrl.Id)
+		listed[shortUrl.Id] = true
+	}
+	for _, id := range top {
+		if listed[id] {
+			continue
+		}
+		shortUrl, err := s.urlRepository.FindById(ctx, id)
+		if err != nil {
+			s.log.Info("Ignoring pending clicks of Id: %v. Cause: %s", id, err)
+			continue
+		}
+		shortUrls = append(shortUrls, *shortUrl)
+		ids = append(ids, id)
+		listed[id] = true
+	}
+
+	counts := s.findPendingClicks(ctx, ids)
+	for i := range shortUrls {
+		addPendingClicks(&shortUrls[i], counts)
+	}
+	return rankByClicks(shortUrls, limit)
 }
@@ -3,7 +3,9 @@ package usecases
 import (
 	"context"
 	"errors"
+	"reflect"
 	"testing"
+	"time"
 
 	"ehgm.com.br/url-shortener/domain/model"
 	"ehgm.com.br/url-shortener/domain/ports"
@@ -11,15 +13,18 @@ import (
 
 // Empty UrlRepository
 type urlRepositoryMock struct {
-	saveFn     func(ctx context.Context, id, url string, enable bool) error
-	findByIdFn func(ctx context.Context, id string) (*model.ShortUrl, error)
-	updateFn   func(ctx context.Context, id string, json map[string]interface{}) error
-	getStatsFn func(ctx context.Context, limit int) ([]model.ShortUrl, error)
+	saveFn       func(ctx context.Context, shortUrl *model.ShortUrl) error
+	findByIdFn   func(ctx context.Context, id string) (*model.ShortUrl, error)
+	findClicksFn func(ctx context.Context, id string) (int64, map[string]int64, error)
+	updateFn     func(ctx context.Context, id string, json map[string]interface{}) error
+	getStatsFn   func(ctx context.Context, limit int) ([]model.ShortUrl, error)
+
+	saveMetadataFn func(ctx context.Context, id string, metadata *model.Metadata) error
 }
 
-func (r *urlRepositoryMock) Save(ctx context.Context, id, url string, enable bool) error {
+func (r *urlRepositoryMock) Save(ctx context.Context, shortUrl *model.ShortUrl) error {
 	if r.saveFn != nil {
-		return r.saveFn(ctx, id, url, enable)
+		return r.saveFn(ctx, shortUrl)
 	}
 	return nil
 }
@@ -31,6 +36,15 @@ func (r *urlRepositoryMock) FindById(ctx context.Context, id string) (*model.Sho
 	return &model.ShortUrl{}, nil
 }
 
+// Without 'findClicksFn' the counters of 'findByIdFn' are kept
+func (r *urlRepositoryMock) FindClicks(ctx context.Context, id string) (int64, map[string]int64, error) {
+	if r.findClicksFn != nil {
+		return r.findClicksFn(ctx, id)
+	}
+	shortUrl, err := r.FindById(ctx, id)
+	return shortUrl.Clicks, shortUrl.VariantClicks, err
+}
+
 func (r *urlRepositoryMock) Update(ctx context.Context, id string, json map[string]interface{}) error {
 	if r.updateFn != nil {
 		return r.updateFn(ctx, id, json)
@@ -45,6 +59,13 @@ func (r *urlRepositoryMock) GetStats(ctx context.Context, limit int) ([]model.Sh
 	return []model.ShortUrl{}, nil
 }
 
+func (r *urlRepositoryMock) SaveMetadata(ctx context.Context, id string, metadata *model.Metadata) error {
+	if r.saveMetadataFn != nil {
+		return r.saveMetadataFn(ctx, id, metadata)
+	}
+	return nil
+}
+
 // Empty IdGenerator
 type idGeneratorMock struct {
 	newFn func() (string, error)
@@ -60,7 +81,119 @@ func (g *idGeneratorMock) New() (string, error) {
 // Empty UrlCounter
 type urlCounterMock struct{}
 
-func (c *urlCounterMock) IncrementCounter(id string) {}
+func (c *urlCounterMock) IncrementCounter(event *model.ClickEvent) {}
+
+func (c *urlCounterMock) Close(ctx context.Context) error {
+	return nil
+}
+
+// PendingClicks with fixed counts, empty by default
+type pendingClicksMock struct {
+	counts []model.ClickCount
+	top    []string
+	err    error
+}
+
+func (p *pendingClicksMock) Pending(ctx context.Context, ids []string) ([]model.ClickCount, error) {
+	return p.counts, p.err
+}
+
+func (p *pendingClicksMock) TopPending(ctx context.Context, limit int) ([]string, error) {
+	return p.top, p.err
+}
+
+func (p *pendingClicksMock) Take(ctx context.Context) (string, []model.ClickCount, error) {
+	return "", nil, nil
+}
+
+func (p *pendingClicksMock) Commit(ctx context.Context, flushId string) error {
+	return nil
+}
+
+func (p *pendingClicksMock) Release(ctx context.Context, flushId string) error {
+	return nil
+}
+
+// Empty UrlFilter
+type urlFilterMock struct {
+	checkFn func(rawUrl string) error
+}
+
+func (f *urlFilterMock) Check(rawUrl string) error {
+	if f.checkFn != nil {
+		return f.checkFn(rawUrl)
+	}
+	return nil
+}
+
+// Empty MetadataFetcher
+type metadataFetcherMock struct {
+	fetchFn func(ctx context.Context, rawUrl string) (*model.Metadata, error)
+}
+
+func (f *metadataFetcherMock) Fetch(ctx context.Context, rawUrl string) (*model.Metadata, error) {
+	if f.fetchFn != nil {
+		return f.fetchFn(ctx, rawUrl)
+	}
+	return &model.Metadata{}, nil
+}
+
+// Empty UtmRepository
+type utmRepositoryMock struct {
+	saveTemplateFn   func(ctx context.Context, template *model.UtmTemplate) error
+	findTemplateFn   func(ctx context.Context, name string) (*model.UtmTemplate, error)
+	getTemplatesFn   func(ctx context.Context, limit int) ([]model.UtmTemplate, error)
+	deleteTemplateFn func(ctx context.Context, name string) error
+}
+
+func (r *utmRepositoryMock) SaveTemplate(ctx context.Context, template *model.UtmTemplate) error {
+	if r.saveTemplateFn != nil {
+		return r.saveTemplateFn(ctx, template)
+	}
+	return nil
+}
+
+func (r *utmRepositoryMock) FindTemplate(ctx context.Context, name string) (*model.UtmTemplate, error) {
+	if r.findTemplateFn != nil {
+		return r.findTemplateFn(ctx, name)
+	}
+	return nil, &model.DocumentNotFoundError{Id: name}
+}
+
+func (r *utmRepositoryMock) GetTemplates(ctx context.Context, limit int) ([]model.UtmTemplate, error) {
+	if r.getTemplatesFn != nil {
+		return r.getTemplatesFn(ctx, limit)
+	}
+	return []model.UtmTemplate{}, nil
+}
+
+func (r *utmRepositoryMock) DeleteTemplate(ctx context.Context, name string) error {
+	if r.deleteTemplateFn != nil {
+		return r.deleteTemplateFn(ctx, name)
+	}
+	return nil
+}
+
+// GeoLocator with a fixed country for each IP
+type geoLocatorMock struct {
+	countries map[string]string
+}
+
+func (g *geoLocatorMock) Country(ip string) string {
+	return g.countries[ip]
+}
+
+// Clock stopped at 'now', the current time when it is empty
+type clockMock struct {
+	now time.Time
+}
+
+func (c *clockMock) Now() time.Time {
+	if c.now.IsZero() {
+		return time.Now()
+	}
+	return c.now
+}
 
 // Empty Logger
 type loggerMock struct{}
@@ -98,7 +231,7 @@ func TestGenerateId(t *testing.T) {
 				},
 				urlCounter: &urlCounterMock{},
 				repo: &urlRepositoryMock{
-					saveFn: func(ctx context.Context, id, url string, enable bool) error {
+					saveFn: func(ctx context.Context, shortUrl *model.ShortUrl) error {
 						return nil
 					}},
 				url: "https://ehgm.com.br"},
@@ -129,7 +262,7 @@ func TestGenerateId(t *testing.T) {
 				idGenerator: &idGeneratorMock{},
 				urlCounter:  &urlCounterMock{},
 				repo: &urlRepositoryMock{
-					saveFn: func(ctx context.Context, id, url string, enable bool) error {
+					saveFn: func(ctx context.Context, shortUrl *model.ShortUrl) error {
 						return errors.New("Save error")
 					}},
 				url: "https://ehgm.com.br"},
@@ -142,8 +275,8 @@ func TestGenerateId(t *testing.T) {
 	ctx := context.Background()
 
 	for i, test := range tests {
-		urlService := NewUrlService(test.input.log, test.input.idGenerator, test.input.repo, test.input.urlCounter)
-		id, err := urlService.GenerateId(ctx, test.input.url)
+		urlService := NewUrlService(test.input.log, test.input.idGenerator, test.input.repo, test.input.urlCounter, &urlFilterMock{}, &urlFilterMock{}, false, &metadataFetcherMock{}, model.RedirectFound, &utmRepositoryMock{}, &geoLocatorMock{}, &clockMock{}, &pendingClicksMock{})
+		id, err := urlService.GenerateId(ctx, &model.ShortUrl{Url: test.input.url})
 
 		if test.output.hasError && err == nil {
 			t.Errorf("#%s: Output is: %s. But should has error: %v", i, err, test.output.hasError)
@@ -190,7 +323,7 @@ func TestGenerateIdDocumentAlrearyExist(t *testing.T) {
 				},
 				urlCounter: &urlCounterMock{},
 				repo: &urlRepositoryMock{
-					saveFn: func(ctx context.Context, id, url string, enable bool) error {
+					saveFn: func(ctx context.Context, shortUrl *model.ShortUrl) error {
 						saveCounter++
 						if saveCounter > 1 {
 							return nil
@@ -209,7 +342,7 @@ func TestGenerateIdDocumentAlrearyExist(t *testing.T) {
 				idGenerator: &idGeneratorMock{},
 				urlCounter:  &urlCounterMock{},
 				repo: &urlRepositoryMock{
-					saveFn: func(ctx context.Context, id, url string, enable bool) error {
+					saveFn: func(ctx context.Context, shortUrl *model.ShortUrl) error {
 						return &model.DocumentAlreadyExistsError{}
 					}},
 				url: "https://ehgm.com.br"},
@@ -222,8 +355,8 @@ func TestGenerateIdDocumentAlrearyExist(t *testing.T) {
 	ctx := context.Background()
 
 	for i, test := range tests {
-		urlService := NewUrlService(test.input.log, test.input.idGenerator, test.input.repo, test.input.urlCounter)
-		id, err := urlService.GenerateId(ctx, test.input.url)
+		urlService := NewUrlService(test.input.log, test.input.idGenerator, test.input.repo, test.input.urlCounter, &urlFilterMock{}, &urlFilterMock{}, false, &metadataFetcherMock{}, model.RedirectFound, &utmRepositoryMock{}, &geoLocatorMock{}, &clockMock{}, &pendingClicksMock{})
+		id, err := urlService.GenerateId(ctx, &model.ShortUrl{Url: test.input.url})
 
 		if test.output.hasError && err == nil {
 			t.Errorf("#%s: Output is: %s. But should has error: %v", i, err, test.output.hasError)
@@ -286,12 +419,30 @@ func TestGetUrl(t *testing.T) {
 				shortUrl: model.ShortUrl{},
 				hasError: true,
 			}},
+
+		"Test 03 - Should return the saved clicks of a cached URL": {
+			Input{
+				log:         &loggerMock{},
+				idGenerator: &idGeneratorMock{},
+				urlCounter:  &urlCounterMock{},
+				repo: &urlRepositoryMock{
+					findByIdFn: func(ctx context.Context, id string) (*model.ShortUrl, error) {
+						return &model.ShortUrl{Url: "https://ehgm.com.br", Enable: true}, nil
+					},
+					findClicksFn: func(ctx context.Context, id string) (int64, map[string]int64, error) {
+						return 10, map[string]int64{"a": 10}, nil
+					}},
+				id: "1q2w3e"},
+			Output{
+				shortUrl: model.ShortUrl{Url: "https://ehgm.com.br", Enable: true, Clicks: 10, VariantClicks: map[string]int64{"a": 10}},
+				hasError: false,
+			}},
 	}
 
 	ctx := context.Background()
 
 	for i, test := range tests {
-		urlService := NewUrlService(test.input.log, test.input.idGenerator, test.input.repo, test.input.urlCounter)
+		urlService := NewUrlService(test.input.log, test.input.idGenerator, test.input.repo, test.input.urlCounter, &urlFilterMock{}, &urlFilterMock{}, false, &metadataFetcherMock{}, model.RedirectFound, &utmRepositoryMock{}, &geoLocatorMock{}, &clockMock{}, &pendingClicksMock{})
 		shortUrl, err := urlService.GetUrl(ctx, test.input.id)
 
 		if test.output.hasError && err == nil {
@@ -302,12 +453,63 @@ func TestGetUrl(t *testing.T) {
 			t.Errorf("#%s: Output is: %s. But should not has error: %v", i, err, test.output.hasError)
 			continue
 		}
-		if !test.output.hasError && *shortUrl != test.output.shortUrl {
+		if !test.output.hasError && !reflect.DeepEqual(*shortUrl, test.output.shortUrl) {
 			t.Errorf("#%s: Output is: %v. But should be: %v", i, shortUrl, test.output.shortUrl)
 		}
 	}
 }
 
+func TestGetUrlToPreview(t *testing.T) {
+	type Input struct {
+		blocked bool
+	}
+
+	type Output struct {
+		blocked bool
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Should return the URL": {
+			Input{blocked: false},
+			Output{blocked: false}},
+
+		"Test 02 - Should block a listed destination": {
+			Input{blocked: true},
+			Output{blocked: true}},
+	}
+
+	ctx := context.Background()
+
+	for i, test := range tests {
+		repo := &urlRepositoryMock{
+			findByIdFn: func(ctx context.Context, id string) (*model.ShortUrl, error) {
+				return &model.ShortUrl{Id: id, Url: "https://evil.com", Enable: true}, nil
+			}}
+		urlFilter := &urlFilterMock{
+			checkFn: func(rawUrl string) error {
+				if test.input.blocked {
+					return &model.BlockedUrlError{Url: rawUrl, Reason: "destination matches blocklist entry evil.com"}
+				}
+				return nil
+			},
+		}
+
+		urlService := NewUrlService(&loggerMock{}, &idGeneratorMock{}, repo, &urlCounterMock{}, urlFilter, &urlFilterMock{}, false, &metadataFetcherMock{}, model.RedirectFound, &utmRepositoryMock{}, &geoLocatorMock{}, &clockMock{}, &pendingClicksMock{})
+		shortUrl, err := urlService.GetUrlToPreview(ctx, "1q2w3e")
+
+		var blocked *model.BlockedUrlError
+		if errors.As(err, &blocked) != test.output.blocked {
+			t.Errorf("#%s: Output is: %v. But should be blocked: %v", i, err, test.output.blocked)
+		}
+		if !test.output.blocked && (err != nil || shortUrl.Url != "https://evil.com") {
+			t.Errorf("#%s: Output is: %v %v. But should be the URL", i, shortUrl, err)
+		}
+	}
+}
+
 func TestGetUrlToRedirect(t *testing.T) {
 	type Input struct {
 		log         ports.Logger
@@ -315,6 +517,7 @@ func TestGetUrlToRedirect(t *testing.T) {
 		urlCounter  ports.UrlCounter
 		repo        ports.UrlRepository
 		id          string
+		visit       model.Visit
 	}
 
 	type Output struct {
@@ -374,13 +577,64 @@ func TestGetUrlToRedirect(t *testing.T) {
 				enable:   true,
 				hasError: true,
 			}},
+
+		"Test 04 - Should return the fallback URL of a broken destination": {
+			Input{
+				log:         &loggerMock{},
+				idGenerator: &idGeneratorMock{},
+				urlCounter:  &urlCounterMock{},
+				repo: &urlRepositoryMock{
+					findByIdFn: func(ctx context.Context, id string) (*model.ShortUrl, error) {
+						return &model.ShortUrl{Url: "https://ehgm.com.br", Enable: true, FallbackUrl: "https://ehgm.com.br/home",
+							Health: &model.Health{Broken: true, Failures: 3, Fallback: true}}, nil
+					}},
+				id: "1q2w3e"},
+			Output{
+				url:      "https://ehgm.com.br/home",
+				enable:   true,
+				hasError: false,
+			}},
+
+		"Test 05 - Should return the URL of a broken destination before the fallback": {
+			Input{
+				log:         &loggerMock{},
+				idGenerator: &idGeneratorMock{},
+				urlCounter:  &urlCounterMock{},
+				repo: &urlRepositoryMock{
+					findByIdFn: func(ctx context.Context, id string) (*model.ShortUrl, error) {
+						return &model.ShortUrl{Url: "https://ehgm.com.br", Enable: true, FallbackUrl: "https://ehgm.com.br/home",
+							Health: &model.Health{Broken: true, Failures: 1}}, nil
+					}},
+				id: "1q2w3e"},
+			Output{
+				url:      "https://ehgm.com.br",
+				enable:   true,
+				hasError: false,
+			}},
+
+		"Test 06 - Should forward the query params": {
+			Input{
+				log:         &loggerMock{},
+				idGenerator: &idGeneratorMock{},
+				urlCounter:  &urlCounterMock{},
+				repo: &urlRepositoryMock{
+					findByIdFn: func(ctx context.Context, id string) (*model.ShortUrl, error) {
+						return &model.ShortUrl{Url: "https://ehgm.com.br?a=1", Enable: true, ForwardQuery: true}, nil
+					}},
+				id:    "1q2w3e",
+				visit: model.Visit{Query: "utm_source=mail"}},
+			Output{
+				url:      "https://ehgm.com.br?a=1&utm_source=mail",
+				enable:   true,
+				hasError: false,
+			}},
 	}
 
 	ctx := context.Background()
 
 	for i, test := range tests {
-		urlService := NewUrlService(test.input.log, test.input.idGenerator, test.input.repo, test.input.urlCounter)
-		url, enable, err := urlService.GetUrlToRedirect(ctx, test.input.id)
+		urlService := NewUrlService(test.input.log, test.input.idGenerator, test.input.repo, test.input.urlCounter, &urlFilterMock{}, &urlFilterMock{}, false, &metadataFetcherMock{}, model.RedirectFound, &utmRepositoryMock{}, &geoLocatorMock{}, &clockMock{}, &pendingClicksMock{})
+		redirect, err := urlService.GetUrlToRedirect(ctx, test.input.id, &test.input.visit)
 
 		if test.output.hasError && err == nil {
 			t.Errorf("#%s: Output is: %s. But should has error: %v", i, err, test.output.hasError)
@@ -390,8 +644,8 @@ func TestGetUrlToRedirect(t *testing.T) {
 			t.Errorf("#%s: Output is: %s. But should not has error: %v", i, err, test.output.hasError)
 			continue
 		}
-		if !test.output.hasError && (url != test.output.url || enable != test.output.enable) {
-			t.Errorf("#%s: Output is: %v / %v. But should be: %v / %v", i, url, enable, test.output.url, test.output.enable)
+		if !test.output.hasError && (redirect.Url != test.output.url || redirect.Enable != test.output.enable) {
+			t.Errorf("#%s: Output is: %v / %v. But should be: %v / %v", i, redirect.Url, redirect.Enable, test.output.url, test.output.enable)
 		}
 	}
 }
@@ -448,7 +702,7 @@ func TestUpdateUrl(t *testing.T) {
 	ctx := context.Background()
 
 	for i, test := range tests {
-		urlService := NewUrlService(test.input.log, test.input.idGenerator, test.input.repo, test.input.urlCounter)
+		urlService := NewUrlService(test.input.log, test.input.idGenerator, test.input.repo, test.input.urlCounter, &urlFilterMock{}, &urlFilterMock{}, false, &metadataFetcherMock{}, model.RedirectFound, &utmRepositoryMock{}, &geoLocatorMock{}, &clockMock{}, &pendingClicksMock{})
 		err := urlService.UpdateUrl(ctx, test.input.id, test.input.json)
 
 		if test.output.hasError && err == nil {
@@ -536,7 +790,7 @@ func TestGetStats(t *testing.T) {
 	ctx := context.Background()
 
 	for i, test := range tests {
-		urlService := NewUrlService(test.input.log, test.input.idGenerator, test.input.repo, test.input.urlCounter)
+		urlService := NewUrlService(test.input.log, test.input.idGenerator, test.input.repo, test.input.urlCounter, &urlFilterMock{}, &urlFilterMock{}, false, &metadataFetcherMock{}, model.RedirectFound, &utmRepositoryMock{}, &geoLocatorMock{}, &clockMock{}, &pendingClicksMock{})
 		shortUrls, err := urlService.GetStats(ctx, test.input.limit)
 
 		if test.output.hasError && err == nil {
@@ -550,3 +804,848 @@ func TestGetStats(t *testing.T) {
 		}
 	}
 }
+
+func TestUrlFilter(t *testing.T) {
+	blocked := "https://evil.com"
+	filter := &urlFilterMock{
+		checkFn: func(rawUrl string) error {
+			if rawUrl == blocked {
+				return &model.BlockedUrlError{Url: rawUrl}
+			}
+			return nil
+		},
+	}
+	repo := &urlRepositoryMock{
+		findByIdFn: func(ctx context.Context, id string) (*model.ShortUrl, error) {
+			return &model.ShortUrl{Url: blocked, Enable: true}, nil
+		}}
+
+	ctx := context.Background()
+	urlService := NewUrlService(&loggerMock{}, &idGeneratorMock{}, repo, &urlCounterMock{}, filter, &urlFilterMock{}, false, &metadataFetcherMock{}, model.RedirectFound, &utmRepositoryMock{}, &geoLocatorMock{}, &clockMock{}, &pendingClicksMock{})
+	var blockedErr *model.BlockedUrlError
+
+	if _, err := urlService.GenerateId(ctx, &model.ShortUrl{Url: blocked}); !errors.As(err, &blockedErr) {
+		t.Errorf("GenerateId output is: %s. But should be a BlockedUrlError", err)
+	}
+	if _, err := urlService.GenerateId(ctx, &model.ShortUrl{Url: "https://ehgm.com.br"}); err != nil {
+		t.Errorf("GenerateId output is: %s. But should not has error", err)
+	}
+	if err := urlService.UpdateUrl(ctx, "1q2w3e", map[string]interface{}{"URL": blocked}); !errors.As(err, &blockedErr) {
+		t.Errorf("UpdateUrl output is: %s. But should be a BlockedUrlError", err)
+	}
+	if err := urlService.UpdateUrl(ctx, "1q2w3e", map[string]interface{}{"enable": false}); err != nil {
+		t.Errorf("UpdateUrl output is: %s. But should not has error", err)
+	}
+	if _, err := urlService.GetUrlToRedirect(ctx, "1q2w3e", &model.Visit{}); !errors.As(err, &blockedErr) {
+		t.Errorf("GetUrlToRedirect output is: %s. But should be a BlockedUrlError", err)
+	}
+}
+
+func TestLookalikeFilter(t *testing.T) {
+	type Input struct {
+		moderate bool
+	}
+
+	type Output struct {
+		id       string
+		saved    bool
+		enable   bool
+		hasError bool
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Should reject the Url": {
+			Input{moderate: false},
+			Output{id: "", saved: false, hasError: true}},
+
+		"Test 02 - Should save the Url disabled": {
+			Input{moderate: true},
+			Output{id: "1q2w3e", saved: true, enable: false, hasError: true}},
+	}
+
+	ctx := context.Background()
+
+	for i, test := range tests {
+		var saved *model.ShortUrl
+		idGenerator := &idGeneratorMock{
+			newFn: func() (string, error) {
+				return "1q2w3e", nil
+			},
+		}
+		repo := &urlRepositoryMock{
+			saveFn: func(ctx context.Context, shortUrl *model.ShortUrl) error {
+				saved = shortUrl
+				return nil
+			}}
+		lookalikeFilter := &urlFilterMock{
+			checkFn: func(rawUrl string) error {
+				return &model.LookalikeUrlError{Url: rawUrl, Brand: "paypal.com", Code: model.ReasonHomoglyph}
+			},
+		}
+
+		urlService := NewUrlService(&loggerMock{}, idGenerator, repo, &urlCounterMock{}, &urlFilterMock{}, lookalikeFilter, test.input.moderate, &metadataFetcherMock{}, model.RedirectFound, &utmRepositoryMock{}, &geoLocatorMock{}, &clockMock{}, &pendingClicksMock{})
+		id, err := urlService.GenerateId(ctx, &model.ShortUrl{Url: "https://paypaI.com"})
+
+		var lookalike *model.LookalikeUrlError
+		if test.output.hasError && !errors.As(err, &lookalike) {
+			t.Errorf("#%s: Output is: %s. But should be a LookalikeUrlError", i, err)
+			continue
+		}
+		if id != test.output.id || (saved != nil) != test.output.saved {
+			t.Errorf("#%s: Output is: %v / %v. But should be: %v / %v", i, id, saved != nil, test.output.id, test.output.saved)
+			continue
+		}
+		if saved != nil && (saved.Enable != test.output.enable || saved.Moderation != model.ReasonHomoglyph) {
+			t.Errorf("#%s: Output is: %v. But should be disabled with moderation code", i, saved)
+		}
+	}
+}
+
+func TestLookalikeUpdate(t *testing.T) {
+	type Input struct {
+		moderate bool
+		json     map[string]interface{}
+	}
+
+	type Output struct {
+		updated  map[string]interface{}
+		held     bool
+		hasError bool
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Should reject the new Url": {
+			Input{moderate: false, json: map[string]interface{}{"url": "https://paypaI.com"}},
+			Output{updated: nil, held: false, hasError: true}},
+
+		"Test 02 - Should update the Url disabled": {
+			Input{moderate: true, json: map[string]interface{}{"url": "https://paypaI.com", "enable": true}},
+			Output{updated: map[string]interface{}{"url": "https://paypaI.com", "enable": false, "moderation": model.ReasonHomoglyph},
+				held: true, hasError: true}},
+
+		"Test 03 - Should reject the new fallback Url": {
+			Input{moderate: false, json: map[string]interface{}{"fallbackUrl": "https://paypaI.com"}},
+			Output{updated: nil, held: false, hasError: true}},
+
+		"Test 04 - Should not accept a moderation code": {
+			Input{moderate: true, json: map[string]interface{}{"url": "https://ehgm.com.br", "moderation": ""}},
+			Output{updated: map[string]interface{}{"url": "https://ehgm.com.br"}, held: false, hasError: false}},
+	}
+
+	ctx := context.Background()
+
+	for i, test := range tests {
+		var updated map[string]interface{}
+		repo := &urlRepositoryMock{
+			updateFn: func(ctx context.Context, id string, json map[string]interface{}) error {
+				updated = json
+				return nil
+			}}
+		lookalikeFilter := &urlFilterMock{
+			checkFn: func(rawUrl string) error {
+				if rawUrl == "https://paypaI.com" {
+					return &model.LookalikeUrlError{Url: rawUrl, Brand: "paypal.com", Code: model.ReasonHomoglyph}
+				}
+				return nil
+			},
+		}
+
+		urlService := NewUrlService(&loggerMock{}, &idGeneratorMock{}, repo, &urlCounterMock{}, &urlFilterMock{}, lookalikeFilter, test.input.moderate, &metadataFetcherMock{}, model.RedirectFound, &utmRepositoryMock{}, &geoLocatorMock{}, &clockMock{}, &pendingClicksMock{})
+		err := urlService.UpdateUrl(ctx, "1q2w3e", test.input.json)
+
+		if test.output.hasError != (err != nil) {
+			t.Errorf("#%s: Output is: %v. But should has error: %v", i, err, test.output.hasError)
+			continue
+		}
+		var lookalike *model.LookalikeUrlError
+		if err != nil && (!errors.As(err, &lookalike) || lookalike.Held != test.output.held) {
+			t.Errorf("#%s: Output is: %s. But should be a LookalikeUrlError held: %v", i, err, test.output.held)
+		}
+		if !reflect.DeepEqual(updated, test.output.updated) {
+			t.Errorf("#%s: Output is: %v. But should be: %v", i, updated, test.output.updated)
+		}
+	}
+}
+
+func TestFetchMetadata(t *testing.T) {
+	saved := make(chan *model.Metadata, 1)
+
+	idGenerator := &idGeneratorMock{
+		newFn: func() (string, error) {
+			return "1q2w3e", nil
+		},
+	}
+	repo := &urlRepositoryMock{
+		saveMetadataFn: func(ctx context.Context, id string, metadata *model.Metadata) error {
+			saved <- metadata
+			return nil
+		}}
+	fetcher := &metadataFetcherMock{
+		fetchFn: func(ctx context.Context, rawUrl string) (*model.Metadata, error) {
+			return &model.Metadata{Title: rawUrl}, nil
+		},
+	}
+
+	urlService := NewUrlService(&loggerMock{}, idGenerator, repo, &urlCounterMock{}, &urlFilterMock{}, &urlFilterMock{}, false, fetcher, model.RedirectFound, &utmRepositoryMock{}, &geoLocatorMock{}, &clockMock{}, &pendingClicksMock{})
+	if _, err := urlService.GenerateId(context.Background(), &model.ShortUrl{Url: "https://ehgm.com.br"}); err != nil {
+		t.Fatalf("Output is: %s. But should not has error", err)
+	}
+
+	select {
+	case metadata := <-saved:
+		if metadata.Title != "https://ehgm.com.br" {
+			t.Errorf("Output is: %v. But should be: %v", metadata.Title, "https://ehgm.com.br")
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Metadata should be saved after the url")
+	}
+}
+
+func TestRedirectType(t *testing.T) {
+	type Input struct {
+		defaultType string
+		linkType    string
+	}
+
+	type Output struct {
+		redirectType string
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Should use the default type": {
+			Input{defaultType: model.RedirectMoved, linkType: ""},
+			Output{redirectType: model.RedirectMoved}},
+
+		"Test 02 - Should use the type of the link": {
+			Input{defaultType: model.RedirectMoved, linkType: model.RedirectHtml},
+			Output{redirectType: model.RedirectHtml}},
+
+		"Test 03 - Should use 302 for an invalid default type": {
+			Input{defaultType: "303", linkType: ""},
+			Output{redirectType: model.RedirectFound}},
+	}
+
+	ctx := context.Background()
+
+	for i, test := range tests {
+		repo := &urlRepositoryMock{
+			findByIdFn: func(ctx context.Context, id string) (*model.ShortUrl, error) {
+				return &model.ShortUrl{Url: "https://ehgm.com.br", Enable: true, RedirectType: test.input.linkType}, nil
+			}}
+
+		urlService := NewUrlService(&loggerMock{}, &idGeneratorMock{}, repo, &urlCounterMock{}, &urlFilterMock{}, &urlFilterMock{}, false, &metadataFetcherMock{}, test.input.defaultType, &utmRepositoryMock{}, &geoLocatorMock{}, &clockMock{}, &pendingClicksMock{})
+		redirect, err := urlService.GetUrlToRedirect(ctx, "1q2w3e", &model.Visit{})
+		if err != nil {
+			t.Errorf("#%s: Output is: %s. But should not has error", i, err)
+			continue
+		}
+		if redirect.Type != test.output.redirectType {
+			t.Errorf("#%s: Output is: %v. But should be: %v", i, redirect.Type, test.output.redirectType)
+		}
+	}
+
+	urlService := NewUrlService(&loggerMock{}, &idGeneratorMock{}, &urlRepositoryMock{}, &urlCounterMock{}, &urlFilterMock{}, &urlFilterMock{}, false, &metadataFetcherMock{}, model.RedirectFound, &utmRepositoryMock{}, &geoLocatorMock{}, &clockMock{}, &pendingClicksMock{})
+	var invalid *model.InvalidRequestError
+
+	if _, err := urlService.GenerateId(ctx, &model.ShortUrl{Url: "https://ehgm.com.br", RedirectType: "303"}); !errors.As(err, &invalid) {
+		t.Errorf("GenerateId output is: %s. But should be an InvalidRequestError", err)
+	}
+	if err := urlService.UpdateUrl(ctx, "1q2w3e", map[string]interface{}{"redirectType": 301}); !errors.As(err, &invalid) {
+		t.Errorf("UpdateUrl output is: %s. But should be an InvalidRequestError", err)
+	}
+	if err := urlService.UpdateUrl(ctx, "1q2w3e", map[string]interface{}{"redirectType": model.RedirectPermanent}); err != nil {
+		t.Errorf("UpdateUrl output is: %s. But should not has error", err)
+	}
+	if err := urlService.UpdateUrl(ctx, "1q2w3e", map[string]interface{}{"redirectType": ""}); err != nil {
+		t.Errorf("UpdateUrl output is: %s. But should not has error", err)
+	}
+}
+
+// UrlCounter that sends the served variants
+type variantCounterMock struct {
+	variants chan string
+}
+
+func (c *variantCounterMock) IncrementCounter(event *model.ClickEvent) {
+	c.variants <- event.Variant
+}
+
+func (c *variantCounterMock) Close(ctx context.Context) error {
+	return nil
+}
+
+func TestVariants(t *testing.T) {
+	type Input struct {
+		sticky  bool
+		variant string
+	}
+
+	type Output struct {
+		variants map[string]bool
+		sticky   bool
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Should serve only variants with weight": {
+			Input{sticky: false, variant: "c"},
+			Output{variants: map[string]bool{"a": true, "b": true}, sticky: false}},
+
+		"Test 02 - Should keep the variant of the visitor": {
+			Input{sticky: true, variant: "b"},
+			Output{variants: map[string]bool{"b": true}, sticky: true}},
+
+		"Test 03 - Should ignore a variant without weight": {
+			Input{sticky: true, variant: "c"},
+			Output{variants: map[string]bool{"a": true, "b": true}, sticky: true}},
+	}
+
+	ctx := context.Background()
+
+	for i, test := range tests {
+		repo := &urlRepositoryMock{
+			findByIdFn: func(ctx context.Context, id string) (*model.ShortUrl, error) {
+				return &model.ShortUrl{Url: "https://ehgm.com.br", Enable: true, StickyVariant: test.input.sticky,
+					Variants: []model.Variant{
+						{Id: "a", Url: "https://ehgm.com.br/a", Weight: 1},
+						{Id: "b", Url: "https://ehgm.com.br/b", Weight: 1},
+						{Id: "c", Url: "https://ehgm.com.br/c", Weight: 0}}}, nil
+			}}
+		counter := &variantCounterMock{variants: make(chan string, 100)}
+
+		urlService := NewUrlService(&loggerMock{}, &idGeneratorMock{}, repo, counter, &urlFilterMock{}, &urlFilterMock{}, false, &metadataFetcherMock{}, model.RedirectFound, &utmRepositoryMock{}, &geoLocatorMock{}, &clockMock{}, &pendingClicksMock{})
+
+		served := map[string]bool{}
+		for j := 0; j < 100; j++ {
+			redirect, err := urlService.GetUrlToRedirect(ctx, "1q2w3e", &model.Visit{Variant: test.input.variant})
+			if err != nil {
+				t.Fatalf("#%s: Output is: %s. But should not has error", i, err)
+			}
+			if redirect.Url != "https://ehgm.com.br/"+redirect.Variant || redirect.Sticky != test.output.sticky {
+				t.Errorf("#%s: Output is: %v. But should be the url of the variant", i, redirect)
+			}
+			if counted := <-counter.variants; counted != redirect.Variant {
+				t.Errorf("#%s: Output is: %v. But should count: %v", i, counted, redirect.Variant)
+			}
+			served[redirect.Variant] = true
+		}
+
+		if !reflect.DeepEqual(served, test.output.variants) {
+			t.Errorf("#%s: Output is: %v. But should be: %v", i, served, test.output.variants)
+		}
+	}
+}
+
+func TestGeo(t *testing.T) {
+	type Input struct {
+		visit *model.Visit
+	}
+
+	type Output struct {
+		url      string
+		targeted bool
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Should use the rule of the country": {
+			Input{visit: &model.Visit{Ip: "177.0.0.1"}},
+			Output{url: "https://ehgm.com.br/br", targeted: true}},
+
+		"Test 02 - Should use the default url for other countries": {
+			Input{visit: &model.Visit{Ip: "81.2.69.160"}},
+			Output{url: "https://ehgm.com.br", targeted: true}},
+
+		"Test 03 - Should use the default url for unknown countries": {
+			Input{visit: &model.Visit{Ip: "10.0.0.1"}},
+			Output{url: "https://ehgm.com.br", targeted: true}},
+
+		"Test 04 - Should use the country of the visit": {
+			Input{visit: &model.Visit{Ip: "81.2.69.160", Country: "US"}},
+			Output{url: "https://ehgm.com.br/us", targeted: true}},
+	}
+
+	ctx := context.Background()
+	geoLocator := &geoLocatorMock{countries: map[string]string{"177.0.0.1": "BR", "81.2.69.160": "GB"}}
+	repo := &urlRepositoryMock{
+		findByIdFn: func(ctx context.Context, id string) (*model.ShortUrl, error) {
+			return &model.ShortUrl{Url: "https://ehgm.com.br", Enable: true,
+				Geo: map[string]string{"BR": "https://ehgm.com.br/br", "US": "https://ehgm.com.br/us"}}, nil
+		}}
+
+	for i, test := range tests {
+		urlService := NewUrlService(&loggerMock{}, &idGeneratorMock{}, repo, &urlCounterMock{}, &urlFilterMock{}, &urlFilterMock{}, false, &metadataFetcherMock{}, model.RedirectFound, &utmRepositoryMock{}, geoLocator, &clockMock{}, &pendingClicksMock{})
+
+		redirect, err := urlService.GetUrlToRedirect(ctx, "1q2w3e", test.input.visit)
+		if err != nil {
+			t.Errorf("#%s: Output is: %s. But should not has error", i, err)
+			continue
+		}
+		if redirect.Url != test.output.url || redirect.Targeted != test.output.targeted {
+			t.Errorf("#%s: Output is: %v / %v. But should be: %v / %v", i, redirect.Url, redirect.Targeted, test.output.url, test.output.targeted)
+		}
+	}
+}
+
+func TestDevices(t *testing.T) {
+	type Input struct {
+		visit *model.Visit
+	}
+
+	type Output struct {
+		url      string
+		deepLink string
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Should try the app and fall back to the store": {
+			Input{visit: &model.Visit{Platform: model.PlatformIos, Ip: "177.0.0.1"}},
+			Output{url: "https://apps.apple.com/app/id1", deepLink: "myapp://home"}},
+
+		"Test 02 - Deep link without store falls back to the url": {
+			Input{visit: &model.Visit{Platform: model.PlatformAndroid}},
+			Output{url: "https://ehgm.com.br", deepLink: "intent://home#Intent;scheme=myapp;end"}},
+
+		"Test 03 - Desktop goes to the web page": {
+			Input{visit: &model.Visit{Platform: model.PlatformDesktop, Ip: "177.0.0.1"}},
+			Output{url: "https://ehgm.com.br/web", deepLink: ""}},
+
+		"Test 04 - Unknown platform uses the geo rules": {
+			Input{visit: &model.Visit{Platform: "", Ip: "177.0.0.1"}},
+			Output{url: "https://ehgm.com.br/br", deepLink: ""}},
+	}
+
+	ctx := context.Background()
+	geoLocator := &geoLocatorMock{countries: map[string]string{"177.0.0.1": "BR"}}
+	repo := &urlRepositoryMock{
+		findByIdFn: func(ctx context.Context, id string) (*model.ShortUrl, error) {
+			return &model.ShortUrl{Url: "https://ehgm.com.br", Enable: true,
+				Geo: map[string]string{"BR": "https://ehgm.com.br/br"},
+				Devices: map[string]model.DeviceRule{
+					model.PlatformIos:     {Url: "https://apps.apple.com/app/id1", DeepLink: "myapp://home"},
+					model.PlatformAndroid: {DeepLink: "intent://home#Intent;scheme=myapp;end"},
+					model.PlatformDesktop: {Url: "https://ehgm.com.br/web"}}}, nil
+		}}
+
+	for i, test := range tests {
+		urlService := NewUrlService(&loggerMock{}, &idGeneratorMock{}, repo, &urlCounterMock{}, &urlFilterMock{}, &urlFilterMock{}, false, &metadataFetcherMock{}, model.RedirectFound, &utmRepositoryMock{}, geoLocator, &clockMock{}, &pendingClicksMock{})
+
+		redirect, err := urlService.GetUrlToRedirect(ctx, "1q2w3e", test.input.visit)
+		if err != nil {
+			t.Errorf("#%s: Output is: %s. But should not has error", i, err)
+			continue
+		}
+		if redirect.Url != test.output.url || redirect.DeepLink != test.output.deepLink || !redirect.Targeted {
+			t.Errorf("#%s: Output is: %v / %v. But should be: %v / %v", i, redirect.Url, redirect.DeepLink, test.output.url, test.output.deepLink)
+		}
+	}
+}
+
+func TestLanguages(t *testing.T) {
+	type Input struct {
+		visit *model.Visit
+	}
+
+	type Output struct {
+		url string
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Should use the language of the visitor": {
+			Input{visit: &model.Visit{Language: "pt-BR,pt;q=0.9,en;q=0.8", Ip: "81.2.69.160"}},
+			Output{url: "https://ehgm.com.br/pt"}},
+
+		"Test 02 - Language comes before the country": {
+			Input{visit: &model.Visit{Language: "en-GB", Ip: "177.0.0.1"}},
+			Output{url: "https://ehgm.com.br/en"}},
+
+		"Test 03 - Other languages use the geo rules": {
+			Input{visit: &model.Visit{Language: "fr", Ip: "177.0.0.1"}},
+			Output{url: "https://ehgm.com.br/br"}},
+
+		"Test 04 - Should use the default url": {
+			Input{visit: &model.Visit{Language: "fr"}},
+			Output{url: "https://ehgm.com.br"}},
+	}
+
+	ctx := context.Background()
+	geoLocator := &geoLocatorMock{countries: map[string]string{"177.0.0.1": "BR"}}
+	repo := &urlRepositoryMock{
+		findByIdFn: func(ctx context.Context, id string) (*model.ShortUrl, error) {
+			return &model.ShortUrl{Url: "https://ehgm.com.br", Enable: true,
+				Geo:       map[string]string{"BR": "https://ehgm.com.br/br"},
+				Languages: map[string]string{"pt": "https://ehgm.com.br/pt", "en": "https://ehgm.com.br/en"}}, nil
+		}}
+
+	for i, test := range tests {
+		urlService := NewUrlService(&loggerMock{}, &idGeneratorMock{}, repo, &urlCounterMock{}, &urlFilterMock{}, &urlFilterMock{}, false, &metadataFetcherMock{}, model.RedirectFound, &utmRepositoryMock{}, geoLocator, &clockMock{}, &pendingClicksMock{})
+
+		redirect, err := urlService.GetUrlToRedirect(ctx, "1q2w3e", test.input.visit)
+		if err != nil {
+			t.Errorf("#%s: Output is: %s. But should not has error", i, err)
+			continue
+		}
+		if redirect.Url != test.output.url || !redirect.Targeted {
+			t.Errorf("#%s: Output is: %v. But should be: %v", i, redirect.Url, test.output.url)
+		}
+	}
+}
+
+func TestSchedule(t *testing.T) {
+	start := time.Date(2021, 11, 26, 0, 0, 0, 0, time.UTC)
+	end := start.Add(72 * time.Hour)
+
+	type Input struct {
+		now time.Time
+	}
+
+	type Output struct {
+		url      string
+		window   string
+		validFor time.Duration
+		counted  bool
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Should not be active before the start": {
+			Input{now: start.Add(-time.Minute)},
+			Output{url: "", window: model.WindowPending, counted: false}},
+
+		"Test 02 - Should use the url after the start": {
+			Input{now: start},
+			Output{url: "https://ehgm.com.br", window: "", validFor: 24 * time.Hour, counted: true}},
+
+		"Test 03 - Should switch to the scheduled url": {
+			Input{now: start.Add(30 * time.Hour)},
+			Output{url: "https://ehgm.com.br/day2", window: "", validFor: 18 * time.Hour, counted: true}},
+
+		"Test 04 - Should use the last scheduled url": {
+			Input{now: start.Add(50 * time.Hour)},
+			Output{url: "https://ehgm.com.br/day3", window: "", validFor: 22 * time.Hour, counted: true}},
+
+		"Test 05 - Should expire at the end": {
+			Input{now: end},
+			Output{url: "", window: model.WindowExpired, counted: false}},
+	}
+
+	ctx := context.Background()
+	repo := &urlRepositoryMock{
+		findByIdFn: func(ctx context.Context, id string) (*model.ShortUrl, error) {
+			return &model.ShortUrl{Url: "https://ehgm.com.br", Enable: true, ActiveFrom: &start, ActiveUntil: &end,
+				Schedule: []model.ScheduledUrl{
+					{At: start.Add(24 * time.Hour), Url: "https://ehgm.com.br/day2"},
+					{At: start.Add(48 * time.Hour), Url: "https://ehgm.com.br/day3"}}}, nil
+		}}
+
+	for i, test := range tests {
+		counter := &variantCounterMock{variants: make(chan string, 1)}
+		urlService := NewUrlService(&loggerMock{}, &idGeneratorMock{}, repo, counter, &urlFilterMock{}, &urlFilterMock{}, false, &metadataFetcherMock{}, model.RedirectFound, &utmRepositoryMock{}, &geoLocatorMock{}, &clockMock{now: test.input.now}, &pendingClicksMock{})
+
+		redirect, err := urlService.GetUrlToRedirect(ctx, "1q2w3e", &model.Visit{})
+		if err != nil {
+			t.Errorf("#%s: Output is: %s. But should not has error", i, err)
+			continue
+		}
+		if redirect.Url != test.output.url || redirect.Window != test.output.window || redirect.ValidFor != test.output.validFor {
+			t.Errorf("#%s: Output is: %v / %v / %v. But should be: %v / %v / %v", i, redirect.Url, redirect.Window, redirect.ValidFor,
+				test.output.url, test.output.window, test.output.validFor)
+		}
+
+		select {
+		case <-counter.variants:
+			if !test.output.counted {
+				t.Errorf("#%s: Output is: counted. But should not be counted", i)
+			}
+		case <-time.After(100 * time.Millisecond):
+			if test.output.counted {
+				t.Errorf("#%s: Output is: not counted. But should be counted", i)
+			}
+		}
+	}
+}
+
+func TestRules(t *testing.T) {
+	type Input struct {
+		visit *model.Visit
+	}
+
+	type Output struct {
+		url string
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - First matching rule wins": {
+			Input{visit: &model.Visit{Query: "ref=partner", Ip: "177.0.0.1", Platform: model.PlatformIos}},
+			Output{url: "https://ehgm.com.br/partner"}},
+
+		"Test 02 - Rules come before the device rules": {
+			Input{visit: &model.Visit{Ip: "177.0.0.1", Platform: model.PlatformIos}},
+			Output{url: "https://ehgm.com.br/br"}},
+
+		"Test 03 - No match uses the device rules": {
+			Input{visit: &model.Visit{Platform: model.PlatformIos}},
+			Output{url: "https://ehgm.com.br/ios"}},
+
+		"Test 04 - No match uses the default url": {
+			Input{visit: &model.Visit{Cookies: map[string]string{"beta": "0"}}},
+			Output{url: "https://ehgm.com.br"}},
+
+		"Test 05 - Should read the cookies": {
+			Input{visit: &model.Visit{Cookies: map[string]string{"beta": "1"}}},
+			Output{url: "https://ehgm.com.br/beta"}},
+	}
+
+	ctx := context.Background()
+	geoLocator := &geoLocatorMock{countries: map[string]string{"177.0.0.1": "BR"}}
+	repo := &urlRepositoryMock{
+		findByIdFn: func(ctx context.Context, id string) (*model.ShortUrl, error) {
+			return &model.ShortUrl{Url: "https://ehgm.com.br", Enable: true,
+				Devices: map[string]model.DeviceRule{model.PlatformIos: {Url: "https://ehgm.com.br/ios"}},
+				Rules: []model.Rule{
+					{Name: "partner", When: `query("ref") == "partner"`, Url: "https://ehgm.com.br/partner"},
+					{Name: "brazil", When: `country == "BR"`, Url: "https://ehgm.com.br/br"},
+					{Name: "beta", When: `cookie("beta") == "1"`, Url: "https://ehgm.com.br/beta"}}}, nil
+		}}
+
+	for i, test := range tests {
+		urlService := NewUrlService(&loggerMock{}, &idGeneratorMock{}, repo, &urlCounterMock{}, &urlFilterMock{}, &urlFilterMock{}, false, &metadataFetcherMock{}, model.RedirectFound, &utmRepositoryMock{}, geoLocator, &clockMock{}, &pendingClicksMock{})
+
+		redirect, err := urlService.GetUrlToRedirect(ctx, "1q2w3e", test.input.visit)
+		if err != nil {
+			t.Errorf("#%s: Output is: %s. But should not has error", i, err)
+			continue
+		}
+		if redirect.Url != test.output.url || !redirect.Targeted {
+			t.Errorf("#%s: Output is: %v. But should be: %v", i, redirect.Url, test.output.url)
+		}
+	}
+}
+
+func TestEvaluateRules(t *testing.T) {
+	type Input struct {
+		id    string
+		visit *model.Visit
+		rules []model.Rule
+	}
+
+	type Output struct {
+		evaluation *model.RuleEvaluation
+		err        error
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Should evaluate the rules of the link": {
+			Input{id: "1q2w3e", visit: &model.Visit{Country: "BR"}},
+			Output{evaluation: &model.RuleEvaluation{Matched: true, Rule: 2, Name: "brazil", Url: "https://ehgm.com.br/br",
+				Results: []model.RuleResult{{Rule: 1, Name: "mobile", Value: false}, {Rule: 2, Name: "brazil", Value: true}}}}},
+
+		"Test 02 - No match returns the url of the link": {
+			Input{id: "1q2w3e", visit: &model.Visit{Country: "PT"}},
+			Output{evaluation: &model.RuleEvaluation{Matched: false, Url: "https://ehgm.com.br",
+				Results: []model.RuleResult{{Rule: 1, Name: "mobile", Value: false}, {Rule: 2, Name: "brazil", Value: false}}}}},
+
+		"Test 03 - Should evaluate the sent rules at the sent time": {
+			Input{id: "1q2w3e", visit: &model.Visit{Time: time.Date(2021, 11, 26, 0, 0, 0, 0, time.UTC)},
+				rules: []model.Rule{{When: `time >= "2021-11-26T00:00:00Z"`, Url: "https://ehgm.com.br/black-friday"}}},
+			Output{evaluation: &model.RuleEvaluation{Matched: true, Rule: 1, Url: "https://ehgm.com.br/black-friday",
+				Results: []model.RuleResult{{Rule: 1, Value: true}}}}},
+
+		"Test 04 - Invalid sent rules": {
+			Input{id: "1q2w3e", visit: &model.Visit{}, rules: []model.Rule{{When: `country ==`, Url: "https://ehgm.com.br"}}},
+			Output{err: &model.InvalidRuleError{}}},
+
+		"Test 05 - Url not found": {
+			Input{id: "notfound", visit: &model.Visit{}},
+			Output{err: &model.DocumentNotFoundError{}}},
+	}
+
+	ctx := context.Background()
+	repo := &urlRepositoryMock{
+		findByIdFn: func(ctx context.Context, id string) (*model.ShortUrl, error) {
+			if id == "notfound" {
+				return &model.ShortUrl{}, nil
+			}
+			return &model.ShortUrl{Url: "https://ehgm.com.br", Enable: true,
+				Rules: []model.Rule{
+					{Name: "mobile", When: `device in ["ios", "android"]`, Url: "https://ehgm.com.br/app"},
+					{Name: "brazil", When: `country == "BR"`, Url: "https://ehgm.com.br/br"}}}, nil
+		}}
+
+	for i, test := range tests {
+		urlService := NewUrlService(&loggerMock{}, &idGeneratorMock{}, repo, &urlCounterMock{}, &urlFilterMock{}, &urlFilterMock{}, false, &metadataFetcherMock{}, model.RedirectFound, &utmRepositoryMock{}, &geoLocatorMock{}, &clockMock{}, &pendingClicksMock{})
+
+		evaluation, err := urlService.EvaluateRules(ctx, test.input.id, test.input.visit, test.input.rules)
+		if test.output.err != nil {
+			if err == nil || reflect.TypeOf(errors.Unwrap(err)) != reflect.TypeOf(test.output.err) {
+				t.Errorf("#%s: Output is: %v. But should be: %T", i, err, test.output.err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(evaluation, test.output.evaluation) {
+			t.Errorf("#%s: Output is: %+v. But should be: %+v", i, evaluation, test.output.evaluation)
+		}
+	}
+}
+
+type eventCounterMock struct {
+	events chan *model.ClickEvent
+}
+
+func (c *eventCounterMock) IncrementCounter(event *model.ClickEvent) {
+	c.events <- event
+}
+
+func (c *eventCounterMock) Close(ctx context.Context) error {
+	return nil
+}
+
+func TestClickEvent(t *testing.T) {
+	now := time.Date(2021, 11, 26, 10, 30, 0, 0, time.FixedZone("BRT", -3*60*60))
+
+	type Input struct {
+		visit *model.Visit
+	}
+
+	type Output struct {
+		event *model.ClickEvent
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Should send the attributes of the visit": {
+			Input{visit: &model.Visit{Ip: "177.10.20.30", Referrer: "https://www.google.com/", UserAgent: "Mozilla/5.0",
+				Platform: model.PlatformIos, RequestId: "abc123"}},
+			Output{event: &model.ClickEvent{Version: model.ClickEventVersion, Id: "1q2w3e", Timestamp: now.UTC(), RequestId: "abc123",
+				Destination: "https://ehgm.com.br", Referrer: "https://www.google.com/", UserAgent: "Mozilla/5.0",
+				Ip: "177.10.20.0", Country: "BR", Platform: model.PlatformIos}}},
+
+		"Test 02 - Should anonymise IPv6": {
+			Input{visit: &model.Visit{Ip: "2001:db8:85a3:8d3:1319:8a2e:370:7348"}},
+			Output{event: &model.ClickEvent{Version: model.ClickEventVersion, Id: "1q2w3e", Timestamp: now.UTC(),
+				Destination: "https://ehgm.com.br", Ip: "2001:db8:85a3::"}}},
+
+		"Test 03 - Without a visit": {
+			Input{visit: nil},
+			Output{event: &model.ClickEvent{Version: model.ClickEventVersion, Id: "1q2w3e", Timestamp: now.UTC(),
+				Destination: "https://ehgm.com.br"}}},
+	}
+
+	ctx := context.Background()
+	geoLocator := &geoLocatorMock{countries: map[string]string{"177.10.20.30": "BR"}}
+	repo := &urlRepositoryMock{
+		findByIdFn: func(ctx context.Context, id string) (*model.ShortUrl, error) {
+			return &model.ShortUrl{Url: "https://ehgm.com.br", Enable: true}, nil
+		}}
+
+	for i, test := range tests {
+		counter := &eventCounterMock{events: make(chan *model.ClickEvent, 1)}
+		urlService := NewUrlService(&loggerMock{}, &idGeneratorMock{}, repo, counter, &urlFilterMock{}, &urlFilterMock{}, false, &metadataFetcherMock{}, model.RedirectFound, &utmRepositoryMock{}, geoLocator, &clockMock{now: now}, &pendingClicksMock{})
+
+		if _, err := urlService.GetUrlToRedirect(ctx, "1q2w3e", test.input.visit); err != nil {
+			t.Errorf("#%s: Output is: %s. But should not has error", i, err)
+			continue
+		}
+		if event := <-counter.events; !reflect.DeepEqual(event, test.output.event) {
+			t.Errorf("#%s: Output is: %+v. But should be: %+v", i, event, test.output.event)
+		}
+	}
+}
+
+func TestPendingClicks(t *testing.T) {
+	saved := map[string]model.ShortUrl{
+		"a": {Id: "a", Clicks: 10, VariantClicks: map[string]int64{"x": 4}},
+		"b": {Id: "b", Clicks: 8},
+		"c": {Id: "c", Clicks: 1},
+	}
+	repo := &urlRepositoryMock{
+		findByIdFn: func(ctx context.Context, id string) (*model.ShortUrl, error) {
+			shortUrl, ok := saved[id]
+			if !ok {
+				return &model.ShortUrl{}, &model.DocumentNotFoundError{Id: id}
+			}
+			return &shortUrl, nil
+		},
+		getStatsFn: func(ctx context.Context, limit int) ([]model.ShortUrl, error) {
+			return []model.ShortUrl{saved["a"], saved["b"]}, nil
+		}}
+
+	type Input struct {
+		pending *pendingClicksMock
+	}
+
+	type Output struct {
+		url   model.ShortUrl
+		stats []string
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Should add the pending clicks": {
+			Input{pending: &pendingClicksMock{
+				counts: []model.ClickCount{{Id: "a", Clicks: 1}, {Id: "a", Variant: "x", Clicks: 2}, {Id: "a", Variant: "y", Clicks: 1}, {Id: "c", Clicks: 9}},
+				top:    []string{"c", "a", "removed"}}},
+			Output{url: model.ShortUrl{Id: "a", Clicks: 14, VariantClicks: map[string]int64{"x": 6, "y": 1}},
+				stats: []string{"a", "c"}}},
+
+		"Test 02 - Should use the saved clicks when the pending ones fail": {
+			Input{pending: &pendingClicksMock{err: errors.New("unavailable")}},
+			Output{url: saved["a"], stats: []string{"a", "b"}}},
+	}
+
+	ctx := context.Background()
+
+	for i, test := range tests {
+		urlService := NewUrlService(&loggerMock{}, &idGeneratorMock{}, repo, &urlCounterMock{}, &urlFilterMock{}, &urlFilterMock{}, false, &metadataFetcherMock{}, model.RedirectFound, &utmRepositoryMock{}, &geoLocatorMock{}, &clockMock{}, test.input.pending)
+
+		shortUrl, err := urlService.GetUrl(ctx, "a")
+		if err != nil || !reflect.DeepEqual(*shortUrl, test.output.url) {
+			t.Errorf("#%s: Output is: %v %v. But should be: %v", i, shortUrl, err, test.output.url)
+		}
+
+		stats, err := urlService.GetStats(ctx, 2)
+		ids := []string{}
+		for _, shortUrl := range stats {
+			ids = append(ids, shortUrl.Id)
+		}
+		if err != nil || !reflect.DeepEqual(ids, test.output.stats) {
+			t.Errorf("#%s: Output is: %v %v. But should be: %v", i, ids, err, test.output.stats)
+		}
+	}
+
+	// The saved counters are not changed
+	if saved["a"].VariantClicks["x"] != 4 {
+		t.Errorf("Output is: %v. But should be: %v", saved["a"].VariantClicks["x"], 4)
+	}
+}
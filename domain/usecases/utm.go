@@ -0,0 +1,68 @@
+package usecases
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"ehgm.com.br/url-shortener/domain/model"
+	"ehgm.com.br/url-shortener/domain/ports"
+)
+
+// Struct that implements 'UtmService' interface
+type utmService struct {
+	log           ports.Logger
+	utmRepository ports.UtmRepository
+}
+
+// Get an instance of 'UtmService' using this method
+func NewUtmService(log ports.Logger, utmRepository ports.UtmRepository) ports.UtmService {
+	return &utmService{log: log, utmRepository: utmRepository}
+}
+
+func (s *utmService) SaveTemplate(ctx context.Context, template *model.UtmTemplate) error {
+	if !utmTemplateName.MatchString(template.Name) {
+		return &model.InvalidRequestError{Message: fmt.Sprintf("UTM template name %v is not valid, use up to 64 lowercase letters, numbers, - or _", template.Name)}
+	}
+	if template.Utm == (model.Utm{}) {
+		return &model.InvalidRequestError{Message: "UTM template cannot be empty"}
+	}
+	if err := validateUtm(&template.Utm); err != nil {
+		return err
+	}
+
+	template.CreateTime = time.Now().UTC()
+	if err := s.utmRepository.SaveTemplate(ctx, template); err != nil {
+		return fmt.Errorf("SaveTemplate error for name: %v. %w", template.Name, err)
+	}
+	return nil
+}
+
+func (s *utmService) GetTemplate(ctx context.Context, name string) (*model.UtmTemplate, error) {
+	template, err := s.utmRepository.FindTemplate(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("GetTemplate error for name: %v. %w", name, err)
+	}
+	return template, nil
+}
+
+func (s *utmService) GetTemplates(ctx context.Context, limit int) ([]model.UtmTemplate, error) {
+	var defaultLimit = 100
+
+	if limit > 0 {
+		defaultLimit = limit
+	}
+
+	templates, err := s.utmRepository.GetTemplates(ctx, defaultLimit)
+	if err != nil {
+		return nil, fmt.Errorf("GetTemplates error using limit: %v. %w", defaultLimit, err)
+	}
+	return templates, nil
+}
+
+func (s *utmService) DeleteTemplate(ctx context.Context, name string) error {
+	if err := s.utmRepository.DeleteTemplate(ctx, name); err != nil {
+		return fmt.Errorf("DeleteTemplate error for name: %v. %w", name, err)
+	}
+	return nil
+}
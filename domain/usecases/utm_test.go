@@ -0,0 +1,228 @@
+package usecases
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"ehgm.com.br/url-shortener/domain/model"
+)
+
+func TestSaveTemplate(t *testing.T) {
+	type Input struct {
+		template model.UtmTemplate
+	}
+
+	type Output struct {
+		saved    bool
+		hasError bool
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Should save the template": {
+			Input{template: model.UtmTemplate{Name: "newsletter_2021-11", Utm: model.Utm{Source: "newsletter", Medium: "email"}}},
+			Output{saved: true}},
+
+		"Test 02 - Should return error for an invalid name": {
+			Input{template: model.UtmTemplate{Name: "News Letter", Utm: model.Utm{Source: "newsletter"}}},
+			Output{hasError: true}},
+
+		"Test 03 - Should return error for an empty template": {
+			Input{template: model.UtmTemplate{Name: "newsletter"}},
+			Output{hasError: true}},
+
+		"Test 04 - Should return error for a long param": {
+			Input{template: model.UtmTemplate{Name: "newsletter", Utm: model.Utm{Campaign: strings.Repeat("a", 257)}}},
+			Output{hasError: true}},
+	}
+
+	ctx := context.Background()
+
+	for i, test := range tests {
+		var saved *model.UtmTemplate
+		repo := &utmRepositoryMock{
+			saveTemplateFn: func(ctx context.Context, template *model.UtmTemplate) error {
+				saved = template
+				return nil
+			}}
+
+		utmService := NewUtmService(&loggerMock{}, repo)
+		err := utmService.SaveTemplate(ctx, &test.input.template)
+
+		if test.output.hasError && err == nil {
+			t.Errorf("#%s: Output is: %s. But should has error: %v", i, err, test.output.hasError)
+			continue
+		}
+		if !test.output.hasError && err != nil {
+			t.Errorf("#%s: Output is: %s. But should not has error: %v", i, err, test.output.hasError)
+			continue
+		}
+		if (saved != nil) != test.output.saved {
+			t.Errorf("#%s: Output is: %v. But should be saved: %v", i, saved, test.output.saved)
+			continue
+		}
+		if saved != nil && saved.CreateTime.IsZero() {
+			t.Errorf("#%s: Output is: %v. But should have a create time", i, saved.CreateTime)
+		}
+	}
+}
+
+func TestUtmTemplate(t *testing.T) {
+	template := &model.UtmTemplate{Name: "newsletter", Utm: model.Utm{Source: "newsletter", Medium: "email", Campaign: "black-friday"}}
+	utmRepository := &utmRepositoryMock{
+		findTemplateFn: func(ctx context.Context, name string) (*model.UtmTemplate, error) {
+			if name == template.Name {
+				return template, nil
+			}
+			return nil, &model.DocumentNotFoundError{Id: name}
+		}}
+
+	type Input struct {
+		shortUrl model.ShortUrl
+	}
+
+	type Output struct {
+		utm      *model.Utm
+		hasError bool
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Should copy the template params": {
+			Input{shortUrl: model.ShortUrl{Url: "https://ehgm.com.br", UtmTemplate: "newsletter"}},
+			Output{utm: &model.Utm{Source: "newsletter", Medium: "email", Campaign: "black-friday"}}},
+
+		"Test 02 - Should replace the template params": {
+			Input{shortUrl: model.ShortUrl{Url: "https://ehgm.com.br", UtmTemplate: "newsletter", Utm: &model.Utm{Campaign: "cyber-monday", Content: "banner"}}},
+			Output{utm: &model.Utm{Source: "newsletter", Medium: "email", Campaign: "cyber-monday", Content: "banner"}}},
+
+		"Test 03 - Should keep the params without template": {
+			Input{shortUrl: model.ShortUrl{Url: "https://ehgm.com.br", Utm: &model.Utm{Source: "twitter"}}},
+			Output{utm: &model.Utm{Source: "twitter"}}},
+
+		"Test 04 - Should remove empty params": {
+			Input{shortUrl: model.ShortUrl{Url: "https://ehgm.com.br", Utm: &model.Utm{}}},
+			Output{utm: nil}},
+
+		"Test 05 - Should return error for an unknown template": {
+			Input{shortUrl: model.ShortUrl{Url: "https://ehgm.com.br", UtmTemplate: "unknown"}},
+			Output{hasError: true}},
+	}
+
+	ctx := context.Background()
+
+	for i, test := range tests {
+		var saved *model.ShortUrl
+		repo := &urlRepositoryMock{
+			saveFn: func(ctx context.Context, shortUrl *model.ShortUrl) error {
+				saved = shortUrl
+				return nil
+			}}
+
+		urlService := NewUrlService(&loggerMock{}, &idGeneratorMock{}, repo, &urlCounterMock{}, &urlFilterMock{}, &urlFilterMock{}, false, &metadataFetcherMock{}, model.RedirectFound, utmRepository, &geoLocatorMock{}, &clockMock{}, &pendingClicksMock{})
+		_, err := urlService.GenerateId(ctx, &test.input.shortUrl)
+
+		if test.output.hasError && err == nil {
+			t.Errorf("#%s: Output is: %s. But should has error: %v", i, err, test.output.hasError)
+			continue
+		}
+		if !test.output.hasError && err != nil {
+			t.Errorf("#%s: Output is: %s. But should not has error: %v", i, err, test.output.hasError)
+			continue
+		}
+		if test.output.hasError {
+			continue
+		}
+		if (saved.Utm == nil) != (test.output.utm == nil) || (saved.Utm != nil && *saved.Utm != *test.output.utm) {
+			t.Errorf("#%s: Output is: %+v. But should be: %+v", i, saved.Utm, test.output.utm)
+		}
+	}
+}
+
+func TestPatchUtm(t *testing.T) {
+	template := &model.UtmTemplate{Name: "newsletter", Utm: model.Utm{Source: "newsletter", Medium: "email"}}
+	utmRepository := &utmRepositoryMock{
+		findTemplateFn: func(ctx context.Context, name string) (*model.UtmTemplate, error) {
+			if name == template.Name {
+				return template, nil
+			}
+			return nil, &model.DocumentNotFoundError{Id: name}
+		}}
+
+	type Input struct {
+		json map[string]interface{}
+	}
+
+	type Output struct {
+		utm         interface{}
+		utmTemplate interface{}
+		hasError    bool
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Should merge the params": {
+			Input{json: map[string]interface{}{"utm": map[string]interface{}{"campaign": "cyber-monday", "term": nil}}},
+			Output{utm: model.Utm{Source: "twitter", Campaign: "cyber-monday"}}},
+
+		"Test 02 - Should use the template params": {
+			Input{json: map[string]interface{}{"utmTemplate": "newsletter", "utm": map[string]interface{}{"content": "banner"}}},
+			Output{utm: model.Utm{Source: "newsletter", Medium: "email", Content: "banner"}, utmTemplate: "newsletter"}},
+
+		"Test 03 - Should remove the params": {
+			Input{json: map[string]interface{}{"utm": nil}},
+			Output{utm: nil}},
+
+		"Test 04 - Should return error for an unknown param": {
+			Input{json: map[string]interface{}{"utm": map[string]interface{}{"id": "1"}}},
+			Output{hasError: true}},
+
+		"Test 05 - Should return error for an unknown template": {
+			Input{json: map[string]interface{}{"utmTemplate": "unknown"}},
+			Output{hasError: true}},
+	}
+
+	ctx := context.Background()
+
+	for i, test := range tests {
+		var updated map[string]interface{}
+		repo := &urlRepositoryMock{
+			findByIdFn: func(ctx context.Context, id string) (*model.ShortUrl, error) {
+				return &model.ShortUrl{Id: id, Url: "https://ehgm.com.br", Utm: &model.Utm{Source: "twitter", Term: "shoes"}}, nil
+			},
+			updateFn: func(ctx context.Context, id string, json map[string]interface{}) error {
+				updated = json
+				return nil
+			}}
+
+		urlService := NewUrlService(&loggerMock{}, &idGeneratorMock{}, repo, &urlCounterMock{}, &urlFilterMock{}, &urlFilterMock{}, false, &metadataFetcherMock{}, model.RedirectFound, utmRepository, &geoLocatorMock{}, &clockMock{}, &pendingClicksMock{})
+		err := urlService.UpdateUrl(ctx, "1q2w3e", test.input.json)
+
+		if test.output.hasError && err == nil {
+			t.Errorf("#%s: Output is: %s. But should has error: %v", i, err, test.output.hasError)
+			continue
+		}
+		if !test.output.hasError && err != nil {
+			t.Errorf("#%s: Output is: %s. But should not has error: %v", i, err, test.output.hasError)
+			continue
+		}
+		if test.output.hasError {
+			continue
+		}
+
+		utm, _ := updated["utm"].(*model.Utm)
+		if (utm == nil) != (test.output.utm == nil) || (utm != nil && *utm != test.output.utm) {
+			t.Errorf("#%s: Output is: %+v. But should be: %+v", i, utm, test.output.utm)
+		}
+		if test.output.utmTemplate != nil && updated["utmTemplate"] != test.output.utmTemplate {
+			t.Errorf("#%s: Output is: %v. But should be: %v", i, updated["utmTemplate"], test.output.utmTemplate)
+		}
+	}
+}
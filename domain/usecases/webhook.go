@@ -0,0 +1,384 @@
+package usecases
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"ehgm.com.br/url-shortener/domain/model"
+	"ehgm.com.br/url-shortener/domain/ports"
+)
+
+// The enabled webhooks are read again after this time, a new webhook gets the events in up to a minute
+const webhooksCacheFor = time.Minute
+
+// Webhooks read to find the ones of an event
+const maxWebhooks = 1000
+
+// Deliveries are kept for this time, a Firestore TTL policy on 'expireAt' removes them
+const deliveryRetention = 30 * 24 * time.Hour
+
+// Struct that implements 'WebhookService' interface
+type webhookService struct {
+	log               ports.Logger
+	webhookRepository ports.WebhookRepository
+	webhookSender     ports.WebhookSender
+	idGenerator       ports.IdGenerator
+	clock             ports.Clock
+
+	mu       sync.Mutex
+	webhooks []model.Webhook
+	loadTime time.Time
+}
+
+// Get an instance of 'WebhookService' using this method.
+// The events are saved as deliveries of the webhooks that accept them, the dispatcher sends them
+func NewWebhookService(log ports.Logger,
+	webhookRepository ports.WebhookRepository,
+	webhookSender ports.WebhookSender,
+	idGenerator ports.IdGenerator,
+	clock ports.Clock) ports.WebhookService {
+
+	return &webhookService{log: log, webhookRepository: webhookRepository, webhookSender: webhookSender,
+		idGenerator: idGenerator, clock: clock}
+}
+
+// The webhook is created enabled, it is returned with its secret
+func (s *webhookService) SaveWebhook(ctx context.Context, webhook *model.Webhook) error {
+	if err := validateWebhook(webhook); err != nil {
+		return err
+	}
+
+	id, err := s.idGenerator.New()
+	if err != nil {
+		return fmt.Errorf("SaveWebhook error generating Id. %w", err)
+	}
+	secret, err := newSecret()
+	if err != nil {
+		return fmt.Errorf("SaveWebhook error generating secret. %w", err)
+	}
+
+	webhook.Id = id
+	webhook.Secret = secret
+	webhook.Enable = true
+	webhook.CreateTime = s.clock.Now().UTC()
+	if err := s.webhookRepository.SaveWebhook(ctx, webhook); err != nil {
+		return fmt.Errorf("SaveWebhook error for Id: %v. %w", id, err)
+	}
+	return nil
+}
+
+func (s *webhookService) GetWebhook(ctx context.Context, id string) (*model.Webhook, error) {
+	webhook, err := s.webhookRepository.FindWebhook(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("GetWebhook error for Id: %v. %w", id, err)
+	}
+	webhook.Secret = ""
+	return webhook, nil
+}
+
+func (s *webhookService) GetWebhooks(ctx context.Context, limit int) ([]model.Webhook, error) {
+	var defaultLimit = 100
+
+	if limit > 0 {
+		defaultLimit = limit
+	}
+
+	webhooks, err := s.webhookRepository.GetWebhooks(ctx, defaultLimit)
+	if err != nil {
+		return nil, fmt.Errorf("GetWebhooks error using limit: %v. %w", defaultLimit, err)
+	}
+	for i := range webhooks {
+		webhooks[i].Secret = ""
+	}
+	return webhooks, nil
+}
+
+func (s *webhookService) UpdateWebhook(ctx context.Context, id string, update *model.WebhookUpdate) (*model.Webhook, error) {
+	webhook, err := s.webhookRepository.FindWebhook(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("UpdateWebhook error for Id: %v. %w", id, err)
+	}
+
+	if update.Url != nil {
+		webhook.Url = *update.Url
+	}
+	if update.Events != nil {
+		webhook.Events = *update.Events
+	}
+	if update.Enable != nil {
+		webhook.Enable = *update.Enable
+	}
+	if err := validateWebhook(webhook); err != nil {
+		return nil, err
+	}
+
+	if err := s.webhookRepository.UpdateWebhook(ctx, webhook); err != nil {
+		return nil, fmt.Errorf("UpdateWebhook error for Id: %v. %w", id, err)
+	}
+	webhook.Secret = ""
+	return webhook, nil
+}
+
+// The old secret stops signing the requests at once, the webhook is returned with the new one
+func (s *webhookService) RotateSecret(ctx context.Context, id string) (*model.Webhook, error) {
+	webhook, err := s.webhookRepository.FindWebhook(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("RotateSecret error for Id: %v. %w", id, err)
+	}
+
+	if webhook.Secret, err = newSecret(); err != nil {
+		return nil, fmt.Errorf("RotateSecret error generating secret. %w", err)
+	}
+	if err := s.webhookRepository.UpdateWebhook(ctx, webhook); err != nil {
+		return nil, fmt.Errorf("RotateSecret error for Id: %v. %w", id, err)
+	}
+	return webhook, nil
+}
+
+// The pending deliveries of a deleted webhook are dead-lettered by the dispatcher
+func (s *webhookService) DeleteWebhook(ctx context.Context, id string) error {
+	if err := s.webhookRepository.DeleteWebhook(ctx, id); err != nil {
+		return fmt.Errorf("DeleteWebhook error for Id: %v. %w", id, err)
+	}
+	return nil
+}
+
+// Most recent deliveries of the webhook, only the ones with 'status' when it is not empty
+func (s *webhookService) GetDeliveries(ctx context.Context, id, status string, limit int) ([]model.WebhookDelivery, error) {
+	var defaultLimit = 100
+
+	if limit > 0 {
+		defaultLimit = limit
+	}
+	if len(status) > 0 && status != model.DeliveryPending && status != model.DeliveryDelivered &&
+		status != model.DeliveryFailed && status != model.DeliveryDead {
+		return nil, &model.InvalidRequestError{Message: fmt.Sprintf("Delivery status %v is not valid, use pending, delivered, failed or dead", status)}
+	}
+
+	if _, err := s.webhookRepository.FindWebhook(ctx, id); err != nil {
+		return nil, fmt.Errorf("GetDeliveries error for Id: %v. %w", id, err)
+	}
+	deliveries, err := s.webhookRepository.GetDeliveries(ctx, id, status, defaultLimit)
+	if err != nil {
+		return nil, fmt.Errorf("GetDeliveries error for Id: %v using limit: %v. %w", id, defaultLimit, err)
+	}
+	return deliveries, nil
+}
+
+// Send a dead delivery again, it gets all the attempts of a new one
+func (s *webhookService) RetryDelivery(ctx context.Context, id, deliveryId string) (*model.WebhookDelivery, error) {
+	delivery, err := s.webhookRepository.FindDelivery(ctx, deliveryId)
+	if err != nil {
+		return nil, fmt.Errorf("RetryDelivery error for delivery: %v. %w", deliveryId, err)
+	}
+	if delivery.WebhookId != id {
+		return nil, fmt.Errorf("RetryDelivery error for Id: %v. %w", id, &model.DocumentNotFoundError{Id: deliveryId})
+	}
+	if delivery.Status != model.DeliveryDead {
+		return nil, &model.InvalidRequestError{Message: fmt.Sprintf("Delivery %v is %v, only dead deliveries can be retried", deliveryId, delivery.Status)}
+	}
+
+	delivery.Status = model.DeliveryPending
+	delivery.Attempts = 0
+	delivery.StatusCode = 0
+	delivery.Error = ""
+	delivery.NextAttempt = s.clock.Now().UTC()
+	if err := s.webhookRepository.SaveDelivery(ctx, delivery); err != nil {
+		return nil, fmt.Errorf("RetryDelivery error for delivery: %v. %w", deliveryId, err)
+	}
+	return delivery, nil
+}
+
+// Send a 'webhook.test' event at once, also to disabled webhooks. It is not retried, its log has the result
+func (s *webhookService) TestWebhook(ctx context.Context, id string) (*model.WebhookDelivery, error) {
+	webhook, err := s.webhookRepository.FindWebhook(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("TestWebhook error for Id: %v. %w", id, err)
+	}
+	eventId, err := s.idGenerator.New()
+	if err != nil {
+		return nil, fmt.Errorf("TestWebhook error generating event Id. %w", err)
+	}
+
+	now := s.clock.Now().UTC()
+	event := &model.WebhookEvent{Id: "test-" + eventId, Type: model.WebhookTest, Time: now,
+		Data: map[string]string{"webhookId": id}}
+	delivery, err := newDelivery(webhook, event, now)
+	if err != nil {
+		return nil, fmt.Errorf("TestWebhook error for Id: %v. %w", id, err)
+	}
+
+	delivery.Attempts = 1
+	delivery.StatusCode, err = s.webhookSender.Send(ctx, webhook, delivery)
+	if err != nil {
+		delivery.Status = model.DeliveryFailed
+		delivery.Error = err.Error()
+	} else {
+		delivery.Status = model.DeliveryDelivered
+		delivery.DeliverTime = &now
+	}
+
+	if err := s.webhookRepository.SaveDelivery(ctx, delivery); err != nil {
+		return nil, fmt.Errorf("TestWebhook error saving delivery: %v. %w", delivery.Id, err)
+	}
+	return delivery, nil
+}
+
+// Used by the relay, the link events are the data of the webhook events with the same id and type
+func (s *webhookService) Publish(ctx context.Context, event *model.LinkEvent) error {
+	return s.enqueue(ctx, []model.WebhookEvent{{Id: event.Id, Type: event.Type, Time: event.Time, Data: event}})
+}
+
+// Used by the consumer with the clicks of a window, each link gets one 'link.clicked' event with all its clicks
+func (s *webhookService) PublishClicks(ctx context.Context, clicks []model.Click) error {
+	return s.enqueue(ctx, clickEvents(clicks, s.clock.Now().UTC()))
+}
+
+// The event id is a hash of the link and its messages, the same window enqueued again is delivered once
+func clickEvents(clicks []model.Click, now time.Time) []model.WebhookEvent {
+	counts := map[string]*model.LinkClicks{}
+	messages := map[string]map[string]bool{}
+	ids := []string{}
+	for _, click := range clicks {
+		count, ok := counts[click.Id]
+		if !ok {
+			count = &model.LinkClicks{Id: click.Id}
+			counts[click.Id] = count
+			messages[click.Id] = map[string]bool{}
+			ids = append(ids, click.Id)
+		}
+		count.Clicks += click.Count
+		if len(click.Variant) > 0 {
+			if count.Variants == nil {
+				count.Variants = map[string]int64{}
+			}
+			count.Variants[click.Variant] += click.Count
+		}
+		messages[click.Id][click.MessageId] = true
+	}
+
+	events := make([]model.WebhookEvent, 0, len(ids))
+	for _, id := range ids {
+		messageIds := []string{}
+		for messageId := range messages[id] {
+			messageIds = append(messageIds, messageId)
+		}
+		sort.Strings(messageIds)
+
+		hash := sha256.New()
+		hash.Write([]byte(id))
+		for _, messageId := range messageIds {
+			hash.Write([]byte("\n" + messageId))
+		}
+		events = append(events, model.WebhookEvent{Id: hex.EncodeToString(hash.Sum(nil)[:16]), Type: model.LinkClicked,
+			Time: now, Data: counts[id]})
+	}
+	return events
+}
+
+// The delivery id comes from the webhook and the event, an event enqueued twice is delivered once
+func (s *webhookService) enqueue(ctx context.Context, events []model.WebhookEvent) error {
+	webhooks, err := s.enabledWebhooks(ctx)
+	if err != nil {
+		return fmt.Errorf("Enqueue events error. %w", err)
+	}
+
+	now := s.clock.Now().UTC()
+	deliveries := []model.WebhookDelivery{}
+	for i := range events {
+		for j := range webhooks {
+			if !webhooks[j].Accepts(events[i].Type) {
+				continue
+			}
+			delivery, err := newDelivery(&webhooks[j], &events[i], now)
+			if err != nil {
+				return fmt.Errorf("Enqueue event %v error. %w", events[i].Id, err)
+			}
+			deliveries = append(deliveries, *delivery)
+		}
+	}
+	if len(deliveries) <= 0 {
+		return nil
+	}
+
+	if err := s.webhookRepository.AddDeliveries(ctx, deliveries); err != nil {
+		return fmt.Errorf("AddDeliveries error for %v deliveries. %w", len(deliveries), err)
+	}
+	return nil
+}
+
+func (s *webhookService) enabledWebhooks(ctx context.Context) ([]model.Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clock.Now()
+	if !s.loadTime.IsZero() && now.Sub(s.loadTime) < webhooksCacheFor {
+		return s.webhooks, nil
+	}
+
+	webhooks, err := s.webhookRepository.GetWebhooks(ctx, maxWebhooks)
+	if err != nil {
+		return nil, fmt.Errorf("GetWebhooks error. %w", err)
+	}
+	s.webhooks = []model.Webhook{}
+	for _, webhook := range webhooks {
+		if webhook.Enable {
+			s.webhooks = append(s.webhooks, webhook)
+		}
+	}
+	s.loadTime = now
+	return s.webhooks, nil
+}
+
+// Pending delivery of the event, sent by the dispatcher from now on
+func newDelivery(webhook *model.Webhook, event *model.WebhookEvent, now time.Time) (*model.WebhookDelivery, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("Marshal webhook event error. %w", err)
+	}
+
+	return &model.WebhookDelivery{
+		Id:          webhook.Id + "-" + event.Id,
+		WebhookId:   webhook.Id,
+		EventId:     event.Id,
+		Type:        event.Type,
+		Payload:     string(payload),
+		Status:      model.DeliveryPending,
+		CreateTime:  now,
+		NextAttempt: now,
+		ExpireAt:    now.Add(deliveryRetention),
+	}, nil
+}
+
+func validateWebhook(webhook *model.Webhook) error {
+	if len(webhook.Url) > 2048 {
+		return &model.InvalidRequestError{Message: "Webhook url cannot be longer than 2048 characters"}
+	}
+	u, err := url.Parse(webhook.Url)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || len(u.Host) <= 0 {
+		return &model.InvalidRequestError{Message: fmt.Sprintf("Webhook url %v is not valid, use an http or https url", webhook.Url)}
+	}
+	for _, event := range webhook.Events {
+		if !model.WebhookEvents[event] {
+			return &model.InvalidRequestError{Message: fmt.Sprintf("Webhook event %v is not valid", event)}
+		}
+	}
+	return nil
+}
+
+// Random secret of 32 bytes, it is a key of the HMAC-SHA256 signature
+func newSecret() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(key), nil
+}
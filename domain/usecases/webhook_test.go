@@ -0,0 +1,385 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"ehgm.com.br/url-shortener/domain/model"
+)
+
+// Keeps the webhooks and deliveries in memory, like the repository 'AddDeliveries' skips the existing ids
+type webhookRepositoryMock struct {
+	webhooks   map[string]model.Webhook
+	deliveries map[string]model.WebhookDelivery
+	reads      int
+}
+
+func newWebhookRepositoryMock(webhooks ...model.Webhook) *webhookRepositoryMock {
+	r := &webhookRepositoryMock{webhooks: map[string]model.Webhook{}, deliveries: map[string]model.WebhookDelivery{}}
+	for _, webhook := range webhooks {
+		r.webhooks[webhook.Id] = webhook
+	}
+	return r
+}
+
+func (r *webhookRepositoryMock) SaveWebhook(ctx context.Context, webhook *model.Webhook) error {
+	r.webhooks[webhook.Id] = *webhook
+	return nil
+}
+
+func (r *webhookRepositoryMock) FindWebhook(ctx context.Context, id string) (*model.Webhook, error) {
+	webhook, ok := r.webhooks[id]
+	if !ok {
+		return nil, &model.DocumentNotFoundError{Id: id}
+	}
+	return &webhook, nil
+}
+
+func (r *webhookRepositoryMock) GetWebhooks(ctx context.Context, limit int) ([]model.Webhook, error) {
+	r.reads++
+	webhooks := []model.Webhook{}
+	for _, webhook := range r.webhooks {
+		webhooks = append(webhooks, webhook)
+	}
+	sort.Slice(webhooks, func(i, j int) bool { return webhooks[i].Id < webhooks[j].Id })
+	return webhooks, nil
+}
+
+func (r *webhookRepositoryMock) UpdateWebhook(ctx context.Context, webhook *model.Webhook) error {
+	r.webhooks[webhook.Id] = *webhook
+	return nil
+}
+
+func (r *webhookRepositoryMock) DeleteWebhook(ctx context.Context, id string) error {
+	delete(r.webhooks, id)
+	return nil
+}
+
+func (r *webhookRepositoryMock) AddDeliveries(ctx context.Context, deliveries []model.WebhookDelivery) error {
+	for _, delivery := range deliveries {
+		if _, ok := r.deliveries[delivery.Id]; !ok {
+			r.deliveries[delivery.Id] = delivery
+		}
+	}
+	return nil
+}
+
+func (r *webhookRepositoryMock) SaveDelivery(ctx context.Context, delivery *model.WebhookDelivery) error {
+	r.deliveries[delivery.Id] = *delivery
+	return nil
+}
+
+func (r *webhookRepositoryMock) FindDelivery(ctx context.Context, id string) (*model.WebhookDelivery, error) {
+	delivery, ok := r.deliveries[id]
+	if !ok {
+		return nil, &model.DocumentNotFoundError{Id: id}
+	}
+	return &delivery, nil
+}
+
+func (r *webhookRepositoryMock) DueDeliveries(ctx context.Context, now time.Time, limit int) ([]model.WebhookDelivery, error) {
+	deliveries := []model.WebhookDelivery{}
+	for _, delivery := range r.deliveries {
+		if delivery.Status == model.DeliveryPending && !delivery.NextAttempt.After(now) {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	return deliveries, nil
+}
+
+func (r *webhookRepositoryMock) GetDeliveries(ctx context.Context, webhookId, status string, limit int) ([]model.WebhookDelivery, error) {
+	deliveries := []model.WebhookDelivery{}
+	for _, delivery := range r.deliveries {
+		if delivery.WebhookId == webhookId && (len(status) <= 0 || delivery.Status == status) {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	return deliveries, nil
+}
+
+func (r *webhookRepositoryMock) ids() []string {
+	ids := []string{}
+	for id := range r.deliveries {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Answers with 'code', the codes >= 300 are errors like in the sender
+type webhookSenderMock struct {
+	code int
+	sent int
+}
+
+func (s *webhookSenderMock) Send(ctx context.Context, webhook *model.Webhook, delivery *model.WebhookDelivery) (int, error) {
+	s.sent++
+	if s.code >= 300 {
+		return s.code, errors.New("webhook answered with an error")
+	}
+	return s.code, nil
+}
+
+func TestSaveWebhook(t *testing.T) {
+	type Input struct {
+		webhook *model.Webhook
+	}
+
+	type Output struct {
+		hasError bool
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Should save a webhook of all events": {
+			Input{&model.Webhook{Url: "https://hooks.ehgm.com.br/links"}},
+			Output{hasError: false}},
+
+		"Test 02 - Should save a webhook with filters": {
+			Input{&model.Webhook{Url: "https://hooks.ehgm.com.br/links", Events: []string{model.LinkCreated, model.LinkClicked}}},
+			Output{hasError: false}},
+
+		"Test 03 - Should not accept an unknown event": {
+			Input{&model.Webhook{Url: "https://hooks.ehgm.com.br/links", Events: []string{"link.viewed"}}},
+			Output{hasError: true}},
+
+		"Test 04 - Should not accept other schemes": {
+			Input{&model.Webhook{Url: "ftp://hooks.ehgm.com.br/links"}},
+			Output{hasError: true}},
+	}
+
+	ctx := context.Background()
+
+	for i, test := range tests {
+		repo := newWebhookRepositoryMock()
+		service := NewWebhookService(&loggerMock{}, repo, &webhookSenderMock{code: 200},
+			&idGeneratorMock{newFn: func() (string, error) { return "w1", nil }}, &clockMock{now: time.Now()})
+
+		err := service.SaveWebhook(ctx, test.input.webhook)
+		if test.output.hasError != (err != nil) {
+			t.Errorf("#%s: Output is: %v. But should has error: %v", i, err, test.output.hasError)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		// Only the creation returns the secret
+		saved, _ := service.GetWebhook(ctx, "w1")
+		if !strings.HasPrefix(test.input.webhook.Secret, "whsec_") || !test.input.webhook.Enable || len(saved.Secret) > 0 {
+			t.Errorf("#%s: Output is: %v %v. But should be enabled with a secret", i, test.input.webhook, saved)
+		}
+	}
+}
+
+func TestPublishWebhooks(t *testing.T) {
+	webhooks := []model.Webhook{
+		{Id: "all", Url: "https://hooks.ehgm.com.br/all", Enable: true},
+		{Id: "clicks", Url: "https://hooks.ehgm.com.br/clicks", Enable: true, Events: []string{model.LinkClicked}},
+		{Id: "off", Url: "https://hooks.ehgm.com.br/off", Enable: false},
+	}
+
+	ctx := context.Background()
+	repo := newWebhookRepositoryMock(webhooks...)
+	service := NewWebhookService(&loggerMock{}, repo, &webhookSenderMock{code: 200},
+		&idGeneratorMock{}, &clockMock{now: time.Now()})
+
+	// The same event published twice is delivered once
+	event := &model.LinkEvent{Version: model.LinkEventVersion, Id: "e1", Type: model.LinkCreated, LinkId: "0aYS7JJ"}
+	service.Publish(ctx, event)
+	service.Publish(ctx, event)
+
+	// The clicks of a window are one event by link, the same window published twice is delivered once
+	clicks := []model.Click{{MessageId: "m1", Id: "0aYS7JJ", Count: 1}, {MessageId: "m2", Id: "0aYS7JJ", Variant: "a", Count: 2}}
+	service.PublishClicks(ctx, clicks)
+	service.PublishClicks(ctx, clicks)
+
+	eventId := clickEvents(clicks, time.Now())[0].Id
+	expected := []string{"all-" + eventId, "all-e1", "clicks-" + eventId}
+	sort.Strings(expected)
+	if ids := repo.ids(); !reflect.DeepEqual(ids, expected) {
+		t.Errorf("Output is: %v. But should be: %v", ids, expected)
+	}
+	if delivery := repo.deliveries["clicks-"+eventId]; delivery.Status != model.DeliveryPending ||
+		!strings.Contains(delivery.Payload, `"type":"link.clicked"`) || !strings.Contains(delivery.Payload, `"clicks":3`) ||
+		!strings.Contains(delivery.Payload, `"variants":{"a":2}`) {
+		t.Errorf("Output is: %v. But should be a pending click", delivery)
+	}
+	if repo.reads != 1 {
+		t.Errorf("Output is: %v reads. But the webhooks should be cached", repo.reads)
+	}
+}
+
+func TestTestWebhook(t *testing.T) {
+	type Input struct {
+		code int
+	}
+
+	type Output struct {
+		status string
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Should be delivered": {
+			Input{code: 204},
+			Output{status: model.DeliveryDelivered}},
+
+		"Test 02 - Should be failed and not retried": {
+			Input{code: 500},
+			Output{status: model.DeliveryFailed}},
+	}
+
+	ctx := context.Background()
+
+	for i, test := range tests {
+		repo := newWebhookRepositoryMock(model.Webhook{Id: "w1", Url: "https://hooks.ehgm.com.br/links"})
+		service := NewWebhookService(&loggerMock{}, repo, &webhookSenderMock{code: test.input.code},
+			&idGeneratorMock{newFn: func() (string, error) { return "t1", nil }}, &clockMock{now: time.Now()})
+
+		delivery, err := service.TestWebhook(ctx, "w1")
+		if err != nil {
+			t.Errorf("#%s: Output is: %s. But should not has error", i, err)
+			continue
+		}
+		if delivery.Status != test.output.status || delivery.StatusCode != test.input.code || delivery.Type != model.WebhookTest {
+			t.Errorf("#%s: Output is: %v. But should be: %v", i, delivery, test.output.status)
+		}
+		if logged := repo.deliveries[delivery.Id]; logged.Status != test.output.status {
+			t.Errorf("#%s: Output is: %v. But the delivery should be logged", i, logged)
+		}
+	}
+}
+
+func TestRetryDelivery(t *testing.T) {
+	type Input struct {
+		webhookId string
+		status    string
+	}
+
+	type Output struct {
+		hasError bool
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Should retry a dead delivery": {
+			Input{webhookId: "w1", status: model.DeliveryDead},
+			Output{hasError: false}},
+
+		"Test 02 - Should not retry a delivered one": {
+			Input{webhookId: "w1", status: model.DeliveryDelivered},
+			Output{hasError: true}},
+
+		"Test 03 - Should not retry the delivery of other webhook": {
+			Input{webhookId: "w2", status: model.DeliveryDead},
+			Output{hasError: true}},
+	}
+
+	ctx := context.Background()
+
+	for i, test := range tests {
+		repo := newWebhookRepositoryMock()
+		repo.deliveries["w1-e1"] = model.WebhookDelivery{Id: "w1-e1", WebhookId: "w1", Status: test.input.status, Attempts: 8}
+		service := NewWebhookService(&loggerMock{}, repo, &webhookSenderMock{}, &idGeneratorMock{}, &clockMock{now: time.Now()})
+
+		delivery, err := service.RetryDelivery(ctx, test.input.webhookId, "w1-e1")
+		if test.output.hasError != (err != nil) {
+			t.Errorf("#%s: Output is: %v. But should has error: %v", i, err, test.output.hasError)
+			continue
+		}
+		if err == nil && (delivery.Status != model.DeliveryPending || delivery.Attempts != 0) {
+			t.Errorf("#%s: Output is: %v. But should be pending again", i, delivery)
+		}
+	}
+}
+
+func TestWebhookDispatcher(t *testing.T) {
+	now := time.Date(2021, 11, 26, 10, 30, 0, 0, time.UTC)
+
+	type Input struct {
+		webhook  *model.Webhook
+		code     int
+		attempts int
+	}
+
+	type Output struct {
+		status      string
+		attempts    int
+		nextAttempt time.Time
+	}
+
+	tests := map[string]struct {
+		input  Input
+		output Output
+	}{
+		"Test 01 - Should be delivered": {
+			Input{webhook: &model.Webhook{Id: "w1", Enable: true}, code: 200},
+			Output{status: model.DeliveryDelivered, attempts: 1, nextAttempt: now}},
+
+		"Test 02 - Should be retried after a minute": {
+			Input{webhook: &model.Webhook{Id: "w1", Enable: true}, code: 503},
+			Output{status: model.DeliveryPending, attempts: 1, nextAttempt: now.Add(time.Minute)}},
+
+		"Test 03 - Should double the wait": {
+			Input{webhook: &model.Webhook{Id: "w1", Enable: true}, code: 503, attempts: 2},
+			Output{status: model.DeliveryPending, attempts: 3, nextAttempt: now.Add(4 * time.Minute)}},
+
+		"Test 04 - Should be dead after the last attempt": {
+			Input{webhook: &model.Webhook{Id: "w1", Enable: true}, code: 503, attempts: 4},
+			Output{status: model.DeliveryDead, attempts: 5, nextAttempt: now}},
+
+		"Test 05 - Should be dead when the webhook is disabled": {
+			Input{webhook: &model.Webhook{Id: "w1", Enable: false}, code: 200},
+			Output{status: model.DeliveryDead, attempts: 0, nextAttempt: now}},
+
+		"Test 06 - Should be dead when the webhook is deleted": {
+			Input{webhook: nil, code: 200},
+			Output{status: model.DeliveryDead, attempts: 0, nextAttempt: now}},
+	}
+
+	ctx := context.Background()
+
+	for i, test := range tests {
+		repo := newWebhookRepositoryMock()
+		if test.input.webhook != nil {
+			repo.webhooks["w1"] = *test.input.webhook
+		}
+		repo.deliveries["w1-e1"] = model.WebhookDelivery{Id: "w1-e1", WebhookId: "w1", Status: model.DeliveryPending,
+			Attempts: test.input.attempts, NextAttempt: now}
+		dispatcher := &webhookDispatcher{log: &loggerMock{}, webhookRepository: repo,
+			webhookSender: &webhookSenderMock{code: test.input.code}, clock: &clockMock{now: now},
+			interval: time.Hour, batchSize: 10, maxAttempts: 5}
+
+		if _, err := dispatcher.dispatch(ctx); err != nil {
+			t.Errorf("#%s: Output is: %s. But should not has error", i, err)
+			continue
+		}
+		delivery := repo.deliveries["w1-e1"]
+		if delivery.Status != test.output.status || delivery.Attempts != test.output.attempts ||
+			!delivery.NextAttempt.Equal(test.output.nextAttempt) {
+			t.Errorf("#%s: Output is: %v %v %v. But should be: %v %v %v", i, delivery.Status, delivery.Attempts,
+				delivery.NextAttempt, test.output.status, test.output.attempts, test.output.nextAttempt)
+		}
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	expected := map[int]time.Duration{1: time.Minute, 2: 2 * time.Minute, 5: 16 * time.Minute, 20: 6 * time.Hour}
+	for attempts, delay := range expected {
+		if output := retryDelay(attempts); output != delay {
+			t.Errorf("Output is: %v. But should be: %v after %v attempts", output, delay, attempts)
+		}
+	}
+}
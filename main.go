@@ -2,20 +2,48 @@ package main
 
 import (
 	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"ehgm.com.br/url-shortener/adapters/api"
+	"ehgm.com.br/url-shortener/adapters/blocklist"
+	"ehgm.com.br/url-shortener/adapters/clock"
+	"ehgm.com.br/url-shortener/adapters/counter"
+	"ehgm.com.br/url-shortener/adapters/geoip"
+	"ehgm.com.br/url-shortener/adapters/healthcheck"
 	"ehgm.com.br/url-shortener/adapters/idgenerator"
+	"ehgm.com.br/url-shortener/adapters/kafka"
+	"ehgm.com.br/url-shortener/adapters/lookalike"
+	"ehgm.com.br/url-shortener/adapters/metadata"
+	"ehgm.com.br/url-shortener/adapters/nats"
 	"ehgm.com.br/url-shortener/adapters/pubsub"
+	"ehgm.com.br/url-shortener/adapters/qrcode"
+	"ehgm.com.br/url-shortener/adapters/ratelimit"
 	"ehgm.com.br/url-shortener/adapters/repository"
+	"ehgm.com.br/url-shortener/adapters/spool"
+	"ehgm.com.br/url-shortener/adapters/webhook"
 	"ehgm.com.br/url-shortener/config"
 	"ehgm.com.br/url-shortener/domain/ports"
 	"ehgm.com.br/url-shortener/domain/usecases"
 
+	"cloud.google.com/go/firestore"
+	gpubsub "cloud.google.com/go/pubsub"
+
 	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
 )
 
 var log ports.Logger
 
+// Time to end the requests and save the counted clicks, Cloud Run kills the container 10 seconds after SIGTERM
+const shutdownTimeout = 9 * time.Second
+
+// Webhook ids are longer than the link ids, they are not typed by people
+const webhookIdLength = 16
+
 func init() {
 	log = config.NewLogger()
 	log.Info("URL Shortener current version: 1.0.0")
@@ -30,16 +58,80 @@ func main() {
 	ps := config.NewPubSubClient(ctx, log, env.ProjectId)
 	fdb := config.NewFirestoreClient(ctx, log, env.ProjectId)
 
+	// Stopped by Cloud Run with SIGTERM, the server ends the requests and the counter saves its clicks
+	stopCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if env.RunMode == config.RunModeConsumer {
+		runConsumer(stopCtx, env, ps, fdb, rdb)
+		return
+	}
+	if env.RunMode == config.RunModeRelay {
+		runRelay(stopCtx, env, ps, fdb, rdb)
+		return
+	}
+
 	idGenerator := idgenerator.NewIdGenerator(env.IdLength)
-	urlCounter := pubsub.NewUrlCounter(log, ps, env.PubsubTopic)
+	clickSpool := newClickSpool(env)
+	urlCounter := newUrlCounter(env, ps, fdb, rdb, clickSpool)
 	urlRepository := repository.NewUrlRepository(log, fdb, rdb, env.RedisTTL)
-	urlService := usecases.NewUrlService(log, idGenerator, urlRepository, urlCounter)
-	controller := api.NewUrlController(log, urlService)
+	urlFilter := blocklist.NewUrlFilter(stopCtx, log, env.BlocklistFiles, env.AllowlistFiles, env.ListsReload)
+	lookalikeFilter := lookalike.NewLookalikeFilter(log, env.ProtectedBrands, env.LookalikeDistance)
+
+	utmRepository := repository.NewUtmRepository(log, fdb)
+	geoLocator := geoip.NewGeoLocator(log, env.GeoIpFile, env.GeoIpReload)
+	metadataFetcher := metadata.NewMetadataFetcher(log, time.Duration(env.MetadataTimeout)*time.Second,
+		env.MetadataMaxBytes, env.MetadataMaxRedirects, false)
+
+	// Only the Redis counter has clicks that are not saved yet, they are added to the saved ones
+	var pendingClicks ports.PendingClicks
+	flushed := make(chan struct{})
+	if env.ClickCounter == config.CounterRedis {
+		pendingClicks = counter.NewPendingClicks(log, rdb)
+		clickFlusher := usecases.NewClickFlusher(log, pendingClicks, repository.NewClickRepository(log, fdb),
+			time.Duration(env.CounterInterval)*time.Second)
+		go func() {
+			defer close(flushed)
+			if err := clickFlusher.Run(stopCtx); err != nil {
+				log.Error("Click flusher error. Cause: %s", err)
+			}
+		}()
+	} else {
+		close(flushed)
+	}
+
+	urlService := usecases.NewUrlService(log, idGenerator, urlRepository, urlCounter, urlFilter,
+		lookalikeFilter, env.ModerateLookalikes, metadataFetcher, env.RedirectType, utmRepository, geoLocator, clock.NewClock(),
+		pendingClicks)
+	moderationRepository := repository.NewModerationRepository(log, fdb, rdb, env.RedisTTL)
+	reportLimiter := ratelimit.NewRateLimiter(log, rdb, env.ReportRateLimit, time.Hour)
+	moderationService := usecases.NewModerationService(log, urlRepository, moderationRepository, reportLimiter,
+		env.ReportThreshold, env.BulkBatchSize)
+	healthClient := config.NewHttpClient(time.Duration(env.HealthTimeout)*time.Second, env.HealthMaxRedirects, false)
+	healthProber := healthcheck.NewHealthProber(log, healthClient, time.Duration(env.HealthHostDelay)*time.Millisecond)
+	healthRepository := repository.NewHealthRepository(log, fdb, rdb, env.RedisTTL)
+	healthService := usecases.NewHealthService(log, healthRepository, healthProber, env.HealthConcurrency, env.HealthFailures,
+		clickSpool)
+	utmService := usecases.NewUtmService(log, utmRepository)
+	qrCodeService := usecases.NewQrCodeService(log, urlRepository, qrcode.NewQrEncoder(log))
+	controller := api.NewUrlController(log, urlService, env.RedirectMaxAge, env.TrustedProxies)
+	moderationController := api.NewModerationController(log, urlService, moderationService, env.TrustedProxies)
+	healthController := api.NewHealthController(log, healthService)
+	qrController := api.NewQrController(log, qrCodeService)
+	utmController := api.NewUtmController(log, utmService)
+	webhookController := api.NewWebhookController(log, newWebhookService(env, fdb))
+
+	if env.HealthInterval > 0 {
+		go healthService.Run(stopCtx, time.Duration(env.HealthInterval)*time.Minute)
+	}
 
 	log.Info("Starting Gin server ...")
 
 	router := gin.Default()
 	router.Use(api.ErrorHandlerMiddleware(log))
+	router.LoadHTMLGlob("templates/*")
+
+	router.GET("/health", healthController.GetStatus)
 
 	docGroup := router.Group("/doc")
 	docGroup.Static("/", "./doc")
@@ -49,14 +141,174 @@ func main() {
 
 	redirectGroup := router.Group("/r")
 	redirectGroup.GET("/:id", controller.RedirectToUrl)
+	redirectGroup.GET("/:id/*rest", controller.RedirectToUrl)
+	redirectGroup.POST("/:id/report", moderationController.PostReport)
 
 	urlsGroup := router.Group("/urls")
 	urlsGroup.POST("/", controller.PostUrl)
+	urlsGroup.GET("/broken", healthController.GetBroken)
 	urlsGroup.GET("/:id", controller.GetUrl)
 	urlsGroup.PATCH("/:id", controller.PatchUrl)
+	urlsGroup.POST("/:id/rules/evaluate", controller.EvaluateRules)
+	urlsGroup.GET("/:id/qr", qrController.GetQrCode)
+
+	utmGroup := router.Group("/utm-templates")
+	utmGroup.POST("/", utmController.PostTemplate)
+	utmGroup.GET("/", utmController.GetTemplates)
+	utmGroup.GET("/:name", utmController.GetTemplate)
+	utmGroup.DELETE("/:name", utmController.DeleteTemplate)
 
 	statsGroup := router.Group("/stats")
 	statsGroup.GET("/", controller.GetStats)
 
-	router.Run()
+	adminGroup := router.Group("/admin")
+	adminGroup.Use(api.AdminAuthMiddleware(log, env.AdminToken))
+	adminGroup.GET("/moderation/", moderationController.GetQueue)
+	adminGroup.GET("/moderation/:id", moderationController.GetReports)
+	adminGroup.POST("/moderation/:id/dismiss", moderationController.DismissReports)
+	adminGroup.POST("/moderation/:id/disable", moderationController.DisableUrl)
+	adminGroup.POST("/domains/disable", moderationController.DisableDomain)
+	adminGroup.POST("/domains/enable", moderationController.EnableDomain)
+	adminGroup.POST("/webhooks/", webhookController.PostWebhook)
+	adminGroup.GET("/webhooks/", webhookController.GetWebhooks)
+	adminGroup.GET("/webhooks/:id", webhookController.GetWebhook)
+	adminGroup.PATCH("/webhooks/:id", webhookController.PatchWebhook)
+	adminGroup.DELETE("/webhooks/:id", webhookController.DeleteWebhook)
+	adminGroup.POST("/webhooks/:id/secret", webhookController.RotateSecret)
+	adminGroup.POST("/webhooks/:id/test", webhookController.TestWebhook)
+	adminGroup.GET("/webhooks/:id/deliveries", webhookController.GetDeliveries)
+	adminGroup.POST("/webhooks/:id/deliveries/:deliveryId/retry", webhookController.RetryDelivery)
+
+	server := &http.Server{Addr: serverAddress(), Handler: router}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal("Failed to start Gin server. Cause: %s", err)
+		}
+	}()
+
+	<-stopCtx.Done()
+	log.Info("Stopping Gin server ...")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Error("Failed to stop Gin server. Cause: %s", err)
+	}
+	if err := urlCounter.Close(shutdownCtx); err != nil {
+		log.Error("Failed to close the click counter. Cause: %s", err)
+	}
+	select {
+	case <-flushed:
+	case <-shutdownCtx.Done():
+		log.Error("The pending clicks were not saved before stopping, they are saved by the next flush")
+	}
+}
+
+// Clicks are published one by one to Pub/Sub, NATS or Kafka, counted in memory and saved in batches, or counted in Redis
+func newUrlCounter(env config.EnvConfig,
+	ps *gpubsub.Client,
+	fdb *firestore.Client,
+	rdb *redis.Client,
+	clickSpool ports.ClickSpool) ports.UrlCounter {
+
+	interval := time.Duration(env.CounterInterval) * time.Second
+	switch env.ClickCounter {
+	case config.CounterPubSubBatch:
+		sink := pubsub.NewClickSink(log, ps, env.PubsubTopic)
+		return counter.NewBatchCounter(log, sink, env.CounterQueueSize, env.CounterBatchSize, interval)
+	case config.CounterFirestore:
+		sink := repository.NewClickRepository(log, fdb)
+		return counter.NewBatchCounter(log, sink, env.CounterQueueSize, env.CounterBatchSize, interval)
+	case config.CounterRedis:
+		return counter.NewRedisCounter(log, rdb)
+	case config.CounterNats:
+		js := config.NewJetStream(log, env.NatsUrl, env.NatsStream, env.NatsSubject)
+		return nats.NewUrlCounter(log, js, env.NatsSubject, clickSpool)
+	case config.CounterKafka:
+		writer := config.NewKafkaWriter(env.KafkaBrokers, env.KafkaTopic)
+		return kafka.NewUrlCounter(log, writer, clickSpool)
+	default:
+		return pubsub.NewUrlCounter(log, ps, env.PubsubTopic, clickSpool, env.ClickFormat == config.ClickFormatJson)
+	}
+}
+
+// Only the clicks published one by one are spooled, nil when there is no spool directory
+func newClickSpool(env config.EnvConfig) ports.ClickSpool {
+	published := env.ClickCounter == config.CounterPubSub || env.ClickCounter == config.CounterNats ||
+		env.ClickCounter == config.CounterKafka
+	if len(env.SpoolDir) <= 0 || !published {
+		return nil
+	}
+
+	clickSpool, err := spool.NewClickSpool(log, env.SpoolDir, int64(env.SpoolMaxSize)<<20)
+	if err != nil {
+		log.Fatal("Failed to open the click spool in %v. Cause: %s", env.SpoolDir, err)
+	}
+	return clickSpool
+}
+
+// Same address used by gin, the PORT environment variable or 8080
+func serverAddress() string {
+	if port := os.Getenv("PORT"); len(port) > 0 {
+		return ":" + port
+	}
+	return ":8080"
+}
+
+// Webhooks of the API, the relay and the consumer. The requests cannot reach private addresses or follow redirects
+func newWebhookService(env config.EnvConfig, fdb *firestore.Client) ports.WebhookService {
+	webhookClient := config.NewHttpClient(time.Duration(env.WebhookTimeout)*time.Second, 0, false)
+	return usecases.NewWebhookService(log, repository.NewWebhookRepository(log, fdb),
+		webhook.NewWebhookSender(log, webhookClient), idgenerator.NewIdGenerator(webhookIdLength), clock.NewClock())
+}
+
+// Save the clicks published by the servers until the process is stopped, the last window is saved before exiting.
+// The saved clicks are also sent to the webhooks of 'link.clicked'
+func runConsumer(ctx context.Context, env config.EnvConfig, ps *gpubsub.Client, fdb *firestore.Client, rdb *redis.Client) {
+	clickSubscriber := pubsub.NewClickSubscriber(log, ps, env.PubsubSubscription, 2*env.ConsumerBatchSize)
+	clickRepository := repository.NewClickRepository(log, fdb)
+	clickConsumer := usecases.NewClickConsumer(log, clickSubscriber, clickRepository,
+		time.Duration(env.ConsumerWindow)*time.Second, env.ConsumerBatchSize, newWebhookService(env, fdb))
+
+	log.Info("Starting click consumer ...")
+	if err := clickConsumer.Run(ctx); err != nil {
+		log.Fatal("Click consumer error. Cause: %s", err)
+	}
+	log.Info("Click consumer stopped")
+}
+
+// Publish the link events saved with the changes of the links and send the webhook deliveries,
+// until the process is stopped. The events go to the topic, when there is one, and to the webhooks
+func runRelay(ctx context.Context, env config.EnvConfig, ps *gpubsub.Client, fdb *firestore.Client, rdb *redis.Client) {
+	interval := time.Duration(env.RelayInterval) * time.Second
+	webhookService := newWebhookService(env, fdb)
+	eventPublishers := []ports.EventPublisher{}
+	if len(env.EventsTopic) > 0 {
+		eventPublishers = append(eventPublishers, pubsub.NewEventPublisher(log, ps, env.EventsTopic))
+	}
+	eventPublishers = append(eventPublishers, webhookService)
+
+	outboxRepository := repository.NewOutboxRepository(log, fdb, rdb, env.RedisTTL)
+	eventRelay := usecases.NewEventRelay(log, outboxRepository, eventPublishers, interval, env.RelayBatchSize,
+		env.RelayMaxAttempts)
+
+	webhookClient := config.NewHttpClient(time.Duration(env.WebhookTimeout)*time.Second, 0, false)
+	webhookDispatcher := usecases.NewWebhookDispatcher(log, repository.NewWebhookRepository(log, fdb),
+		webhook.NewWebhookSender(log, webhookClient), clock.NewClock(), interval, env.RelayBatchSize, env.WebhookMaxAttempts)
+
+	log.Info("Starting webhook dispatcher ...")
+	dispatched := make(chan struct{})
+	go func() {
+		defer close(dispatched)
+		if err := webhookDispatcher.Run(ctx); err != nil {
+			log.Error("Webhook dispatcher error. Cause: %s", err)
+		}
+	}()
+
+	log.Info("Starting event relay ...")
+	if err := eventRelay.Run(ctx); err != nil {
+		log.Fatal("Event relay error. Cause: %s", err)
+	}
+	<-dispatched
+	log.Info("Event relay stopped")
 }